@@ -2,41 +2,127 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/dinowar/gateway-service/internal/pkg/config"
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
 	"github.com/dinowar/gateway-service/internal/pkg/gateway"
+	"github.com/dinowar/gateway-service/internal/pkg/migrations"
 	"github.com/dinowar/gateway-service/internal/pkg/server"
 	"github.com/dinowar/gateway-service/internal/pkg/service"
 	"github.com/dinowar/gateway-service/internal/pkg/util"
+	"github.com/dinowar/gateway-service/internal/pkg/validation"
 	"github.com/sethvargo/go-envconfig"
 	"go.uber.org/zap"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 )
 
 func main() {
 	logger, _ := zap.NewProduction()
 	defer logger.Sync()
 
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	serviceConfig := &config.ServiceConfig{}
 	if configErr := envconfig.Process(ctx, serviceConfig); configErr != nil {
-		log.Fatal(ctx, "failed to init config", configErr)
-	}
-	db, dbErr := util.InitDB(
-		serviceConfig.DBConfig.Host,
-		serviceConfig.DBConfig.Port,
-		serviceConfig.DBConfig.Database,
-		serviceConfig.DBConfig.Username,
-		serviceConfig.DBConfig.Password,
-	)
+		logger.Fatal("failed to init config", zap.Error(configErr))
+	}
+	migrateCommand := len(os.Args) > 1 && os.Args[1] == "migrate"
+	merchantCommand := len(os.Args) > 1 && os.Args[1] == "merchant"
+	validate := serviceConfig.Validate
+	if migrateCommand || merchantCommand {
+		validate = serviceConfig.ValidateDatabase
+	}
+	if validationErr := validate(); validationErr != nil {
+		logger.Fatal(validationErr.Error())
+	}
+
+	db, dbErr := util.InitDB(ctx, serviceConfig.DBConfig)
 	if dbErr != nil {
-		log.Println("failed to initialize database", dbErr)
+		logger.Fatal("failed to initialize database", zap.Error(dbErr))
+	}
+
+	migrator, migratorErr := migrations.NewMigrator(db)
+	if migratorErr != nil {
+		logger.Fatal("failed to load migrations", zap.Error(migratorErr))
+	}
+	if migrateCommand {
+		exitCode := runMigrate(ctx, logger, migrator, os.Args[2:])
+		db.Close()
+		logger.Sync()
+		os.Exit(exitCode)
+	}
+	if serviceConfig.DBConfig.MigrateOnStart {
+		applied, upErr := migrator.Up(ctx)
+		if upErr != nil {
+			logger.Fatal("failed to apply migrations", zap.Error(upErr))
+		}
+		for _, migration := range applied {
+			logger.Info("applied migration", zap.Int64("version", migration.Version), zap.String("name", migration.Name))
+		}
 	}
 
 	repService := service.NewRepositoryService(db)
+	authService := service.NewAuthService(repService)
 	logService := service.NewLogService(logger)
-	appServer := server.NewAppServer(repService, logService, serviceConfig)
+	webhookService := service.NewWebhookService(repService, repService, logService,
+		&http.Client{Timeout: time.Duration(serviceConfig.WebhookConfig.Timeout) * time.Second}, serviceConfig.WebhookConfig)
+	gatewayExists := func(gatewayId string) bool {
+		return gatewayId == serviceConfig.RestGatewayConfig.GatewayId || gatewayId == serviceConfig.SoapGatewayConfig.GatewayId
+	}
+	if merchantCommand {
+		exitCode := runMerchant(logger, authService, webhookService, repService, gatewayExists, os.Args[2:])
+		db.Close()
+		logger.Sync()
+		os.Exit(exitCode)
+	}
+	healthService := service.NewHealthService(db, logService, serviceConfig.HealthConfig.ProbeInterval, serviceConfig.HealthConfig.ProbeTimeout)
+	broker := service.NewTransactionBroker()
+	listener := service.NewTransactionListener(util.ConnectionString(serviceConfig.DBConfig), repService, broker, logService)
+	riskRules := service.DefaultRiskRules(repService, serviceConfig.RiskConfig)
+	var sanctionsScreener *service.SanctionsScreener
+	if serviceConfig.SanctionsConfig.ListPath != "" {
+		// withdrawals must not go out unscreened, so a list that cannot be loaded stops the start
+		sanctionsScreener = service.NewSanctionsScreener(serviceConfig.SanctionsConfig, logService)
+		if loadErr := sanctionsScreener.Load(); loadErr != nil {
+			logger.Fatal("failed to load sanctions list", zap.Error(loadErr))
+		}
+		riskRules = append(riskRules, service.NewSanctionsRule(sanctionsScreener, model.RiskDecision(serviceConfig.SanctionsConfig.Action)))
+	}
+	feeSchedule, parseErr := service.ParseFeeSchedule(serviceConfig.FeeSchedule)
+	if parseErr == nil {
+		parseErr = validation.ValidateFeeSchedule(feeSchedule, gatewayExists)
+	}
+	if parseErr != nil {
+		var domainErr *model.Error
+		if errors.As(parseErr, &domainErr) {
+			for _, field := range domainErr.Fields {
+				logger.Error("invalid fee rule", zap.String("field", field.Field), zap.String("problem", field.Message))
+			}
+		}
+		logger.Fatal("invalid GATEWAY_SERVICE_FEE_SCHEDULE", zap.Error(parseErr))
+	}
+	var fxService *service.FxService
+	if serviceConfig.FxConfig.RatesPath != "" {
+		rates := service.NewFileRateProvider(serviceConfig.FxConfig.RatesPath)
+		if loadErr := rates.Load(); loadErr != nil {
+			logger.Fatal("failed to load fx rates", zap.Error(loadErr))
+		}
+		fxService = service.NewFxService(rates, repService, time.Duration(serviceConfig.FxConfig.QuoteTTL)*time.Second)
+	}
+	authorizationService := service.NewAuthorizationService(repService, logService, serviceConfig.AuthorizationConfig)
+	appServer := server.NewAppServer(repService, logService, serviceConfig, server.WithHealthService(healthService), server.WithAuthService(authService),
+		server.WithWebhookService(webhookService), server.WithTransactionBroker(broker), server.WithLedgerService(service.NewLedgerService(repService)),
+		server.WithRiskService(service.NewRiskService(riskRules...)),
+		server.WithReviewService(service.NewReviewService(repService)), server.WithFeeService(service.NewFeeService(feeSchedule)),
+		server.WithFxService(fxService), server.WithAuthorizationService(authorizationService))
 
 	// registering gateways
 	appServer.RegisterGateway(serviceConfig.RestGatewayConfig.GatewayId,
@@ -55,12 +141,47 @@ func main() {
 			RetryElapseTime: serviceConfig.RetryElapseTime,
 		})
 
-	http.HandleFunc("/deposit", appServer.HandleDeposit)
-	http.HandleFunc("/withdraw", appServer.HandleWithdraw)
-	http.HandleFunc("/callback", appServer.HandleCallback)
-	http.HandleFunc("/transaction", appServer.HandleGetTransaction)
-	http.HandleFunc("/transactions", appServer.HandleGetTransactions)
+	// background workers stop on the shutdown signal and are awaited before the db is closed
+	var workers sync.WaitGroup
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		healthService.Run(ctx)
+	}()
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		webhookService.Run(ctx)
+	}()
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		listener.Run(ctx)
+	}()
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		authorizationService.Run(ctx, appServer.ExpireAuthorization)
+	}()
+	if sanctionsScreener != nil {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			sanctionsScreener.Run(ctx)
+		}()
+	}
 
+	httpServer := util.NewHTTPServer(serviceConfig.ServicePort, server.RequestId(appServer.Routes()), serviceConfig.HTTPConfig)
+	// open event streams would otherwise hold up draining until the shutdown timeout
+	httpServer.RegisterOnShutdown(broker.Close)
 	log.Println(fmt.Sprintf("service started on port: %s", serviceConfig.ServicePort))
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", serviceConfig.ServicePort), nil))
+	serveErr := util.ServeAndDrain(ctx, httpServer, &workers, serviceConfig.HTTPConfig.ShutdownTimeout)
+	if serveErr != nil {
+		logger.Error("service stopped with error", zap.Error(serveErr))
+	}
+
+	if closeErr := db.Close(); closeErr != nil {
+		logger.Error("failed to close database", zap.Error(closeErr))
+	}
+	log.Println("service stopped")
 }
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/service"
+	"github.com/dinowar/gateway-service/internal/pkg/validation"
+	"go.uber.org/zap"
+	"io"
+	"os"
+)
+
+const merchantUsage = "usage: gateway-service merchant create <name> | issue-key <merchant_id> | revoke-key <key_id> | " +
+	"assign-account <merchant_id> <account_id> | settings <merchant_id> | configure <merchant_id> <settings.json|-> | " +
+	"rotate-webhook-secret <merchant_id>"
+
+// runMerchant implements the `merchant` subcommand and returns the process exit code.
+// Plaintext API keys and webhook secrets are printed once and cannot be recovered later.
+func runMerchant(logger *zap.Logger, auth *service.AuthService, webhooks *service.WebhookService, rep service.MerchantRepository, gatewayExists func(gatewayId string) bool, args []string) int {
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, merchantUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "create":
+		merchant, createErr := auth.CreateMerchant(args[1])
+		if createErr != nil {
+			logger.Error("merchant create failed", zap.Error(createErr))
+			return 1
+		}
+		plaintext, key, issueErr := auth.IssueAPIKey(merchant.Id)
+		if issueErr != nil {
+			logger.Error("merchant issue-key failed", zap.Error(issueErr))
+			return 1
+		}
+		fmt.Printf("merchant_id: %s\nkey_id: %s\napi_key: %s\n", merchant.Id, key.Id, plaintext)
+	case "issue-key":
+		plaintext, key, issueErr := auth.IssueAPIKey(args[1])
+		if issueErr != nil {
+			logger.Error("merchant issue-key failed", zap.Error(issueErr))
+			return 1
+		}
+		fmt.Printf("key_id: %s\napi_key: %s\n", key.Id, plaintext)
+	case "revoke-key":
+		if revokeErr := auth.RevokeAPIKey(args[1]); revokeErr != nil {
+			logger.Error("merchant revoke-key failed", zap.Error(revokeErr))
+			return 1
+		}
+		fmt.Printf("revoked %s\n", args[1])
+	case "assign-account":
+		if len(args) < 3 {
+			fmt.Fprintln(os.Stderr, merchantUsage)
+			return 2
+		}
+		if claimErr := auth.ClaimAccount(model.Merchant{Id: args[1]}, args[2]); claimErr != nil {
+			logger.Error("merchant assign-account failed", zap.Error(claimErr))
+			return 1
+		}
+		fmt.Printf("account %s belongs to %s\n", args[2], args[1])
+	case "settings":
+		merchant, getErr := rep.GetMerchant(args[1])
+		if getErr != nil {
+			logger.Error("merchant settings failed", zap.Error(getErr))
+			return 1
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(merchant.Settings)
+	case "configure":
+		if len(args) < 3 {
+			fmt.Fprintln(os.Stderr, merchantUsage)
+			return 2
+		}
+		settings, readErr := readMerchantSettings(args[2])
+		if readErr != nil {
+			logger.Error("merchant configure failed", zap.Error(readErr))
+			return 1
+		}
+		if validationErr := validation.ValidateMerchantSettings(settings, gatewayExists); validationErr != nil {
+			var domainErr *model.Error
+			if errors.As(validationErr, &domainErr) {
+				for _, field := range domainErr.Fields {
+					fmt.Fprintf(os.Stderr, "%s: %s\n", field.Field, field.Message)
+				}
+			}
+			return 1
+		}
+		if configureErr := auth.ConfigureMerchant(args[1], settings); configureErr != nil {
+			logger.Error("merchant configure failed", zap.Error(configureErr))
+			return 1
+		}
+		fmt.Printf("configured %s\n", args[1])
+		// webhooks cannot be signed, and are not sent, until the merchant has a secret
+		merchant, getErr := rep.GetMerchant(args[1])
+		if getErr != nil {
+			logger.Error("merchant configure failed", zap.Error(getErr))
+			return 1
+		}
+		if merchant.Settings.WebhookURL != "" && merchant.WebhookSecret == "" {
+			return rotateWebhookSecret(logger, webhooks, args[1])
+		}
+	case "rotate-webhook-secret":
+		return rotateWebhookSecret(logger, webhooks, args[1])
+	default:
+		fmt.Fprintln(os.Stderr, merchantUsage)
+		return 2
+	}
+	return 0
+}
+
+func rotateWebhookSecret(logger *zap.Logger, webhooks *service.WebhookService, merchantId string) int {
+	secret, rotateErr := webhooks.RotateWebhookSecret(merchantId)
+	if rotateErr != nil {
+		logger.Error("merchant rotate-webhook-secret failed", zap.Error(rotateErr))
+		return 1
+	}
+	fmt.Printf("webhook_secret: %s\n", secret)
+	return 0
+}
+
+// readMerchantSettings reads the JSON settings document from path, or from stdin for "-".
+func readMerchantSettings(path string) (model.MerchantSettings, error) {
+	var settings model.MerchantSettings
+	var input io.Reader = os.Stdin
+	if path != "-" {
+		file, openErr := os.Open(path)
+		if openErr != nil {
+			return settings, openErr
+		}
+		defer file.Close()
+		input = file
+	}
+
+	decoder := json.NewDecoder(input)
+	decoder.DisallowUnknownFields()
+	if decodeErr := decoder.Decode(&settings); decodeErr != nil {
+		return settings, fmt.Errorf("invalid settings in %s: %w", path, decodeErr)
+	}
+	return settings, nil
+}
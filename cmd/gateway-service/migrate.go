@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/dinowar/gateway-service/internal/pkg/migrations"
+	"go.uber.org/zap"
+	"os"
+	"strconv"
+	"time"
+)
+
+const migrateUsage = "usage: gateway-service migrate up | down [steps] | status"
+
+// runMigrate implements the `migrate` subcommand and returns the process exit code.
+func runMigrate(ctx context.Context, logger *zap.Logger, migrator *migrations.Migrator, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "up":
+		applied, upErr := migrator.Up(ctx)
+		for _, migration := range applied {
+			fmt.Printf("applied %d_%s\n", migration.Version, migration.Name)
+		}
+		if upErr != nil {
+			logger.Error("migrate up failed", zap.Error(upErr))
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			parsed, parseErr := strconv.Atoi(args[1])
+			if parseErr != nil || parsed < 1 {
+				fmt.Fprintln(os.Stderr, migrateUsage)
+				return 2
+			}
+			steps = parsed
+		}
+		reverted, downErr := migrator.Down(ctx, steps)
+		for _, migration := range reverted {
+			fmt.Printf("reverted %d_%s\n", migration.Version, migration.Name)
+		}
+		if downErr != nil {
+			logger.Error("migrate down failed", zap.Error(downErr))
+			return 1
+		}
+	case "status":
+		statuses, statusErr := migrator.Status(ctx)
+		if statusErr != nil {
+			logger.Error("migrate status failed", zap.Error(statusErr))
+			return 1
+		}
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.Applied {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%-40s %s\n", status.Version, status.Name, appliedAt)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	return 0
+}
@@ -1,18 +1,21 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/dinowar/gateway-service/internal/pkg/config"
 	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/gateway/mock"
 	"github.com/dinowar/gateway-service/internal/pkg/util"
 	"github.com/google/uuid"
 	"github.com/sethvargo/go-envconfig"
 	"go.uber.org/zap"
 	"log"
 	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -20,6 +23,13 @@ var (
 	logger          *zap.Logger
 	retryInterval   int
 	retryElapseTime int
+	// the service's name of this gateway and the secret callbacks are signed with
+	callbackGatewayId string
+	callbackSecret    string
+	// callbacks in flight, awaited on shutdown
+	workers sync.WaitGroup
+	// authorizations by reference id, settled once by a capture or void
+	authorizations mock.Authorizations
 )
 
 const (
@@ -58,6 +68,20 @@ func asyncProcessWithdraw(referenceId string, callbackURL string) {
 	sendCallback(callbackURL, callbackData)
 }
 
+func asyncProcessAuthorization(transactionId, referenceId string, callbackURL string) {
+	// imitation of delay
+	time.Sleep(1 * time.Second)
+
+	callbackData := map[string]string{
+		"transaction_id": transactionId,
+		"reference_id":   referenceId,
+		"status":         string(StatusAuthorized),
+		"message":        "funds reserved for capture",
+	}
+
+	sendCallback(callbackURL, callbackData)
+}
+
 func sendCallback(callbackURL string, data map[string]string) {
 	reqBody, marshalErr := json.Marshal(data)
 	if marshalErr != nil {
@@ -65,7 +89,7 @@ func sendCallback(callbackURL string, data map[string]string) {
 		return
 	}
 
-	resp, retryErr := util.RetryableRequest(callbackURL, "POST", bytes.NewBuffer(reqBody), "", "application/json", retryInterval, retryElapseTime)
+	resp, retryErr := util.RetryableCallback(callbackURL, reqBody, callbackGatewayId, callbackSecret, retryInterval, retryElapseTime)
 	if retryErr != nil {
 		logger.Error("HandleDeposit: error processing deposit after retries: %v", zap.Error(retryErr))
 		return
@@ -103,7 +127,11 @@ func depositHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 
-	go asyncProcessDeposit(req.ReferenceID, callbackURL)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		asyncProcessDeposit(req.ReferenceID, callbackURL)
+	}()
 }
 
 func withdrawHandler(w http.ResponseWriter, r *http.Request) {
@@ -132,24 +160,132 @@ func withdrawHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 
-	go asyncProcessWithdraw(req.ReferenceID, callbackURL)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		asyncProcessWithdraw(req.ReferenceID, callbackURL)
+	}()
+}
+
+func authorizeHandler(w http.ResponseWriter, r *http.Request) {
+	var req AuthorizeReq
+	decodeErr := json.NewDecoder(r.Body).Decode(&req)
+	if decodeErr != nil {
+		logger.Error("error decoding request", zap.Error(decodeErr))
+		http.Error(w, decodeErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	callbackURL := r.Header.Get("Callback-URL")
+	if callbackURL == "" {
+		http.Error(w, "missing Callback-URL header", http.StatusBadRequest)
+		return
+	}
+
+	transactionId := uuid.NewString()
+	authorizations.Authorize(req.ReferenceID, req.Amount)
+
+	resp := AuthorizeResponse{
+		Gateway:       gatewayId,
+		TransactionID: transactionId,
+		AccountID:     req.AccountID,
+		Status:        StatusPending,
+		Message:       "authorization request is being processed",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		asyncProcessAuthorization(transactionId, req.ReferenceID, callbackURL)
+	}()
+}
+
+func captureHandler(w http.ResponseWriter, r *http.Request) {
+	var req CaptureReq
+	decodeErr := json.NewDecoder(r.Body).Decode(&req)
+	if decodeErr != nil {
+		logger.Error("error decoding request", zap.Error(decodeErr))
+		http.Error(w, decodeErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	status, message := authorizations.Settle(req.ReferenceID, StatusCaptured, req.Amount)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CaptureResponse{
+		Gateway:       gatewayId,
+		TransactionID: req.TransactionID,
+		Status:        status,
+		Message:       message,
+	})
+}
+
+func voidHandler(w http.ResponseWriter, r *http.Request) {
+	var req VoidReq
+	decodeErr := json.NewDecoder(r.Body).Decode(&req)
+	if decodeErr != nil {
+		logger.Error("error decoding request", zap.Error(decodeErr))
+		http.Error(w, decodeErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	status, message := authorizations.Settle(req.ReferenceID, StatusVoided, 0)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(VoidResponse{
+		Gateway:       gatewayId,
+		TransactionID: req.TransactionID,
+		Status:        status,
+		Message:       message,
+	})
+}
+
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"gateway": gatewayId,
+		"status":  "OK",
+	})
 }
 
 func main() {
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	serviceConfig := &config.ServiceConfig{}
 	if configErr := envconfig.Process(ctx, serviceConfig); configErr != nil {
-		log.Fatal(ctx, "failed to init config", configErr)
+		log.Fatal("failed to init config: ", configErr)
+	}
+	if validationErr := serviceConfig.ValidateRestGateway(); validationErr != nil {
+		log.Fatal(validationErr)
 	}
 
 	retryInterval = serviceConfig.RetryInterval
 	retryElapseTime = serviceConfig.RetryElapseTime
+	callbackGatewayId = serviceConfig.RestGatewayConfig.GatewayId
+	callbackSecret = serviceConfig.RestGatewayConfig.CallbackSecret
 
-	http.HandleFunc("/deposit", depositHandler)
-	http.HandleFunc("/withdraw", withdrawHandler)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/deposit", depositHandler)
+	mux.HandleFunc("/withdraw", withdrawHandler)
+	mux.HandleFunc("/authorize", authorizeHandler)
+	mux.HandleFunc("/capture", captureHandler)
+	mux.HandleFunc("/void", voidHandler)
+	mux.HandleFunc("/health", healthHandler)
 
 	address := fmt.Sprintf("%s:%s", serviceConfig.RestGatewayConfig.Host, serviceConfig.RestGatewayConfig.Port)
 
 	fmt.Println(fmt.Sprintf("rest mock server running on address %s...", address))
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", serviceConfig.RestGatewayConfig.Port), nil))
+	httpServer := util.NewHTTPServer(serviceConfig.RestGatewayConfig.Port, mux, serviceConfig.HTTPConfig)
+	serveErr := util.ServeAndDrain(ctx, httpServer, &workers, serviceConfig.HTTPConfig.ShutdownTimeout)
+	if serveErr != nil {
+		log.Fatal("rest mock server stopped with error: ", serveErr)
+	}
+	log.Println("rest mock server stopped")
 }
@@ -1,13 +1,13 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"github.com/dinowar/gateway-service/internal/pkg/config"
 	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/gateway/mock"
 	"github.com/dinowar/gateway-service/internal/pkg/util"
 	"github.com/google/uuid"
 	"github.com/sethvargo/go-envconfig"
@@ -15,6 +15,9 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -22,6 +25,13 @@ var (
 	logger          *zap.Logger
 	retryInterval   int
 	retryElapseTime int
+	// the service's name of this gateway and the secret callbacks are signed with
+	callbackGatewayId string
+	callbackSecret    string
+	// callbacks in flight, awaited on shutdown
+	workers sync.WaitGroup
+	// authorizations by reference id, settled once by a capture or void
+	authorizations mock.Authorizations
 )
 
 const (
@@ -67,7 +77,12 @@ func soapHandler(w http.ResponseWriter, r *http.Request) {
 			AccountID:     req.AccountID,
 		}
 
-		go processTransaction(transactionId, req.ReferenceID, r.Header.Get(callbackHeader))
+		callbackURL := r.Header.Get(callbackHeader)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			processTransaction(transactionId, req.ReferenceID, callbackURL)
+		}()
 
 	} else if envelope.Body.WithdrawReq != nil {
 		req := envelope.Body.WithdrawReq
@@ -81,7 +96,60 @@ func soapHandler(w http.ResponseWriter, r *http.Request) {
 			Message:       "CashOut request received and is being processed",
 		}
 
-		go processTransaction(transactionId, req.ReferenceID, r.Header.Get(callbackHeader))
+		callbackURL := r.Header.Get(callbackHeader)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			processTransaction(transactionId, req.ReferenceID, callbackURL)
+		}()
+
+	} else if envelope.Body.AuthorizeReq != nil {
+		req := envelope.Body.AuthorizeReq
+		fmt.Printf("Processing AuthorizeRequest: %+v\n", req)
+
+		transactionId := uuid.NewString()
+		authorizations.Authorize(req.ReferenceID, req.Amount)
+		response = AuthorizeResponse{
+			Gateway:       gatewayId,
+			TransactionID: transactionId,
+			Status:        StatusPending,
+			Message:       "Authorize request received and is being processed",
+			AccountID:     req.AccountID,
+		}
+
+		callbackURL := r.Header.Get(callbackHeader)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			processAuthorization(transactionId, req.ReferenceID, callbackURL)
+		}()
+
+	} else if envelope.Body.CaptureReq != nil {
+		req := envelope.Body.CaptureReq
+		status, message := authorizations.Settle(req.ReferenceID, StatusCaptured, req.Amount)
+		response = CaptureResponse{
+			Gateway:       gatewayId,
+			TransactionID: req.TransactionID,
+			Status:        status,
+			Message:       message,
+		}
+
+	} else if envelope.Body.VoidReq != nil {
+		req := envelope.Body.VoidReq
+		status, message := authorizations.Settle(req.ReferenceID, StatusVoided, 0)
+		response = VoidResponse{
+			Gateway:       gatewayId,
+			TransactionID: req.TransactionID,
+			Status:        status,
+			Message:       message,
+		}
+
+	} else if envelope.Body.PingReq != nil {
+		response = PingResponse{
+			Gateway: gatewayId,
+			Echo:    envelope.Body.PingReq.Echo,
+			Status:  "OK",
+		}
 
 	} else {
 		http.Error(w, "Unknown request", http.StatusBadRequest)
@@ -129,6 +197,25 @@ func processTransaction(transactionId, referenceId string, callbackURL string) {
 	}
 }
 
+func processAuthorization(transactionId, referenceId string, callbackURL string) {
+	// imitation of delay
+	time.Sleep(delay)
+
+	callbackData := map[string]string{
+		"transaction_id": transactionId,
+		"reference_id":   referenceId,
+		"status":         string(StatusAuthorized),
+		"message":        fmt.Sprintf("%s reserved for capture", transactionId),
+	}
+
+	callbackErr := sendCallback(callbackURL, callbackData)
+	if callbackErr != nil {
+		logger.Error("error sending callback", zap.Error(callbackErr))
+	} else {
+		logger.Info("callback sent successfully")
+	}
+}
+
 func sendCallback(callbackURL string, data map[string]string) error {
 	if callbackURL == "" {
 		logger.Error("callback url is empty")
@@ -142,7 +229,7 @@ func sendCallback(callbackURL string, data map[string]string) error {
 		return marshalErr
 	}
 
-	resp, retryErr := util.RetryableRequest(callbackURL, "POST", bytes.NewBuffer(reqBody), "", "application/json", retryInterval, retryElapseTime)
+	resp, retryErr := util.RetryableCallback(callbackURL, reqBody, callbackGatewayId, callbackSecret, retryInterval, retryElapseTime)
 	if retryErr != nil {
 		logger.Error("HandleDeposit: error processing deposit after retries: %v", zap.Error(retryErr))
 		return retryErr
@@ -155,17 +242,30 @@ func sendCallback(callbackURL string, data map[string]string) error {
 }
 
 func main() {
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	serviceConfig := &config.ServiceConfig{}
 	if configErr := envconfig.Process(ctx, serviceConfig); configErr != nil {
-		log.Fatal(ctx, "failed to init config", configErr)
+		log.Fatal("failed to init config: ", configErr)
+	}
+	if validationErr := serviceConfig.ValidateSoapGateway(); validationErr != nil {
+		log.Fatal(validationErr)
 	}
 
 	retryInterval = serviceConfig.RetryInterval
 	retryElapseTime = serviceConfig.RetryElapseTime
+	callbackGatewayId = serviceConfig.SoapGatewayConfig.GatewayId
+	callbackSecret = serviceConfig.SoapGatewayConfig.CallbackSecret
 
-	http.HandleFunc(serviceConfig.SoapGatewayConfig.Endpoint, soapHandler)
+	mux := http.NewServeMux()
+	mux.HandleFunc(serviceConfig.SoapGatewayConfig.Endpoint, soapHandler)
 	address := fmt.Sprintf("%s:%s", serviceConfig.SoapGatewayConfig.EndpointHost, serviceConfig.SoapGatewayConfig.EndpointPort)
 	log.Println(fmt.Sprintf("soap mock server running on address %s..", address))
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", serviceConfig.SoapGatewayConfig.EndpointPort), nil))
+	httpServer := util.NewHTTPServer(serviceConfig.SoapGatewayConfig.EndpointPort, mux, serviceConfig.HTTPConfig)
+	serveErr := util.ServeAndDrain(ctx, httpServer, &workers, serviceConfig.HTTPConfig.ShutdownTimeout)
+	if serveErr != nil {
+		log.Fatal("soap mock server stopped with error: ", serveErr)
+	}
+	log.Println("soap mock server stopped")
 }
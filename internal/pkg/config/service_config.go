@@ -7,27 +7,120 @@ type ServiceConfig struct {
 	SoapGatewayConfig       SoapGatewayConfig
 	RestGatewayConfig       RestGatewayConfig
 	DBConfig                DBConfig
-	RetryInterval           int `env:"GATEWAY_SERVICE_INTERVAL"`
-	RetryElapseTime         int `env:"GATEWAY_SERVICE_ELAPSE_TIME"`
+	HealthConfig            HealthConfig
+	HTTPConfig              HTTPConfig
+	WebhookConfig           WebhookConfig
+	RiskConfig              RiskConfig
+	SanctionsConfig         SanctionsConfig
+	FxConfig                FxConfig
+	AuthorizationConfig     AuthorizationConfig
+	RetryInterval           int   `env:"GATEWAY_SERVICE_INTERVAL"`
+	RetryElapseTime         int   `env:"GATEWAY_SERVICE_ELAPSE_TIME"`
+	MaxBodyBytes            int64 `env:"GATEWAY_SERVICE_MAX_BODY_BYTES, default=1048576"`
+	// AdminAPIKey is the bearer token of the operator API under /admin, which is disabled while it is empty.
+	AdminAPIKey string `env:"GATEWAY_SERVICE_ADMIN_API_KEY"`
+	// ReviewerAPIKeys are named keys of the review routes under /admin as reviewer:key pairs separated by commas.
+	// Review decisions are only accepted with one of them and are recorded under its reviewer's name.
+	ReviewerAPIKeys map[string]string `env:"GATEWAY_SERVICE_REVIEWER_API_KEYS"`
+	// FeeSchedule is a JSON array of fee rules pricing every merchant without a matching rule of its own.
+	FeeSchedule string `env:"GATEWAY_SERVICE_FEE_SCHEDULE"`
 }
 
+// DBConfig lifetimes and the connect timeout are in seconds.
 type DBConfig struct {
-	Host     string `env:"GATEWAY_SERVICE_DB_HOST"`
-	Port     string `env:"GATEWAY_SERVICE_DB_PORT"`
-	Database string `env:"GATEWAY_SERVICE_DB_NAME"`
-	Username string `env:"GATEWAY_SERVICE_DB_USER"`
-	Password string `env:"GATEWAY_SERVICE_DB_PASSWORD"`
+	Host            string `env:"GATEWAY_SERVICE_DB_HOST"`
+	Port            string `env:"GATEWAY_SERVICE_DB_PORT"`
+	Database        string `env:"GATEWAY_SERVICE_DB_NAME"`
+	Username        string `env:"GATEWAY_SERVICE_DB_USER"`
+	Password        string `env:"GATEWAY_SERVICE_DB_PASSWORD"`
+	MaxOpenConns    int    `env:"GATEWAY_SERVICE_DB_MAX_OPEN_CONNS, default=25"`
+	MaxIdleConns    int    `env:"GATEWAY_SERVICE_DB_MAX_IDLE_CONNS, default=5"`
+	ConnMaxLifetime int    `env:"GATEWAY_SERVICE_DB_CONN_MAX_LIFETIME, default=1800"`
+	ConnMaxIdleTime int    `env:"GATEWAY_SERVICE_DB_CONN_MAX_IDLE_TIME, default=300"`
+	ConnectTimeout  int    `env:"GATEWAY_SERVICE_DB_CONNECT_TIMEOUT, default=30"`
+	MigrateOnStart  bool   `env:"GATEWAY_SERVICE_DB_MIGRATE_ON_START, default=true"`
 }
 
+// SoapGatewayConfig and RestGatewayConfig CallbackSecret is shared by the
+// gateway and the service, the gateway signs its callbacks with it.
 type SoapGatewayConfig struct {
-	GatewayId    string `env:"SOAP_GATEWAY_ID"`
-	Endpoint     string `env:"SOAP_GATEWAY_ENDPOINT"`
-	EndpointHost string `env:"SOAP_GATEWAY_ENDPOINT_HOST"`
-	EndpointPort string `env:"SOAP_GATEWAY_ENDPOINT_PORT"`
+	GatewayId      string `env:"SOAP_GATEWAY_ID"`
+	Endpoint       string `env:"SOAP_GATEWAY_ENDPOINT"`
+	EndpointHost   string `env:"SOAP_GATEWAY_ENDPOINT_HOST"`
+	EndpointPort   string `env:"SOAP_GATEWAY_ENDPOINT_PORT"`
+	CallbackSecret string `env:"SOAP_GATEWAY_CALLBACK_SECRET"`
 }
 
 type RestGatewayConfig struct {
-	GatewayId string `env:"REST_GATEWAY_ID"`
-	Host      string `env:"REST_GATEWAY_HOST"`
-	Port      string `env:"REST_GATEWAY_PORT"`
+	GatewayId      string `env:"REST_GATEWAY_ID"`
+	Host           string `env:"REST_GATEWAY_HOST"`
+	Port           string `env:"REST_GATEWAY_PORT"`
+	CallbackSecret string `env:"REST_GATEWAY_CALLBACK_SECRET"`
+}
+
+// HealthConfig intervals and timeouts are in seconds, like the retry settings.
+type HealthConfig struct {
+	ProbeInterval int `env:"GATEWAY_SERVICE_HEALTH_INTERVAL, default=15"`
+	ProbeTimeout  int `env:"GATEWAY_SERVICE_HEALTH_TIMEOUT, default=3"`
+}
+
+// HTTPConfig timeouts are in seconds. ShutdownTimeout bounds draining of
+// in-flight requests and background workers on SIGTERM.
+type HTTPConfig struct {
+	ReadTimeout     int `env:"GATEWAY_SERVICE_READ_TIMEOUT, default=10"`
+	WriteTimeout    int `env:"GATEWAY_SERVICE_WRITE_TIMEOUT, default=30"`
+	IdleTimeout     int `env:"GATEWAY_SERVICE_IDLE_TIMEOUT, default=60"`
+	ShutdownTimeout int `env:"GATEWAY_SERVICE_SHUTDOWN_TIMEOUT, default=30"`
+}
+
+// WebhookConfig intervals and timeouts are in seconds. A failing delivery is
+// retried after RetryBase, doubling per attempt, until MaxAttempts is reached
+// and it becomes a dead letter.
+type WebhookConfig struct {
+	PollInterval int `env:"GATEWAY_SERVICE_WEBHOOK_POLL_INTERVAL, default=5"`
+	Timeout      int `env:"GATEWAY_SERVICE_WEBHOOK_TIMEOUT, default=10"`
+	MaxAttempts  int `env:"GATEWAY_SERVICE_WEBHOOK_MAX_ATTEMPTS, default=10"`
+	RetryBase    int `env:"GATEWAY_SERVICE_WEBHOOK_RETRY_BASE, default=30"`
+	BatchSize    int `env:"GATEWAY_SERVICE_WEBHOOK_BATCH_SIZE, default=50"`
+}
+
+// RiskConfig tunes the risk rules screening deposits and withdrawals, see
+// service.DefaultRiskRules. Windows are in minutes and the anomaly history in
+// days; a zero attempt limit, factor or window turns its rule off.
+type RiskConfig struct {
+	VelocityMaxAttempts   int      `env:"GATEWAY_SERVICE_RISK_VELOCITY_MAX_ATTEMPTS, default=10"`
+	VelocityWindow        int      `env:"GATEWAY_SERVICE_RISK_VELOCITY_WINDOW, default=10"`
+	AnomalyFactor         int      `env:"GATEWAY_SERVICE_RISK_ANOMALY_FACTOR, default=10"`
+	AnomalyMinHistory     int      `env:"GATEWAY_SERVICE_RISK_ANOMALY_MIN_HISTORY, default=5"`
+	AnomalyHistoryDays    int      `env:"GATEWAY_SERVICE_RISK_ANOMALY_HISTORY_DAYS, default=90"`
+	RapidWithdrawalWindow int      `env:"GATEWAY_SERVICE_RISK_RAPID_WITHDRAWAL_WINDOW, default=30"`
+	BlockedAccounts       []string `env:"GATEWAY_SERVICE_RISK_BLOCKED_ACCOUNTS"`
+}
+
+// SanctionsConfig enables watchlist screening of withdrawals while ListPath is
+// set, see service.SanctionsScreener. The list is a CSV file or a consolidated
+// list XML file, told apart by the extension, and is reloaded every
+// ReloadInterval minutes; zero loads it once. Names match at MatchThreshold
+// percent similarity and matches are denied or sent to review by Action.
+type SanctionsConfig struct {
+	ListPath       string `env:"GATEWAY_SERVICE_SANCTIONS_LIST_PATH"`
+	ReloadInterval int    `env:"GATEWAY_SERVICE_SANCTIONS_RELOAD_INTERVAL, default=60"`
+	MatchThreshold int    `env:"GATEWAY_SERVICE_SANCTIONS_MATCH_THRESHOLD, default=90"`
+	Action         string `env:"GATEWAY_SERVICE_SANCTIONS_ACTION, default=deny"`
+}
+
+// FxConfig enables currency conversion while RatesPath is set, see
+// service.FileRateProvider for the JSON file of rates. Quotes lock a rate for
+// QuoteTTL seconds.
+type FxConfig struct {
+	RatesPath string `env:"GATEWAY_SERVICE_FX_RATES_PATH"`
+	QuoteTTL  int    `env:"GATEWAY_SERVICE_FX_QUOTE_TTL, default=60"`
+}
+
+// AuthorizationConfig bounds deposits authorized for a later capture: they
+// lapse TTL minutes after they are created and are voided by a sweep every
+// ExpiryInterval seconds, which zero turns off.
+type AuthorizationConfig struct {
+	TTL            int `env:"GATEWAY_SERVICE_AUTHORIZATION_TTL, default=10080"`
+	ExpiryInterval int `env:"GATEWAY_SERVICE_AUTHORIZATION_EXPIRY_INTERVAL, default=60"`
 }
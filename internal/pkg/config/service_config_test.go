@@ -0,0 +1,171 @@
+package config
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func validConfig() *ServiceConfig {
+	return &ServiceConfig{
+		ServicePort:             "9090",
+		ServiceCallbackEndpoint: "http://gateway-service:9090/callback",
+		SoapGatewayConfig: SoapGatewayConfig{
+			GatewayId:      "soap",
+			Endpoint:       "/soap",
+			EndpointHost:   "soap-gateway",
+			EndpointPort:   "9091",
+			CallbackSecret: "soap-callback-secret-0123456789abcdef",
+		},
+		RestGatewayConfig: RestGatewayConfig{
+			GatewayId:      "rest",
+			Host:           "rest-gateway",
+			Port:           "9092",
+			CallbackSecret: "rest-callback-secret-0123456789abcdef",
+		},
+		DBConfig: DBConfig{
+			Host:            "postgres",
+			Port:            "5432",
+			Database:        "default",
+			Username:        "admin",
+			Password:        "password",
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 1800,
+			ConnMaxIdleTime: 300,
+			ConnectTimeout:  30,
+		},
+		HealthConfig:        HealthConfig{ProbeInterval: 15, ProbeTimeout: 3},
+		HTTPConfig:          HTTPConfig{ReadTimeout: 10, WriteTimeout: 30, IdleTimeout: 60, ShutdownTimeout: 30},
+		WebhookConfig:       WebhookConfig{PollInterval: 5, Timeout: 10, MaxAttempts: 10, RetryBase: 30, BatchSize: 50},
+		RetryInterval:       10,
+		RetryElapseTime:     1,
+		MaxBodyBytes:        1 << 20,
+		AuthorizationConfig: AuthorizationConfig{TTL: 10080, ExpiryInterval: 60},
+	}
+}
+
+func TestValidate_Success(t *testing.T) {
+	assert.NoError(t, validConfig().Validate())
+}
+
+func TestValidate_AggregatesProblems(t *testing.T) {
+	cfg := validConfig()
+	cfg.ServicePort = "http"
+	cfg.ServiceCallbackEndpoint = "gateway-service/callback"
+	cfg.RestGatewayConfig.GatewayId = ""
+	cfg.DBConfig.MaxIdleConns = 50
+	cfg.RetryInterval = 0
+
+	validationErr := cfg.Validate()
+	var configErr *ValidationError
+	assert.True(t, errors.As(validationErr, &configErr))
+	assert.Len(t, configErr.Problems, 5)
+	assert.Contains(t, validationErr.Error(), "GATEWAY_SERVICE_PORT must be a port number")
+	assert.Contains(t, validationErr.Error(), "GATEWAY_SERVICE_CALLBACK_ENDPOINT must be an absolute http(s) URL")
+	assert.Contains(t, validationErr.Error(), "REST_GATEWAY_ID is required")
+	assert.Contains(t, validationErr.Error(), "GATEWAY_SERVICE_DB_MAX_IDLE_CONNS (50) must not exceed")
+	assert.Contains(t, validationErr.Error(), "GATEWAY_SERVICE_INTERVAL must be positive")
+}
+
+func TestValidate_DuplicateGatewayIds(t *testing.T) {
+	cfg := validConfig()
+	cfg.SoapGatewayConfig.GatewayId = "rest"
+
+	assert.ErrorContains(t, cfg.Validate(), "REST_GATEWAY_ID and SOAP_GATEWAY_ID must differ")
+}
+
+func TestValidate_CallbackSecrets(t *testing.T) {
+	cfg := validConfig()
+	cfg.RestGatewayConfig.CallbackSecret = ""
+	cfg.SoapGatewayConfig.CallbackSecret = "short"
+
+	validationErr := cfg.Validate()
+	assert.ErrorContains(t, validationErr, "REST_GATEWAY_CALLBACK_SECRET must be at least 32 characters long")
+	assert.ErrorContains(t, validationErr, "SOAP_GATEWAY_CALLBACK_SECRET must be at least 32 characters long")
+	assert.ErrorContains(t, cfg.ValidateRestGateway(), "REST_GATEWAY_CALLBACK_SECRET")
+}
+
+func TestValidate_AdminAPIKeyLength(t *testing.T) {
+	cfg := validConfig()
+	cfg.AdminAPIKey = "short"
+	assert.ErrorContains(t, cfg.Validate(), "GATEWAY_SERVICE_ADMIN_API_KEY must be at least 32 characters long")
+
+	cfg.AdminAPIKey = "0123456789abcdef0123456789abcdef"
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestValidate_ReviewerAPIKeys(t *testing.T) {
+	cfg := validConfig()
+	cfg.AdminAPIKey = "0123456789abcdef0123456789abcdef"
+	cfg.ReviewerAPIKeys = map[string]string{
+		"alice": "alice-0123456789abcdef0123456789abcdef",
+		"bob":   "short",
+		"carol": "0123456789abcdef0123456789abcdef",
+	}
+	validationErr := cfg.Validate()
+	assert.ErrorContains(t, validationErr, "GATEWAY_SERVICE_REVIEWER_API_KEYS key of bob must be at least 32 characters long")
+	assert.ErrorContains(t, validationErr, "GATEWAY_SERVICE_REVIEWER_API_KEYS key of carol is also the key of GATEWAY_SERVICE_ADMIN_API_KEY")
+
+	delete(cfg.ReviewerAPIKeys, "bob")
+	delete(cfg.ReviewerAPIKeys, "carol")
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestValidate_RiskConfig(t *testing.T) {
+	cfg := validConfig()
+	cfg.RiskConfig = RiskConfig{}
+	assert.NoError(t, cfg.Validate(), "every risk rule can be turned off")
+
+	cfg.RiskConfig.VelocityWindow = -1
+	assert.ErrorContains(t, cfg.Validate(), "GATEWAY_SERVICE_RISK_VELOCITY_WINDOW must not be negative")
+}
+
+func TestValidate_SanctionsConfig(t *testing.T) {
+	cfg := validConfig()
+	cfg.SanctionsConfig = SanctionsConfig{}
+	assert.NoError(t, cfg.Validate(), "screening is off without a list")
+
+	cfg.SanctionsConfig = SanctionsConfig{ListPath: "/etc/sanctions/list.json", ReloadInterval: 60, MatchThreshold: 0, Action: "block"}
+	validationErr := cfg.Validate()
+	assert.ErrorContains(t, validationErr, "GATEWAY_SERVICE_SANCTIONS_LIST_PATH must be a .csv or .xml file")
+	assert.ErrorContains(t, validationErr, "GATEWAY_SERVICE_SANCTIONS_MATCH_THRESHOLD must be a percentage between 1 and 100")
+	assert.ErrorContains(t, validationErr, "GATEWAY_SERVICE_SANCTIONS_ACTION must be deny or review")
+
+	cfg.SanctionsConfig = SanctionsConfig{ListPath: "/etc/sanctions/consolidated.XML", MatchThreshold: 85, Action: "review"}
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestValidate_FxConfig(t *testing.T) {
+	cfg := validConfig()
+	cfg.FxConfig = FxConfig{}
+	assert.NoError(t, cfg.Validate(), "conversion is off without rates")
+
+	cfg.FxConfig = FxConfig{RatesPath: "/etc/fx/rates.csv", QuoteTTL: 0}
+	validationErr := cfg.Validate()
+	assert.ErrorContains(t, validationErr, "GATEWAY_SERVICE_FX_RATES_PATH must be a .json file")
+	assert.ErrorContains(t, validationErr, "GATEWAY_SERVICE_FX_QUOTE_TTL must be positive")
+
+	cfg.FxConfig = FxConfig{RatesPath: "/etc/fx/rates.json", QuoteTTL: 60}
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestValidate_AuthorizationConfig(t *testing.T) {
+	cfg := validConfig()
+	cfg.AuthorizationConfig = AuthorizationConfig{TTL: 0, ExpiryInterval: -1}
+	validationErr := cfg.Validate()
+	assert.ErrorContains(t, validationErr, "GATEWAY_SERVICE_AUTHORIZATION_TTL must be positive")
+	assert.ErrorContains(t, validationErr, "GATEWAY_SERVICE_AUTHORIZATION_EXPIRY_INTERVAL must not be negative")
+
+	cfg.AuthorizationConfig = AuthorizationConfig{TTL: 60, ExpiryInterval: 0}
+	assert.NoError(t, cfg.Validate(), "zero turns the sweep off")
+}
+
+func TestValidateRestGateway_IgnoresDatabase(t *testing.T) {
+	cfg := validConfig()
+	cfg.DBConfig = DBConfig{}
+
+	assert.NoError(t, cfg.ValidateRestGateway())
+	assert.Error(t, cfg.Validate())
+}
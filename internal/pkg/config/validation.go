@@ -0,0 +1,267 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MinAdminAPIKeyLength keeps the operator's key out of reach of guessing.
+const MinAdminAPIKeyLength = 32
+
+// MinCallbackSecretLength does the same for the secrets gateways sign their
+// callbacks with.
+const MinCallbackSecretLength = 32
+
+// ValidationError lists every configuration problem found, so a broken
+// deployment can be fixed in one pass instead of one variable at a time.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid configuration:\n  - %s", strings.Join(e.Problems, "\n  - "))
+}
+
+type validator struct {
+	problems []string
+}
+
+func (v *validator) addf(format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+func (v *validator) required(name, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.addf("%s is required", name)
+	}
+}
+
+func (v *validator) port(name, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.addf("%s is required", name)
+		return
+	}
+	port, parseErr := strconv.Atoi(value)
+	if parseErr != nil || port < 1 || port > 65535 {
+		v.addf("%s must be a port number between 1 and 65535, got %q", name, value)
+	}
+}
+
+func (v *validator) url(name, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.addf("%s is required", name)
+		return
+	}
+	parsed, parseErr := url.Parse(value)
+	if parseErr != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		v.addf("%s must be an absolute http(s) URL, got %q", name, value)
+	}
+}
+
+func (v *validator) secret(name, value string) {
+	if len(value) < MinCallbackSecretLength {
+		v.addf("%s must be at least %d characters long", name, MinCallbackSecretLength)
+	}
+}
+
+func (v *validator) positive(name string, value int) {
+	if value <= 0 {
+		v.addf("%s must be positive, got %d", name, value)
+	}
+}
+
+func (v *validator) nonNegative(name string, value int) {
+	if value < 0 {
+		v.addf("%s must not be negative, got %d", name, value)
+	}
+}
+
+func (v *validator) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
+
+// Validate checks everything the gateway service needs to start.
+func (cfg *ServiceConfig) Validate() error {
+	v := &validator{}
+	v.port("GATEWAY_SERVICE_PORT", cfg.ServicePort)
+	v.url("GATEWAY_SERVICE_CALLBACK_ENDPOINT", cfg.ServiceCallbackEndpoint)
+	cfg.validateRetry(v)
+	if cfg.MaxBodyBytes <= 0 {
+		v.addf("GATEWAY_SERVICE_MAX_BODY_BYTES must be positive, got %d", cfg.MaxBodyBytes)
+	}
+	if cfg.AdminAPIKey != "" && len(cfg.AdminAPIKey) < MinAdminAPIKeyLength {
+		v.addf("GATEWAY_SERVICE_ADMIN_API_KEY must be at least %d characters long", MinAdminAPIKeyLength)
+	}
+	cfg.validateReviewerKeys(v)
+	cfg.RestGatewayConfig.validate(v)
+	cfg.SoapGatewayConfig.validate(v)
+	if cfg.RestGatewayConfig.GatewayId != "" && cfg.RestGatewayConfig.GatewayId == cfg.SoapGatewayConfig.GatewayId {
+		v.addf("REST_GATEWAY_ID and SOAP_GATEWAY_ID must differ, both are %q", cfg.RestGatewayConfig.GatewayId)
+	}
+	cfg.DBConfig.validate(v)
+	cfg.HealthConfig.validate(v)
+	cfg.HTTPConfig.validate(v)
+	cfg.WebhookConfig.validate(v)
+	cfg.RiskConfig.validate(v)
+	cfg.SanctionsConfig.validate(v)
+	cfg.FxConfig.validate(v)
+	cfg.AuthorizationConfig.validate(v)
+	return v.err()
+}
+
+// validateReviewerKeys requires every reviewer key to be as strong as the
+// admin key and to name exactly one reviewer.
+func (cfg *ServiceConfig) validateReviewerKeys(v *validator) {
+	reviewers := make([]string, 0, len(cfg.ReviewerAPIKeys))
+	for reviewer := range cfg.ReviewerAPIKeys {
+		reviewers = append(reviewers, reviewer)
+	}
+	sort.Strings(reviewers)
+
+	owners := map[string]string{cfg.AdminAPIKey: "GATEWAY_SERVICE_ADMIN_API_KEY"}
+	for _, reviewer := range reviewers {
+		key := cfg.ReviewerAPIKeys[reviewer]
+		if strings.TrimSpace(reviewer) == "" {
+			v.addf("GATEWAY_SERVICE_REVIEWER_API_KEYS has a key without a reviewer name")
+			continue
+		}
+		if len(key) < MinAdminAPIKeyLength {
+			v.addf("GATEWAY_SERVICE_REVIEWER_API_KEYS key of %s must be at least %d characters long", reviewer, MinAdminAPIKeyLength)
+			continue
+		}
+		if owner, taken := owners[key]; taken {
+			v.addf("GATEWAY_SERVICE_REVIEWER_API_KEYS key of %s is also the key of %s", reviewer, owner)
+			continue
+		}
+		owners[key] = reviewer
+	}
+}
+
+// ValidateRestGateway checks the subset of the configuration used by the REST mock.
+func (cfg *ServiceConfig) ValidateRestGateway() error {
+	v := &validator{}
+	cfg.validateRetry(v)
+	cfg.RestGatewayConfig.validate(v)
+	cfg.HTTPConfig.validate(v)
+	return v.err()
+}
+
+// ValidateSoapGateway checks the subset of the configuration used by the SOAP mock.
+func (cfg *ServiceConfig) ValidateSoapGateway() error {
+	v := &validator{}
+	cfg.validateRetry(v)
+	cfg.SoapGatewayConfig.validate(v)
+	cfg.HTTPConfig.validate(v)
+	return v.err()
+}
+
+// ValidateDatabase checks the subset of the configuration used by the migrate command.
+func (cfg *ServiceConfig) ValidateDatabase() error {
+	v := &validator{}
+	cfg.DBConfig.validate(v)
+	return v.err()
+}
+
+func (cfg *ServiceConfig) validateRetry(v *validator) {
+	v.positive("GATEWAY_SERVICE_INTERVAL", cfg.RetryInterval)
+	v.positive("GATEWAY_SERVICE_ELAPSE_TIME", cfg.RetryElapseTime)
+}
+
+func (cfg RestGatewayConfig) validate(v *validator) {
+	v.required("REST_GATEWAY_ID", cfg.GatewayId)
+	v.required("REST_GATEWAY_HOST", cfg.Host)
+	v.port("REST_GATEWAY_PORT", cfg.Port)
+	v.secret("REST_GATEWAY_CALLBACK_SECRET", cfg.CallbackSecret)
+}
+
+func (cfg SoapGatewayConfig) validate(v *validator) {
+	v.required("SOAP_GATEWAY_ID", cfg.GatewayId)
+	v.required("SOAP_GATEWAY_ENDPOINT_HOST", cfg.EndpointHost)
+	v.port("SOAP_GATEWAY_ENDPOINT_PORT", cfg.EndpointPort)
+	if !strings.HasPrefix(cfg.Endpoint, "/") {
+		v.addf("SOAP_GATEWAY_ENDPOINT must be a path starting with '/', got %q", cfg.Endpoint)
+	}
+	v.secret("SOAP_GATEWAY_CALLBACK_SECRET", cfg.CallbackSecret)
+}
+
+func (cfg DBConfig) validate(v *validator) {
+	v.required("GATEWAY_SERVICE_DB_HOST", cfg.Host)
+	v.port("GATEWAY_SERVICE_DB_PORT", cfg.Port)
+	v.required("GATEWAY_SERVICE_DB_NAME", cfg.Database)
+	v.required("GATEWAY_SERVICE_DB_USER", cfg.Username)
+	v.positive("GATEWAY_SERVICE_DB_MAX_OPEN_CONNS", cfg.MaxOpenConns)
+	v.nonNegative("GATEWAY_SERVICE_DB_MAX_IDLE_CONNS", cfg.MaxIdleConns)
+	if cfg.MaxOpenConns > 0 && cfg.MaxIdleConns > cfg.MaxOpenConns {
+		v.addf("GATEWAY_SERVICE_DB_MAX_IDLE_CONNS (%d) must not exceed GATEWAY_SERVICE_DB_MAX_OPEN_CONNS (%d)", cfg.MaxIdleConns, cfg.MaxOpenConns)
+	}
+	v.nonNegative("GATEWAY_SERVICE_DB_CONN_MAX_LIFETIME", cfg.ConnMaxLifetime)
+	v.nonNegative("GATEWAY_SERVICE_DB_CONN_MAX_IDLE_TIME", cfg.ConnMaxIdleTime)
+	v.positive("GATEWAY_SERVICE_DB_CONNECT_TIMEOUT", cfg.ConnectTimeout)
+}
+
+func (cfg HealthConfig) validate(v *validator) {
+	v.positive("GATEWAY_SERVICE_HEALTH_INTERVAL", cfg.ProbeInterval)
+	v.positive("GATEWAY_SERVICE_HEALTH_TIMEOUT", cfg.ProbeTimeout)
+}
+
+func (cfg HTTPConfig) validate(v *validator) {
+	v.positive("GATEWAY_SERVICE_READ_TIMEOUT", cfg.ReadTimeout)
+	v.positive("GATEWAY_SERVICE_WRITE_TIMEOUT", cfg.WriteTimeout)
+	v.positive("GATEWAY_SERVICE_IDLE_TIMEOUT", cfg.IdleTimeout)
+	v.positive("GATEWAY_SERVICE_SHUTDOWN_TIMEOUT", cfg.ShutdownTimeout)
+}
+
+func (cfg WebhookConfig) validate(v *validator) {
+	v.positive("GATEWAY_SERVICE_WEBHOOK_POLL_INTERVAL", cfg.PollInterval)
+	v.positive("GATEWAY_SERVICE_WEBHOOK_TIMEOUT", cfg.Timeout)
+	v.positive("GATEWAY_SERVICE_WEBHOOK_MAX_ATTEMPTS", cfg.MaxAttempts)
+	v.positive("GATEWAY_SERVICE_WEBHOOK_RETRY_BASE", cfg.RetryBase)
+	v.positive("GATEWAY_SERVICE_WEBHOOK_BATCH_SIZE", cfg.BatchSize)
+}
+
+func (cfg RiskConfig) validate(v *validator) {
+	v.nonNegative("GATEWAY_SERVICE_RISK_VELOCITY_MAX_ATTEMPTS", cfg.VelocityMaxAttempts)
+	v.nonNegative("GATEWAY_SERVICE_RISK_VELOCITY_WINDOW", cfg.VelocityWindow)
+	v.nonNegative("GATEWAY_SERVICE_RISK_ANOMALY_FACTOR", cfg.AnomalyFactor)
+	v.nonNegative("GATEWAY_SERVICE_RISK_ANOMALY_MIN_HISTORY", cfg.AnomalyMinHistory)
+	v.nonNegative("GATEWAY_SERVICE_RISK_ANOMALY_HISTORY_DAYS", cfg.AnomalyHistoryDays)
+	v.nonNegative("GATEWAY_SERVICE_RISK_RAPID_WITHDRAWAL_WINDOW", cfg.RapidWithdrawalWindow)
+}
+
+func (cfg SanctionsConfig) validate(v *validator) {
+	if cfg.ListPath == "" {
+		return
+	}
+	if extension := strings.ToLower(filepath.Ext(cfg.ListPath)); extension != ".csv" && extension != ".xml" {
+		v.addf("GATEWAY_SERVICE_SANCTIONS_LIST_PATH must be a .csv or .xml file, got %q", cfg.ListPath)
+	}
+	v.nonNegative("GATEWAY_SERVICE_SANCTIONS_RELOAD_INTERVAL", cfg.ReloadInterval)
+	if cfg.MatchThreshold < 1 || cfg.MatchThreshold > 100 {
+		v.addf("GATEWAY_SERVICE_SANCTIONS_MATCH_THRESHOLD must be a percentage between 1 and 100, got %d", cfg.MatchThreshold)
+	}
+	if cfg.Action != "deny" && cfg.Action != "review" {
+		v.addf("GATEWAY_SERVICE_SANCTIONS_ACTION must be deny or review, got %q", cfg.Action)
+	}
+}
+
+func (cfg FxConfig) validate(v *validator) {
+	if cfg.RatesPath == "" {
+		return
+	}
+	if !strings.EqualFold(filepath.Ext(cfg.RatesPath), ".json") {
+		v.addf("GATEWAY_SERVICE_FX_RATES_PATH must be a .json file, got %q", cfg.RatesPath)
+	}
+	v.positive("GATEWAY_SERVICE_FX_QUOTE_TTL", cfg.QuoteTTL)
+}
+
+func (cfg AuthorizationConfig) validate(v *validator) {
+	v.positive("GATEWAY_SERVICE_AUTHORIZATION_TTL", cfg.TTL)
+	v.nonNegative("GATEWAY_SERVICE_AUTHORIZATION_EXPIRY_INTERVAL", cfg.ExpiryInterval)
+}
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+// Authorization is the capture state of a deposit authorized to be captured
+// later, see StatusAuthorized.
+type Authorization struct {
+	// ExpiresAt is when an uncaptured authorization lapses; nil on
+	// transactions that are not authorizations.
+	ExpiresAt *time.Time
+	// Captured is the amount taken of a captured authorization, at most the
+	// transaction's amount.
+	Captured decimal.Decimal
+}
+
+// Expired reports whether the authorization lapsed by now.
+func (auth Authorization) Expired(now time.Time) bool {
+	return auth.ExpiresAt != nil && !now.Before(*auth.ExpiresAt)
+}
+
+// IsAuthorization reports whether txn was authorized for a later capture
+// instead of being settled in one step.
+func (txn Transaction) IsAuthorization() bool {
+	return txn.Authorization.ExpiresAt != nil
+}
+
+// SettledAmount returns the amount txn settles for: the captured amount of a
+// captured authorization, its whole amount otherwise.
+func (txn Transaction) SettledAmount() decimal.Decimal {
+	if txn.Status == StatusCaptured {
+		return txn.Authorization.Captured
+	}
+	return txn.Amount
+}
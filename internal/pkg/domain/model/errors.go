@@ -0,0 +1,94 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error kinds shared by the repositories, services and the HTTP layer, which
+// maps them to status codes. Match them with errors.Is.
+var (
+	ErrInvalidInput  = errors.New("invalid input")
+	ErrNotFound      = errors.New("not found")
+	ErrConflict      = errors.New("conflict")
+	ErrUnprocessable = errors.New("unprocessable")
+	ErrTooLarge      = errors.New("too large")
+	ErrUnauthorized  = errors.New("unauthorized")
+	ErrForbidden     = errors.New("forbidden")
+	ErrInternal      = errors.New("internal error")
+)
+
+// Stable machine-readable error codes returned to clients in problem details.
+// They are part of the public API and documented in api/api.yaml.
+const (
+	CodeInvalidRequestBody      = "invalid_request_body"
+	CodeRequestTooLarge         = "request_too_large"
+	CodeValidationFailed        = "validation_failed"
+	CodeGatewayNotFound         = "gateway_not_found"
+	CodeMethodNotAllowed        = "method_not_allowed"
+	CodeRouteNotFound           = "route_not_found"
+	CodeTransactionNotFound     = "transaction_not_found"
+	CodeTransactionFinal        = "transaction_already_final"
+	CodeNotInReview             = "transaction_not_in_review"
+	CodeReviewerKeyRequired     = "reviewer_key_required"
+	CodeNotAuthorized           = "transaction_not_authorized"
+	CodeAuthorizationExpired    = "authorization_expired"
+	CodeAuthorizationInProgress = "authorization_in_progress"
+	CodeUnknownStatus           = "unknown_transaction_status"
+	CodeGatewayError            = "gateway_error"
+	CodeUnauthenticated         = "unauthenticated"
+	CodeInvalidSignature        = "invalid_callback_signature"
+	CodeAccountNotOwned         = "account_not_owned"
+	CodeMerchantNotFound        = "merchant_not_found"
+	CodeAPIKeyNotFound          = "api_key_not_found"
+	CodeAmountOutOfLimits       = "amount_out_of_limits"
+	CodeInsufficientFunds       = "insufficient_funds"
+	CodeVelocityExceeded        = "velocity_limit_exceeded"
+	CodeRiskDenied              = "risk_denied"
+	CodeRateUnavailable         = "fx_rate_unavailable"
+	CodeQuoteNotFound           = "fx_quote_not_found"
+	CodeQuoteExpired            = "fx_quote_expired"
+	CodeQuoteMismatch           = "fx_quote_mismatch"
+	CodeQuoteUsed               = "fx_quote_used"
+	CodeDeliveryNotFound        = "webhook_delivery_not_found"
+	CodeInternal                = "internal_error"
+)
+
+// FieldError describes one invalid field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is a domain error with a message that is safe to return to clients.
+type Error struct {
+	Kind    error
+	Code    string
+	Message string
+	Fields  []FieldError
+	Cause   error
+}
+
+func NewError(kind error, code string, format string, args ...interface{}) *Error {
+	return &Error{Kind: kind, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func (e *Error) Wrap(cause error) *Error {
+	e.Cause = cause
+	return e
+}
+
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Cause)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Cause != nil {
+		return []error{e.Kind, e.Cause}
+	}
+	return []error{e.Kind}
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+// FxRate is the price of one unit of From in To, as published by Source at AsOf.
+type FxRate struct {
+	From   string
+	To     string
+	Rate   decimal.Decimal
+	Source string
+	AsOf   time.Time
+}
+
+// FxQuote locks a rate for a merchant until ExpiresAt. A quote converts a
+// single transaction of its currency pair, UsedBy; a transaction rejected
+// before it is accepted gives it back.
+type FxQuote struct {
+	Id         string
+	MerchantId string
+	From       string
+	To         string
+	Rate       decimal.Decimal
+	Source     string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	// UsedBy is the reference id of the transaction the quote converted
+	UsedBy string
+}
+
+// Expired reports whether the quote can no longer be used at now.
+func (quote FxQuote) Expired(now time.Time) bool {
+	return !now.Before(quote.ExpiresAt)
+}
+
+// FxConversion is the audit record of converting a transaction's amount into
+// the currency of its account: Amount in Currency at Rate, taken from Source
+// directly or through the quote QuoteId.
+type FxConversion struct {
+	QuoteId  string
+	Rate     decimal.Decimal
+	Source   string
+	Currency string
+	Amount   decimal.Decimal
+}
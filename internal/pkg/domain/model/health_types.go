@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+type HealthState string
+
+const (
+	HealthUnknown  HealthState = "UNKNOWN"
+	HealthUp       HealthState = "UP"
+	HealthDown     HealthState = "DOWN"
+	HealthDegraded HealthState = "DEGRADED"
+)
+
+type ComponentHealth struct {
+	Status    HealthState `json:"status"`
+	Error     string      `json:"error,omitempty"`
+	LatencyMs int64       `json:"latency_ms"`
+	CheckedAt *time.Time  `json:"checked_at,omitempty"`
+}
+
+type HealthReport struct {
+	Status   HealthState                `json:"status"`
+	Database ComponentHealth            `json:"database"`
+	Gateways map[string]ComponentHealth `json:"gateways"`
+}
@@ -0,0 +1,172 @@
+package model
+
+import (
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+// LedgerAccountType says whose money a ledger account tracks.
+type LedgerAccountType string
+
+const (
+	// LedgerCustomer is the money the merchant owes an account holder, a
+	// liability: credits increase its balance.
+	LedgerCustomer LedgerAccountType = "customer"
+	// LedgerGateway is the money held for the merchant at a payment provider,
+	// an asset: debits increase its balance.
+	LedgerGateway LedgerAccountType = "gateway"
+	// LedgerFees is the fees charged by the provider owning it, an expense:
+	// debits increase its balance.
+	LedgerFees LedgerAccountType = "fees"
+	// LedgerFx is the merchant's position in a currency from converting
+	// transactions between the currency of the gateway and of the customer,
+	// an asset: debits increase its balance.
+	LedgerFx LedgerAccountType = "fx"
+)
+
+type Direction string
+
+const (
+	Debit  Direction = "debit"
+	Credit Direction = "credit"
+)
+
+// EntryKind is what a journal entry books. Every kind is booked at most once
+// per reference id.
+type EntryKind string
+
+const (
+	EntryDeposit    EntryKind = "deposit"
+	EntryWithdrawal EntryKind = "withdrawal"
+	// EntryFee books the provider fee of a settled transaction.
+	EntryFee EntryKind = "fee"
+	// EntryFx books the gateway side of a converted transaction, in the
+	// currency the gateway moved.
+	EntryFx EntryKind = "fx"
+)
+
+// LedgerAccountKey identifies a ledger account within a merchant and currency:
+// Owner is the account id of customer accounts and the gateway id of gateway accounts.
+type LedgerAccountKey struct {
+	Type  LedgerAccountType
+	Owner string
+}
+
+// BalanceDelta is the change of the account's balance when amount is posted
+// to it in direction.
+func (key LedgerAccountKey) BalanceDelta(direction Direction, amount decimal.Decimal) decimal.Decimal {
+	increases := Credit
+	if key.Type == LedgerGateway || key.Type == LedgerFees || key.Type == LedgerFx {
+		increases = Debit
+	}
+	if direction == increases {
+		return amount
+	}
+	return amount.Neg()
+}
+
+// Posting moves a positive Amount into or out of one ledger account.
+// BalanceAfter is filled in when the entry is booked.
+type Posting struct {
+	Account      LedgerAccountKey
+	Direction    Direction
+	Amount       decimal.Decimal
+	BalanceAfter decimal.Decimal
+}
+
+// JournalEntry is one balanced booking in a single currency.
+type JournalEntry struct {
+	Id          string
+	MerchantId  string
+	ReferenceId string
+	Kind        EntryKind
+	Currency    string
+	CreatedAt   time.Time
+	Postings    []Posting
+}
+
+// Balanced reports whether the entry has postings, all positive, whose
+// debits equal its credits.
+func (entry JournalEntry) Balanced() bool {
+	if len(entry.Postings) < 2 {
+		return false
+	}
+	sum := decimal.Zero
+	for _, posting := range entry.Postings {
+		if !posting.Amount.IsPositive() {
+			return false
+		}
+		if posting.Direction == Debit {
+			sum = sum.Add(posting.Amount)
+		} else {
+			sum = sum.Sub(posting.Amount)
+		}
+	}
+	return sum.IsZero()
+}
+
+// Balance is the balance of an account holder in one currency. Held is the
+// part of it reserved by withdrawals that have not settled yet.
+type Balance struct {
+	Currency  string
+	Balance   decimal.Decimal
+	Held      decimal.Decimal
+	UpdatedAt time.Time
+}
+
+// Available is the part of the balance that new withdrawals can use.
+func (balance Balance) Available() decimal.Decimal {
+	return balance.Balance.Sub(balance.Held)
+}
+
+type HoldStatus string
+
+const (
+	HoldActive   HoldStatus = "active"
+	HoldReleased HoldStatus = "released"
+	HoldCaptured HoldStatus = "captured"
+)
+
+// FundsHold reserves Amount of an account holder's available balance for the
+// withdrawal ReferenceId while it is in flight. It is released when the
+// withdrawal fails and captured when its debit is booked.
+type FundsHold struct {
+	Id          string
+	MerchantId  string
+	AccountId   string
+	ReferenceId string
+	Currency    string
+	Amount      decimal.Decimal
+	Status      HoldStatus
+	CreatedAt   time.Time
+}
+
+// StatementLine is one posting to an account holder's ledger account. Amount
+// is positive for money credited to the holder and negative for debits.
+type StatementLine struct {
+	Sequence     int64
+	EntryId      string
+	ReferenceId  string
+	Kind         EntryKind
+	Currency     string
+	Amount       decimal.Decimal
+	BalanceAfter decimal.Decimal
+	CreatedAt    time.Time
+}
+
+// StatementRequest selects up to Limit statement lines, newest first, that
+// precede the line with sequence Before, or the newest ones when Before is 0.
+// From is inclusive and To exclusive.
+type StatementRequest struct {
+	Currency string
+	From     *time.Time
+	To       *time.Time
+	Limit    int
+	Before   int64
+}
+
+// StatementPage holds one page of a statement. Next is 0 on the last page.
+type StatementPage struct {
+	Lines []StatementLine
+	Next  int64
+}
@@ -0,0 +1,225 @@
+package model
+
+import (
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+type Merchant struct {
+	Id        string
+	Name      string
+	CreatedAt time.Time
+	Settings  MerchantSettings
+	// WebhookSecret signs the merchant's webhook deliveries, empty until first generated.
+	WebhookSecret string
+}
+
+// APIKey is what is stored of a merchant's key: never the key itself, only
+// its lookup Prefix and the SHA-256 Hash of the full key.
+type APIKey struct {
+	Id         string
+	MerchantId string
+	Prefix     string
+	Hash       []byte
+	CreatedAt  time.Time
+	RevokedAt  *time.Time
+}
+
+// MerchantSettings override the service wide gateway configuration for one
+// merchant. The zero value overrides nothing.
+type MerchantSettings struct {
+	// EnabledGateways restricts the gateways the merchant may use, nil allows every registered one.
+	EnabledGateways []string `json:"enabled_gateways,omitempty"`
+	// RoutingRules pick the gateway of requests without gateway_id, the first matching rule wins.
+	RoutingRules []RoutingRule `json:"routing_rules,omitempty"`
+	Limits       []AmountLimit `json:"limits,omitempty"`
+	// VelocityLimits cap the totals of a day or month, see VelocityLimit.
+	VelocityLimits []VelocityLimit `json:"velocity_limits,omitempty"`
+	// Fees override the service's fee schedule, see FeeRule.
+	Fees       []FeeRule `json:"fees,omitempty"`
+	WebhookURL string    `json:"webhook_url,omitempty"`
+}
+
+// RoutingRule matches requests by operation and currency, empty fields match everything.
+type RoutingRule struct {
+	Operation Operation `json:"operation,omitempty"`
+	Currency  string    `json:"currency,omitempty"`
+	GatewayId string    `json:"gateway_id"`
+}
+
+// AmountLimit bounds the amount of a single transaction in Currency, both
+// bounds inclusive. An empty Operation applies to deposits and withdrawals,
+// an empty GatewayId to every gateway.
+type AmountLimit struct {
+	Operation Operation        `json:"operation,omitempty"`
+	Currency  string           `json:"currency"`
+	GatewayId string           `json:"gateway_id,omitempty"`
+	Min       *decimal.Decimal `json:"min,omitempty"`
+	Max       *decimal.Decimal `json:"max,omitempty"`
+}
+
+func (limit AmountLimit) Matches(operation Operation, currency, gatewayId string) bool {
+	return limit.Currency == currency &&
+		(limit.Operation == "" || limit.Operation == operation) &&
+		(limit.GatewayId == "" || limit.GatewayId == gatewayId)
+}
+
+// FeeRule prices the provider fee of a transaction in Currency: Fixed plus
+// Percent of the amount, raised to Min and capped at Max. An empty Operation
+// applies to deposits and withdrawals, an empty GatewayId to every gateway.
+type FeeRule struct {
+	Operation Operation        `json:"operation,omitempty"`
+	Currency  string           `json:"currency"`
+	GatewayId string           `json:"gateway_id,omitempty"`
+	Fixed     *decimal.Decimal `json:"fixed,omitempty"`
+	Percent   *decimal.Decimal `json:"percent,omitempty"`
+	Min       *decimal.Decimal `json:"min,omitempty"`
+	Max       *decimal.Decimal `json:"max,omitempty"`
+}
+
+func (rule FeeRule) Matches(operation Operation, currency, gatewayId string) bool {
+	return rule.Currency == currency &&
+		(rule.Operation == "" || rule.Operation == operation) &&
+		(rule.GatewayId == "" || rule.GatewayId == gatewayId)
+}
+
+// Fee returns the fee of amount rounded half up to places decimals, the
+// minor units of the currency.
+func (rule FeeRule) Fee(amount decimal.Decimal, places int32) decimal.Decimal {
+	fee := decimal.Zero
+	if rule.Fixed != nil {
+		fee = fee.Add(*rule.Fixed)
+	}
+	if rule.Percent != nil {
+		fee = fee.Add(amount.Mul(*rule.Percent).Div(decimal.NewFromInt(100)))
+	}
+	if rule.Min != nil && fee.LessThan(*rule.Min) {
+		fee = *rule.Min
+	}
+	if rule.Max != nil && fee.GreaterThan(*rule.Max) {
+		fee = *rule.Max
+	}
+	return fee.Round(places)
+}
+
+type LimitPeriod string
+
+const (
+	PeriodDaily   LimitPeriod = "daily"
+	PeriodMonthly LimitPeriod = "monthly"
+)
+
+func (period LimitPeriod) Valid() bool {
+	switch period {
+	case PeriodDaily, PeriodMonthly:
+		return true
+	}
+	return false
+}
+
+// Start returns the beginning of the period containing now: midnight UTC of
+// the day or of the first day of the month.
+func (period LimitPeriod) Start(now time.Time) time.Time {
+	year, month, day := now.UTC().Date()
+	if period == PeriodMonthly {
+		day = 1
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+type LimitScope string
+
+const (
+	// ScopeAccount caps the totals of each account.
+	ScopeAccount LimitScope = "account"
+	// ScopeGateway caps the merchant's totals through each gateway.
+	ScopeGateway LimitScope = "gateway"
+)
+
+func (scope LimitScope) Valid() bool {
+	switch scope {
+	case ScopeAccount, ScopeGateway:
+		return true
+	}
+	return false
+}
+
+// VelocityLimit caps the number and total amount in Currency of the
+// transactions of one account, or of the merchant through one gateway, since
+// the start of the current Period. Transactions count from their creation
+// unless they FAILED. Empty Operation and GatewayId match everything.
+type VelocityLimit struct {
+	Scope     LimitScope       `json:"scope"`
+	Period    LimitPeriod      `json:"period"`
+	Operation Operation        `json:"operation,omitempty"`
+	Currency  string           `json:"currency"`
+	GatewayId string           `json:"gateway_id,omitempty"`
+	MaxAmount *decimal.Decimal `json:"max_amount,omitempty"`
+	MaxCount  *int             `json:"max_count,omitempty"`
+}
+
+func (limit VelocityLimit) Matches(operation Operation, currency, gatewayId string) bool {
+	return limit.Currency == currency &&
+		(limit.Operation == "" || limit.Operation == operation) &&
+		(limit.GatewayId == "" || limit.GatewayId == gatewayId)
+}
+
+// UsageQuery selects the transactions of a merchant that count towards a
+// velocity limit or a risk rule. Empty fields match everything. Currency and
+// the summed amounts are those booked to the account, see
+// Transaction.AccountAmount. FAILED transactions and VOIDED authorizations
+// only count with IncludeFailed, as for attempt counts.
+type UsageQuery struct {
+	AccountId     string
+	GatewayId     string
+	Operation     Operation
+	Currency      string
+	Since         time.Time
+	IncludeFailed bool
+}
+
+// Usage is the number and total amount of the transactions matching a UsageQuery.
+type Usage struct {
+	Count  int
+	Amount decimal.Decimal
+}
+
+func (settings MerchantSettings) GatewayEnabled(gatewayId string) bool {
+	if settings.EnabledGateways == nil {
+		return true
+	}
+	for _, enabled := range settings.EnabledGateways {
+		if enabled == gatewayId {
+			return true
+		}
+	}
+	return false
+}
+
+// Route returns the gateway of the first rule matching operation and
+// currency, or "" when none does.
+func (settings MerchantSettings) Route(operation Operation, currency string) string {
+	for _, rule := range settings.RoutingRules {
+		if (rule.Operation == "" || rule.Operation == operation) && (rule.Currency == "" || rule.Currency == currency) {
+			return rule.GatewayId
+		}
+	}
+	return ""
+}
+
+// CheckLimits returns ErrUnprocessable when amount breaks one of the
+// per-transaction limits matching operation, currency and gatewayId.
+func (settings MerchantSettings) CheckLimits(operation Operation, currency, gatewayId string, amount decimal.Decimal) error {
+	for _, limit := range settings.Limits {
+		if !limit.Matches(operation, currency, gatewayId) {
+			continue
+		}
+		if limit.Min != nil && amount.LessThan(*limit.Min) {
+			return NewError(ErrUnprocessable, CodeAmountOutOfLimits, "amount %s %s is below the minimum of %s", amount, currency, limit.Min)
+		}
+		if limit.Max != nil && amount.GreaterThan(*limit.Max) {
+			return NewError(ErrUnprocessable, CodeAmountOutOfLimits, "amount %s %s exceeds the maximum of %s", amount, currency, limit.Max)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package model
+
+import "time"
+
+type ReviewOutcome string
+
+const (
+	// ReviewApproved moves the transaction to StatusPending and dispatches it.
+	ReviewApproved ReviewOutcome = "approved"
+	// ReviewRejected fails the transaction with the reviewer's reason.
+	ReviewRejected ReviewOutcome = "rejected"
+)
+
+// ReviewDecision is the audit record of a reviewer deciding a transaction
+// held in StatusReview. Decisions are never changed or deleted.
+type ReviewDecision struct {
+	Id          string
+	MerchantId  string
+	ReferenceId string
+	Outcome     ReviewOutcome
+	Reviewer    string
+	Reason      string
+	DecidedAt   time.Time
+}
+
+// HistoryEventKind is what happened to a transaction in its event history.
+type HistoryEventKind string
+
+const (
+	HistoryCreated        HistoryEventKind = "created"
+	HistoryStatusChanged  HistoryEventKind = "status_changed"
+	HistoryReviewApproved HistoryEventKind = "review_approved"
+	HistoryReviewRejected HistoryEventKind = "review_rejected"
+)
+
+// HistoryEvent is one entry of a transaction's event history. Status is the
+// status after the event, Actor the reviewer of review decisions and Detail
+// the risk reasons on creation, the gateway message of status changes or the
+// reviewer's reason. Sequence orders the events.
+type HistoryEvent struct {
+	Sequence    int64
+	MerchantId  string
+	ReferenceId string
+	Kind        HistoryEventKind
+	Status      TransactionStatus
+	Actor       string
+	Detail      string
+	CreatedAt   time.Time
+}
@@ -0,0 +1,42 @@
+package model
+
+// RiskDecision is the outcome of risk screening. Decisions are ordered by
+// severity: RiskDeny over RiskReview over RiskAllow.
+type RiskDecision string
+
+const (
+	RiskAllow RiskDecision = "allow"
+	// RiskReview holds the transaction in StatusReview for manual approval.
+	RiskReview RiskDecision = "review"
+	// RiskDeny fails the transaction without sending it to a gateway.
+	RiskDeny RiskDecision = "deny"
+)
+
+func (decision RiskDecision) severity() int {
+	switch decision {
+	case RiskReview:
+		return 1
+	case RiskDeny:
+		return 2
+	}
+	return 0
+}
+
+// Outweighs reports whether decision is more severe than other.
+func (decision RiskDecision) Outweighs(other RiskDecision) bool {
+	return decision.severity() > other.severity()
+}
+
+// RiskFinding is the verdict of one risk rule. Reason is empty for RiskAllow.
+type RiskFinding struct {
+	Decision RiskDecision
+	Reason   string
+}
+
+// RiskAssessment is stored on a transaction when it is screened. Reasons list
+// the findings that led to the decision; transactions created without
+// screening have an empty Decision.
+type RiskAssessment struct {
+	Decision RiskDecision
+	Reasons  []string
+}
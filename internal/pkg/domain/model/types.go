@@ -13,11 +13,19 @@ type Envelope struct {
 }
 
 type Body struct {
-	XMLName          xml.Name          `xml:"Body"`
-	DepositReq       *DepositReq       `xml:"DepositRequest"`
-	WithdrawReq      *WithdrawReq      `xml:"WithdrawRequest"`
-	DepositResponse  *DepositResponse  `xml:"DepositResponse"`
-	WithdrawResponse *WithdrawResponse `xml:"WithdrawResponse"`
+	XMLName           xml.Name           `xml:"Body"`
+	DepositReq        *DepositReq        `xml:"DepositRequest"`
+	WithdrawReq       *WithdrawReq       `xml:"WithdrawRequest"`
+	DepositResponse   *DepositResponse   `xml:"DepositResponse"`
+	WithdrawResponse  *WithdrawResponse  `xml:"WithdrawResponse"`
+	PingReq           *PingReq           `xml:"PingRequest"`
+	PingResponse      *PingResponse      `xml:"PingResponse"`
+	AuthorizeReq      *AuthorizeReq      `xml:"AuthorizeRequest"`
+	AuthorizeResponse *AuthorizeResponse `xml:"AuthorizeResponse"`
+	CaptureReq        *CaptureReq        `xml:"CaptureRequest"`
+	CaptureResponse   *CaptureResponse   `xml:"CaptureResponse"`
+	VoidReq           *VoidReq           `xml:"VoidRequest"`
+	VoidResponse      *VoidResponse      `xml:"VoidResponse"`
 }
 
 type DepositReq struct {
@@ -54,17 +62,100 @@ type WithdrawResponse struct {
 	Message       string            `json:"Message" xml:"Message"`
 }
 
+// AuthorizeReq asks the provider to reserve a deposit for a later capture.
+type AuthorizeReq struct {
+	XMLName     xml.Name `xml:"AuthorizeRequest"`
+	Amount      float64  `json:"Amount" xml:"Amount"`
+	Currency    string   `json:"Currency" xml:"Currency"`
+	ReferenceID string   `json:"ReferenceId" xml:"ReferenceId"`
+	AccountID   string   `json:"AccountId" xml:"AccountId"`
+}
+
+type AuthorizeResponse struct {
+	XMLName       xml.Name          `xml:"AuthorizeResponse"`
+	Gateway       string            `json:"Gateway" xml:"Gateway"`
+	TransactionID string            `json:"TransactionId" xml:"TransactionId"`
+	AccountID     string            `json:"AccountId" xml:"AccountId"`
+	Status        TransactionStatus `json:"Status" xml:"Status"`
+	Message       string            `json:"Message" xml:"Message"`
+}
+
+// CaptureReq takes Amount, at most the authorized amount, of an authorization.
+type CaptureReq struct {
+	XMLName       xml.Name `xml:"CaptureRequest"`
+	ReferenceID   string   `json:"ReferenceId" xml:"ReferenceId"`
+	TransactionID string   `json:"TransactionId" xml:"TransactionId"`
+	Amount        float64  `json:"Amount" xml:"Amount"`
+	Currency      string   `json:"Currency" xml:"Currency"`
+}
+
+type CaptureResponse struct {
+	XMLName       xml.Name          `xml:"CaptureResponse"`
+	Gateway       string            `json:"Gateway" xml:"Gateway"`
+	TransactionID string            `json:"TransactionId" xml:"TransactionId"`
+	Status        TransactionStatus `json:"Status" xml:"Status"`
+	Message       string            `json:"Message" xml:"Message"`
+}
+
+// VoidReq releases an authorization without capturing it.
+type VoidReq struct {
+	XMLName       xml.Name `xml:"VoidRequest"`
+	ReferenceID   string   `json:"ReferenceId" xml:"ReferenceId"`
+	TransactionID string   `json:"TransactionId" xml:"TransactionId"`
+}
+
+type VoidResponse struct {
+	XMLName       xml.Name          `xml:"VoidResponse"`
+	Gateway       string            `json:"Gateway" xml:"Gateway"`
+	TransactionID string            `json:"TransactionId" xml:"TransactionId"`
+	Status        TransactionStatus `json:"Status" xml:"Status"`
+	Message       string            `json:"Message" xml:"Message"`
+}
+
+type PingReq struct {
+	XMLName xml.Name `xml:"PingRequest"`
+	Echo    string   `json:"Echo" xml:"Echo"`
+}
+
+type PingResponse struct {
+	XMLName xml.Name `xml:"PingResponse"`
+	Gateway string   `json:"Gateway" xml:"Gateway"`
+	Echo    string   `json:"Echo" xml:"Echo"`
+	Status  string   `json:"Status" xml:"Status"`
+}
+
 type Transaction struct {
 	Id          string
 	ReferenceId string
+	MerchantId  string
 	AccountId   string
 	GatewayId   string
 	Amount      decimal.Decimal
-	Currency    string
-	Status      TransactionStatus
-	Message     string
-	Operation   Operation
-	Ts          time.Time
+	// Fee is the provider fee in Currency, booked apart from Amount.
+	Fee       decimal.Decimal
+	Currency  string
+	Status    TransactionStatus
+	Message   string
+	Operation Operation
+	// BeneficiaryName is the payee named in a withdrawal request, screened
+	// against the sanctions list.
+	BeneficiaryName string
+	Risk            RiskAssessment
+	// Conversion is set when the account is booked in another currency than
+	// the gateway moves.
+	Conversion FxConversion
+	// Authorization is set on deposits captured after they are authorized.
+	Authorization Authorization
+	Ts            time.Time
+}
+
+// AccountAmount returns the amount and currency txn is booked to the account
+// in: its conversion when it was converted, its own otherwise.
+func (txn Transaction) AccountAmount() (decimal.Decimal, string) {
+	if txn.Conversion.Currency != "" {
+		return txn.Conversion.Amount, txn.Conversion.Currency
+	}
+	return txn.Amount, txn.Currency
 }
 
 type TransactionStatus string
@@ -73,11 +164,143 @@ const (
 	StatusPending TransactionStatus = "PENDING"
 	StatusSuccess TransactionStatus = "SUCCESS"
 	StatusFailed  TransactionStatus = "FAILED"
+	// StatusReview holds a transaction flagged by risk screening until it is
+	// reviewed; it has not been sent to a gateway yet.
+	StatusReview TransactionStatus = "REVIEW"
+	// StatusAuthorized is a deposit whose funds the provider reserved, waiting
+	// to be captured or voided.
+	StatusAuthorized TransactionStatus = "AUTHORIZED"
+	// StatusCaptured is an authorization settled for its captured amount.
+	StatusCaptured TransactionStatus = "CAPTURED"
+	// StatusVoided is an authorization released without a capture, by the
+	// merchant or because it expired.
+	StatusVoided TransactionStatus = "VOIDED"
 )
 
+func (status TransactionStatus) Valid() bool {
+	switch status {
+	case StatusPending, StatusSuccess, StatusFailed, StatusReview, StatusAuthorized, StatusCaptured, StatusVoided:
+		return true
+	}
+	return false
+}
+
+// Final reports whether status can no longer change.
+func (status TransactionStatus) Final() bool {
+	switch status {
+	case StatusSuccess, StatusFailed, StatusCaptured, StatusVoided:
+		return true
+	}
+	return false
+}
+
+// Predecessors returns the statuses a transaction can be updated to status
+// from, besides status itself: providers settle PENDING transactions, and
+// authorizations are captured, voided or fail once AUTHORIZED.
+func (status TransactionStatus) Predecessors() []TransactionStatus {
+	switch status {
+	case StatusPending, StatusSuccess, StatusAuthorized:
+		return []TransactionStatus{StatusPending}
+	case StatusFailed:
+		return []TransactionStatus{StatusPending, StatusAuthorized}
+	case StatusCaptured, StatusVoided:
+		return []TransactionStatus{StatusAuthorized}
+	}
+	return nil
+}
+
+// Follows reports whether a transaction in previous can be updated to status.
+func (status TransactionStatus) Follows(previous TransactionStatus) bool {
+	if status == previous {
+		return true
+	}
+	for _, predecessor := range status.Predecessors() {
+		if predecessor == previous {
+			return true
+		}
+	}
+	return false
+}
+
 type Operation string
 
 const (
 	Withdraw Operation = "Withdraw"
 	Deposit  Operation = "Deposit"
 )
+
+func (operation Operation) Valid() bool {
+	switch operation {
+	case Withdraw, Deposit:
+		return true
+	}
+	return false
+}
+
+// TransactionFilter narrows an account's transaction listing. Empty fields match everything.
+// Amount bounds are inclusive; From is inclusive and To exclusive.
+type TransactionFilter struct {
+	Status    TransactionStatus
+	Operation Operation
+	GatewayId string
+	Currency  string
+	MinAmount *decimal.Decimal
+	MaxAmount *decimal.Decimal
+	From      *time.Time
+	To        *time.Time
+}
+
+func (filter TransactionFilter) Matches(txn Transaction) bool {
+	return (filter.Status == "" || txn.Status == filter.Status) &&
+		(filter.Operation == "" || txn.Operation == filter.Operation) &&
+		(filter.GatewayId == "" || txn.GatewayId == filter.GatewayId) &&
+		(filter.Currency == "" || txn.Currency == filter.Currency) &&
+		(filter.MinAmount == nil || txn.Amount.GreaterThanOrEqual(*filter.MinAmount)) &&
+		(filter.MaxAmount == nil || txn.Amount.LessThanOrEqual(*filter.MaxAmount)) &&
+		(filter.From == nil || !txn.Ts.Before(*filter.From)) &&
+		(filter.To == nil || txn.Ts.Before(*filter.To))
+}
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+)
+
+// TransactionCursor is the keyset position of a listing: the (ts, reference_id)
+// of the last transaction already returned.
+type TransactionCursor struct {
+	Ts          time.Time
+	ReferenceId string
+}
+
+// Precedes reports whether txn comes after the cursor in newest-first order.
+func (cursor TransactionCursor) Precedes(txn Transaction) bool {
+	if !txn.Ts.Equal(cursor.Ts) {
+		return txn.Ts.Before(cursor.Ts)
+	}
+	return txn.ReferenceId < cursor.ReferenceId
+}
+
+// PageRequest selects up to Limit transactions following After, or the first
+// page when After is nil.
+type PageRequest struct {
+	Limit int
+	After *TransactionCursor
+}
+
+// Size is Limit clamped to (0, MaxPageSize], defaulting to DefaultPageSize.
+func (page PageRequest) Size() int {
+	switch {
+	case page.Limit <= 0:
+		return DefaultPageSize
+	case page.Limit > MaxPageSize:
+		return MaxPageSize
+	}
+	return page.Limit
+}
+
+// TransactionPage holds one page of a listing. Next is nil on the last page.
+type TransactionPage struct {
+	Transactions []Transaction
+	Next         *TransactionCursor
+}
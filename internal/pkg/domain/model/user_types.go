@@ -1,10 +1,18 @@
 package model
 
+import "github.com/shopspring/decimal"
+
 type ClientRequest struct {
-	Amount    float64 `json:"amount"`
-	Currency  string  `json:"currency"`
-	AccountID string  `json:"account_id"`
-	GatewayID string  `json:"gateway_id"`
+	Amount    decimal.Decimal `json:"amount"`
+	Currency  string          `json:"currency"`
+	AccountID string          `json:"account_id"`
+	GatewayID string          `json:"gateway_id"`
+	// BeneficiaryName is only read from withdrawals.
+	BeneficiaryName string `json:"beneficiary_name"`
+	// AccountCurrency books the transaction to the account in another
+	// currency, converted at the rate locked by FxQuoteId or the current one.
+	AccountCurrency string `json:"account_currency"`
+	FxQuoteId       string `json:"fx_quote_id"`
 }
 
 type GetTransactionRequest struct {
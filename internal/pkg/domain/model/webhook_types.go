@@ -0,0 +1,48 @@
+package model
+
+import "time"
+
+// Webhook event types, part of the public API next to the problem codes.
+const (
+	EventTransactionSucceeded  = "transaction.succeeded"
+	EventTransactionFailed     = "transaction.failed"
+	EventTransactionAuthorized = "transaction.authorized"
+	EventTransactionCaptured   = "transaction.captured"
+	EventTransactionVoided     = "transaction.voided"
+)
+
+// TransactionEventType returns the webhook event announcing that a
+// transaction reached status; statuses without an event return false.
+func TransactionEventType(status TransactionStatus) (string, bool) {
+	switch status {
+	case StatusSuccess:
+		return EventTransactionSucceeded, true
+	case StatusFailed:
+		return EventTransactionFailed, true
+	case StatusAuthorized:
+		return EventTransactionAuthorized, true
+	case StatusCaptured:
+		return EventTransactionCaptured, true
+	case StatusVoided:
+		return EventTransactionVoided, true
+	}
+	return "", false
+}
+
+// WebhookDelivery is a signed event waiting for, or done with, delivery to
+// a merchant's webhook URL. Payload is sent verbatim on every attempt.
+type WebhookDelivery struct {
+	Id             string
+	MerchantId     string
+	ReferenceId    string
+	EventType      string
+	Payload        []byte
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastError      string
+	LastStatusCode int
+	CreatedAt      time.Time
+	DeliveredAt    *time.Time
+	// FailedAt is set on dead letters only.
+	FailedAt *time.Time
+}
@@ -1,8 +1,25 @@
 package gateway
 
-import . "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+import (
+	"context"
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+)
 
 type PaymentGateway interface {
 	ProcessDeposit(req DepositReq, callbackUrl string) (*DepositResponse, error)
 	ProcessWithdrawal(req WithdrawReq, callbackUrl string) (*WithdrawResponse, error)
+	// ProcessAuthorization reserves a deposit for a later capture; its
+	// callback reports AUTHORIZED once the funds are reserved.
+	ProcessAuthorization(req AuthorizeReq, callbackUrl string) (*AuthorizeResponse, error)
+	// ProcessCapture and ProcessVoid settle an authorization synchronously,
+	// their response reports CAPTURED or VOIDED, or FAILED when the provider
+	// declines.
+	ProcessCapture(req CaptureReq) (*CaptureResponse, error)
+	ProcessVoid(req VoidReq) (*VoidResponse, error)
+}
+
+// HealthChecker is implemented by gateways that expose a liveness probe.
+// It is optional: gateways without it are reported as UNKNOWN.
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
 }
@@ -0,0 +1,57 @@
+// Package mock holds what the mock REST and SOAP gateways in cmd share.
+package mock
+
+import (
+	"fmt"
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"sync"
+)
+
+// Authorizations are the authorizations of a mock gateway by reference id,
+// settled once by a capture or void. The zero value is ready to use.
+type Authorizations struct {
+	mu             sync.Mutex
+	authorizations map[string]*authorization
+}
+
+type authorization struct {
+	amount float64
+	status TransactionStatus
+}
+
+// Authorize reserves amount under referenceId until it is settled.
+func (a *Authorizations) Authorize(referenceId string, amount float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.authorizations == nil {
+		a.authorizations = make(map[string]*authorization)
+	}
+	a.authorizations[referenceId] = &authorization{amount: amount, status: StatusAuthorized}
+}
+
+// Settle captures amount of, or voids, the authorization of referenceId and
+// returns the status and message to answer with. Repeating the same
+// settlement is accepted, anything else on a settled or unknown authorization
+// is declined with FAILED.
+func (a *Authorizations) Settle(referenceId string, status TransactionStatus, amount float64) (TransactionStatus, string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	auth, exists := a.authorizations[referenceId]
+	switch {
+	case !exists:
+		return StatusFailed, "unknown authorization"
+	case auth.status == status:
+		return status, "authorization already settled"
+	case auth.status != StatusAuthorized:
+		return StatusFailed, fmt.Sprintf("authorization is already %s", auth.status)
+	case status == StatusCaptured && amount > auth.amount:
+		return StatusFailed, fmt.Sprintf("capture exceeds the authorized %.2f", auth.amount)
+	}
+	auth.status = status
+	if status == StatusCaptured {
+		return status, "capture processed successfully"
+	}
+	return status, "authorization released"
+}
@@ -0,0 +1,27 @@
+package mock
+
+import (
+	"testing"
+
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorizations_SettleOnce(t *testing.T) {
+	var authorizations Authorizations
+	status, _ := authorizations.Settle("ref-1", model.StatusVoided, 0)
+	assert.Equal(t, model.StatusFailed, status, "unknown authorizations are declined")
+
+	authorizations.Authorize("ref-1", 100)
+	status, message := authorizations.Settle("ref-1", model.StatusCaptured, 100.01)
+	assert.Equal(t, model.StatusFailed, status)
+	assert.Equal(t, "capture exceeds the authorized 100.00", message)
+
+	status, _ = authorizations.Settle("ref-1", model.StatusCaptured, 60)
+	assert.Equal(t, model.StatusCaptured, status)
+	status, _ = authorizations.Settle("ref-1", model.StatusCaptured, 60)
+	assert.Equal(t, model.StatusCaptured, status, "repeating the settlement is accepted")
+	status, message = authorizations.Settle("ref-1", model.StatusVoided, 0)
+	assert.Equal(t, model.StatusFailed, status)
+	assert.Equal(t, "authorization is already CAPTURED", message)
+}
@@ -2,12 +2,14 @@ package gateway
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
 	"github.com/dinowar/gateway-service/internal/pkg/util"
 	"go.uber.org/zap"
 	"io"
+	"net/http"
 )
 
 type RestGateway struct {
@@ -77,3 +79,75 @@ func (rg *RestGateway) ProcessWithdrawal(req WithdrawReq, callbackUrl string) (*
 
 	return &withdrawResp, nil
 }
+
+func (rg *RestGateway) HealthCheck(ctx context.Context) error {
+	url := fmt.Sprintf("http://%s/health", rg.BaseURL)
+	req, reqErr := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if reqErr != nil {
+		return reqErr
+	}
+
+	resp, respErr := http.DefaultClient.Do(req)
+	if respErr != nil {
+		return respErr
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check returned status: %s", resp.Status)
+	}
+	return nil
+}
+
+func (rg *RestGateway) ProcessAuthorization(req AuthorizeReq, callbackUrl string) (*AuthorizeResponse, error) {
+	var authorizeResp AuthorizeResponse
+	if callErr := rg.call("authorize", req, callbackUrl, &authorizeResp); callErr != nil {
+		return &AuthorizeResponse{}, callErr
+	}
+	return &authorizeResp, nil
+}
+
+func (rg *RestGateway) ProcessCapture(req CaptureReq) (*CaptureResponse, error) {
+	var captureResp CaptureResponse
+	if callErr := rg.call("capture", req, "", &captureResp); callErr != nil {
+		return &CaptureResponse{}, callErr
+	}
+	return &captureResp, nil
+}
+
+func (rg *RestGateway) ProcessVoid(req VoidReq) (*VoidResponse, error) {
+	var voidResp VoidResponse
+	if callErr := rg.call("void", req, "", &voidResp); callErr != nil {
+		return &VoidResponse{}, callErr
+	}
+	return &voidResp, nil
+}
+
+// call POSTs req as JSON to path and decodes the response into resp.
+func (rg *RestGateway) call(path string, req interface{}, callbackUrl string, resp interface{}) error {
+	url := fmt.Sprintf("http://%s/%s", rg.BaseURL, path)
+	jsonData, marshalErr := json.Marshal(req)
+	if marshalErr != nil {
+		rg.Logger.Error(marshalErr.Error())
+		return marshalErr
+	}
+
+	httpResp, retryErr := util.RetryableRequest(url, "POST", bytes.NewBuffer(jsonData), callbackUrl, "application/json", rg.RetryInterval, rg.RetryElapseTime)
+	if retryErr != nil {
+		rg.Logger.Error("error calling gateway after retries", zap.String("url", url), zap.Error(retryErr))
+		return retryErr
+	}
+	defer httpResp.Body.Close()
+
+	responseBytes, readErr := io.ReadAll(httpResp.Body)
+	if readErr != nil {
+		rg.Logger.Error("http response failed", zap.Error(readErr))
+		return readErr
+	}
+	if decodeErr := json.Unmarshal(responseBytes, resp); decodeErr != nil {
+		rg.Logger.Error(decodeErr.Error(), zap.String("url", url))
+		return decodeErr
+	}
+	return nil
+}
@@ -2,12 +2,14 @@ package gateway
 
 import (
 	"bytes"
+	"context"
 	"encoding/xml"
 	"fmt"
 	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
 	"github.com/dinowar/gateway-service/internal/pkg/util"
 	"go.uber.org/zap"
 	"io"
+	"net/http"
 )
 
 type SoapGateway struct {
@@ -76,3 +78,103 @@ func (sg *SoapGateway) ProcessWithdrawal(req WithdrawReq, callbackUrl string) (*
 
 	return envelope.Body.WithdrawResponse, nil
 }
+
+func (sg *SoapGateway) ProcessAuthorization(req AuthorizeReq, callbackUrl string) (*AuthorizeResponse, error) {
+	envelope, callErr := sg.call(Body{AuthorizeReq: &req}, callbackUrl)
+	if callErr != nil {
+		return &AuthorizeResponse{}, callErr
+	}
+	if envelope.Body.AuthorizeResponse == nil {
+		return &AuthorizeResponse{}, fmt.Errorf("missing authorize response")
+	}
+	return envelope.Body.AuthorizeResponse, nil
+}
+
+func (sg *SoapGateway) ProcessCapture(req CaptureReq) (*CaptureResponse, error) {
+	envelope, callErr := sg.call(Body{CaptureReq: &req}, "")
+	if callErr != nil {
+		return &CaptureResponse{}, callErr
+	}
+	if envelope.Body.CaptureResponse == nil {
+		return &CaptureResponse{}, fmt.Errorf("missing capture response")
+	}
+	return envelope.Body.CaptureResponse, nil
+}
+
+func (sg *SoapGateway) ProcessVoid(req VoidReq) (*VoidResponse, error) {
+	envelope, callErr := sg.call(Body{VoidReq: &req}, "")
+	if callErr != nil {
+		return &VoidResponse{}, callErr
+	}
+	if envelope.Body.VoidResponse == nil {
+		return &VoidResponse{}, fmt.Errorf("missing void response")
+	}
+	return envelope.Body.VoidResponse, nil
+}
+
+// call sends body in a SOAP envelope and returns the envelope answered.
+func (sg *SoapGateway) call(body Body, callbackUrl string) (Envelope, error) {
+	soapReq, marshalErr := xml.MarshalIndent(Envelope{XMLName: xml.Name{}, Body: body}, "", "  ")
+	if marshalErr != nil {
+		sg.Logger.Error("xml marshal failed", zap.Error(marshalErr))
+		return Envelope{}, marshalErr
+	}
+
+	url := fmt.Sprintf("http://%s", sg.Endpoint)
+	resp, retryErr := util.RetryableRequest(url, "POST", bytes.NewBuffer(soapReq), callbackUrl, "text/xml; charset=utf-8", sg.RetryInterval, sg.RetryElapseTime)
+	if retryErr != nil {
+		sg.Logger.Error("error calling gateway after retries", zap.Error(retryErr))
+		return Envelope{}, retryErr
+	}
+	defer resp.Body.Close()
+
+	responseBytes, readErr := io.ReadAll(resp.Body)
+	if readErr != nil {
+		sg.Logger.Error("http response failed", zap.Error(readErr))
+		return Envelope{}, readErr
+	}
+	var envelope Envelope
+	if unmarshalErr := xml.Unmarshal(responseBytes, &envelope); unmarshalErr != nil {
+		sg.Logger.Error("xml unmarshal failed", zap.Error(unmarshalErr))
+		return Envelope{}, unmarshalErr
+	}
+	return envelope, nil
+}
+
+func (sg *SoapGateway) HealthCheck(ctx context.Context) error {
+	soapReq, marshalErr := xml.Marshal(Envelope{Body: Body{PingReq: &PingReq{Echo: "ping"}}})
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	url := fmt.Sprintf("http://%s", sg.Endpoint)
+	req, reqErr := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(soapReq))
+	if reqErr != nil {
+		return reqErr
+	}
+	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+
+	resp, respErr := http.DefaultClient.Do(req)
+	if respErr != nil {
+		return respErr
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ping returned status: %s", resp.Status)
+	}
+
+	responseBytes, readErr := io.ReadAll(resp.Body)
+	if readErr != nil {
+		return readErr
+	}
+	var envelope Envelope
+	unmarshalErr := xml.Unmarshal(responseBytes, &envelope)
+	if unmarshalErr != nil {
+		return unmarshalErr
+	}
+	if envelope.Body.PingResponse == nil || envelope.Body.PingResponse.Status != "OK" {
+		return fmt.Errorf("unexpected ping response")
+	}
+	return nil
+}
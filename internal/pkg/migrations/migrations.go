@@ -0,0 +1,243 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// lockId is the pg_advisory_lock key serializing migrations across replicas.
+const lockId int64 = 7262311801
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// Load returns the embedded migrations ordered by version. Files are named
+// <version>_<name>.up.sql and <version>_<name>.down.sql.
+func Load() ([]Migration, error) {
+	return load(files, "sql")
+}
+
+func load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, readErr := fs.ReadDir(fsys, dir)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(fileName, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s: expected .up.sql or .down.sql suffix", fileName)
+		}
+
+		base := strings.TrimSuffix(fileName, "."+direction+".sql")
+		versionPart, name, found := strings.Cut(base, "_")
+		if !found {
+			return nil, fmt.Errorf("migration %s: expected <version>_<name> prefix", fileName)
+		}
+		version, parseErr := strconv.ParseInt(versionPart, 10, 64)
+		if parseErr != nil {
+			return nil, fmt.Errorf("migration %s: invalid version: %w", fileName, parseErr)
+		}
+
+		content, contentErr := fs.ReadFile(fsys, path.Join(dir, fileName))
+		if contentErr != nil {
+			return nil, contentErr
+		}
+
+		migration, exists := byVersion[version]
+		if !exists {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if migration.Name != name {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, migration.Name, name)
+		}
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, loadErr := Load()
+	if loadErr != nil {
+		return nil, loadErr
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Up applies every pending migration, each in its own transaction.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	lockErr := m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, versionsErr := m.appliedVersions(ctx, conn)
+		if versionsErr != nil {
+			return versionsErr
+		}
+		for _, migration := range m.migrations {
+			if _, done := versions[migration.Version]; done {
+				continue
+			}
+			applyErr := m.apply(ctx, conn, migration.Up,
+				`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, migration.Version, migration.Name)
+			if applyErr != nil {
+				return fmt.Errorf("migration %d_%s up: %w", migration.Version, migration.Name, applyErr)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, lockErr
+}
+
+// Down reverts the last steps applied migrations, newest first.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+	lockErr := m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, versionsErr := m.appliedVersions(ctx, conn)
+		if versionsErr != nil {
+			return versionsErr
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.migrations[i]
+			if _, done := versions[migration.Version]; !done {
+				continue
+			}
+			applyErr := m.apply(ctx, conn, migration.Down,
+				`DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+			if applyErr != nil {
+				return fmt.Errorf("migration %d_%s down: %w", migration.Version, migration.Name, applyErr)
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, lockErr
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	lockErr := m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, versionsErr := m.appliedVersions(ctx, conn)
+		if versionsErr != nil {
+			return versionsErr
+		}
+		for _, migration := range m.migrations {
+			status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+			if appliedAt, done := versions[migration.Version]; done {
+				status.Applied = true
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, lockErr
+}
+
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, connErr := m.db.Conn(ctx)
+	if connErr != nil {
+		return connErr
+	}
+	defer conn.Close()
+
+	if _, lockErr := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockId); lockErr != nil {
+		return fmt.Errorf("acquiring migration lock: %w", lockErr)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockId)
+
+	_, createErr := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    BIGINT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if createErr != nil {
+		return fmt.Errorf("creating schema_migrations: %w", createErr)
+	}
+
+	return fn(conn)
+}
+
+func (m *Migrator) appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, rowsErr := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if rowsErr != nil {
+		return nil, rowsErr
+	}
+	defer rows.Close()
+
+	versions := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if scanErr := rows.Scan(&version, &appliedAt); scanErr != nil {
+			return nil, scanErr
+		}
+		versions[version] = appliedAt
+	}
+	return versions, rows.Err()
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, script string, bookkeeping string, args ...interface{}) error {
+	tx, txErr := conn.BeginTx(ctx, nil)
+	if txErr != nil {
+		return txErr
+	}
+	defer tx.Rollback()
+
+	if _, execErr := tx.ExecContext(ctx, script); execErr != nil {
+		return execErr
+	}
+	if _, execErr := tx.ExecContext(ctx, bookkeeping, args...); execErr != nil {
+		return execErr
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,135 @@
+package migrations
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad_EmbeddedMigrations(t *testing.T) {
+	migrations, loadErr := Load()
+	assert.NoError(t, loadErr)
+	assert.NotEmpty(t, migrations)
+
+	for i, migration := range migrations {
+		assert.Equal(t, int64(i+1), migration.Version, "migration versions must be contiguous")
+		assert.NotEmpty(t, migration.Up)
+		assert.NotEmpty(t, migration.Down)
+	}
+}
+
+func TestLoad_MissingDownFile(t *testing.T) {
+	fsys := fstest.MapFS{
+		"sql/0001_init.up.sql": {Data: []byte("SELECT 1")},
+	}
+
+	_, loadErr := load(fsys, "sql")
+	assert.ErrorContains(t, loadErr, "must have both up and down files")
+}
+
+func TestLoad_InvalidName(t *testing.T) {
+	fsys := fstest.MapFS{
+		"sql/init.up.sql": {Data: []byte("SELECT 1")},
+	}
+
+	_, loadErr := load(fsys, "sql")
+	assert.Error(t, loadErr)
+}
+
+func newTestMigrator(t *testing.T) (*Migrator, sqlmock.Sqlmock) {
+	db, mock, mockErr := sqlmock.New()
+	assert.NoError(t, mockErr)
+	t.Cleanup(func() { db.Close() })
+
+	return &Migrator{
+		db: db,
+		migrations: []Migration{
+			{Version: 1, Name: "first", Up: "CREATE TABLE first", Down: "DROP TABLE first"},
+			{Version: 2, Name: "second", Up: "CREATE TABLE second", Down: "DROP TABLE second"},
+		},
+	}, mock
+}
+
+func expectLock(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(`SELECT pg_advisory_lock`).WithArgs(lockId).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func expectUnlock(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(`SELECT pg_advisory_unlock`).WithArgs(lockId).WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestUp_AppliesOnlyPending(t *testing.T) {
+	migrator, mock := newTestMigrator(t)
+
+	expectLock(mock)
+	mock.ExpectQuery(`SELECT version, applied_at FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}).AddRow(1, time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectExec(`CREATE TABLE second`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO schema_migrations`).WithArgs(int64(2), "second").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	expectUnlock(mock)
+
+	applied, upErr := migrator.Up(context.Background())
+	assert.NoError(t, upErr)
+	assert.Len(t, applied, 1)
+	assert.Equal(t, int64(2), applied[0].Version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUp_RollsBackFailedMigration(t *testing.T) {
+	migrator, mock := newTestMigrator(t)
+
+	expectLock(mock)
+	mock.ExpectQuery(`SELECT version, applied_at FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(`CREATE TABLE first`).WillReturnError(assert.AnError)
+	mock.ExpectRollback()
+	expectUnlock(mock)
+
+	applied, upErr := migrator.Up(context.Background())
+	assert.ErrorContains(t, upErr, "migration 1_first up")
+	assert.Empty(t, applied)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDown_RevertsNewestFirst(t *testing.T) {
+	migrator, mock := newTestMigrator(t)
+
+	expectLock(mock)
+	mock.ExpectQuery(`SELECT version, applied_at FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}).AddRow(1, time.Now()).AddRow(2, time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectExec(`DROP TABLE second`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM schema_migrations`).WithArgs(int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectUnlock(mock)
+
+	reverted, downErr := migrator.Down(context.Background(), 1)
+	assert.NoError(t, downErr)
+	assert.Len(t, reverted, 1)
+	assert.Equal(t, int64(2), reverted[0].Version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStatus(t *testing.T) {
+	migrator, mock := newTestMigrator(t)
+
+	expectLock(mock)
+	mock.ExpectQuery(`SELECT version, applied_at FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}).AddRow(1, time.Now()))
+	expectUnlock(mock)
+
+	statuses, statusErr := migrator.Status(context.Background())
+	assert.NoError(t, statusErr)
+	assert.Len(t, statuses, 2)
+	assert.True(t, statuses[0].Applied)
+	assert.False(t, statuses[1].Applied)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
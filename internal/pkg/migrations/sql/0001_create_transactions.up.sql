@@ -0,0 +1,15 @@
+-- Baseline matching the former dev/init.sql, so databases created by it are adopted as-is.
+CREATE TABLE IF NOT EXISTS transactions (
+    id           TEXT,
+    reference_id TEXT PRIMARY KEY,
+    account_id   TEXT,
+    amount       NUMERIC(10, 2) CHECK (amount >= 0),
+    currency     TEXT,
+    status       TEXT,
+    operation    TEXT,
+    message      TEXT,
+    gateway_id   TEXT,
+    ts           TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_transactions_account_id ON transactions (account_id);
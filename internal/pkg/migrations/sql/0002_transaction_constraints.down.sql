@@ -0,0 +1,10 @@
+ALTER TABLE transactions
+    DROP CONSTRAINT IF EXISTS transactions_operation_check,
+    DROP CONSTRAINT IF EXISTS transactions_status_check,
+    ALTER COLUMN account_id DROP NOT NULL,
+    ALTER COLUMN amount DROP NOT NULL,
+    ALTER COLUMN currency DROP NOT NULL,
+    ALTER COLUMN status DROP NOT NULL,
+    ALTER COLUMN operation DROP NOT NULL,
+    ALTER COLUMN gateway_id DROP NOT NULL,
+    ALTER COLUMN ts DROP NOT NULL;
@@ -0,0 +1,13 @@
+-- reference_id is the primary key, a second index on it only slows down writes.
+DROP INDEX IF EXISTS idx_reference_id;
+
+ALTER TABLE transactions
+    ALTER COLUMN account_id SET NOT NULL,
+    ALTER COLUMN amount SET NOT NULL,
+    ALTER COLUMN currency SET NOT NULL,
+    ALTER COLUMN status SET NOT NULL,
+    ALTER COLUMN operation SET NOT NULL,
+    ALTER COLUMN gateway_id SET NOT NULL,
+    ALTER COLUMN ts SET NOT NULL,
+    ADD CONSTRAINT transactions_status_check CHECK (status IN ('PENDING', 'SUCCESS', 'FAILED')),
+    ADD CONSTRAINT transactions_operation_check CHECK (operation IN ('Deposit', 'Withdraw'));
@@ -0,0 +1,5 @@
+CREATE INDEX IF NOT EXISTS idx_transactions_account_id ON transactions (account_id);
+
+DROP INDEX IF EXISTS idx_transactions_account_operation_ts;
+DROP INDEX IF EXISTS idx_transactions_account_status_ts;
+DROP INDEX IF EXISTS idx_transactions_account_ts;
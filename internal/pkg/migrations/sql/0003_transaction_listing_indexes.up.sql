@@ -0,0 +1,13 @@
+-- Keyset pagination walks (ts, reference_id) newest first within an account.
+-- The plain account index becomes a prefix of the composite one.
+CREATE INDEX IF NOT EXISTS idx_transactions_account_ts
+    ON transactions (account_id, ts DESC, reference_id DESC);
+
+-- The most common filtered listings: by status (e.g. open PENDING payments) and by operation.
+CREATE INDEX IF NOT EXISTS idx_transactions_account_status_ts
+    ON transactions (account_id, status, ts DESC, reference_id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_transactions_account_operation_ts
+    ON transactions (account_id, operation, ts DESC, reference_id DESC);
+
+DROP INDEX IF EXISTS idx_transactions_account_id;
@@ -0,0 +1,26 @@
+CREATE TABLE merchants (
+    id         TEXT PRIMARY KEY,
+    name       TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Only the SHA-256 of a key is stored; prefix is the public part used to find it.
+CREATE TABLE api_keys (
+    id          TEXT PRIMARY KEY,
+    merchant_id TEXT NOT NULL REFERENCES merchants (id),
+    prefix      TEXT NOT NULL UNIQUE,
+    hash        BYTEA NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at  TIMESTAMPTZ
+);
+
+CREATE INDEX idx_api_keys_merchant_id ON api_keys (merchant_id);
+
+-- An account belongs to exactly one merchant.
+CREATE TABLE merchant_accounts (
+    account_id  TEXT PRIMARY KEY,
+    merchant_id TEXT NOT NULL REFERENCES merchants (id),
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_merchant_accounts_merchant_id ON merchant_accounts (merchant_id);
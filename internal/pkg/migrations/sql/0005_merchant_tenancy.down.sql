@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS merchant_settings;
+ALTER TABLE transactions DROP COLUMN IF EXISTS merchant_id;
@@ -0,0 +1,20 @@
+-- Transactions belong to the merchant that created them. Rows created before
+-- merchants existed are adopted by the owner of their account; rows of
+-- accounts nobody owns keep a NULL merchant and are visible to no merchant.
+ALTER TABLE transactions ADD COLUMN merchant_id TEXT REFERENCES merchants (id);
+
+UPDATE transactions t
+SET merchant_id = ma.merchant_id
+FROM merchant_accounts ma
+WHERE ma.account_id = t.account_id;
+
+-- Per-merchant overrides of the service wide gateway configuration.
+-- A NULL enabled_gateways allows every registered gateway.
+CREATE TABLE merchant_settings (
+    merchant_id      TEXT PRIMARY KEY REFERENCES merchants (id),
+    enabled_gateways TEXT[],
+    routing_rules    JSONB NOT NULL DEFAULT '[]',
+    limits           JSONB NOT NULL DEFAULT '[]',
+    webhook_url      TEXT,
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT now()
+);
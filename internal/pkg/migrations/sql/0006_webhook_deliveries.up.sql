@@ -0,0 +1,38 @@
+-- Secret of the HMAC signature on a merchant's webhook deliveries.
+ALTER TABLE merchants ADD COLUMN webhook_secret TEXT;
+
+-- Outbox of webhook events. A row is due while delivered_at is NULL and
+-- next_attempt_at has passed; dispatchers lease rows by moving next_attempt_at.
+CREATE TABLE webhook_deliveries (
+    id               TEXT PRIMARY KEY,
+    merchant_id      TEXT NOT NULL REFERENCES merchants (id),
+    reference_id     TEXT NOT NULL,
+    event_type       TEXT NOT NULL,
+    payload          TEXT NOT NULL,
+    attempts         INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_error       TEXT,
+    last_status_code INTEGER,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+    delivered_at     TIMESTAMPTZ,
+    UNIQUE (reference_id, event_type)
+);
+
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE delivered_at IS NULL;
+
+-- Deliveries that exhausted their attempts, kept until they are redelivered.
+CREATE TABLE webhook_dead_letters (
+    id               TEXT PRIMARY KEY,
+    merchant_id      TEXT NOT NULL REFERENCES merchants (id),
+    reference_id     TEXT NOT NULL,
+    event_type       TEXT NOT NULL,
+    payload          TEXT NOT NULL,
+    attempts         INTEGER NOT NULL,
+    last_error       TEXT,
+    last_status_code INTEGER,
+    created_at       TIMESTAMPTZ NOT NULL,
+    failed_at        TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (reference_id, event_type)
+);
+
+CREATE INDEX idx_webhook_dead_letters_merchant ON webhook_dead_letters (merchant_id, failed_at DESC);
@@ -0,0 +1,18 @@
+-- Announces committed status changes on the transaction_updates channel, so
+-- every replica can push them to its streaming clients. The payload only
+-- identifies the row: NOTIFY payloads are limited to 8000 bytes.
+CREATE FUNCTION notify_transaction_update() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('transaction_updates', json_build_object(
+        'reference_id', NEW.reference_id,
+        'merchant_id', NEW.merchant_id
+    )::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER transactions_notify_update
+    AFTER UPDATE OF status ON transactions
+    FOR EACH ROW
+    WHEN (OLD.status IS DISTINCT FROM NEW.status AND NEW.merchant_id IS NOT NULL)
+    EXECUTE PROCEDURE notify_transaction_update();
@@ -0,0 +1,36 @@
+-- Double-entry ledger. Balances are kept on the accounts and changed only
+-- together with the postings that explain them, in one database transaction.
+CREATE TABLE ledger_accounts (
+    id          BIGSERIAL PRIMARY KEY,
+    merchant_id TEXT NOT NULL REFERENCES merchants (id),
+    type        TEXT NOT NULL CHECK (type IN ('customer', 'gateway')),
+    owner       TEXT NOT NULL,
+    currency    TEXT NOT NULL,
+    balance     NUMERIC NOT NULL DEFAULT 0,
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (merchant_id, type, owner, currency)
+);
+
+-- A reference is booked at most once per kind, e.g. a transaction settles once.
+CREATE TABLE journal_entries (
+    id           TEXT PRIMARY KEY,
+    merchant_id  TEXT NOT NULL REFERENCES merchants (id),
+    reference_id TEXT NOT NULL,
+    kind         TEXT NOT NULL CHECK (kind IN ('deposit', 'withdrawal', 'refund')),
+    currency     TEXT NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (reference_id, kind)
+);
+
+-- id orders the postings of an account, statements page over it.
+CREATE TABLE ledger_postings (
+    id                BIGSERIAL PRIMARY KEY,
+    entry_id          TEXT NOT NULL REFERENCES journal_entries (id),
+    ledger_account_id BIGINT NOT NULL REFERENCES ledger_accounts (id),
+    direction         TEXT NOT NULL CHECK (direction IN ('debit', 'credit')),
+    amount            NUMERIC NOT NULL CHECK (amount > 0),
+    balance_after     NUMERIC NOT NULL
+);
+
+CREATE INDEX idx_ledger_postings_account ON ledger_postings (ledger_account_id, id DESC);
+CREATE INDEX idx_ledger_postings_entry ON ledger_postings (entry_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS funds_holds;
+ALTER TABLE ledger_accounts DROP COLUMN IF EXISTS held;
@@ -0,0 +1,15 @@
+-- Funds reserved by withdrawals in flight. held is the sum of the active holds
+-- of the account and changes only together with them, so the available
+-- balance is balance - held.
+ALTER TABLE ledger_accounts ADD COLUMN held NUMERIC NOT NULL DEFAULT 0 CHECK (held >= 0);
+
+CREATE TABLE funds_holds (
+    id                TEXT PRIMARY KEY,
+    merchant_id       TEXT NOT NULL REFERENCES merchants (id),
+    ledger_account_id BIGINT NOT NULL REFERENCES ledger_accounts (id),
+    reference_id      TEXT NOT NULL UNIQUE,
+    amount            NUMERIC NOT NULL CHECK (amount > 0),
+    status            TEXT NOT NULL CHECK (status IN ('active', 'released', 'captured')),
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at        TIMESTAMPTZ NOT NULL DEFAULT now()
+);
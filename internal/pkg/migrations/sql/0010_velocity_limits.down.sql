@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_transactions_merchant_gateway_ts;
+ALTER TABLE merchant_settings DROP COLUMN IF EXISTS velocity_limits;
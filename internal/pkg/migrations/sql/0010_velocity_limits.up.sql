@@ -0,0 +1,7 @@
+-- Daily and monthly caps per account or gateway, evaluated against the
+-- transactions created in the period.
+ALTER TABLE merchant_settings ADD COLUMN velocity_limits JSONB NOT NULL DEFAULT '[]';
+
+-- Per-gateway totals of a merchant; per-account totals use idx_transactions_account_ts.
+CREATE INDEX IF NOT EXISTS idx_transactions_merchant_gateway_ts
+    ON transactions (merchant_id, gateway_id, ts);
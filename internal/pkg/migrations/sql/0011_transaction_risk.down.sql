@@ -0,0 +1,7 @@
+-- Transactions still waiting for review were never sent to a gateway.
+UPDATE transactions SET status = 'FAILED' WHERE status = 'REVIEW';
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_status_check;
+ALTER TABLE transactions
+    ADD CONSTRAINT transactions_status_check CHECK (status IN ('PENDING', 'SUCCESS', 'FAILED')),
+    DROP COLUMN IF EXISTS risk_decision,
+    DROP COLUMN IF EXISTS risk_reasons;
@@ -0,0 +1,6 @@
+-- Transactions flagged by risk screening wait in REVIEW for manual approval.
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_status_check;
+ALTER TABLE transactions
+    ADD CONSTRAINT transactions_status_check CHECK (status IN ('PENDING', 'SUCCESS', 'FAILED', 'REVIEW')),
+    ADD COLUMN risk_decision TEXT CHECK (risk_decision IN ('allow', 'review', 'deny')),
+    ADD COLUMN risk_reasons TEXT[];
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_transactions_review;
+DROP TABLE IF EXISTS review_decisions;
+DROP TRIGGER IF EXISTS transactions_record_history ON transactions;
+DROP FUNCTION IF EXISTS record_transaction_history();
+DROP TABLE IF EXISTS transaction_history;
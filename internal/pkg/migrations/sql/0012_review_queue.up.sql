@@ -0,0 +1,52 @@
+-- Event history of every transaction: the trigger records creation and status
+-- changes, review decisions are written next to the status change they cause.
+CREATE TABLE transaction_history (
+    sequence     BIGSERIAL PRIMARY KEY,
+    merchant_id  TEXT NOT NULL REFERENCES merchants (id),
+    reference_id TEXT NOT NULL,
+    kind         TEXT NOT NULL CHECK (kind IN ('created', 'status_changed', 'review_approved', 'review_rejected')),
+    status       TEXT NOT NULL,
+    actor        TEXT NOT NULL DEFAULT '',
+    detail       TEXT NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_transaction_history_reference ON transaction_history (reference_id, sequence);
+
+CREATE FUNCTION record_transaction_history() RETURNS trigger AS $$
+BEGIN
+    IF NEW.merchant_id IS NULL THEN
+        RETURN NULL;
+    END IF;
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO transaction_history (merchant_id, reference_id, kind, status, detail)
+        VALUES (NEW.merchant_id, NEW.reference_id, 'created', NEW.status, COALESCE(array_to_string(NEW.risk_reasons, '; '), ''));
+    ELSIF OLD.status IS DISTINCT FROM NEW.status THEN
+        INSERT INTO transaction_history (merchant_id, reference_id, kind, status, detail)
+        VALUES (NEW.merchant_id, NEW.reference_id, 'status_changed', NEW.status, COALESCE(NEW.message, ''));
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER transactions_record_history
+    AFTER INSERT OR UPDATE OF status ON transactions
+    FOR EACH ROW
+    EXECUTE PROCEDURE record_transaction_history();
+
+-- Audit trail of manual reviews, append only.
+CREATE TABLE review_decisions (
+    id           TEXT PRIMARY KEY,
+    merchant_id  TEXT NOT NULL REFERENCES merchants (id),
+    reference_id TEXT NOT NULL REFERENCES transactions (reference_id),
+    outcome      TEXT NOT NULL CHECK (outcome IN ('approved', 'rejected')),
+    reviewer     TEXT NOT NULL,
+    reason       TEXT NOT NULL DEFAULT '',
+    decided_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_review_decisions_decided_at ON review_decisions (decided_at DESC);
+CREATE INDEX idx_review_decisions_reference ON review_decisions (reference_id, decided_at DESC);
+
+-- The review queue, oldest first.
+CREATE INDEX idx_transactions_review ON transactions (ts) WHERE status = 'REVIEW';
@@ -0,0 +1,2 @@
+-- Payee of a withdrawal, screened against the sanctions list.
+ALTER TABLE transactions ADD COLUMN beneficiary_name TEXT;
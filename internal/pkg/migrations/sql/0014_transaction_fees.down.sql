@@ -0,0 +1,17 @@
+-- Fee bookings are dropped together with their postings; the gateway
+-- balances are restored from the postings that remain.
+DELETE FROM ledger_postings WHERE entry_id IN (SELECT id FROM journal_entries WHERE kind = 'fee');
+DELETE FROM journal_entries WHERE kind = 'fee';
+UPDATE ledger_accounts a
+SET balance = COALESCE((SELECT SUM(CASE WHEN p.direction = 'debit' THEN p.amount ELSE -p.amount END)
+                        FROM ledger_postings p WHERE p.ledger_account_id = a.id), 0)
+WHERE a.type = 'gateway';
+DELETE FROM ledger_accounts WHERE type = 'fees';
+
+ALTER TABLE journal_entries DROP CONSTRAINT IF EXISTS journal_entries_kind_check;
+ALTER TABLE journal_entries ADD CONSTRAINT journal_entries_kind_check CHECK (kind IN ('deposit', 'withdrawal', 'refund'));
+
+ALTER TABLE ledger_accounts DROP CONSTRAINT IF EXISTS ledger_accounts_type_check;
+ALTER TABLE ledger_accounts ADD CONSTRAINT ledger_accounts_type_check CHECK (type IN ('customer', 'gateway'));
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS fee;
@@ -0,0 +1,9 @@
+-- Provider fees are stored next to the amount and booked in entries of their
+-- own against a fees account per gateway.
+ALTER TABLE transactions ADD COLUMN fee NUMERIC NOT NULL DEFAULT 0 CHECK (fee >= 0);
+
+ALTER TABLE ledger_accounts DROP CONSTRAINT IF EXISTS ledger_accounts_type_check;
+ALTER TABLE ledger_accounts ADD CONSTRAINT ledger_accounts_type_check CHECK (type IN ('customer', 'gateway', 'fees'));
+
+ALTER TABLE journal_entries DROP CONSTRAINT IF EXISTS journal_entries_kind_check;
+ALTER TABLE journal_entries ADD CONSTRAINT journal_entries_kind_check CHECK (kind IN ('deposit', 'withdrawal', 'refund', 'fee'));
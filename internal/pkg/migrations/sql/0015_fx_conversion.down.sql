@@ -0,0 +1,25 @@
+-- Converted bookings cannot be told apart from the others once the fx
+-- accounts are gone, so the down migration refuses to run while there are any.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM journal_entries WHERE kind = 'fx') THEN
+        RAISE EXCEPTION 'converted transactions are booked, cannot drop fx conversion';
+    END IF;
+END
+$$;
+DELETE FROM ledger_accounts WHERE type = 'fx';
+
+ALTER TABLE journal_entries DROP CONSTRAINT IF EXISTS journal_entries_kind_check;
+ALTER TABLE journal_entries ADD CONSTRAINT journal_entries_kind_check CHECK (kind IN ('deposit', 'withdrawal', 'refund', 'fee'));
+
+ALTER TABLE ledger_accounts DROP CONSTRAINT IF EXISTS ledger_accounts_type_check;
+ALTER TABLE ledger_accounts ADD CONSTRAINT ledger_accounts_type_check CHECK (type IN ('customer', 'gateway', 'fees'));
+
+ALTER TABLE transactions
+    DROP COLUMN IF EXISTS fx_quote_id,
+    DROP COLUMN IF EXISTS fx_source,
+    DROP COLUMN IF EXISTS fx_rate,
+    DROP COLUMN IF EXISTS account_amount,
+    DROP COLUMN IF EXISTS account_currency;
+
+DROP TABLE IF EXISTS fx_quotes;
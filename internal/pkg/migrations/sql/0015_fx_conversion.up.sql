@@ -0,0 +1,26 @@
+-- Exchange rates locked for a merchant until they expire.
+CREATE TABLE fx_quotes (
+    id            TEXT PRIMARY KEY,
+    merchant_id   TEXT NOT NULL REFERENCES merchants (id),
+    from_currency TEXT NOT NULL,
+    to_currency   TEXT NOT NULL,
+    rate          NUMERIC NOT NULL CHECK (rate > 0),
+    source        TEXT NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at    TIMESTAMPTZ NOT NULL
+);
+
+-- Transactions booked to an account in another currency keep the converted
+-- amount with the rate, its source and quote for audit.
+ALTER TABLE transactions
+    ADD COLUMN account_currency TEXT,
+    ADD COLUMN account_amount   NUMERIC CHECK (account_amount > 0),
+    ADD COLUMN fx_rate          NUMERIC CHECK (fx_rate > 0),
+    ADD COLUMN fx_source        TEXT,
+    ADD COLUMN fx_quote_id      TEXT REFERENCES fx_quotes (id);
+
+ALTER TABLE ledger_accounts DROP CONSTRAINT IF EXISTS ledger_accounts_type_check;
+ALTER TABLE ledger_accounts ADD CONSTRAINT ledger_accounts_type_check CHECK (type IN ('customer', 'gateway', 'fees', 'fx'));
+
+ALTER TABLE journal_entries DROP CONSTRAINT IF EXISTS journal_entries_kind_check;
+ALTER TABLE journal_entries ADD CONSTRAINT journal_entries_kind_check CHECK (kind IN ('deposit', 'withdrawal', 'refund', 'fee', 'fx'));
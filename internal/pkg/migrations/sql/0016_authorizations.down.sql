@@ -0,0 +1,11 @@
+-- Captures settle for what they took; authorizations never captured did not
+-- settle at all.
+UPDATE transactions SET status = 'SUCCESS', amount = captured_amount WHERE status = 'CAPTURED';
+UPDATE transactions SET status = 'FAILED' WHERE status IN ('AUTHORIZED', 'VOIDED');
+
+DROP INDEX IF EXISTS idx_transactions_authorized;
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_status_check;
+ALTER TABLE transactions
+    ADD CONSTRAINT transactions_status_check CHECK (status IN ('PENDING', 'SUCCESS', 'FAILED', 'REVIEW')),
+    DROP COLUMN IF EXISTS captured_amount,
+    DROP COLUMN IF EXISTS authorization_expires_at;
@@ -0,0 +1,11 @@
+-- Deposits authorized for a later capture are AUTHORIZED until they are
+-- CAPTURED, for all or part of their amount, or VOIDED, by the merchant or
+-- when the authorization expires.
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_status_check;
+ALTER TABLE transactions
+    ADD CONSTRAINT transactions_status_check
+        CHECK (status IN ('PENDING', 'SUCCESS', 'FAILED', 'REVIEW', 'AUTHORIZED', 'CAPTURED', 'VOIDED')),
+    ADD COLUMN authorization_expires_at TIMESTAMPTZ,
+    ADD COLUMN captured_amount          NUMERIC CHECK (captured_amount > 0 AND captured_amount <= amount);
+
+CREATE INDEX idx_transactions_authorized ON transactions (authorization_expires_at) WHERE status = 'AUTHORIZED';
@@ -0,0 +1,5 @@
+-- A quote converts a single transaction, the one that used it first.
+ALTER TABLE fx_quotes ADD COLUMN used_by TEXT UNIQUE;
+
+UPDATE fx_quotes q
+SET used_by = (SELECT min(reference_id) FROM transactions t WHERE t.fx_quote_id = q.id);
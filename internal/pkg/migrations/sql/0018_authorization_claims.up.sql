@@ -0,0 +1,4 @@
+-- A capture or void claims its authorization until the provider answered, so
+-- concurrent captures and the expiry sweep cannot settle it twice. Claims
+-- left by a request that never finished lapse at authorization_claimed_until.
+ALTER TABLE transactions ADD COLUMN authorization_claimed_until TIMESTAMPTZ;
@@ -0,0 +1 @@
+ALTER TABLE transactions ALTER COLUMN amount TYPE NUMERIC(10, 2) USING round(amount, 2);
@@ -0,0 +1,3 @@
+-- Amounts keep the minor units of their currency, three for BHD, JOD, KWD,
+-- OMR and TND, and are not bounded, like fees and ledger postings.
+ALTER TABLE transactions ALTER COLUMN amount TYPE NUMERIC;
@@ -0,0 +1,3 @@
+-- Refunds are not offered, no entry of kind refund was ever booked.
+ALTER TABLE journal_entries DROP CONSTRAINT IF EXISTS journal_entries_kind_check;
+ALTER TABLE journal_entries ADD CONSTRAINT journal_entries_kind_check CHECK (kind IN ('deposit', 'withdrawal', 'fee', 'fx'));
@@ -0,0 +1,202 @@
+package router
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Middleware wraps the handlers of a group.
+type Middleware func(next http.Handler) http.Handler
+
+// ErrorHandlers answer requests that match no route, or a route without a
+// handler for their method. allowed is sorted and never empty.
+type ErrorHandlers struct {
+	NotFound         func(w http.ResponseWriter, r *http.Request)
+	MethodNotAllowed func(w http.ResponseWriter, r *http.Request, allowed ...string)
+}
+
+// Router dispatches on method and path. Patterns are slash separated
+// segments, where {name} matches any single non-empty segment and is exposed
+// to handlers through r.PathValue(name). A literal segment wins over a
+// parameter at the same position, so /transactions/stream can sit next to
+// /transactions/{reference_id}.
+//
+// Groups share the routing table of their parent and add a path prefix and
+// middleware, which is how one set of handlers is mounted under several API
+// versions.
+type Router struct {
+	table      *table
+	prefix     string
+	middleware []Middleware
+}
+
+type table struct {
+	routes []*route
+	errors ErrorHandlers
+}
+
+type route struct {
+	segments []string
+	handlers map[string]http.Handler
+}
+
+func New(errors ErrorHandlers) *Router {
+	if errors.NotFound == nil {
+		errors.NotFound = http.NotFound
+	}
+	if errors.MethodNotAllowed == nil {
+		errors.MethodNotAllowed = func(w http.ResponseWriter, r *http.Request, allowed ...string) {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	}
+	return &Router{table: &table{errors: errors}}
+}
+
+// Group returns a router registering below prefix, with middleware applied
+// after the middleware of router.
+func (router *Router) Group(prefix string, middleware ...Middleware) *Router {
+	return &Router{
+		table:      router.table,
+		prefix:     router.prefix + strings.TrimSuffix(prefix, "/"),
+		middleware: append(append([]Middleware{}, router.middleware...), middleware...),
+	}
+}
+
+// Handle registers handler for method and pattern. It panics on a duplicate
+// registration, like http.ServeMux.
+func (router *Router) Handle(method, pattern string, handler http.Handler) {
+	for i := len(router.middleware) - 1; i >= 0; i-- {
+		handler = router.middleware[i](handler)
+	}
+
+	segments := split(router.prefix + pattern)
+	target := router.table.find(segments)
+	if target != nil && strings.Join(target.segments, "/") != strings.Join(segments, "/") {
+		panic("router: " + router.prefix + pattern + " conflicts with /" + strings.Join(target.segments, "/"))
+	}
+	if target == nil {
+		target = &route{segments: segments, handlers: make(map[string]http.Handler)}
+		router.table.routes = append(router.table.routes, target)
+	}
+	if _, exists := target.handlers[method]; exists {
+		panic("router: duplicate route " + method + " " + router.prefix + pattern)
+	}
+	target.handlers[method] = handler
+}
+
+func (router *Router) HandleFunc(method, pattern string, handler http.HandlerFunc) {
+	router.Handle(method, pattern, handler)
+}
+
+func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments := split(r.URL.Path)
+	var best *route
+	for _, candidate := range router.table.routes {
+		if candidate.matches(segments) && (best == nil || candidate.moreSpecific(best)) {
+			best = candidate
+		}
+	}
+	if best == nil {
+		router.table.errors.NotFound(w, r)
+		return
+	}
+
+	handler, exists := best.handlers[r.Method]
+	if !exists && r.Method == http.MethodHead {
+		handler, exists = best.handlers[http.MethodGet]
+	}
+	if !exists {
+		router.table.errors.MethodNotAllowed(w, r, best.allowed()...)
+		return
+	}
+
+	for i, segment := range best.segments {
+		if name, isParam := param(segment); isParam {
+			r.SetPathValue(name, segments[i])
+		}
+	}
+	handler.ServeHTTP(w, r)
+}
+
+// find returns the route matching the same paths as segments, whatever its
+// parameter names.
+func (t *table) find(segments []string) *route {
+	for _, existing := range t.routes {
+		if equal(existing.segments, segments) {
+			return existing
+		}
+	}
+	return nil
+}
+
+func (rt *route) matches(segments []string) bool {
+	if len(rt.segments) != len(segments) {
+		return false
+	}
+	for i, segment := range rt.segments {
+		if _, isParam := param(segment); isParam {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if segment != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// moreSpecific reports whether rt has a literal segment at the first
+// position where rt and other differ in kind.
+func (rt *route) moreSpecific(other *route) bool {
+	for i := range rt.segments {
+		_, rtParam := param(rt.segments[i])
+		_, otherParam := param(other.segments[i])
+		if rtParam != otherParam {
+			return otherParam
+		}
+	}
+	return false
+}
+
+func (rt *route) allowed() []string {
+	methods := make([]string, 0, len(rt.handlers)+1)
+	for method := range rt.handlers {
+		methods = append(methods, method)
+	}
+	if _, hasGet := rt.handlers[http.MethodGet]; hasGet {
+		if _, hasHead := rt.handlers[http.MethodHead]; !hasHead {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+func split(path string) []string {
+	return strings.Split(strings.TrimPrefix(path, "/"), "/")
+}
+
+func param(segment string) (string, bool) {
+	if len(segment) > 2 && strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		return segment[1 : len(segment)-1], true
+	}
+	return "", false
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		_, aParam := param(a[i])
+		_, bParam := param(b[i])
+		if aParam != bParam || (!aParam && a[i] != b[i]) {
+			return false
+		}
+	}
+	return true
+}
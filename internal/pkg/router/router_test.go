@@ -0,0 +1,111 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func respond(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}
+}
+
+func serve(router http.Handler, method, target string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(method, target, nil))
+	return recorder
+}
+
+func TestRouter_DispatchesOnMethodAndPath(t *testing.T) {
+	router := New(ErrorHandlers{})
+	router.HandleFunc(http.MethodGet, "/items", respond("list"))
+	router.HandleFunc(http.MethodPost, "/items", respond("create"))
+
+	assert.Equal(t, "list", serve(router, http.MethodGet, "/items").Body.String())
+	assert.Equal(t, "create", serve(router, http.MethodPost, "/items").Body.String())
+	assert.Equal(t, http.StatusNotFound, serve(router, http.MethodGet, "/items/").Code)
+	assert.Equal(t, http.StatusNotFound, serve(router, http.MethodGet, "/other").Code)
+}
+
+func TestRouter_PathParameters(t *testing.T) {
+	router := New(ErrorHandlers{})
+	router.HandleFunc(http.MethodGet, "/accounts/{account_id}/items/{item_id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.PathValue("account_id") + ":" + r.PathValue("item_id")))
+	})
+
+	assert.Equal(t, "ACC1:42", serve(router, http.MethodGet, "/accounts/ACC1/items/42").Body.String())
+	assert.Equal(t, http.StatusNotFound, serve(router, http.MethodGet, "/accounts//items/42").Code)
+}
+
+func TestRouter_LiteralBeatsParameter(t *testing.T) {
+	router := New(ErrorHandlers{})
+	router.HandleFunc(http.MethodGet, "/items/{id}", respond("item"))
+	router.HandleFunc(http.MethodGet, "/items/stream", respond("stream"))
+
+	assert.Equal(t, "stream", serve(router, http.MethodGet, "/items/stream").Body.String())
+	assert.Equal(t, "item", serve(router, http.MethodGet, "/items/streams").Body.String())
+}
+
+func TestRouter_MethodNotAllowed(t *testing.T) {
+	var allowed []string
+	router := New(ErrorHandlers{
+		MethodNotAllowed: func(w http.ResponseWriter, r *http.Request, methods ...string) {
+			allowed = methods
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		},
+	})
+	router.HandleFunc(http.MethodPost, "/items", respond("create"))
+	router.HandleFunc(http.MethodGet, "/items", respond("list"))
+
+	recorder := serve(router, http.MethodDelete, "/items")
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+	assert.Equal(t, []string{http.MethodGet, http.MethodHead, http.MethodPost}, allowed)
+
+	assert.Equal(t, http.StatusOK, serve(router, http.MethodHead, "/items").Code)
+}
+
+func TestRouter_DefaultMethodNotAllowedSetsAllow(t *testing.T) {
+	router := New(ErrorHandlers{})
+	router.HandleFunc(http.MethodPost, "/items", respond("create"))
+
+	recorder := serve(router, http.MethodGet, "/items")
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+	assert.Equal(t, http.MethodPost, recorder.Header().Get("Allow"))
+}
+
+func TestRouter_GroupsSharePrefixAndMiddleware(t *testing.T) {
+	tag := func(value string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("X-Tag", value)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	router := New(ErrorHandlers{})
+	api := router.Group("/api", tag("api"))
+	for _, version := range []string{"v1", "v2"} {
+		api.Group("/"+version, tag(version)).HandleFunc(http.MethodGet, "/items", respond(version))
+	}
+
+	recorder := serve(router, http.MethodGet, "/api/v2/items")
+	assert.Equal(t, "v2", recorder.Body.String())
+	assert.Equal(t, []string{"api", "v2"}, recorder.Header().Values("X-Tag"))
+	assert.Equal(t, "v1", serve(router, http.MethodGet, "/api/v1/items").Body.String())
+	assert.Equal(t, http.StatusNotFound, serve(router, http.MethodGet, "/items").Code)
+}
+
+func TestRouter_RejectsConflictingRoutes(t *testing.T) {
+	router := New(ErrorHandlers{})
+	router.HandleFunc(http.MethodGet, "/items/{id}", respond("item"))
+
+	require.Panics(t, func() { router.HandleFunc(http.MethodGet, "/items/{id}", respond("again")) })
+	require.Panics(t, func() { router.HandleFunc(http.MethodPost, "/items/{item_id}", respond("renamed")) })
+	require.NotPanics(t, func() { router.HandleFunc(http.MethodPost, "/items/{id}", respond("update")) })
+}
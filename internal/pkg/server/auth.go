@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/service"
+	"github.com/dinowar/gateway-service/internal/pkg/util"
+	"net/http"
+	"strings"
+)
+
+type merchantKey struct{}
+
+type reviewerKey struct{}
+
+func WithAuthService(auth *service.AuthService) Option {
+	return func(server *Server) {
+		server.auth = auth
+	}
+}
+
+// Authenticate requires an `Authorization: Bearer <api key>` header and
+// passes the key's merchant on in the request context. Without an
+// AuthService every request is rejected.
+func (server *Server) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme, key, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !strings.EqualFold(scheme, "Bearer") || key == "" || server.auth == nil {
+			server.writeUnauthorized(w, r, NewError(ErrUnauthorized, CodeUnauthenticated, "an API key is required as Authorization: Bearer <key>"))
+			return
+		}
+
+		merchant, authErr := server.auth.Authenticate(strings.TrimSpace(key))
+		if authErr != nil {
+			server.writeUnauthorized(w, r, authErr)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), merchantKey{}, merchant)))
+	})
+}
+
+// AuthenticateAdmin requires the operator's admin key, see
+// config.ServiceConfig.AdminAPIKey, as a bearer token. Without a configured
+// key every request is rejected.
+func (server *Server) AuthenticateAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme, key, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		reviewer, valid := server.adminKeyOwner(strings.TrimSpace(key))
+		if !strings.EqualFold(scheme, "Bearer") || !valid || reviewer != "" || server.auth == nil {
+			server.writeUnauthorized(w, r, NewError(ErrUnauthorized, CodeUnauthenticated, "the admin API key is required as Authorization: Bearer <key>"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AuthenticateReviewer requires the operator's admin key or a reviewer's key,
+// see config.ServiceConfig.ReviewerAPIKeys, as a bearer token, and passes a
+// reviewer on in the request context. Reviewer keys open the review routes
+// only, the rest of the admin API takes the admin key.
+func (server *Server) AuthenticateReviewer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme, key, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		reviewer, valid := server.adminKeyOwner(strings.TrimSpace(key))
+		if !strings.EqualFold(scheme, "Bearer") || !valid || server.auth == nil {
+			server.writeUnauthorized(w, r, NewError(ErrUnauthorized, CodeUnauthenticated, "the admin API key is required as Authorization: Bearer <key>"))
+			return
+		}
+		if reviewer != "" {
+			r = r.WithContext(context.WithValue(r.Context(), reviewerKey{}, reviewer))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// adminKeyOwner reports whether key is an admin key and names the reviewer it
+// belongs to, which is empty for the operator's shared key. Every configured
+// key is compared so the time taken does not tell which one matched.
+func (server *Server) adminKeyOwner(key string) (string, bool) {
+	if server.config == nil || key == "" {
+		return "", false
+	}
+	valid := server.config.AdminAPIKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(server.config.AdminAPIKey)) == 1
+	owner := ""
+	for reviewer, reviewerKey := range server.config.ReviewerAPIKeys {
+		if reviewerKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(reviewerKey)) == 1 {
+			valid, owner = true, reviewer
+		}
+	}
+	return owner, valid
+}
+
+// reviewer returns the reviewer whose key authenticated r. Review decisions
+// are attributed to it, so the operator's shared key cannot make them.
+func (server *Server) reviewer(r *http.Request) (string, error) {
+	reviewer, exists := r.Context().Value(reviewerKey{}).(string)
+	if !exists {
+		return "", NewError(ErrForbidden, CodeReviewerKeyRequired, "review decisions require a reviewer's key, see GATEWAY_SERVICE_REVIEWER_API_KEYS")
+	}
+	return reviewer, nil
+}
+
+// authenticateCallback requires body to be signed with the callback secret of
+// the gateway named in the request, see util.SignCallback.
+func (server *Server) authenticateCallback(r *http.Request, body []byte) error {
+	secret := server.callbackSecret(r.Header.Get(util.CallbackGatewayHeader))
+	if !util.VerifyCallback(secret, body, r.Header.Get(util.CallbackSignatureHeader)) {
+		return NewError(ErrUnauthorized, CodeInvalidSignature, "callbacks must be signed with the gateway's callback secret in %s", util.CallbackSignatureHeader)
+	}
+	return nil
+}
+
+// callbackSecret returns the callback secret of gatewayId, empty for unknown gateways.
+func (server *Server) callbackSecret(gatewayId string) string {
+	if server.config == nil || gatewayId == "" {
+		return ""
+	}
+	switch gatewayId {
+	case server.config.RestGatewayConfig.GatewayId:
+		return server.config.RestGatewayConfig.CallbackSecret
+	case server.config.SoapGatewayConfig.GatewayId:
+		return server.config.SoapGatewayConfig.CallbackSecret
+	}
+	return ""
+}
+
+func MerchantFromContext(ctx context.Context) (Merchant, bool) {
+	merchant, exists := ctx.Value(merchantKey{}).(Merchant)
+	return merchant, exists
+}
+
+func (server *Server) writeUnauthorized(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="gateway-service"`)
+	server.writeError(w, r, "Authenticate", err)
+}
+
+// merchant returns the authenticated merchant of r. Handlers reached without
+// Authenticate have none and answer 401.
+func (server *Server) merchant(r *http.Request) (Merchant, error) {
+	merchant, exists := MerchantFromContext(r.Context())
+	if !exists || server.auth == nil {
+		return Merchant{}, NewError(ErrUnauthorized, CodeUnauthenticated, "an API key is required as Authorization: Bearer <key>")
+	}
+	return merchant, nil
+}
+
+// authorizeAccount returns the authenticated merchant if it owns accountId.
+func (server *Server) authorizeAccount(r *http.Request, accountId string) (Merchant, error) {
+	merchant, merchantErr := server.merchant(r)
+	if merchantErr != nil {
+		return Merchant{}, merchantErr
+	}
+	owns, ownsErr := server.auth.OwnsAccount(merchant, accountId)
+	if ownsErr != nil {
+		return Merchant{}, ownsErr
+	}
+	if !owns {
+		return Merchant{}, NewError(ErrForbidden, CodeAccountNotOwned, "account %s does not belong to this merchant", accountId)
+	}
+	return merchant, nil
+}
@@ -0,0 +1,136 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticate_RejectsMissingAndInvalidKeys(t *testing.T) {
+	env := newTestEnv(t)
+	routes := env.server.Routes()
+
+	for name, apiKey := range map[string]string{
+		"missing":   "",
+		"malformed": "not-a-key",
+		"unknown":   "gws_0000000000000000_secret",
+		"tampered":  env.apiKey + "x",
+	} {
+		t.Run(name, func(t *testing.T) {
+			recorder := route(routes, http.MethodPost, "/v1/deposit", apiKey, depositBody)
+			require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			assert.Equal(t, `Bearer realm="gateway-service"`, recorder.Header().Get("WWW-Authenticate"))
+			assert.Equal(t, model.CodeUnauthenticated, decodeProblem(t, recorder).Code)
+		})
+	}
+	assert.Empty(t, env.gateway.deposits, "unauthenticated requests must not reach the gateway")
+}
+
+func TestAuthenticate_RevokedKey(t *testing.T) {
+	env := newTestEnv(t)
+	merchant, createErr := env.auth.CreateMerchant("revoked")
+	require.NoError(t, createErr)
+	require.NoError(t, env.auth.ClaimAccount(merchant, "ACC999"))
+	apiKey, key, issueErr := env.auth.IssueAPIKey(merchant.Id)
+	require.NoError(t, issueErr)
+	routes := env.server.Routes()
+	body := map[string]interface{}{"amount": "5", "currency": "USD", "account_id": "ACC999", "gateway_id": "rest"}
+
+	require.Equal(t, http.StatusOK, route(routes, http.MethodPost, "/v1/deposit", apiKey, body).Code)
+	require.NoError(t, env.auth.RevokeAPIKey(key.Id))
+	assert.Equal(t, http.StatusUnauthorized, route(routes, http.MethodPost, "/v1/deposit", apiKey, body).Code)
+}
+
+func TestAuthenticate_PublicRoutes(t *testing.T) {
+	env := newTestEnv(t)
+	referenceId := env.deposit(t, "ACC123")
+	routes := env.server.Routes()
+
+	assert.Equal(t, http.StatusOK, route(routes, http.MethodGet, "/healthz", "", nil).Code)
+
+	recorder := postCallback(routes, model.CallbackPayload{ReferenceId: referenceId, Status: string(model.StatusSuccess)})
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	recorder = route(routes, http.MethodGet, "/transactions", "", model.GetTransactionsRequest{AccountId: "ACC123"})
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestCallback_RejectsUnsignedCallbacks(t *testing.T) {
+	env := newTestEnv(t)
+	referenceId := env.deposit(t, "ACC123")
+	routes := env.server.Routes()
+	body, _ := json.Marshal(model.CallbackPayload{ReferenceId: referenceId, Status: string(model.StatusSuccess)})
+
+	for name, sign := range map[string]func(req *http.Request){
+		"unsigned": func(req *http.Request) {},
+		"wrong secret": func(req *http.Request) {
+			req.Header.Set(util.CallbackGatewayHeader, "rest")
+			req.Header.Set(util.CallbackSignatureHeader, util.SignCallback("not-the-rest-callback-secret-0123456789", body))
+		},
+		"unknown gateway": func(req *http.Request) {
+			req.Header.Set(util.CallbackGatewayHeader, "soap")
+			req.Header.Set(util.CallbackSignatureHeader, util.SignCallback(testCallbackSecret, body))
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/callback", bytes.NewReader(body))
+			sign(req)
+			recorder := httptest.NewRecorder()
+			routes.ServeHTTP(recorder, req)
+
+			require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			assert.Equal(t, model.CodeInvalidSignature, decodeProblem(t, recorder).Code)
+		})
+	}
+
+	stored, getErr := env.rep.GetTransaction(env.merchant.Id, referenceId)
+	require.NoError(t, getErr)
+	assert.Equal(t, model.StatusPending, stored.Status)
+	assert.Empty(t, getBalance(t, routes, env.apiKey, "ACC123").Balances, "nothing is booked")
+}
+
+func TestAccountOwnership(t *testing.T) {
+	env := newTestEnv(t)
+	referenceId := env.deposit(t, "ACC123")
+	other := env.newMerchant(t, "other")
+	routes := env.server.Routes()
+
+	recorder := route(routes, http.MethodPost, "/v1/withdraw", other, depositBody)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Equal(t, model.CodeAccountNotOwned, decodeProblem(t, recorder).Code)
+	assert.Empty(t, env.gateway.withdrawals)
+
+	recorder = route(routes, http.MethodGet, "/v1/transactions/"+referenceId, other, nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Equal(t, model.CodeTransactionNotFound, decodeProblem(t, recorder).Code)
+
+	recorder = route(routes, http.MethodGet, "/v1/accounts/ACC123/transactions", other, nil)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = route(routes, http.MethodGet, "/transaction", other, model.GetTransactionRequest{ReferenceId: referenceId})
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	// using an account does not make it the merchant's, it has to be assigned
+	otherDeposit := map[string]interface{}{"amount": "5", "currency": "USD", "account_id": "ACC999", "gateway_id": "rest"}
+	recorder = route(routes, http.MethodPost, "/v1/deposit", other, otherDeposit)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Equal(t, model.CodeAccountNotOwned, decodeProblem(t, recorder).Code)
+	recorder = route(routes, http.MethodGet, "/v1/accounts/ACC999/transactions", other, nil)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+
+	otherMerchant, authErr := env.auth.Authenticate(other)
+	require.NoError(t, authErr)
+	require.NoError(t, env.auth.ClaimAccount(otherMerchant, "ACC999"))
+	recorder = route(routes, http.MethodPost, "/v1/deposit", other, otherDeposit)
+	created := decodeTransaction(t, recorder)
+
+	assert.Equal(t, http.StatusOK, route(routes, http.MethodGet, "/v1/transactions/"+created.ReferenceId, other, nil).Code)
+	assert.Equal(t, http.StatusNotFound, route(routes, http.MethodGet, "/v1/transactions/"+created.ReferenceId, env.apiKey, nil).Code)
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	gateways "github.com/dinowar/gateway-service/internal/pkg/gateway"
+	"github.com/dinowar/gateway-service/internal/pkg/service"
+	"github.com/dinowar/gateway-service/internal/pkg/validation"
+	"github.com/shopspring/decimal"
+	"net/http"
+)
+
+func WithAuthorizationService(authorizations *service.AuthorizationService) Option {
+	return func(server *Server) {
+		server.authorizations = authorizations
+	}
+}
+
+// expiredAuthorizationMessage is the message of authorizations voided because
+// they lapsed.
+const expiredAuthorizationMessage = "authorization expired"
+
+// CaptureRequest is the optional body of a capture. Without an amount the
+// whole authorized amount is captured.
+type CaptureRequest struct {
+	Amount *decimal.Decimal `json:"amount"`
+}
+
+// HandleAuthorize serves POST /authorize, a deposit the provider only
+// reserves until it is captured or voided, or its authorization lapses.
+func (server *Server) HandleAuthorize(w http.ResponseWriter, r *http.Request) {
+	server.deposit(w, r, "HandleAuthorize", true)
+}
+
+// HandleCaptureTransaction serves POST /transactions/{reference_id}/capture,
+// taking all or part of an authorized deposit. The provider answers at once;
+// a declined capture leaves the authorization as it was.
+func (server *Server) HandleCaptureTransaction(w http.ResponseWriter, r *http.Request) {
+	var req CaptureRequest
+	if r.ContentLength != 0 {
+		if decodeErr := validation.DecodeJSON(w, r, &req, server.maxBodyBytes()); decodeErr != nil {
+			server.writeError(w, r, "HandleCaptureTransaction", decodeErr)
+			return
+		}
+	}
+
+	merchant, merchantErr := server.merchant(r)
+	if merchantErr != nil {
+		server.writeError(w, r, "HandleCaptureTransaction", merchantErr)
+		return
+	}
+	txn, gateway, claimErr := server.claimAuthorization(merchant, r.PathValue("reference_id"))
+	if claimErr != nil {
+		server.writeError(w, r, "HandleCaptureTransaction", claimErr)
+		return
+	}
+	captured, captureErr := server.capture(merchant.Settings, txn, gateway, req.Amount)
+	if captureErr != nil {
+		server.releaseAuthorization("HandleCaptureTransaction", txn)
+		server.writeError(w, r, "HandleCaptureTransaction", captureErr)
+		return
+	}
+	server.settleAuthorization(w, r, "HandleCaptureTransaction", captured)
+}
+
+// capture takes amount of the claimed authorization txn at gateway, all of it
+// when amount is nil, and prices it by settings.
+func (server *Server) capture(settings MerchantSettings, txn Transaction, gateway gateways.PaymentGateway, requested *decimal.Decimal) (Transaction, error) {
+	if checkErr := server.authorizations.CheckCapture(txn); checkErr != nil {
+		return txn, checkErr
+	}
+	amount := txn.Amount
+	if requested != nil {
+		amount = *requested
+		v := &validation.Validator{}
+		if v.PositiveAmount("amount", amount) && v.AmountPrecision("amount", amount, txn.Currency) && amount.GreaterThan(txn.Amount) {
+			v.Add("amount", validation.CodeOutOfRange, "amount must not exceed the authorized %s", formatAmount(txn.Amount, txn.Currency))
+		}
+		if validationErr := v.Err(); validationErr != nil {
+			return txn, validationErr
+		}
+	}
+
+	resp, gatewayErr := gateway.ProcessCapture(CaptureReq{
+		ReferenceID:   txn.ReferenceId,
+		TransactionID: txn.Id,
+		Amount:        amount.InexactFloat64(),
+		Currency:      txn.Currency,
+	})
+	if gatewayErr != nil {
+		return txn, NewError(ErrInternal, CodeGatewayError, "error capturing authorization").Wrap(gatewayErr)
+	}
+	if resp.Status != StatusCaptured {
+		return txn, NewError(ErrUnprocessable, CodeGatewayError, "the gateway declined the capture: %s", resp.Message)
+	}
+
+	txn.Status = StatusCaptured
+	txn.Message = resp.Message
+	txn.Authorization.Captured = amount
+	// the fee of the authorization was priced on its whole amount
+	settled := txn
+	settled.Amount = txn.SettledAmount()
+	txn.Fee = server.fees.Calculate(settings, settled)
+	return txn, nil
+}
+
+// HandleVoidTransaction serves POST /transactions/{reference_id}/void,
+// releasing an authorized deposit without taking any of it.
+func (server *Server) HandleVoidTransaction(w http.ResponseWriter, r *http.Request) {
+	merchant, merchantErr := server.merchant(r)
+	if merchantErr != nil {
+		server.writeError(w, r, "HandleVoidTransaction", merchantErr)
+		return
+	}
+	txn, gateway, claimErr := server.claimAuthorization(merchant, r.PathValue("reference_id"))
+	if claimErr != nil {
+		server.writeError(w, r, "HandleVoidTransaction", claimErr)
+		return
+	}
+	voided, voidErr := server.void(txn, gateway)
+	if voidErr != nil {
+		server.releaseAuthorization("HandleVoidTransaction", txn)
+		server.writeError(w, r, "HandleVoidTransaction", voidErr)
+		return
+	}
+	server.settleAuthorization(w, r, "HandleVoidTransaction", voided)
+}
+
+// void releases the claimed authorization txn at gateway.
+func (server *Server) void(txn Transaction, gateway gateways.PaymentGateway) (Transaction, error) {
+	if checkErr := server.authorizations.CheckVoid(txn); checkErr != nil {
+		return txn, checkErr
+	}
+	resp, gatewayErr := gateway.ProcessVoid(VoidReq{ReferenceID: txn.ReferenceId, TransactionID: txn.Id})
+	if gatewayErr != nil {
+		return txn, NewError(ErrInternal, CodeGatewayError, "error voiding authorization").Wrap(gatewayErr)
+	}
+	if resp.Status != StatusVoided {
+		return txn, NewError(ErrUnprocessable, CodeGatewayError, "the gateway declined the void: %s", resp.Message)
+	}
+
+	txn.Status = StatusVoided
+	txn.Message = resp.Message
+	return txn, nil
+}
+
+// claimAuthorization claims the authorization referenceId of merchant and
+// returns it with the gateway that authorized it. The claim keeps concurrent
+// captures, voids and the expiry sweep from reaching the provider for the
+// same authorization.
+func (server *Server) claimAuthorization(merchant Merchant, referenceId string) (Transaction, gateways.PaymentGateway, error) {
+	txn, claimErr := server.authorizations.Claim(merchant.Id, referenceId)
+	if claimErr != nil {
+		return Transaction{}, nil, claimErr
+	}
+	gateway, exists := server.gateways[txn.GatewayId]
+	if !exists {
+		server.releaseAuthorization("claimAuthorization", txn)
+		return Transaction{}, nil, NewError(ErrInternal, CodeGatewayError, "gateway %s is not registered", txn.GatewayId)
+	}
+	return txn, gateway, nil
+}
+
+// releaseAuthorization gives up the claim on txn. A claim that cannot be
+// released lapses on its own.
+func (server *Server) releaseAuthorization(operation string, txn Transaction) {
+	if releaseErr := server.authorizations.Release(txn); releaseErr != nil {
+		server.logger.LogError(operation+": error releasing authorization "+txn.ReferenceId, releaseErr)
+	}
+}
+
+// settleAuthorization stores the capture or void the provider accepted and
+// answers with it, see storeSettlement.
+func (server *Server) settleAuthorization(w http.ResponseWriter, r *http.Request, operation string, txn Transaction) {
+	if storeErr := server.storeSettlement(operation, &txn); storeErr != nil {
+		server.writeError(w, r, operation, storeErr)
+		return
+	}
+	server.writeJSON(w, operation, http.StatusOK, representation(r).Transaction(txn))
+}
+
+// storeSettlement stores the capture or void the provider accepted, books it
+// and notifies the merchant. The provider settled the authorization already,
+// so booking and publishing errors are only logged.
+func (server *Server) storeSettlement(operation string, txn *Transaction) error {
+	if trxErr := server.rep.UpdateTransaction(txn); trxErr != nil {
+		return trxErr
+	}
+	if bookErr := server.bookTransaction(*txn); bookErr != nil {
+		server.logger.LogError(operation+": error booking "+txn.ReferenceId, bookErr)
+	}
+	if publishErr := server.publishTransactionEvent(*txn); publishErr != nil {
+		server.logger.LogError(operation+": error publishing event of "+txn.ReferenceId, publishErr)
+	}
+	server.logger.LogInfo("authorization settled", "reference_id", txn.ReferenceId, "status", string(txn.Status))
+	return nil
+}
+
+// ExpireAuthorization voids the lapsed authorization txn, claimed by the
+// expiry sweep, at its gateway and stores it with expiredAuthorizationMessage,
+// see service.AuthorizationService.Run. The authorization stays AUTHORIZED
+// when the gateway does not void it.
+func (server *Server) ExpireAuthorization(txn Transaction) error {
+	gateway, exists := server.gateways[txn.GatewayId]
+	if !exists {
+		return NewError(ErrInternal, CodeGatewayError, "gateway %s is not registered", txn.GatewayId)
+	}
+	voided, voidErr := server.void(txn, gateway)
+	if voidErr != nil {
+		return voidErr
+	}
+	voided.Message = expiredAuthorizationMessage
+	return server.storeSettlement("ExpireAuthorization", &voided)
+}
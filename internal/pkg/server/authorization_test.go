@@ -0,0 +1,204 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dinowar/gateway-service/internal/pkg/config"
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/server"
+	"github.com/dinowar/gateway-service/internal/pkg/service"
+	"github.com/dinowar/gateway-service/internal/pkg/validation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// authorize authorizes amount on ACC123 and answers its callback with AUTHORIZED.
+func (env *testEnv) authorize(t *testing.T, routes http.Handler, amount float64) server.TransactionResponse {
+	t.Helper()
+
+	created := decodeTransaction(t, route(routes, http.MethodPost, "/v1/authorize", env.apiKey, map[string]interface{}{
+		"amount":     amount,
+		"currency":   "USD",
+		"account_id": "ACC123",
+		"gateway_id": "rest",
+	}))
+	callback := model.CallbackPayload{ReferenceId: created.ReferenceId, TransactionId: "auth-" + created.ReferenceId, Status: string(model.StatusAuthorized)}
+	require.Equal(t, http.StatusOK, postCallback(routes, callback).Code)
+	return created
+}
+
+func TestAuthorization_PartialCapture(t *testing.T) {
+	env := newTestEnv(t)
+	routes := env.server.Routes()
+
+	created := env.authorize(t, routes, 100)
+	assert.Equal(t, model.StatusPending, created.Status)
+	require.NotNil(t, created.Authorization)
+	assert.NotEmpty(t, created.Authorization.ExpiresAt)
+	assert.Empty(t, getBalance(t, routes, env.apiKey, "ACC123").Balances, "authorizations are not booked")
+
+	capture := "/v1/transactions/" + created.ReferenceId + "/capture"
+	recorder := route(routes, http.MethodPost, capture, env.apiKey, map[string]interface{}{"amount": 100.01})
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, validation.CodeOutOfRange, fieldCode(decodeProblem(t, recorder), "amount"))
+
+	captured := decodeTransaction(t, route(routes, http.MethodPost, capture, env.apiKey, map[string]interface{}{"amount": 60}))
+	assert.Equal(t, model.StatusCaptured, captured.Status)
+	assert.Equal(t, "100.00", captured.Amount)
+	assert.Equal(t, "60.00", captured.Authorization.CapturedAmount)
+	require.Len(t, env.gateway.captures, 1)
+	assert.Equal(t, "auth-"+created.ReferenceId, env.gateway.captures[0].TransactionID)
+
+	balance := getBalance(t, routes, env.apiKey, "ACC123")
+	require.Len(t, balance.Balances, 1)
+	assert.Equal(t, "60.00", balance.Balances[0].Balance, "only the captured amount is booked")
+
+	recorder = route(routes, http.MethodPost, capture, env.apiKey, nil)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+	assert.Equal(t, model.CodeNotAuthorized, decodeProblem(t, recorder).Code, "authorizations are captured once")
+	recorder = route(routes, http.MethodPost, "/v1/transactions/"+created.ReferenceId+"/void", env.apiKey, nil)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+}
+
+func TestAuthorization_CaptureWholeAndVoid(t *testing.T) {
+	env := newTestEnv(t)
+	routes := env.server.Routes()
+
+	whole := env.authorize(t, routes, 25.5)
+	captured := decodeTransaction(t, route(routes, http.MethodPost, "/v1/transactions/"+whole.ReferenceId+"/capture", env.apiKey, nil))
+	assert.Equal(t, "25.50", captured.Authorization.CapturedAmount, "without an amount the whole authorization is captured")
+
+	voided := env.authorize(t, routes, 40)
+	env.gateway.declined = true
+	recorder := route(routes, http.MethodPost, "/v1/transactions/"+voided.ReferenceId+"/void", env.apiKey, nil)
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	assert.Equal(t, model.CodeGatewayError, decodeProblem(t, recorder).Code)
+
+	env.gateway.declined = false
+	released := decodeTransaction(t, route(routes, http.MethodPost, "/v1/transactions/"+voided.ReferenceId+"/void", env.apiKey, nil))
+	assert.Equal(t, model.StatusVoided, released.Status)
+	require.Len(t, env.gateway.voids, 1)
+
+	balance := getBalance(t, routes, env.apiKey, "ACC123")
+	require.Len(t, balance.Balances, 1)
+	assert.Equal(t, "25.50", balance.Balances[0].Balance)
+}
+
+func TestAuthorization_ClaimedWhileTheProviderAnswers(t *testing.T) {
+	env := newTestEnv(t)
+	routes := env.server.Routes()
+
+	created := env.authorize(t, routes, 100)
+	stored, getErr := env.rep.GetTransaction(env.merchant.Id, created.ReferenceId)
+	require.NoError(t, getErr)
+	expiresAt := time.Now().Add(time.Second)
+	stored.Authorization.ExpiresAt = &expiresAt
+	require.NoError(t, env.rep.SaveTransaction(&stored))
+
+	capture := "/v1/transactions/" + created.ReferenceId + "/capture"
+	env.gateway.settling = func(referenceId string) {
+		env.gateway.settling = nil
+		recorder := route(routes, http.MethodPost, capture, env.apiKey, map[string]interface{}{"amount": 30})
+		require.Equal(t, http.StatusConflict, recorder.Code)
+		assert.Equal(t, model.CodeAuthorizationInProgress, decodeProblem(t, recorder).Code, "a second capture waits for the first")
+		recorder = route(routes, http.MethodPost, "/v1/transactions/"+created.ReferenceId+"/void", env.apiKey, nil)
+		require.Equal(t, http.StatusConflict, recorder.Code)
+		assert.Equal(t, model.CodeAuthorizationInProgress, decodeProblem(t, recorder).Code)
+
+		now := time.Now().Add(time.Minute)
+		expired, expireErr := env.rep.ClaimExpiredAuthorizations(now, now.Add(time.Minute), 10)
+		require.NoError(t, expireErr)
+		assert.Empty(t, expired, "the sweep leaves authorizations being captured alone")
+	}
+
+	captured := decodeTransaction(t, route(routes, http.MethodPost, capture, env.apiKey, map[string]interface{}{"amount": 60}))
+	assert.Equal(t, model.StatusCaptured, captured.Status)
+	assert.Equal(t, "60.00", captured.Authorization.CapturedAmount)
+	require.Len(t, env.gateway.captures, 1)
+
+	declined := env.authorize(t, routes, 40)
+	env.gateway.declined = true
+	recorder := route(routes, http.MethodPost, "/v1/transactions/"+declined.ReferenceId+"/capture", env.apiKey, nil)
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	env.gateway.declined = false
+	decodeTransaction(t, route(routes, http.MethodPost, "/v1/transactions/"+declined.ReferenceId+"/capture", env.apiKey, nil))
+}
+
+func TestAuthorization_OnlyAuthorizedTransactions(t *testing.T) {
+	env := newTestEnv(t)
+	routes := env.server.Routes()
+
+	deposit := env.deposit(t, "ACC123")
+	recorder := route(routes, http.MethodPost, "/v1/transactions/"+deposit+"/capture", env.apiKey, nil)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+	assert.Equal(t, model.CodeNotAuthorized, decodeProblem(t, recorder).Code)
+
+	created := decodeTransaction(t, route(routes, http.MethodPost, "/v1/authorize", env.apiKey, depositBody))
+	recorder = route(routes, http.MethodPost, "/v1/transactions/"+created.ReferenceId+"/void", env.apiKey, nil)
+	require.Equal(t, http.StatusConflict, recorder.Code, "the provider has not confirmed the authorization yet")
+
+	other := env.newMerchant(t, "globex")
+	recorder = route(routes, http.MethodPost, "/v1/transactions/"+created.ReferenceId+"/void", other, nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	callback := model.CallbackPayload{ReferenceId: created.ReferenceId, Status: string(model.StatusCaptured)}
+	recorder = postCallback(routes, callback)
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	assert.Equal(t, model.CodeUnknownStatus, decodeProblem(t, recorder).Code, "captures are answered synchronously")
+
+	env.gateway.err = errors.New("connection refused")
+	recorder = route(routes, http.MethodPost, "/v1/authorize", env.apiKey, depositBody)
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.Equal(t, model.CodeGatewayError, decodeProblem(t, recorder).Code)
+}
+
+func TestAuthorization_Expiry(t *testing.T) {
+	env := newTestEnv(t)
+	receiver := &webhookReceiver{status: http.StatusOK}
+	env.subscribe(t, receiver)
+	routes := env.server.Routes()
+
+	created := env.authorize(t, routes, 100)
+	stored, getErr := env.rep.GetTransaction(env.merchant.Id, created.ReferenceId)
+	require.NoError(t, getErr)
+	lapsed := time.Now().Add(-time.Minute)
+	stored.Authorization.ExpiresAt = &lapsed
+	require.NoError(t, env.rep.SaveTransaction(&stored))
+
+	recorder := route(routes, http.MethodPost, "/v1/transactions/"+created.ReferenceId+"/capture", env.apiKey, nil)
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	assert.Equal(t, model.CodeAuthorizationExpired, decodeProblem(t, recorder).Code)
+	assert.Empty(t, env.gateway.captures)
+
+	authorizations := service.NewAuthorizationService(env.rep, service.NewLogService(zap.NewNop()), config.AuthorizationConfig{})
+	env.gateway.declined = true
+	expired, expireErr := authorizations.ExpireDue(env.server.ExpireAuthorization)
+	require.NoError(t, expireErr)
+	assert.Zero(t, expired)
+	kept := decodeTransaction(t, route(routes, http.MethodGet, "/v1/transactions/"+created.ReferenceId, env.apiKey, nil))
+	assert.Equal(t, model.StatusAuthorized, kept.Status, "the provider still holds the funds")
+
+	env.gateway.declined = false
+	require.NoError(t, env.rep.ReleaseAuthorization(created.ReferenceId))
+	expired, expireErr = authorizations.ExpireDue(env.server.ExpireAuthorization)
+	require.NoError(t, expireErr)
+	assert.Equal(t, 1, expired)
+	require.Len(t, env.gateway.voids, 1, "the provider releases the funds")
+	assert.Equal(t, "auth-"+created.ReferenceId, env.gateway.voids[0].TransactionID)
+
+	voided := decodeTransaction(t, route(routes, http.MethodGet, "/v1/transactions/"+created.ReferenceId, env.apiKey, nil))
+	assert.Equal(t, model.StatusVoided, voided.Status)
+	assert.Equal(t, "authorization expired", voided.Message)
+
+	assert.Equal(t, 2, env.webhooks.Dispatch(context.Background()))
+	require.Len(t, receiver.received, 2)
+	var event server.WebhookEvent
+	require.NoError(t, json.Unmarshal(receiver.received[1].body, &event))
+	assert.Equal(t, model.EventTransactionVoided, event.Type)
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/service"
+	"github.com/dinowar/gateway-service/internal/pkg/validation"
+	"net/http"
+)
+
+func WithFeeService(fees *service.FeeService) Option {
+	return func(server *Server) {
+		server.fees = fees
+	}
+}
+
+// MerchantFees are the fee rules overriding the service's fee schedule for
+// one merchant. A PUT replaces them.
+type MerchantFees struct {
+	Fees []FeeRule `json:"fees"`
+}
+
+func newMerchantFees(settings MerchantSettings) MerchantFees {
+	fees := MerchantFees{Fees: settings.Fees}
+	if fees.Fees == nil {
+		fees.Fees = []FeeRule{}
+	}
+	return fees
+}
+
+// HandleGetMerchantFees serves GET /admin/merchants/{merchant_id}/fees.
+func (server *Server) HandleGetMerchantFees(w http.ResponseWriter, r *http.Request) {
+	merchant, getErr := server.auth.GetMerchant(r.PathValue("merchant_id"))
+	if getErr != nil {
+		server.writeError(w, r, "HandleGetMerchantFees", getErr)
+		return
+	}
+	server.writeJSON(w, "HandleGetMerchantFees", http.StatusOK, newMerchantFees(merchant.Settings))
+}
+
+// HandlePutMerchantFees serves PUT /admin/merchants/{merchant_id}/fees,
+// replacing the merchant's fee rules and keeping the rest of its settings.
+// Transactions created before keep the fee they were priced with.
+func (server *Server) HandlePutMerchantFees(w http.ResponseWriter, r *http.Request) {
+	var fees MerchantFees
+	if decodeErr := validation.DecodeJSON(w, r, &fees, server.maxBodyBytes()); decodeErr != nil {
+		server.writeError(w, r, "HandlePutMerchantFees", decodeErr)
+		return
+	}
+
+	merchant, getErr := server.auth.GetMerchant(r.PathValue("merchant_id"))
+	if getErr != nil {
+		server.writeError(w, r, "HandlePutMerchantFees", getErr)
+		return
+	}
+
+	settings := merchant.Settings
+	settings.Fees = fees.Fees
+	validationErr := validation.ValidateMerchantSettings(settings, func(gatewayId string) bool {
+		_, exists := server.gateways[gatewayId]
+		return exists
+	})
+	if validationErr != nil {
+		server.writeError(w, r, "HandlePutMerchantFees", validationErr)
+		return
+	}
+	if configureErr := server.auth.ConfigureMerchant(merchant.Id, settings); configureErr != nil {
+		server.writeError(w, r, "HandlePutMerchantFees", configureErr)
+		return
+	}
+	server.writeJSON(w, "HandlePutMerchantFees", http.StatusOK, newMerchantFees(settings))
+}
@@ -0,0 +1,119 @@
+package server_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/server"
+	"github.com/dinowar/gateway-service/internal/pkg/service"
+	"github.com/dinowar/gateway-service/internal/pkg/validation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withTestFees prices USD through "rest" at 0.30 plus 2.9%.
+func withTestFees(t *testing.T) server.Option {
+	t.Helper()
+
+	schedule, parseErr := service.ParseFeeSchedule(`[{"currency":"USD","gateway_id":"rest","fixed":"0.30","percent":"2.9"}]`)
+	require.NoError(t, parseErr)
+	return server.WithFeeService(service.NewFeeService(schedule))
+}
+
+func TestFees_PricedAtRequestTime(t *testing.T) {
+	env := newTestEnv(t, withTestFees(t))
+	routes := env.server.Routes()
+
+	created := decodeTransaction(t, route(routes, http.MethodPost, "/v1/deposit", env.apiKey, depositBody))
+	assert.Equal(t, "100.50", created.Amount)
+	assert.Equal(t, "3.21", created.Fee)
+
+	recorder := route(routes, http.MethodPut, "/admin/merchants/"+env.merchant.Id+"/fees", testAdminKey, map[string]interface{}{
+		"fees": []map[string]interface{}{{"operation": "Deposit", "currency": "USD", "percent": "1", "min": "2"}},
+	})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	overridden := decodeTransaction(t, route(routes, http.MethodPost, "/v1/deposit", env.apiKey, map[string]interface{}{
+		"amount": 100, "currency": "USD", "account_id": "ACC123", "gateway_id": "rest",
+	}))
+	assert.Equal(t, "2.00", overridden.Fee, "the merchant's rule comes first")
+
+	stored := decodeTransaction(t, route(routes, http.MethodGet, "/v1/transactions/"+created.ReferenceId, env.apiKey, nil))
+	assert.Equal(t, "3.21", stored.Fee, "stored transactions keep their fee")
+
+	env.fund(t, "ACC123", "USD", "50")
+	withdrawal := decodeTransaction(t, route(routes, http.MethodPost, "/v1/withdraw", env.apiKey, map[string]interface{}{
+		"amount": 10, "currency": "USD", "account_id": "ACC123", "gateway_id": "rest",
+	}))
+	assert.Equal(t, "0.59", withdrawal.Fee, "the schedule prices what the merchant's rules do not")
+}
+
+func TestFees_PartialCapturePricedAtCapture(t *testing.T) {
+	env := newTestEnv(t, withTestFees(t))
+	routes := env.server.Routes()
+
+	created := env.authorize(t, routes, 100)
+	assert.Equal(t, "3.20", created.Fee)
+
+	captured := decodeTransaction(t, route(routes, http.MethodPost, "/v1/transactions/"+created.ReferenceId+"/capture", env.apiKey,
+		map[string]interface{}{"amount": 60}))
+	assert.Equal(t, "2.04", captured.Fee, "the fee is priced for the captured amount")
+	stored := decodeTransaction(t, route(routes, http.MethodGet, "/v1/transactions/"+created.ReferenceId, env.apiKey, nil))
+	assert.Equal(t, "2.04", stored.Fee)
+}
+
+func TestFees_StayOffCustomerBalance(t *testing.T) {
+	env := newTestEnv(t, withTestFees(t))
+	routes := env.server.Routes()
+
+	env.settle(t, routes, "deposit", "ACC123", 100.5, model.StatusSuccess)
+
+	balance := getBalance(t, routes, env.apiKey, "ACC123")
+	require.Len(t, balance.Balances, 1)
+	assert.Equal(t, "100.50", balance.Balances[0].Balance)
+}
+
+func TestAdminFees_GetAndPut(t *testing.T) {
+	env := newTestEnv(t)
+	routes := env.server.Routes()
+	target := "/admin/merchants/" + env.merchant.Id + "/fees"
+	env.configure(t, model.MerchantSettings{WebhookURL: "https://acme.example/hooks"})
+
+	recorder := route(routes, http.MethodGet, target, testAdminKey, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"fees":[]}`, recorder.Body.String())
+	require.Equal(t, http.StatusUnauthorized, route(routes, http.MethodGet, target, env.apiKey, nil).Code)
+
+	recorder = route(routes, http.MethodPut, target, testAdminKey, map[string]interface{}{
+		"fees": []map[string]interface{}{{"currency": "EUR", "gateway_id": "rest", "percent": "1.4", "max": "20"}},
+	})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.JSONEq(t, `{"fees":[{"currency":"EUR","gateway_id":"rest","percent":"1.4","max":"20"}]}`,
+		route(routes, http.MethodGet, target, testAdminKey, nil).Body.String())
+
+	merchant, getErr := env.auth.GetMerchant(env.merchant.Id)
+	require.NoError(t, getErr)
+	assert.Equal(t, "https://acme.example/hooks", merchant.Settings.WebhookURL, "other settings are kept")
+}
+
+func TestAdminFees_PutValidation(t *testing.T) {
+	env := newTestEnv(t)
+	routes := env.server.Routes()
+
+	recorder := route(routes, http.MethodPut, "/admin/merchants/"+env.merchant.Id+"/fees", testAdminKey, map[string]interface{}{
+		"fees": []map[string]interface{}{
+			{"currency": "USD", "gateway_id": "paypal", "percent": "150"},
+			{"currency": "USD", "min": "5"},
+		},
+	})
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	problem := decodeProblem(t, recorder)
+	assert.Equal(t, validation.CodeUnknownGateway, fieldCode(problem, "fees[0].gateway_id"))
+	assert.Equal(t, validation.CodeOutOfRange, fieldCode(problem, "fees[0].percent"))
+	assert.Equal(t, validation.CodeRequired, fieldCode(problem, "fees[1]"))
+
+	recorder = route(routes, http.MethodPut, "/admin/merchants/missing/fees", testAdminKey, map[string]interface{}{"fees": []interface{}{}})
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Equal(t, model.CodeMerchantNotFound, decodeProblem(t, recorder).Code)
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/service"
+	"github.com/dinowar/gateway-service/internal/pkg/validation"
+	"net/http"
+	"time"
+)
+
+func WithFxService(fx *service.FxService) Option {
+	return func(server *Server) {
+		server.fx = fx
+	}
+}
+
+// releaseQuote gives back the quote of a transaction rejected before it was
+// accepted. A quote that cannot be released is only logged, the rejection wins.
+func (server *Server) releaseQuote(txn Transaction) {
+	if releaseErr := server.fx.Release(txn); releaseErr != nil {
+		server.logger.LogError("error releasing fx quote of "+txn.ReferenceId, releaseErr)
+	}
+}
+
+type FxQuoteRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// FxQuoteResponse is a rate locked until ExpiresAt. Deposits and withdrawals
+// in From pass QuoteId as fx_quote_id to be booked in To at Rate.
+type FxQuoteResponse struct {
+	QuoteId   string `json:"quote_id"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Rate      string `json:"rate"`
+	Source    string `json:"source"`
+	CreatedAt string `json:"created_at"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+// HandleCreateFxQuote serves POST /fx/quotes, locking the current rate of a
+// currency pair for the authenticated merchant.
+func (server *Server) HandleCreateFxQuote(w http.ResponseWriter, r *http.Request) {
+	var req FxQuoteRequest
+	if decodeErr := validation.DecodeJSON(w, r, &req, server.maxBodyBytes()); decodeErr != nil {
+		server.writeError(w, r, "HandleCreateFxQuote", decodeErr)
+		return
+	}
+	v := &validation.Validator{}
+	v.Currency("from", req.From)
+	if v.Currency("to", req.To) && req.To == req.From {
+		v.Add("to", validation.CodeInvalidFormat, "to must differ from from")
+	}
+	if validationErr := v.Err(); validationErr != nil {
+		server.writeError(w, r, "HandleCreateFxQuote", validationErr)
+		return
+	}
+
+	merchant, merchantErr := server.merchant(r)
+	if merchantErr != nil {
+		server.writeError(w, r, "HandleCreateFxQuote", merchantErr)
+		return
+	}
+	quote, quoteErr := server.fx.Quote(merchant.Id, req.From, req.To)
+	if quoteErr != nil {
+		server.writeError(w, r, "HandleCreateFxQuote", quoteErr)
+		return
+	}
+	server.writeJSON(w, "HandleCreateFxQuote", http.StatusCreated, newFxQuoteResponse(quote))
+}
+
+func newFxQuoteResponse(quote FxQuote) FxQuoteResponse {
+	return FxQuoteResponse{
+		QuoteId:   quote.Id,
+		From:      quote.From,
+		To:        quote.To,
+		Rate:      quote.Rate.String(),
+		Source:    quote.Source,
+		CreatedAt: quote.CreatedAt.UTC().Format(time.RFC3339Nano),
+		ExpiresAt: quote.ExpiresAt.UTC().Format(time.RFC3339Nano),
+	}
+}
@@ -0,0 +1,193 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/server"
+	"github.com/dinowar/gateway-service/internal/pkg/service"
+	"github.com/dinowar/gateway-service/internal/pkg/validation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withTestFx converts EUR into USD at 1.0907 with quotes of rep held for ttl.
+func withTestFx(t *testing.T, rep *service.MemoryRepositoryService, ttl time.Duration) server.Option {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "rates.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"source": "ECB reference rates",
+		"rates": [{"from": "EUR", "to": "USD", "rate": "1.0907"}]
+	}`), 0o600))
+	rates := service.NewFileRateProvider(path)
+	require.NoError(t, rates.Load())
+
+	return server.WithFxService(service.NewFxService(rates, rep, ttl))
+}
+
+func eurDeposit(extra map[string]interface{}) map[string]interface{} {
+	body := map[string]interface{}{
+		"amount":     100,
+		"currency":   "EUR",
+		"account_id": "ACC123",
+		"gateway_id": "rest",
+	}
+	for key, value := range extra {
+		body[key] = value
+	}
+	return body
+}
+
+func TestFx_DepositBookedInAccountCurrency(t *testing.T) {
+	rep := service.NewMemoryRepositoryService()
+	env := newTestEnvWithRepository(t, rep, withTestFx(t, rep, time.Minute))
+	routes := env.server.Routes()
+
+	created := decodeTransaction(t, route(routes, http.MethodPost, "/v1/deposit", env.apiKey, eurDeposit(map[string]interface{}{"account_currency": "USD"})))
+	assert.Equal(t, "100.00", created.Amount)
+	assert.Equal(t, "EUR", created.Currency)
+	require.NotNil(t, created.Conversion)
+	assert.Equal(t, server.FxConversionResponse{AccountCurrency: "USD", AccountAmount: "109.07", Rate: "1.0907",
+		Source: "ECB reference rates"}, *created.Conversion)
+
+	callback := model.CallbackPayload{ReferenceId: created.ReferenceId, Status: string(model.StatusSuccess)}
+	require.Equal(t, http.StatusOK, postCallback(routes, callback).Code)
+
+	balance := getBalance(t, routes, env.apiKey, "ACC123")
+	require.Len(t, balance.Balances, 1)
+	assert.Equal(t, "USD", balance.Balances[0].Currency)
+	assert.Equal(t, "109.07", balance.Balances[0].Balance)
+
+	recorder := route(routes, http.MethodGet, "/v1/transactions/"+created.ReferenceId, env.apiKey, nil)
+	stored := decodeTransaction(t, recorder)
+	assert.Equal(t, created.Conversion, stored.Conversion, "the applied rate is kept for audit")
+}
+
+func TestFx_QuoteLocksTheRate(t *testing.T) {
+	rep := service.NewMemoryRepositoryService()
+	env := newTestEnvWithRepository(t, rep, withTestFx(t, rep, time.Minute))
+	routes := env.server.Routes()
+
+	recorder := route(routes, http.MethodPost, "/v1/fx/quotes", env.apiKey, map[string]interface{}{"from": "EUR", "to": "USD"})
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	var quote server.FxQuoteResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &quote))
+	assert.Equal(t, "1.0907", quote.Rate)
+	assert.NotEmpty(t, quote.ExpiresAt)
+
+	created := decodeTransaction(t, route(routes, http.MethodPost, "/v1/deposit", env.apiKey, eurDeposit(map[string]interface{}{"fx_quote_id": quote.QuoteId})))
+	require.NotNil(t, created.Conversion)
+	assert.Equal(t, "USD", created.Conversion.AccountCurrency, "the quote implies the account currency")
+	assert.Equal(t, quote.QuoteId, created.Conversion.QuoteId)
+
+	other := env.newMerchant(t, "globex", "ACC999")
+	recorder = route(routes, http.MethodPost, "/v1/deposit", other, eurDeposit(map[string]interface{}{
+		"account_id": "ACC999", "fx_quote_id": quote.QuoteId,
+	}))
+	require.Equal(t, http.StatusNotFound, recorder.Code, "quotes belong to the merchant that asked for them")
+	assert.Equal(t, model.CodeQuoteNotFound, decodeProblem(t, recorder).Code)
+
+	recorder = route(routes, http.MethodPost, "/v1/deposit", env.apiKey, eurDeposit(map[string]interface{}{
+		"fx_quote_id": quote.QuoteId, "account_currency": "GBP",
+	}))
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	assert.Equal(t, model.CodeQuoteMismatch, decodeProblem(t, recorder).Code)
+
+	recorder = route(routes, http.MethodPost, "/v1/deposit", env.apiKey, eurDeposit(map[string]interface{}{"fx_quote_id": quote.QuoteId}))
+	require.Equal(t, http.StatusConflict, recorder.Code, "a quote converts a single transaction")
+	assert.Equal(t, model.CodeQuoteUsed, decodeProblem(t, recorder).Code)
+}
+
+func TestFx_LimitsApplyToTheAccountAmount(t *testing.T) {
+	rep := service.NewMemoryRepositoryService()
+	env := newTestEnvWithRepository(t, rep, withTestFx(t, rep, time.Minute))
+	routes := env.server.Routes()
+	recorder := route(routes, http.MethodPut, "/admin/merchants/"+env.merchant.Id+"/limits", testAdminKey, map[string]interface{}{
+		"limits": []map[string]interface{}{{"currency": "USD", "max": "100"}},
+	})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	recorder = route(routes, http.MethodPost, "/v1/deposit", env.apiKey, eurDeposit(map[string]interface{}{"account_currency": "USD"}))
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code, "100 EUR are booked as 109.07 USD")
+	problem := decodeProblem(t, recorder)
+	assert.Equal(t, model.CodeAmountOutOfLimits, problem.Code)
+	assert.Equal(t, "amount 109.07 USD exceeds the maximum of 100", problem.Detail)
+
+	decodeTransaction(t, route(routes, http.MethodPost, "/v1/deposit", env.apiKey, eurDeposit(map[string]interface{}{"amount": 90, "account_currency": "USD"})))
+}
+
+func TestFx_RejectedTransactionGivesTheQuoteBack(t *testing.T) {
+	rep := service.NewMemoryRepositoryService()
+	env := newTestEnvWithRepository(t, rep, withTestFx(t, rep, time.Minute))
+	routes := env.server.Routes()
+	recorder := route(routes, http.MethodPut, "/admin/merchants/"+env.merchant.Id+"/limits", testAdminKey, map[string]interface{}{
+		"limits": []map[string]interface{}{{"currency": "USD", "max": "100"}},
+	})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	recorder = route(routes, http.MethodPost, "/v1/fx/quotes", env.apiKey, map[string]interface{}{"from": "EUR", "to": "USD"})
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	var quote server.FxQuoteResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &quote))
+
+	recorder = route(routes, http.MethodPost, "/v1/deposit", env.apiKey, eurDeposit(map[string]interface{}{"fx_quote_id": quote.QuoteId}))
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code, recorder.Body.String())
+	assert.Equal(t, model.CodeAmountOutOfLimits, decodeProblem(t, recorder).Code)
+
+	created := decodeTransaction(t, route(routes, http.MethodPost, "/v1/deposit", env.apiKey, eurDeposit(map[string]interface{}{
+		"amount": 90, "fx_quote_id": quote.QuoteId,
+	})))
+	require.NotNil(t, created.Conversion, "the retry is converted with the quote")
+	assert.Equal(t, quote.QuoteId, created.Conversion.QuoteId)
+	assert.Equal(t, "98.16", created.Conversion.AccountAmount)
+}
+
+func TestFx_ExpiredQuoteIsRejected(t *testing.T) {
+	rep := service.NewMemoryRepositoryService()
+	env := newTestEnvWithRepository(t, rep, withTestFx(t, rep, time.Nanosecond))
+	routes := env.server.Routes()
+
+	recorder := route(routes, http.MethodPost, "/v1/fx/quotes", env.apiKey, map[string]interface{}{"from": "EUR", "to": "USD"})
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	var quote server.FxQuoteResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &quote))
+
+	recorder = route(routes, http.MethodPost, "/v1/deposit", env.apiKey, eurDeposit(map[string]interface{}{"fx_quote_id": quote.QuoteId}))
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code, recorder.Body.String())
+	assert.Equal(t, model.CodeQuoteExpired, decodeProblem(t, recorder).Code)
+}
+
+func TestFx_Validation(t *testing.T) {
+	rep := service.NewMemoryRepositoryService()
+	env := newTestEnvWithRepository(t, rep, withTestFx(t, rep, time.Minute))
+	routes := env.server.Routes()
+
+	recorder := route(routes, http.MethodPost, "/v1/fx/quotes", env.apiKey, map[string]interface{}{"from": "EUR", "to": "EUR"})
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, validation.CodeInvalidFormat, fieldCode(decodeProblem(t, recorder), "to"))
+
+	recorder = route(routes, http.MethodPost, "/v1/fx/quotes", env.apiKey, map[string]interface{}{"from": "EUR", "to": "JPY"})
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	assert.Equal(t, model.CodeRateUnavailable, decodeProblem(t, recorder).Code)
+
+	recorder = route(routes, http.MethodPost, "/v1/deposit", env.apiKey, eurDeposit(map[string]interface{}{"account_currency": "XXZ"}))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, validation.CodeUnknownCurrency, fieldCode(decodeProblem(t, recorder), "account_currency"))
+}
+
+func TestFx_DisabledWithoutRates(t *testing.T) {
+	env := newTestEnv(t)
+	routes := env.server.Routes()
+
+	recorder := route(routes, http.MethodPost, "/v1/deposit", env.apiKey, eurDeposit(map[string]interface{}{"account_currency": "USD"}))
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	assert.Equal(t, model.CodeRateUnavailable, decodeProblem(t, recorder).Code)
+
+	created := decodeTransaction(t, route(routes, http.MethodPost, "/v1/deposit", env.apiKey, eurDeposit(map[string]interface{}{"account_currency": "EUR"})))
+	assert.Nil(t, created.Conversion, "the transaction's own currency needs no rate")
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"net/http"
+)
+
+// HandleHealthz reports the last probe results. It answers 200 as long as the
+// process is serving requests, so it is suitable as a liveness probe.
+func (server *Server) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	server.writeHealthReport(w, http.StatusOK)
+}
+
+// HandleReadyz answers 503 while the database or every gateway is down.
+func (server *Server) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	if server.health == nil || !server.health.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+	server.writeHealthReport(w, status)
+}
+
+func (server *Server) writeHealthReport(w http.ResponseWriter, status int) {
+	report := HealthReport{Status: HealthUnknown, Database: ComponentHealth{Status: HealthUnknown}}
+	if server.health != nil {
+		report = server.health.Report()
+	}
+	server.writeJSON(w, "writeHealthReport", status, report)
+}
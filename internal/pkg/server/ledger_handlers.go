@@ -0,0 +1,173 @@
+package server
+
+import (
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/service"
+	"github.com/dinowar/gateway-service/internal/pkg/validation"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func WithLedgerService(ledger *service.LedgerService) Option {
+	return func(server *Server) {
+		server.ledger = ledger
+	}
+}
+
+type BalanceResponse struct {
+	AccountId string            `json:"account_id"`
+	Balances  []CurrencyBalance `json:"balances"`
+}
+
+// CurrencyBalance is the settled balance of an account in one currency. Held
+// is reserved by withdrawals in flight, Available is what is left of Balance.
+type CurrencyBalance struct {
+	Currency  string `json:"currency"`
+	Balance   string `json:"balance"`
+	Held      string `json:"held"`
+	Available string `json:"available"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+type StatementResponse struct {
+	AccountId  string                  `json:"account_id"`
+	Lines      []StatementLineResponse `json:"lines"`
+	NextCursor string                  `json:"next_cursor,omitempty"`
+}
+
+// StatementLineResponse is one booking on an account. Amount is negative for
+// money leaving the account.
+type StatementLineResponse struct {
+	EntryId      string    `json:"entry_id"`
+	ReferenceId  string    `json:"reference_id"`
+	Kind         EntryKind `json:"kind"`
+	Currency     string    `json:"currency"`
+	Amount       string    `json:"amount"`
+	BalanceAfter string    `json:"balance_after"`
+	CreatedAt    string    `json:"created_at"`
+}
+
+// holdFunds reserves the amount of a withdrawal before it is dispatched.
+func (server *Server) holdFunds(txn Transaction) error {
+	if server.ledger == nil {
+		return nil
+	}
+	return server.ledger.HoldWithdrawal(txn)
+}
+
+// releaseFunds returns the hold of a withdrawal that was never stored. A hold
+// that cannot be released is only logged, the storage error wins.
+func (server *Server) releaseFunds(txn Transaction) {
+	if server.ledger == nil {
+		return
+	}
+	if releaseErr := server.ledger.ReleaseHold(txn); releaseErr != nil {
+		server.logger.LogError("error releasing hold of "+txn.ReferenceId, releaseErr)
+	}
+}
+
+// bookTransaction books txn into the ledger once it settled, capturing or
+// releasing the hold of a withdrawal. Booking is idempotent, so a repeated
+// callback books a transaction at most once.
+func (server *Server) bookTransaction(txn Transaction) error {
+	if server.ledger == nil {
+		return nil
+	}
+	return server.ledger.BookTransaction(txn)
+}
+
+// HandleGetAccountBalance serves GET /accounts/{account_id}/balance, the
+// settled balance of the account per currency.
+func (server *Server) HandleGetAccountBalance(w http.ResponseWriter, r *http.Request) {
+	accountId := r.PathValue("account_id")
+	v := &validation.Validator{}
+	v.AccountId("account_id", accountId)
+	if validationErr := v.Err(); validationErr != nil {
+		server.writeError(w, r, "HandleGetAccountBalance", validationErr)
+		return
+	}
+
+	merchant, authErr := server.authorizeAccount(r, accountId)
+	if authErr != nil {
+		server.writeError(w, r, "HandleGetAccountBalance", authErr)
+		return
+	}
+
+	response := BalanceResponse{AccountId: accountId, Balances: []CurrencyBalance{}}
+	if server.ledger != nil {
+		balances, balancesErr := server.ledger.Balances(merchant.Id, accountId)
+		if balancesErr != nil {
+			server.writeError(w, r, "HandleGetAccountBalance", balancesErr)
+			return
+		}
+		for _, balance := range balances {
+			response.Balances = append(response.Balances, CurrencyBalance{
+				Currency:  balance.Currency,
+				Balance:   formatAmount(balance.Balance, balance.Currency),
+				Held:      formatAmount(balance.Held, balance.Currency),
+				Available: formatAmount(balance.Available(), balance.Currency),
+				UpdatedAt: balance.UpdatedAt.UTC().Format(time.RFC3339Nano),
+			})
+		}
+	}
+	server.writeJSON(w, "HandleGetAccountBalance", http.StatusOK, response)
+}
+
+// HandleGetAccountStatement serves GET /accounts/{account_id}/statement, the
+// bookings on the account newest first, one page at a time.
+func (server *Server) HandleGetAccountStatement(w http.ResponseWriter, r *http.Request) {
+	accountId := r.PathValue("account_id")
+	v := &validation.Validator{}
+	v.AccountId("account_id", accountId)
+	query := r.URL.Query()
+	req := StatementRequest{Limit: parseLimit(v, query)}
+	if currency := query.Get("currency"); currency != "" {
+		req.Currency = strings.ToUpper(currency)
+		v.Currency("currency", req.Currency)
+	}
+	req.From = parseTimeParam(v, query, "from")
+	req.To = parseTimeParam(v, query, "to")
+	if req.From != nil && req.To != nil && !req.From.Before(*req.To) {
+		v.Add("to", validation.CodeOutOfRange, "to must be after from")
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		before, valid := decodeStatementCursor(cursor)
+		if !valid {
+			v.Add("cursor", validation.CodeInvalidFormat, "cursor is not a value returned as next_cursor")
+		}
+		req.Before = before
+	}
+	if validationErr := v.Err(); validationErr != nil {
+		server.writeError(w, r, "HandleGetAccountStatement", validationErr)
+		return
+	}
+
+	merchant, authErr := server.authorizeAccount(r, accountId)
+	if authErr != nil {
+		server.writeError(w, r, "HandleGetAccountStatement", authErr)
+		return
+	}
+
+	response := StatementResponse{AccountId: accountId, Lines: []StatementLineResponse{}}
+	if server.ledger != nil {
+		page, statementErr := server.ledger.Statement(merchant.Id, accountId, req)
+		if statementErr != nil {
+			server.writeError(w, r, "HandleGetAccountStatement", statementErr)
+			return
+		}
+		for _, line := range page.Lines {
+			response.Lines = append(response.Lines, StatementLineResponse{
+				EntryId:      line.EntryId,
+				ReferenceId:  line.ReferenceId,
+				Kind:         line.Kind,
+				Currency:     line.Currency,
+				Amount:       formatAmount(line.Amount, line.Currency),
+				BalanceAfter: formatAmount(line.BalanceAfter, line.Currency),
+				CreatedAt:    line.CreatedAt.UTC().Format(time.RFC3339Nano),
+			})
+		}
+		response.NextCursor = encodeStatementCursor(page.Next)
+	}
+	server.writeJSON(w, "HandleGetAccountStatement", http.StatusOK, response)
+}
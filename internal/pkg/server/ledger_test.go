@@ -0,0 +1,177 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/server"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fund books a settled deposit of amount to accountId of the env's merchant,
+// without going through a gateway.
+func (env *testEnv) fund(t *testing.T, accountId, currency, amount string) {
+	t.Helper()
+
+	require.NoError(t, env.auth.ClaimAccount(env.merchant, accountId))
+	require.NoError(t, env.ledger.BookTransaction(model.Transaction{
+		ReferenceId: uuid.NewString(),
+		MerchantId:  env.merchant.Id,
+		AccountId:   accountId,
+		GatewayId:   "rest",
+		Amount:      decimal.RequireFromString(amount),
+		Currency:    currency,
+		Status:      model.StatusSuccess,
+		Operation:   model.Deposit,
+	}))
+}
+
+// settle submits operation for amount on accountId and answers its callback with status.
+func (env *testEnv) settle(t *testing.T, routes http.Handler, operation, accountId string, amount float64, status model.TransactionStatus) string {
+	t.Helper()
+
+	recorder := route(routes, http.MethodPost, "/v1/"+operation, env.apiKey, map[string]interface{}{
+		"amount":     amount,
+		"currency":   "USD",
+		"account_id": accountId,
+		"gateway_id": "rest",
+	})
+	created := decodeTransaction(t, recorder)
+
+	callback := model.CallbackPayload{ReferenceId: created.ReferenceId, Status: string(status)}
+	require.Equal(t, http.StatusOK, postCallback(routes, callback).Code)
+	return created.ReferenceId
+}
+
+func getBalance(t *testing.T, routes http.Handler, apiKey, accountId string) server.BalanceResponse {
+	t.Helper()
+
+	recorder := route(routes, http.MethodGet, "/v1/accounts/"+accountId+"/balance", apiKey, nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var balance server.BalanceResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &balance))
+	return balance
+}
+
+func TestLedger_BooksSettledTransactions(t *testing.T) {
+	env := newTestEnv(t)
+	routes := env.server.Routes()
+
+	env.deposit(t, "ACC123")
+	assert.Empty(t, getBalance(t, routes, env.apiKey, "ACC123").Balances, "pending deposits are not booked")
+
+	deposit := env.settle(t, routes, "deposit", "ACC123", 100.5, model.StatusSuccess)
+	env.settle(t, routes, "withdraw", "ACC123", 40, model.StatusSuccess)
+	env.settle(t, routes, "deposit", "ACC123", 7, model.StatusFailed)
+	repeat := model.CallbackPayload{ReferenceId: deposit, Status: string(model.StatusSuccess)}
+	require.Equal(t, http.StatusOK, postCallback(routes, repeat).Code)
+
+	balance := getBalance(t, routes, env.apiKey, "ACC123")
+	assert.Equal(t, "ACC123", balance.AccountId)
+	require.Len(t, balance.Balances, 1)
+	assert.Equal(t, "USD", balance.Balances[0].Currency)
+	assert.Equal(t, "60.50", balance.Balances[0].Balance, "repeated callbacks book once, failed transactions not at all")
+	assert.NotEmpty(t, balance.Balances[0].UpdatedAt)
+
+	other := env.newMerchant(t, "other")
+	recorder := route(routes, http.MethodGet, "/v1/accounts/ACC123/balance", other, nil)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Equal(t, model.CodeAccountNotOwned, decodeProblem(t, recorder).Code)
+}
+
+func TestLedger_WithdrawalsHoldFunds(t *testing.T) {
+	env := newTestEnv(t)
+	routes := env.server.Routes()
+	withdraw := func(amount string) *httptest.ResponseRecorder {
+		return route(routes, http.MethodPost, "/v1/withdraw", env.apiKey, map[string]interface{}{
+			"amount": amount, "currency": "USD", "account_id": "ACC123", "gateway_id": "rest",
+		})
+	}
+
+	recorder := withdraw("10")
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code, recorder.Body.String())
+	assert.Equal(t, model.CodeInsufficientFunds, decodeProblem(t, recorder).Code)
+	assert.Empty(t, env.gateway.withdrawals, "rejected withdrawals are not dispatched")
+
+	env.fund(t, "ACC123", "USD", "100")
+	recorder = withdraw("60")
+	pending := decodeTransaction(t, recorder)
+
+	balance := getBalance(t, routes, env.apiKey, "ACC123").Balances[0]
+	assert.Equal(t, "100.00", balance.Balance)
+	assert.Equal(t, "60.00", balance.Held)
+	assert.Equal(t, "40.00", balance.Available)
+	assert.Equal(t, http.StatusUnprocessableEntity, withdraw("50").Code, "held funds are not available")
+
+	callback := model.CallbackPayload{ReferenceId: pending.ReferenceId, Status: string(model.StatusFailed)}
+	require.Equal(t, http.StatusOK, postCallback(routes, callback).Code)
+	balance = getBalance(t, routes, env.apiKey, "ACC123").Balances[0]
+	assert.Equal(t, "100.00", balance.Available, "failed withdrawals release their hold")
+
+	env.settle(t, routes, "withdraw", "ACC123", 60, model.StatusSuccess)
+	balance = getBalance(t, routes, env.apiKey, "ACC123").Balances[0]
+	assert.Equal(t, "40.00", balance.Balance, "settled withdrawals turn their hold into a debit")
+	assert.Equal(t, "0.00", balance.Held)
+	assert.Equal(t, "40.00", balance.Available)
+	assert.Len(t, env.gateway.withdrawals, 2)
+}
+
+func TestLedger_Statement(t *testing.T) {
+	env := newTestEnv(t)
+	routes := env.server.Routes()
+	first := env.settle(t, routes, "deposit", "ACC123", 100, model.StatusSuccess)
+	second := env.settle(t, routes, "withdraw", "ACC123", 30, model.StatusSuccess)
+	third := env.settle(t, routes, "deposit", "ACC123", 5.25, model.StatusSuccess)
+
+	recorder := route(routes, http.MethodGet, "/v1/accounts/ACC123/statement?limit=2", env.apiKey, nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var page server.StatementResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &page))
+	require.Len(t, page.Lines, 2)
+	assert.Equal(t, third, page.Lines[0].ReferenceId)
+	assert.Equal(t, "5.25", page.Lines[0].Amount)
+	assert.Equal(t, "75.25", page.Lines[0].BalanceAfter)
+	assert.Equal(t, second, page.Lines[1].ReferenceId)
+	assert.Equal(t, model.EntryWithdrawal, page.Lines[1].Kind)
+	assert.Equal(t, "-30.00", page.Lines[1].Amount)
+	assert.Equal(t, "70.00", page.Lines[1].BalanceAfter)
+	require.NotEmpty(t, page.NextCursor)
+
+	recorder = route(routes, http.MethodGet, "/v1/accounts/ACC123/statement?limit=2&cursor="+page.NextCursor, env.apiKey, nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var last server.StatementResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &last))
+	require.Len(t, last.Lines, 1)
+	assert.Equal(t, first, last.Lines[0].ReferenceId)
+	assert.Equal(t, model.EntryDeposit, last.Lines[0].Kind)
+	assert.Empty(t, last.NextCursor)
+
+	recorder = route(routes, http.MethodGet, "/v1/accounts/ACC123/statement?currency=EUR", env.apiKey, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"account_id":"ACC123","lines":[]}`, recorder.Body.String())
+}
+
+func TestLedger_StatementValidation(t *testing.T) {
+	env := newTestEnv(t)
+	routes := env.server.Routes()
+
+	for query, field := range map[string]string{
+		"?cursor=bogus":   "cursor",
+		"?limit=0":        "limit",
+		"?currency=EURO":  "currency",
+		"?from=yesterday": "from",
+		"?from=2024-10-14T00:00:00Z&to=2024-10-13T00:00:00Z": "to",
+	} {
+		recorder := route(routes, http.MethodGet, "/v1/accounts/ACC123/statement"+query, env.apiKey, nil)
+		require.Equal(t, http.StatusBadRequest, recorder.Code, query)
+		problem := decodeProblem(t, recorder)
+		require.Len(t, problem.Errors, 1, query)
+		assert.Equal(t, field, problem.Errors[0].Field, query)
+	}
+}
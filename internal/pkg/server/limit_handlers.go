@@ -0,0 +1,75 @@
+package server
+
+import (
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/service"
+	"github.com/dinowar/gateway-service/internal/pkg/validation"
+	"net/http"
+)
+
+func WithLimitService(limits *service.LimitService) Option {
+	return func(server *Server) {
+		server.limits = limits
+	}
+}
+
+// MerchantLimits is the part of a merchant's settings managed through the
+// admin API. A PUT replaces both lists.
+type MerchantLimits struct {
+	Limits         []AmountLimit   `json:"limits"`
+	VelocityLimits []VelocityLimit `json:"velocity_limits"`
+}
+
+func newMerchantLimits(settings MerchantSettings) MerchantLimits {
+	limits := MerchantLimits{Limits: settings.Limits, VelocityLimits: settings.VelocityLimits}
+	if limits.Limits == nil {
+		limits.Limits = []AmountLimit{}
+	}
+	if limits.VelocityLimits == nil {
+		limits.VelocityLimits = []VelocityLimit{}
+	}
+	return limits
+}
+
+// HandleGetMerchantLimits serves GET /admin/merchants/{merchant_id}/limits.
+func (server *Server) HandleGetMerchantLimits(w http.ResponseWriter, r *http.Request) {
+	merchant, getErr := server.auth.GetMerchant(r.PathValue("merchant_id"))
+	if getErr != nil {
+		server.writeError(w, r, "HandleGetMerchantLimits", getErr)
+		return
+	}
+	server.writeJSON(w, "HandleGetMerchantLimits", http.StatusOK, newMerchantLimits(merchant.Settings))
+}
+
+// HandlePutMerchantLimits serves PUT /admin/merchants/{merchant_id}/limits,
+// replacing the merchant's limits and keeping the rest of its settings.
+func (server *Server) HandlePutMerchantLimits(w http.ResponseWriter, r *http.Request) {
+	var limits MerchantLimits
+	if decodeErr := validation.DecodeJSON(w, r, &limits, server.maxBodyBytes()); decodeErr != nil {
+		server.writeError(w, r, "HandlePutMerchantLimits", decodeErr)
+		return
+	}
+
+	merchant, getErr := server.auth.GetMerchant(r.PathValue("merchant_id"))
+	if getErr != nil {
+		server.writeError(w, r, "HandlePutMerchantLimits", getErr)
+		return
+	}
+
+	settings := merchant.Settings
+	settings.Limits = limits.Limits
+	settings.VelocityLimits = limits.VelocityLimits
+	validationErr := validation.ValidateMerchantSettings(settings, func(gatewayId string) bool {
+		_, exists := server.gateways[gatewayId]
+		return exists
+	})
+	if validationErr != nil {
+		server.writeError(w, r, "HandlePutMerchantLimits", validationErr)
+		return
+	}
+	if configureErr := server.auth.ConfigureMerchant(merchant.Id, settings); configureErr != nil {
+		server.writeError(w, r, "HandlePutMerchantLimits", configureErr)
+		return
+	}
+	server.writeJSON(w, "HandlePutMerchantLimits", http.StatusOK, newMerchantLimits(settings))
+}
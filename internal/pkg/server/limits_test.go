@@ -0,0 +1,82 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/server"
+	"github.com/dinowar/gateway-service/internal/pkg/validation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminLimits_RequireAdminKey(t *testing.T) {
+	env := newTestEnv(t)
+	routes := env.server.Routes()
+	target := "/admin/merchants/" + env.merchant.Id + "/limits"
+
+	for _, apiKey := range []string{"", env.apiKey, testAdminKey + "x"} {
+		recorder := route(routes, http.MethodGet, target, apiKey, nil)
+		require.Equal(t, http.StatusUnauthorized, recorder.Code, apiKey)
+		assert.Equal(t, model.CodeUnauthenticated, decodeProblem(t, recorder).Code)
+	}
+	assert.Equal(t, http.StatusOK, route(routes, http.MethodGet, target, testAdminKey, nil).Code)
+}
+
+func TestAdminLimits_GetAndPut(t *testing.T) {
+	env := newTestEnv(t)
+	routes := env.server.Routes()
+	target := "/admin/merchants/" + env.merchant.Id + "/limits"
+	env.configure(t, model.MerchantSettings{WebhookURL: "https://acme.example/hooks"})
+
+	recorder := route(routes, http.MethodGet, target, testAdminKey, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"limits":[],"velocity_limits":[]}`, recorder.Body.String())
+
+	limits := map[string]interface{}{
+		"limits": []map[string]interface{}{{"currency": "USD", "gateway_id": "rest", "max": "500"}},
+		"velocity_limits": []map[string]interface{}{
+			{"scope": "account", "period": "daily", "operation": "Deposit", "currency": "USD", "max_amount": "150"},
+		},
+	}
+	recorder = route(routes, http.MethodPut, target, testAdminKey, limits)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var stored server.MerchantLimits
+	require.NoError(t, json.Unmarshal(route(routes, http.MethodGet, target, testAdminKey, nil).Body.Bytes(), &stored))
+	require.Len(t, stored.Limits, 1)
+	assert.Equal(t, "rest", stored.Limits[0].GatewayId)
+	require.Len(t, stored.VelocityLimits, 1)
+	assert.Equal(t, model.PeriodDaily, stored.VelocityLimits[0].Period)
+
+	merchant, getErr := env.auth.GetMerchant(env.merchant.Id)
+	require.NoError(t, getErr)
+	assert.Equal(t, "https://acme.example/hooks", merchant.Settings.WebhookURL, "other settings are kept")
+
+	// the new limits apply to the next requests
+	env.deposit(t, "ACC123")
+	recorder = route(routes, http.MethodPost, "/v1/deposit", env.apiKey, depositBody)
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code, recorder.Body.String())
+	problem := decodeProblem(t, recorder)
+	assert.Equal(t, model.CodeVelocityExceeded, problem.Code)
+	assert.Equal(t, "daily deposit total of account ACC123 would reach 201 USD, above the limit of 150", problem.Detail)
+}
+
+func TestAdminLimits_PutValidation(t *testing.T) {
+	env := newTestEnv(t)
+	routes := env.server.Routes()
+
+	recorder := route(routes, http.MethodPut, "/admin/merchants/"+env.merchant.Id+"/limits", testAdminKey, map[string]interface{}{
+		"limits":          []map[string]interface{}{{"currency": "USD", "gateway_id": "paypal", "max": "5"}},
+		"velocity_limits": []map[string]interface{}{{"scope": "account", "period": "yearly", "currency": "USD", "max_count": 1}},
+	})
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	problem := decodeProblem(t, recorder)
+	assert.Equal(t, validation.CodeUnknownGateway, fieldCode(problem, "limits[0].gateway_id"))
+	assert.Equal(t, validation.CodeInvalidFormat, fieldCode(problem, "velocity_limits[0].period"))
+
+	recorder = route(routes, http.MethodPut, "/admin/merchants/missing/limits", testAdminKey, map[string]interface{}{"limits": []interface{}{}})
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Equal(t, model.CodeMerchantNotFound, decodeProblem(t, recorder).Code)
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"net/http"
+)
+
+const requestIdHeader = "X-Request-Id"
+
+type requestIdKey struct{}
+
+// RequestId propagates the caller's X-Request-Id, or assigns a new one, and
+// echoes it on the response so problem details can be correlated with logs.
+func RequestId(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestId := r.Header.Get(requestIdHeader)
+		if requestId == "" || len(requestId) > 128 {
+			requestId = uuid.NewString()
+		}
+		w.Header().Set(requestIdHeader, requestId)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIdKey{}, requestId)))
+	})
+}
+
+func RequestIdFromContext(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdKey{}).(string)
+	return requestId
+}
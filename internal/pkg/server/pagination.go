@@ -0,0 +1,93 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/validation"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// cursorToken is the JSON behind the opaque cursor handed to clients. Clients
+// must not build cursors themselves, so the layout may change at any time.
+type cursorToken struct {
+	Ts          time.Time `json:"t"`
+	ReferenceId string    `json:"r"`
+}
+
+func encodeCursor(cursor *TransactionCursor) string {
+	if cursor == nil {
+		return ""
+	}
+	token, _ := json.Marshal(cursorToken{Ts: cursor.Ts, ReferenceId: cursor.ReferenceId})
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+func decodeCursor(value string) (*TransactionCursor, bool) {
+	raw, decodeErr := base64.RawURLEncoding.DecodeString(value)
+	if decodeErr != nil {
+		return nil, false
+	}
+	var token cursorToken
+	if unmarshalErr := json.Unmarshal(raw, &token); unmarshalErr != nil || token.ReferenceId == "" || token.Ts.IsZero() {
+		return nil, false
+	}
+	return &TransactionCursor{Ts: token.Ts, ReferenceId: token.ReferenceId}, true
+}
+
+func parsePageRequest(v *validation.Validator, query url.Values) PageRequest {
+	page := PageRequest{Limit: parseLimit(v, query)}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		after, valid := decodeCursor(cursor)
+		if !valid {
+			v.Add("cursor", validation.CodeInvalidFormat, "cursor is not a value returned as next_cursor")
+		}
+		page.After = after
+	}
+
+	return page
+}
+
+func parseLimit(v *validation.Validator, query url.Values) int {
+	limit := query.Get("limit")
+	if limit == "" {
+		return DefaultPageSize
+	}
+	parsed, parseErr := strconv.Atoi(limit)
+	switch {
+	case parseErr != nil:
+		v.Add("limit", validation.CodeInvalidFormat, "limit must be an integer")
+	case parsed < 1 || parsed > MaxPageSize:
+		v.Add("limit", validation.CodeOutOfRange, "limit must be between 1 and %d", MaxPageSize)
+	default:
+		return parsed
+	}
+	return DefaultPageSize
+}
+
+type statementCursorToken struct {
+	Sequence int64 `json:"s"`
+}
+
+func encodeStatementCursor(sequence int64) string {
+	if sequence == 0 {
+		return ""
+	}
+	token, _ := json.Marshal(statementCursorToken{Sequence: sequence})
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+func decodeStatementCursor(value string) (int64, bool) {
+	raw, decodeErr := base64.RawURLEncoding.DecodeString(value)
+	if decodeErr != nil {
+		return 0, false
+	}
+	var token statementCursorToken
+	if unmarshalErr := json.Unmarshal(raw, &token); unmarshalErr != nil || token.Sequence <= 0 {
+		return 0, false
+	}
+	return token.Sequence, true
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"net/http"
+	"strings"
+)
+
+const (
+	problemContentType = "application/problem+json"
+	problemTypePrefix  = "urn:gateway-service:problem:"
+)
+
+// Problem is an RFC 7807 problem details body. Code repeats the last segment
+// of Type so clients can switch on it without parsing URNs.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestId string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+var problemTitles = map[string]string{
+	CodeInvalidRequestBody:      "Invalid request body",
+	CodeRequestTooLarge:         "Request body too large",
+	CodeValidationFailed:        "Request validation failed",
+	CodeGatewayNotFound:         "Gateway not found",
+	CodeMethodNotAllowed:        "Method not allowed",
+	CodeRouteNotFound:           "Route not found",
+	CodeTransactionNotFound:     "Transaction not found",
+	CodeTransactionFinal:        "Transaction already final",
+	CodeNotInReview:             "Transaction not awaiting review",
+	CodeReviewerKeyRequired:     "Reviewer key required",
+	CodeNotAuthorized:           "Transaction not authorized",
+	CodeAuthorizationExpired:    "Authorization expired",
+	CodeAuthorizationInProgress: "Authorization already being settled",
+	CodeUnknownStatus:           "Unknown transaction status",
+	CodeGatewayError:            "Payment gateway error",
+	CodeUnauthenticated:         "Authentication required",
+	CodeInvalidSignature:        "Invalid callback signature",
+	CodeAccountNotOwned:         "Account not owned",
+	CodeAmountOutOfLimits:       "Amount out of limits",
+	CodeInsufficientFunds:       "Insufficient funds",
+	CodeVelocityExceeded:        "Velocity limit exceeded",
+	CodeRiskDenied:              "Declined by risk screening",
+	CodeRateUnavailable:         "Exchange rate unavailable",
+	CodeQuoteNotFound:           "Exchange rate quote not found",
+	CodeQuoteExpired:            "Exchange rate quote expired",
+	CodeQuoteMismatch:           "Exchange rate quote does not match",
+	CodeQuoteUsed:               "Exchange rate quote already used",
+	CodeDeliveryNotFound:        "Webhook delivery not found",
+	CodeInternal:                "Internal server error",
+}
+
+// statusFor maps domain error kinds to HTTP status codes.
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidInput):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, ErrUnprocessable):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrForbidden):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func newProblem(r *http.Request, status int, code, detail string) Problem {
+	title, known := problemTitles[code]
+	if !known {
+		title = http.StatusText(status)
+	}
+	return Problem{
+		Type:      problemTypePrefix + code,
+		Title:     title,
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestId: RequestIdFromContext(r.Context()),
+	}
+}
+
+// writeError answers with the problem details of err. Domain errors carry a
+// client safe message; anything else gets a generic one. Server side failures
+// are logged with their cause.
+func (server *Server) writeError(w http.ResponseWriter, r *http.Request, operation string, err error) {
+	status := statusFor(err)
+	code := CodeInternal
+	detail := "internal server error"
+	var fields []FieldError
+
+	var domainErr *Error
+	if errors.As(err, &domainErr) {
+		detail = domainErr.Message
+		fields = domainErr.Fields
+		if domainErr.Code != "" {
+			code = domainErr.Code
+		}
+	}
+	if status == http.StatusInternalServerError {
+		server.logger.LogError(operation+": %v", err)
+	}
+
+	problem := newProblem(r, status, code, detail)
+	problem.Errors = fields
+	server.writeProblem(w, operation, problem)
+}
+
+func (server *Server) writeMethodNotAllowed(w http.ResponseWriter, r *http.Request, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	server.writeProblem(w, "writeMethodNotAllowed", newProblem(r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "method not allowed"))
+}
+
+func (server *Server) writeNotFound(w http.ResponseWriter, r *http.Request) {
+	server.writeProblem(w, "writeNotFound", newProblem(r, http.StatusNotFound, CodeRouteNotFound, "no route for "+r.URL.Path))
+}
+
+func (server *Server) writeProblem(w http.ResponseWriter, operation string, problem Problem) {
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(problem.Status)
+	encoderErr := json.NewEncoder(w).Encode(problem)
+	if encoderErr != nil {
+		server.logger.LogError(operation+": error encoding problem: %v", encoderErr)
+	}
+}
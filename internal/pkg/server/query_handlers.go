@@ -0,0 +1,200 @@
+package server
+
+import (
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/validation"
+	"github.com/shopspring/decimal"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// setDeprecated marks legacy routes as described in RFC 8594 and the
+// deprecation header draft, pointing clients at the replacement route.
+func setDeprecated(w http.ResponseWriter, successor string) {
+	w.Header().Set("Deprecation", "true")
+	w.Header().Add("Link", "<"+successor+`>; rel="successor-version"`)
+}
+
+// HandleGetTransactionByReference serves GET /transactions/{reference_id}.
+func (server *Server) HandleGetTransactionByReference(w http.ResponseWriter, r *http.Request) {
+	referenceId := r.PathValue("reference_id")
+	v := &validation.Validator{}
+	v.Required("reference_id", referenceId)
+	if validationErr := v.Err(); validationErr != nil {
+		server.writeError(w, r, "HandleGetTransactionByReference", validationErr)
+		return
+	}
+
+	merchant, merchantErr := server.merchant(r)
+	if merchantErr != nil {
+		server.writeError(w, r, "HandleGetTransactionByReference", merchantErr)
+		return
+	}
+
+	transaction, trErr := server.rep.GetTransaction(merchant.Id, referenceId)
+	if trErr != nil {
+		server.writeError(w, r, "HandleGetTransactionByReference", trErr)
+		return
+	}
+
+	server.writeJSON(w, "HandleGetTransactionByReference", http.StatusOK, representation(r).Transaction(transaction))
+}
+
+// TransactionHistoryResponse is the event history of a transaction, oldest
+// first. Reviewer identities stay in the operator's audit trail.
+type TransactionHistoryResponse struct {
+	ReferenceId string                 `json:"reference_id"`
+	Events      []HistoryEventResponse `json:"events"`
+}
+
+type HistoryEventResponse struct {
+	Kind      HistoryEventKind  `json:"kind"`
+	Status    TransactionStatus `json:"status"`
+	Detail    string            `json:"detail,omitempty"`
+	CreatedAt string            `json:"created_at"`
+}
+
+// HandleGetTransactionHistory serves GET /transactions/{reference_id}/events.
+// Transactions created before the history was recorded have no events.
+func (server *Server) HandleGetTransactionHistory(w http.ResponseWriter, r *http.Request) {
+	referenceId := r.PathValue("reference_id")
+	v := &validation.Validator{}
+	v.Required("reference_id", referenceId)
+	if validationErr := v.Err(); validationErr != nil {
+		server.writeError(w, r, "HandleGetTransactionHistory", validationErr)
+		return
+	}
+
+	merchant, merchantErr := server.merchant(r)
+	if merchantErr != nil {
+		server.writeError(w, r, "HandleGetTransactionHistory", merchantErr)
+		return
+	}
+	if _, trErr := server.rep.GetTransaction(merchant.Id, referenceId); trErr != nil {
+		server.writeError(w, r, "HandleGetTransactionHistory", trErr)
+		return
+	}
+
+	events, historyErr := server.rep.GetTransactionHistory(merchant.Id, referenceId)
+	if historyErr != nil {
+		server.writeError(w, r, "HandleGetTransactionHistory", historyErr)
+		return
+	}
+	response := TransactionHistoryResponse{ReferenceId: referenceId, Events: make([]HistoryEventResponse, 0, len(events))}
+	for _, event := range events {
+		response.Events = append(response.Events, HistoryEventResponse{
+			Kind:      event.Kind,
+			Status:    event.Status,
+			Detail:    event.Detail,
+			CreatedAt: event.CreatedAt.UTC().Format(time.RFC3339Nano),
+		})
+	}
+	server.writeJSON(w, "HandleGetTransactionHistory", http.StatusOK, response)
+}
+
+// HandleGetAccountTransactions serves GET /accounts/{account_id}/transactions,
+// one page at a time. Filters and the page size must stay the same while
+// following next_cursor.
+func (server *Server) HandleGetAccountTransactions(w http.ResponseWriter, r *http.Request) {
+	accountId := r.PathValue("account_id")
+	v := &validation.Validator{}
+	v.AccountId("account_id", accountId)
+	query := r.URL.Query()
+	filter := server.parseTransactionFilter(v, query)
+	page := parsePageRequest(v, query)
+	if validationErr := v.Err(); validationErr != nil {
+		server.writeError(w, r, "HandleGetAccountTransactions", validationErr)
+		return
+	}
+
+	merchant, authErr := server.authorizeAccount(r, accountId)
+	if authErr != nil {
+		server.writeError(w, r, "HandleGetAccountTransactions", authErr)
+		return
+	}
+
+	transactions, trErr := server.rep.GetTransactions(merchant.Id, accountId, filter, page)
+	if trErr != nil {
+		server.writeError(w, r, "HandleGetAccountTransactions", trErr)
+		return
+	}
+
+	server.writeJSON(w, "HandleGetAccountTransactions", http.StatusOK, representation(r).TransactionPage(transactions))
+}
+
+func (server *Server) parseTransactionFilter(v *validation.Validator, query url.Values) TransactionFilter {
+	var filter TransactionFilter
+
+	if status := query.Get("status"); status != "" {
+		filter.Status = TransactionStatus(strings.ToUpper(status))
+		if !filter.Status.Valid() {
+			v.Add("status", validation.CodeInvalidFormat, "status must be one of PENDING, SUCCESS, FAILED")
+		}
+	}
+
+	if operation := query.Get("operation"); operation != "" {
+		for _, known := range []Operation{Deposit, Withdraw} {
+			if strings.EqualFold(operation, string(known)) {
+				filter.Operation = known
+			}
+		}
+		if filter.Operation == "" {
+			v.Add("operation", validation.CodeInvalidFormat, "operation must be one of Deposit, Withdraw")
+		}
+	}
+
+	if gatewayId := query.Get("gateway_id"); gatewayId != "" {
+		filter.GatewayId = gatewayId
+		v.Gateway("gateway_id", gatewayId, func(gatewayId string) bool {
+			_, exists := server.gateways[gatewayId]
+			return exists
+		})
+	}
+
+	if currency := query.Get("currency"); currency != "" {
+		filter.Currency = strings.ToUpper(currency)
+		v.Currency("currency", filter.Currency)
+	}
+
+	filter.MinAmount = parseAmountParam(v, query, "min_amount")
+	filter.MaxAmount = parseAmountParam(v, query, "max_amount")
+	if filter.MinAmount != nil && filter.MaxAmount != nil && filter.MinAmount.GreaterThan(*filter.MaxAmount) {
+		v.Add("max_amount", validation.CodeOutOfRange, "max_amount must not be less than min_amount")
+	}
+
+	filter.From = parseTimeParam(v, query, "from")
+	filter.To = parseTimeParam(v, query, "to")
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		v.Add("to", validation.CodeOutOfRange, "to must be after from")
+	}
+
+	return filter
+}
+
+func parseAmountParam(v *validation.Validator, query url.Values, field string) *decimal.Decimal {
+	value := query.Get(field)
+	if value == "" {
+		return nil
+	}
+	amount, parseErr := decimal.NewFromString(value)
+	if parseErr != nil || amount.IsNegative() {
+		v.Add(field, validation.CodeInvalidFormat, "%s must be a non-negative decimal number", field)
+		return nil
+	}
+	return &amount
+}
+
+func parseTimeParam(v *validation.Validator, query url.Values, field string) *time.Time {
+	value := query.Get(field)
+	if value == "" {
+		return nil
+	}
+	ts, parseErr := time.Parse(time.RFC3339, value)
+	if parseErr != nil {
+		v.Add(field, validation.CodeInvalidFormat, "%s must be an RFC 3339 timestamp", field)
+		return nil
+	}
+	return &ts
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"context"
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/router"
+	"github.com/dinowar/gateway-service/internal/pkg/validation"
+	"github.com/shopspring/decimal"
+	"net/http"
+	"time"
+)
+
+// Representation renders transactions in the JSON form of one API version.
+// Handlers are shared by all versions and only differ in the representation
+// Routes puts into the request context.
+type Representation interface {
+	Transaction(txn Transaction) interface{}
+	Transactions(transactions []Transaction) interface{}
+	TransactionPage(page TransactionPage) interface{}
+}
+
+// RepresentationV1 renders TransactionResponse and TransactionPageResponse.
+type RepresentationV1 struct{}
+
+func (RepresentationV1) Transaction(txn Transaction) interface{} {
+	return NewTransactionResponse(txn)
+}
+
+func (RepresentationV1) Transactions(transactions []Transaction) interface{} {
+	return newTransactionResponses(transactions)
+}
+
+func (RepresentationV1) TransactionPage(page TransactionPage) interface{} {
+	return newTransactionPageResponse(page)
+}
+
+type representationKey struct{}
+
+func withRepresentation(representation Representation) router.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), representationKey{}, representation)))
+		})
+	}
+}
+
+// representation falls back to v1 for requests that did not come through Routes.
+func representation(r *http.Request) Representation {
+	if found, exists := r.Context().Value(representationKey{}).(Representation); exists {
+		return found
+	}
+	return RepresentationV1{}
+}
+
+// TransactionResponse is the public JSON form of a transaction, returned by
+// every endpoint that answers with one. model.Transaction stays internal so
+// fields added to it are not published by accident; api/api.yaml documents
+// this type and a test keeps the two in sync.
+type TransactionResponse struct {
+	ReferenceId          string                 `json:"reference_id"`
+	AccountId            string                 `json:"account_id"`
+	GatewayId            string                 `json:"gateway_id"`
+	GatewayTransactionId string                 `json:"gateway_transaction_id,omitempty"`
+	Operation            Operation              `json:"operation"`
+	Status               TransactionStatus      `json:"status"`
+	Amount               string                 `json:"amount"`
+	Fee                  string                 `json:"fee"`
+	Currency             string                 `json:"currency"`
+	Message              string                 `json:"message,omitempty"`
+	BeneficiaryName      string                 `json:"beneficiary_name,omitempty"`
+	Risk                 *RiskResponse          `json:"risk,omitempty"`
+	Conversion           *FxConversionResponse  `json:"conversion,omitempty"`
+	Authorization        *AuthorizationResponse `json:"authorization,omitempty"`
+	CreatedAt            string                 `json:"created_at"`
+}
+
+// RiskResponse is the outcome of risk screening, absent on transactions
+// created without it.
+type RiskResponse struct {
+	Decision RiskDecision `json:"decision"`
+	Reasons  []string     `json:"reasons"`
+}
+
+// FxConversionResponse is the amount a transaction is booked to its account
+// in another currency, with the applied rate and where it came from. Absent
+// on transactions booked in their own currency.
+type FxConversionResponse struct {
+	AccountCurrency string `json:"account_currency"`
+	AccountAmount   string `json:"account_amount"`
+	Rate            string `json:"rate"`
+	Source          string `json:"source"`
+	QuoteId         string `json:"quote_id,omitempty"`
+}
+
+// AuthorizationResponse is when an authorized deposit lapses unless it is
+// captured, and the amount it was captured for. Absent on transactions
+// settled in one step.
+type AuthorizationResponse struct {
+	ExpiresAt      string `json:"expires_at"`
+	CapturedAmount string `json:"captured_amount,omitempty"`
+}
+
+type TransactionPageResponse struct {
+	Transactions []TransactionResponse `json:"transactions"`
+	NextCursor   string                `json:"next_cursor,omitempty"`
+}
+
+// NewTransactionResponse renders amounts with the currency's minor units and
+// timestamps as RFC 3339 in UTC.
+func NewTransactionResponse(txn Transaction) TransactionResponse {
+	return TransactionResponse{
+		ReferenceId:          txn.ReferenceId,
+		AccountId:            txn.AccountId,
+		GatewayId:            txn.GatewayId,
+		GatewayTransactionId: txn.Id,
+		Operation:            txn.Operation,
+		Status:               txn.Status,
+		Amount:               formatAmount(txn.Amount, txn.Currency),
+		Fee:                  formatAmount(txn.Fee, txn.Currency),
+		Currency:             txn.Currency,
+		Message:              txn.Message,
+		BeneficiaryName:      txn.BeneficiaryName,
+		Risk:                 newRiskResponse(txn.Risk),
+		Conversion:           newFxConversionResponse(txn.Conversion),
+		Authorization:        newAuthorizationResponse(txn),
+		CreatedAt:            txn.Ts.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+func newRiskResponse(assessment RiskAssessment) *RiskResponse {
+	if assessment.Decision == "" {
+		return nil
+	}
+	reasons := assessment.Reasons
+	if reasons == nil {
+		reasons = []string{}
+	}
+	return &RiskResponse{Decision: assessment.Decision, Reasons: reasons}
+}
+
+func newFxConversionResponse(conversion FxConversion) *FxConversionResponse {
+	if conversion.Currency == "" {
+		return nil
+	}
+	return &FxConversionResponse{
+		AccountCurrency: conversion.Currency,
+		AccountAmount:   formatAmount(conversion.Amount, conversion.Currency),
+		Rate:            conversion.Rate.String(),
+		Source:          conversion.Source,
+		QuoteId:         conversion.QuoteId,
+	}
+}
+
+func newAuthorizationResponse(txn Transaction) *AuthorizationResponse {
+	if !txn.IsAuthorization() {
+		return nil
+	}
+	response := &AuthorizationResponse{ExpiresAt: txn.Authorization.ExpiresAt.UTC().Format(time.RFC3339Nano)}
+	if txn.Status == StatusCaptured {
+		response.CapturedAmount = formatAmount(txn.Authorization.Captured, txn.Currency)
+	}
+	return response
+}
+
+// formatAmount renders amount with the minor units of currency, if known.
+func formatAmount(amount decimal.Decimal, currency string) string {
+	if units, known := validation.MinorUnits(currency); known {
+		return amount.StringFixed(units)
+	}
+	return amount.String()
+}
+
+func newTransactionResponses(transactions []Transaction) []TransactionResponse {
+	responses := make([]TransactionResponse, 0, len(transactions))
+	for _, txn := range transactions {
+		responses = append(responses, NewTransactionResponse(txn))
+	}
+	return responses
+}
+
+func newTransactionPageResponse(page TransactionPage) TransactionPageResponse {
+	return TransactionPageResponse{
+		Transactions: newTransactionResponses(page.Transactions),
+		NextCursor:   encodeCursor(page.Next),
+	}
+}
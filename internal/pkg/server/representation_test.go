@@ -0,0 +1,165 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/server"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestNewTransactionResponse(t *testing.T) {
+	ts := time.Date(2024, 10, 14, 16, 32, 20, 123000000, time.FixedZone("CEST", 2*60*60))
+	response := server.NewTransactionResponse(model.Transaction{
+		Id:          "provider-1",
+		ReferenceId: "ref-1",
+		AccountId:   "ACC123",
+		GatewayId:   "rest",
+		Amount:      decimal.RequireFromString("100.5"),
+		Currency:    "USD",
+		Status:      model.StatusSuccess,
+		Operation:   model.Deposit,
+		Ts:          ts,
+	})
+
+	body, marshalErr := json.Marshal(response)
+	require.NoError(t, marshalErr)
+	assert.JSONEq(t, `{
+		"reference_id": "ref-1",
+		"account_id": "ACC123",
+		"gateway_id": "rest",
+		"gateway_transaction_id": "provider-1",
+		"operation": "Deposit",
+		"status": "SUCCESS",
+		"amount": "100.50",
+		"fee": "0.00",
+		"currency": "USD",
+		"created_at": "2024-10-14T14:32:20.123Z"
+	}`, string(body))
+
+	response = server.NewTransactionResponse(model.Transaction{Amount: decimal.RequireFromString("5"), Currency: "JPY", Ts: ts})
+	assert.Equal(t, "5", response.Amount)
+}
+
+func TestWriteEndpoints_UseTransactionResponse(t *testing.T) {
+	env := newTestEnv(t)
+	env.fund(t, "ACC123", "EUR", "12.3")
+
+	recorder := env.do(env.server.HandleWithdraw, http.MethodPost, "/withdraw", map[string]interface{}{
+		"amount":     "12.3",
+		"currency":   "EUR",
+		"account_id": "ACC123",
+		"gateway_id": "rest",
+	})
+	created := decodeTransaction(t, recorder)
+	assert.Equal(t, "12.30", created.Amount)
+	assert.Equal(t, model.Withdraw, created.Operation)
+	assert.Equal(t, model.StatusPending, created.Status)
+
+	recorder = env.get(env.server.HandleGetTransactionByReference, "/transactions/"+created.ReferenceId, map[string]string{"reference_id": created.ReferenceId})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, mustMarshal(t, created), recorder.Body.String())
+}
+
+// TestOpenAPI_MatchesResponses keeps the schemas in api/api.yaml in line with
+// the JSON the handlers actually produce.
+func TestOpenAPI_MatchesResponses(t *testing.T) {
+	raw, readErr := os.ReadFile("../../../api/api.yaml")
+	require.NoError(t, readErr)
+
+	var spec struct {
+		Paths      map[string]map[string]yaml.Node `yaml:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Required   []string             `yaml:"required"`
+				Properties map[string]yaml.Node `yaml:"properties"`
+			} `yaml:"schemas"`
+		} `yaml:"components"`
+	}
+	require.NoError(t, yaml.Unmarshal(raw, &spec))
+
+	for schema, goType := range map[string]reflect.Type{
+		"Transaction":        reflect.TypeOf(server.TransactionResponse{}),
+		"TransactionPage":    reflect.TypeOf(server.TransactionPageResponse{}),
+		"Risk":               reflect.TypeOf(server.RiskResponse{}),
+		"FxConversion":       reflect.TypeOf(server.FxConversionResponse{}),
+		"FxQuote":            reflect.TypeOf(server.FxQuoteResponse{}),
+		"Authorization":      reflect.TypeOf(server.AuthorizationResponse{}),
+		"Problem":            reflect.TypeOf(server.Problem{}),
+		"WebhookEvent":       reflect.TypeOf(server.WebhookEvent{}),
+		"WebhookDelivery":    reflect.TypeOf(server.WebhookDeliveryResponse{}),
+		"DeadLetters":        reflect.TypeOf(server.DeadLettersResponse{}),
+		"TransactionHistory": reflect.TypeOf(server.TransactionHistoryResponse{}),
+		"HistoryEvent":       reflect.TypeOf(server.HistoryEventResponse{}),
+		"ReviewQueue":        reflect.TypeOf(server.ReviewQueueResponse{}),
+		"ReviewTransaction":  reflect.TypeOf(server.ReviewTransactionResponse{}),
+		"ReviewDecisions":    reflect.TypeOf(server.ReviewDecisionsResponse{}),
+		"ReviewDecision":     reflect.TypeOf(server.ReviewDecisionResponse{}),
+	} {
+		documented, exists := spec.Components.Schemas[schema]
+		require.True(t, exists, "schema %s missing from api.yaml", schema)
+
+		var properties []string
+		for property := range documented.Properties {
+			properties = append(properties, property)
+		}
+		fields, required := jsonFields(goType)
+		assert.ElementsMatch(t, fields, properties, "properties of schema %s", schema)
+		assert.ElementsMatch(t, required, documented.Required, "required properties of schema %s", schema)
+	}
+
+	for _, route := range []struct{ path, method string }{
+		{"/v1/deposit", "post"},
+		{"/v1/withdraw", "post"},
+		{"/v1/transactions/{reference_id}", "get"},
+	} {
+		operation, exists := spec.Paths[route.path][route.method]
+		require.True(t, exists, "%s %s missing from api.yaml", route.method, route.path)
+
+		var response struct {
+			Responses map[string]struct {
+				Content map[string]struct {
+					Schema struct {
+						Ref string `yaml:"$ref"`
+					} `yaml:"schema"`
+				} `yaml:"content"`
+			} `yaml:"responses"`
+		}
+		require.NoError(t, operation.Decode(&response))
+		assert.Equal(t, "#/components/schemas/Transaction", response.Responses["200"].Content["application/json"].Schema.Ref,
+			"%s %s must answer with a Transaction", route.method, route.path)
+	}
+}
+
+// jsonFields lists the JSON names of a struct's fields; those without
+// omitempty are always present and so documented as required.
+func jsonFields(goType reflect.Type) (fields []string, required []string) {
+	for i := 0; i < goType.NumField(); i++ {
+		name, options, _ := strings.Cut(goType.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fields = append(fields, name)
+		if !strings.Contains(options, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	return fields, required
+}
+
+func mustMarshal(t *testing.T, value interface{}) string {
+	t.Helper()
+
+	body, marshalErr := json.Marshal(value)
+	require.NoError(t, marshalErr)
+	return string(body)
+}
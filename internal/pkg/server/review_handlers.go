@@ -0,0 +1,188 @@
+package server
+
+import (
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/service"
+	"github.com/dinowar/gateway-service/internal/pkg/validation"
+	"net/http"
+	"time"
+)
+
+// MaxReviewTextLength bounds the reason of a review decision.
+const MaxReviewTextLength = 500
+
+func WithReviewService(reviews *service.ReviewService) Option {
+	return func(server *Server) {
+		server.reviews = reviews
+	}
+}
+
+// ReviewRequest is the body of approving or rejecting a transaction;
+// rejections require a reason. The audit trail records the reviewer whose key
+// made the decision, see Server.reviewer.
+type ReviewRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ReviewTransactionResponse is a transaction of the review queue. Reviewers
+// work across merchants, so it names the merchant.
+type ReviewTransactionResponse struct {
+	MerchantId  string              `json:"merchant_id"`
+	Transaction TransactionResponse `json:"transaction"`
+}
+
+type ReviewQueueResponse struct {
+	Transactions []ReviewTransactionResponse `json:"transactions"`
+}
+
+type ReviewDecisionResponse struct {
+	Id          string        `json:"id"`
+	MerchantId  string        `json:"merchant_id"`
+	ReferenceId string        `json:"reference_id"`
+	Outcome     ReviewOutcome `json:"outcome"`
+	Reviewer    string        `json:"reviewer"`
+	Reason      string        `json:"reason,omitempty"`
+	DecidedAt   string        `json:"decided_at"`
+}
+
+type ReviewDecisionsResponse struct {
+	Decisions []ReviewDecisionResponse `json:"decisions"`
+}
+
+// HandleGetReviewQueue serves GET /admin/reviews, the transactions awaiting
+// review oldest first, optionally of one merchant_id.
+func (server *Server) HandleGetReviewQueue(w http.ResponseWriter, r *http.Request) {
+	v := &validation.Validator{}
+	query := r.URL.Query()
+	limit := parseLimit(v, query)
+	if validationErr := v.Err(); validationErr != nil {
+		server.writeError(w, r, "HandleGetReviewQueue", validationErr)
+		return
+	}
+
+	response := ReviewQueueResponse{Transactions: []ReviewTransactionResponse{}}
+	if server.reviews != nil {
+		queue, queueErr := server.reviews.Queue(query.Get("merchant_id"), limit)
+		if queueErr != nil {
+			server.writeError(w, r, "HandleGetReviewQueue", queueErr)
+			return
+		}
+		for _, txn := range queue {
+			response.Transactions = append(response.Transactions, ReviewTransactionResponse{
+				MerchantId:  txn.MerchantId,
+				Transaction: NewTransactionResponse(txn),
+			})
+		}
+	}
+	server.writeJSON(w, "HandleGetReviewQueue", http.StatusOK, response)
+}
+
+// HandleApproveReview serves POST /admin/reviews/{reference_id}/approve. The
+// transaction is dispatched through its original gateway; when the gateway
+// does not accept it, it fails like a transaction the gateway rejected.
+func (server *Server) HandleApproveReview(w http.ResponseWriter, r *http.Request) {
+	txn, decideErr := server.decideReview(w, r, ReviewApproved)
+	if decideErr != nil {
+		server.writeError(w, r, "HandleApproveReview", decideErr)
+		return
+	}
+
+	if gatewayErr := server.dispatch(txn); gatewayErr != nil {
+		server.failUndispatched("HandleApproveReview", txn, "the gateway did not accept the approved transaction")
+		server.writeError(w, r, "HandleApproveReview", gatewayErr)
+		return
+	}
+	server.writeJSON(w, "HandleApproveReview", http.StatusOK, NewTransactionResponse(txn))
+}
+
+// HandleRejectReview serves POST /admin/reviews/{reference_id}/reject. The
+// transaction fails with the reviewer's reason as message.
+func (server *Server) HandleRejectReview(w http.ResponseWriter, r *http.Request) {
+	txn, decideErr := server.decideReview(w, r, ReviewRejected)
+	if decideErr != nil {
+		server.writeError(w, r, "HandleRejectReview", decideErr)
+		return
+	}
+	server.settleUndispatched("HandleRejectReview", txn)
+	server.writeJSON(w, "HandleRejectReview", http.StatusOK, NewTransactionResponse(txn))
+}
+
+// decideReview validates a ReviewRequest and records the decision.
+func (server *Server) decideReview(w http.ResponseWriter, r *http.Request, outcome ReviewOutcome) (Transaction, error) {
+	var req ReviewRequest
+	if decodeErr := validation.DecodeJSON(w, r, &req, server.maxBodyBytes()); decodeErr != nil {
+		return Transaction{}, decodeErr
+	}
+
+	referenceId := r.PathValue("reference_id")
+	v := &validation.Validator{}
+	v.Required("reference_id", referenceId)
+	if outcome == ReviewRejected {
+		v.Required("reason", req.Reason)
+	}
+	if len(req.Reason) > MaxReviewTextLength {
+		v.Add("reason", validation.CodeOutOfRange, "reason must not be longer than %d characters", MaxReviewTextLength)
+	}
+	if validationErr := v.Err(); validationErr != nil {
+		return Transaction{}, validationErr
+	}
+	reviewer, reviewerErr := server.reviewer(r)
+	if reviewerErr != nil {
+		return Transaction{}, reviewerErr
+	}
+	if server.reviews == nil {
+		return Transaction{}, NewError(ErrNotFound, CodeTransactionNotFound, "transaction %s not found", referenceId)
+	}
+
+	txn, decideErr := server.reviews.Decide(referenceId, outcome, reviewer, req.Reason)
+	if decideErr != nil {
+		return Transaction{}, decideErr
+	}
+	server.logger.LogInfo("review decided", "reference_id", referenceId, "outcome", string(outcome), "reviewer", reviewer)
+	return txn, nil
+}
+
+// settleUndispatched releases the hold of a transaction that failed before
+// reaching its gateway and notifies the merchant. The failure is committed
+// already, so errors are only logged.
+func (server *Server) settleUndispatched(operation string, txn Transaction) {
+	if bookErr := server.bookTransaction(txn); bookErr != nil {
+		server.logger.LogError(operation+": error releasing hold of "+txn.ReferenceId, bookErr)
+	}
+	if publishErr := server.publishTransactionEvent(txn); publishErr != nil {
+		server.logger.LogError(operation+": error publishing event of "+txn.ReferenceId, publishErr)
+	}
+}
+
+// HandleGetReviewDecisions serves GET /admin/review-decisions, the audit
+// trail newest first, optionally of one reference_id.
+func (server *Server) HandleGetReviewDecisions(w http.ResponseWriter, r *http.Request) {
+	v := &validation.Validator{}
+	query := r.URL.Query()
+	limit := parseLimit(v, query)
+	if validationErr := v.Err(); validationErr != nil {
+		server.writeError(w, r, "HandleGetReviewDecisions", validationErr)
+		return
+	}
+
+	response := ReviewDecisionsResponse{Decisions: []ReviewDecisionResponse{}}
+	if server.reviews != nil {
+		decisions, listErr := server.reviews.Decisions(query.Get("reference_id"), limit)
+		if listErr != nil {
+			server.writeError(w, r, "HandleGetReviewDecisions", listErr)
+			return
+		}
+		for _, decision := range decisions {
+			response.Decisions = append(response.Decisions, ReviewDecisionResponse{
+				Id:          decision.Id,
+				MerchantId:  decision.MerchantId,
+				ReferenceId: decision.ReferenceId,
+				Outcome:     decision.Outcome,
+				Reviewer:    decision.Reviewer,
+				Reason:      decision.Reason,
+				DecidedAt:   decision.DecidedAt.UTC().Format(time.RFC3339Nano),
+			})
+		}
+	}
+	server.writeJSON(w, "HandleGetReviewDecisions", http.StatusOK, response)
+}
@@ -0,0 +1,153 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/server"
+	"github.com/dinowar/gateway-service/internal/pkg/service"
+	"github.com/dinowar/gateway-service/internal/pkg/validation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// watchACC777 sends every transaction of ACC777 to review.
+func watchACC777() server.Option {
+	flagged := service.RiskRuleFunc(func(txn model.Transaction, _ time.Time) (model.RiskFinding, error) {
+		if txn.AccountId == "ACC777" {
+			return model.RiskFinding{Decision: model.RiskReview, Reason: "account on watch"}, nil
+		}
+		return model.RiskFinding{Decision: model.RiskAllow}, nil
+	})
+	return server.WithRiskService(service.NewRiskService(flagged))
+}
+
+// withdrawForReview submits a withdrawal of ACC777 and returns its reference id.
+func (env *testEnv) withdrawForReview(t *testing.T, routes http.Handler, amount float64) string {
+	t.Helper()
+
+	recorder := route(routes, http.MethodPost, "/v1/withdraw", env.apiKey, map[string]interface{}{
+		"amount": amount, "currency": "USD", "account_id": "ACC777", "gateway_id": "rest",
+	})
+	require.Equal(t, http.StatusAccepted, recorder.Code, recorder.Body.String())
+	var txn server.TransactionResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &txn))
+	return txn.ReferenceId
+}
+
+func TestReview_RequiresAdminKey(t *testing.T) {
+	env := newTestEnv(t, watchACC777())
+	routes := env.server.Routes()
+
+	for _, target := range []string{"/admin/reviews", "/admin/review-decisions"} {
+		recorder := route(routes, http.MethodGet, target, env.apiKey, nil)
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code, target)
+	}
+	recorder := route(routes, http.MethodPost, "/admin/reviews/ref-1/approve", env.apiKey, server.ReviewRequest{})
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestReview_ApproveDispatchesThroughOriginalGateway(t *testing.T) {
+	env := newTestEnv(t, watchACC777())
+	env.fund(t, "ACC777", "USD", "100")
+	routes := env.server.Routes()
+	referenceId := env.withdrawForReview(t, routes, 40)
+	require.Empty(t, env.gateway.withdrawals)
+
+	require.Equal(t, http.StatusOK, route(routes, http.MethodGet, "/admin/reviews", testBobKey, nil).Code, "reviewer keys open the review routes")
+	for _, target := range []string{"/admin/merchants/" + env.merchant.Id + "/limits", "/admin/merchants/" + env.merchant.Id + "/fees"} {
+		assert.Equal(t, http.StatusUnauthorized, route(routes, http.MethodGet, target, testBobKey, nil).Code, "reviewer keys do not open "+target)
+		assert.Equal(t, http.StatusOK, route(routes, http.MethodGet, target, testAdminKey, nil).Code, target)
+	}
+	recorder := route(routes, http.MethodGet, "/admin/reviews?merchant_id="+env.merchant.Id, testAdminKey, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var queue server.ReviewQueueResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &queue))
+	require.Len(t, queue.Transactions, 1)
+	assert.Equal(t, env.merchant.Id, queue.Transactions[0].MerchantId)
+	assert.Equal(t, referenceId, queue.Transactions[0].Transaction.ReferenceId)
+	assert.Equal(t, []string{"account on watch"}, queue.Transactions[0].Transaction.Risk.Reasons)
+
+	recorder = route(routes, http.MethodPost, "/admin/reviews/"+referenceId+"/approve", testAdminKey, server.ReviewRequest{})
+	require.Equal(t, http.StatusForbidden, recorder.Code, "the shared admin key does not name a reviewer")
+	assert.Equal(t, model.CodeReviewerKeyRequired, decodeProblem(t, recorder).Code)
+	recorder = route(routes, http.MethodPost, "/admin/reviews/"+referenceId+"/approve", testAliceKey, map[string]string{"reviewer": "bob"})
+	require.Equal(t, http.StatusBadRequest, recorder.Code, "the reviewer cannot be chosen by the caller")
+
+	recorder = route(routes, http.MethodPost, "/admin/reviews/"+referenceId+"/approve", testAliceKey, server.ReviewRequest{Reason: "known customer"})
+	approved := decodeTransaction(t, recorder)
+	assert.Equal(t, model.StatusPending, approved.Status)
+	require.Len(t, env.gateway.withdrawals, 1)
+	assert.Equal(t, referenceId, env.gateway.withdrawals[0].ReferenceID)
+
+	recorder = route(routes, http.MethodPost, "/admin/reviews/"+referenceId+"/reject", testBobKey, server.ReviewRequest{Reason: "too late"})
+	require.Equal(t, http.StatusConflict, recorder.Code)
+	assert.Equal(t, model.CodeNotInReview, decodeProblem(t, recorder).Code)
+
+	// the provider settles it like any other withdrawal
+	recorder = postCallback(routes, model.CallbackPayload{TransactionId: "provider-1", ReferenceId: referenceId, Status: string(model.StatusSuccess)})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, "60.00", getBalance(t, routes, env.apiKey, "ACC777").Balances[0].Balance)
+
+	recorder = route(routes, http.MethodGet, "/admin/review-decisions?reference_id="+referenceId, testAdminKey, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var decisions server.ReviewDecisionsResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &decisions))
+	require.Len(t, decisions.Decisions, 1)
+	assert.Equal(t, model.ReviewApproved, decisions.Decisions[0].Outcome)
+	assert.Equal(t, "alice", decisions.Decisions[0].Reviewer)
+	assert.Equal(t, "known customer", decisions.Decisions[0].Reason)
+
+	recorder = route(routes, http.MethodGet, "/v1/transactions/"+referenceId+"/events", env.apiKey, nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var history server.TransactionHistoryResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &history))
+	var kinds []model.HistoryEventKind
+	for _, event := range history.Events {
+		kinds = append(kinds, event.Kind)
+	}
+	assert.Equal(t, []model.HistoryEventKind{model.HistoryCreated, model.HistoryReviewApproved, model.HistoryStatusChanged, model.HistoryStatusChanged}, kinds)
+	assert.NotContains(t, recorder.Body.String(), "alice", "reviewers stay in the audit trail")
+}
+
+func TestReview_RejectFailsAndReleasesHold(t *testing.T) {
+	env := newTestEnv(t, watchACC777())
+	env.fund(t, "ACC777", "USD", "100")
+	routes := env.server.Routes()
+	referenceId := env.withdrawForReview(t, routes, 40)
+	assert.Equal(t, "40.00", getBalance(t, routes, env.apiKey, "ACC777").Balances[0].Held)
+
+	recorder := route(routes, http.MethodPost, "/admin/reviews/"+referenceId+"/reject", testBobKey, server.ReviewRequest{})
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, validation.CodeRequired, fieldCode(decodeProblem(t, recorder), "reason"))
+
+	recorder = route(routes, http.MethodPost, "/admin/reviews/"+referenceId+"/reject", testBobKey, server.ReviewRequest{Reason: "card testing pattern"})
+	rejected := decodeTransaction(t, recorder)
+	assert.Equal(t, model.StatusFailed, rejected.Status)
+	assert.Equal(t, "card testing pattern", rejected.Message)
+	assert.Empty(t, env.gateway.withdrawals)
+
+	balance := getBalance(t, routes, env.apiKey, "ACC777").Balances[0]
+	assert.Equal(t, "0.00", balance.Held)
+	assert.Equal(t, "100.00", balance.Available)
+}
+
+func TestReview_ApprovedTransactionFailsWhenGatewayRefuses(t *testing.T) {
+	env := newTestEnv(t, watchACC777())
+	env.fund(t, "ACC777", "USD", "100")
+	routes := env.server.Routes()
+	referenceId := env.withdrawForReview(t, routes, 40)
+	env.gateway.err = assert.AnError
+
+	recorder := route(routes, http.MethodPost, "/admin/reviews/"+referenceId+"/approve", testAliceKey, server.ReviewRequest{})
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.Equal(t, model.CodeGatewayError, decodeProblem(t, recorder).Code)
+
+	stored, getErr := env.rep.GetTransaction(env.merchant.Id, referenceId)
+	require.NoError(t, getErr)
+	assert.Equal(t, model.StatusFailed, stored.Status)
+	assert.Equal(t, "0.00", getBalance(t, routes, env.apiKey, "ACC777").Balances[0].Held)
+}
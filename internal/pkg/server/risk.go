@@ -0,0 +1,44 @@
+package server
+
+import (
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/service"
+)
+
+// WithRiskService screens deposits and withdrawals before dispatch. Without
+// it every transaction is sent to its gateway unscreened.
+func WithRiskService(risk *service.RiskService) Option {
+	return func(server *Server) {
+		server.risk = risk
+	}
+}
+
+// screenTransaction stores the risk assessment on txn and moves transactions
+// flagged for review to StatusReview. Denied transactions are saved as FAILED,
+// announced like every failed transaction, and answered with CodeRiskDenied.
+func (server *Server) screenTransaction(txn *Transaction) error {
+	if server.risk == nil {
+		return nil
+	}
+	assessment, riskErr := server.risk.Assess(*txn)
+	if riskErr != nil {
+		return NewError(ErrInternal, CodeInternal, "error screening transaction").Wrap(riskErr)
+	}
+	txn.Risk = assessment
+
+	switch assessment.Decision {
+	case RiskDeny:
+		txn.Status = StatusFailed
+		if trxErr := server.rep.SaveTransaction(txn); trxErr != nil {
+			return NewError(ErrInternal, CodeInternal, "error saving transaction").Wrap(trxErr)
+		}
+		// the denial is what the caller reports, see settleUndispatched
+		if publishErr := server.publishTransactionEvent(*txn); publishErr != nil {
+			server.logger.LogError("screenTransaction: error publishing event of "+txn.ReferenceId, publishErr)
+		}
+		return NewError(ErrUnprocessable, CodeRiskDenied, "transaction %s was declined by risk screening", txn.ReferenceId)
+	case RiskReview:
+		txn.Status = StatusReview
+	}
+	return nil
+}
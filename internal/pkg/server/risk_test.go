@@ -0,0 +1,132 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dinowar/gateway-service/internal/pkg/config"
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/server"
+	"github.com/dinowar/gateway-service/internal/pkg/service"
+	"github.com/dinowar/gateway-service/internal/pkg/validation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRisk_DeniedTransactionsAreStoredAsFailed(t *testing.T) {
+	env := newTestEnv(t, server.WithRiskService(service.NewRiskService(service.NewBlocklistRule([]string{"ACC666"}))))
+	routes := env.server.Routes()
+	receiver := &webhookReceiver{status: http.StatusOK}
+	env.subscribe(t, receiver)
+
+	recorder := route(routes, http.MethodPost, "/v1/deposit", env.apiKey, map[string]interface{}{
+		"amount": 10, "currency": "USD", "account_id": "ACC666", "gateway_id": "rest",
+	})
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code, recorder.Body.String())
+	assert.Equal(t, model.CodeRiskDenied, decodeProblem(t, recorder).Code)
+	assert.Empty(t, env.gateway.deposits, "denied transactions are not dispatched")
+
+	page, listErr := env.rep.GetTransactions(env.merchant.Id, "ACC666", model.TransactionFilter{}, model.PageRequest{})
+	require.NoError(t, listErr)
+	require.Len(t, page.Transactions, 1)
+	assert.Equal(t, model.StatusFailed, page.Transactions[0].Status)
+	assert.Equal(t, model.RiskAssessment{Decision: model.RiskDeny, Reasons: []string{"account ACC666 is blocklisted"}}, page.Transactions[0].Risk)
+
+	assert.Equal(t, 1, env.webhooks.Dispatch(context.Background()))
+	require.Len(t, receiver.received, 1)
+	var event server.WebhookEvent
+	require.NoError(t, json.Unmarshal(receiver.received[0].body, &event))
+	assert.Equal(t, model.EventTransactionFailed, event.Type, "the merchant hears of the denial like of any failure")
+	assert.Equal(t, page.Transactions[0].ReferenceId, event.Data.ReferenceId)
+
+	// other accounts pass and carry the decision
+	recorder = route(routes, http.MethodPost, "/v1/deposit", env.apiKey, depositBody)
+	txn := decodeTransaction(t, recorder)
+	assert.Equal(t, &server.RiskResponse{Decision: model.RiskAllow, Reasons: []string{}}, txn.Risk)
+	assert.Len(t, env.gateway.deposits, 1)
+}
+
+func TestRisk_ReviewHoldsWithdrawalWithoutDispatch(t *testing.T) {
+	// the rule reads the repository of the env it is part of
+	var env *testEnv
+	rapidWithdrawal := service.RiskRuleFunc(func(txn model.Transaction, now time.Time) (model.RiskFinding, error) {
+		return service.NewRapidWithdrawalRule(env.rep, 30*time.Minute).Evaluate(txn, now)
+	})
+	env = newTestEnv(t, server.WithRiskService(service.NewRiskService(rapidWithdrawal)))
+	routes := env.server.Routes()
+	env.fund(t, "ACC123", "USD", "100")
+
+	recorder := route(routes, http.MethodPost, "/v1/withdraw", env.apiKey, map[string]interface{}{
+		"amount": 40, "currency": "USD", "account_id": "ACC123", "gateway_id": "rest",
+	})
+	require.Equal(t, http.StatusOK, recorder.Code, "no recent deposit: %s", recorder.Body.String())
+
+	env.deposit(t, "ACC123")
+	recorder = route(routes, http.MethodPost, "/v1/withdraw", env.apiKey, map[string]interface{}{
+		"amount": 50, "currency": "USD", "account_id": "ACC123", "gateway_id": "rest",
+	})
+	require.Equal(t, http.StatusAccepted, recorder.Code, recorder.Body.String())
+	var txn server.TransactionResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &txn))
+	assert.Equal(t, model.StatusReview, txn.Status)
+	require.NotNil(t, txn.Risk)
+	assert.Equal(t, model.RiskReview, txn.Risk.Decision)
+	assert.Equal(t, []string{"withdrawal within 30 minutes of a deposit to account ACC123"}, txn.Risk.Reasons)
+	assert.Len(t, env.gateway.withdrawals, 1, "withdrawals under review are not dispatched")
+
+	balance := getBalance(t, routes, env.apiKey, "ACC123").Balances[0]
+	assert.Equal(t, "90.00", balance.Held, "the withdrawal under review keeps its hold")
+
+	// gateways cannot settle what they were never sent, nor set REVIEW themselves
+	recorder = postCallback(routes, model.CallbackPayload{ReferenceId: txn.ReferenceId, Status: string(model.StatusSuccess)})
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	recorder = postCallback(routes, model.CallbackPayload{ReferenceId: txn.ReferenceId, Status: string(model.StatusReview)})
+	assert.Equal(t, model.CodeUnknownStatus, decodeProblem(t, recorder).Code)
+}
+
+func TestRisk_SanctionedBeneficiaryBlocksWithdrawal(t *testing.T) {
+	list := filepath.Join(t.TempDir(), "sanctions.csv")
+	require.NoError(t, os.WriteFile(list, []byte("id,name\nSDN-1,Ivan Petrovich Sidorov\n"), 0o600))
+	screener := service.NewSanctionsScreener(config.SanctionsConfig{ListPath: list, MatchThreshold: 90, Action: "deny"}, nil)
+	require.NoError(t, screener.Load())
+	env := newTestEnv(t, server.WithRiskService(service.NewRiskService(service.NewSanctionsRule(screener, model.RiskDeny))))
+	routes := env.server.Routes()
+	env.fund(t, "ACC123", "USD", "100")
+
+	recorder := route(routes, http.MethodPost, "/v1/withdraw", env.apiKey, map[string]interface{}{
+		"amount": 40, "currency": "USD", "account_id": "ACC123", "gateway_id": "rest", "beneficiary_name": "SIDOROV, Ivan Petrovitch",
+	})
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code, recorder.Body.String())
+	assert.Equal(t, model.CodeRiskDenied, decodeProblem(t, recorder).Code)
+	assert.Empty(t, env.gateway.withdrawals, "sanctioned withdrawals are not dispatched")
+
+	page, listErr := env.rep.GetTransactions(env.merchant.Id, "ACC123", model.TransactionFilter{Operation: model.Withdraw}, model.PageRequest{})
+	require.NoError(t, listErr)
+	require.Len(t, page.Transactions, 1)
+	assert.Equal(t, model.StatusFailed, page.Transactions[0].Status)
+	assert.Equal(t, "SIDOROV, Ivan Petrovitch", page.Transactions[0].BeneficiaryName)
+	require.Len(t, page.Transactions[0].Risk.Reasons, 1)
+	assert.Contains(t, page.Transactions[0].Risk.Reasons[0], `matches "Ivan Petrovich Sidorov" on the sanctions list (entry SDN-1`)
+
+	recorder = route(routes, http.MethodPost, "/v1/withdraw", env.apiKey, map[string]interface{}{
+		"amount": 40, "currency": "USD", "account_id": "ACC123", "gateway_id": "rest", "beneficiary_name": "Jane Doe",
+	})
+	txn := decodeTransaction(t, recorder)
+	assert.Equal(t, "Jane Doe", txn.BeneficiaryName)
+	assert.Len(t, env.gateway.withdrawals, 1)
+
+	recorder = route(routes, http.MethodPost, "/v1/withdraw", env.apiKey, map[string]interface{}{
+		"amount": 10, "currency": "USD", "account_id": "ACC123", "gateway_id": "rest",
+	})
+	require.Equal(t, http.StatusBadRequest, recorder.Code, "withdrawals cannot skip name screening")
+	assert.Equal(t, validation.CodeRequired, fieldCode(decodeProblem(t, recorder), "beneficiary_name"))
+	assert.Len(t, env.gateway.withdrawals, 1)
+
+	recorder = route(routes, http.MethodPost, "/v1/deposit", env.apiKey, depositBody)
+	require.Equal(t, http.StatusOK, recorder.Code, "deposits are not screened by name")
+}
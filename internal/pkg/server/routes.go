@@ -0,0 +1,89 @@
+package server
+
+import (
+	"github.com/dinowar/gateway-service/internal/pkg/router"
+	"net/http"
+)
+
+type apiVersion struct {
+	name           string
+	representation Representation
+}
+
+// WithAPIVersion mounts the client API a second time under /<name>, answering
+// with representation. This is how a v2 with a changed transaction
+// representation runs next to v1 on the same handlers.
+func WithAPIVersion(name string, representation Representation) Option {
+	return func(server *Server) {
+		server.versions = append(server.versions, apiVersion{name: name, representation: representation})
+	}
+}
+
+// Routes returns the handler serving every route of the service. The client
+// API lives under one prefix per version, e.g. /v1/deposit; health probes and
+// the operator's admin API are not versioned.
+func (server *Server) Routes() http.Handler {
+	root := router.New(router.ErrorHandlers{
+		NotFound:         server.writeNotFound,
+		MethodNotAllowed: server.writeMethodNotAllowed,
+	})
+	root.HandleFunc(http.MethodGet, "/healthz", server.HandleHealthz)
+	root.HandleFunc(http.MethodGet, "/readyz", server.HandleReadyz)
+
+	admin := root.Group("/admin", server.AuthenticateAdmin)
+	admin.HandleFunc(http.MethodGet, "/merchants/{merchant_id}/limits", server.HandleGetMerchantLimits)
+	admin.HandleFunc(http.MethodPut, "/merchants/{merchant_id}/limits", server.HandlePutMerchantLimits)
+	admin.HandleFunc(http.MethodGet, "/merchants/{merchant_id}/fees", server.HandleGetMerchantFees)
+	admin.HandleFunc(http.MethodPut, "/merchants/{merchant_id}/fees", server.HandlePutMerchantFees)
+	reviews := root.Group("/admin", server.AuthenticateReviewer)
+	reviews.HandleFunc(http.MethodGet, "/reviews", server.HandleGetReviewQueue)
+	reviews.HandleFunc(http.MethodPost, "/reviews/{reference_id}/approve", server.HandleApproveReview)
+	reviews.HandleFunc(http.MethodPost, "/reviews/{reference_id}/reject", server.HandleRejectReview)
+	reviews.HandleFunc(http.MethodGet, "/review-decisions", server.HandleGetReviewDecisions)
+
+	for _, version := range server.versions {
+		server.registerAPI(root.Group("/"+version.name, withRepresentation(version.representation)))
+	}
+
+	// the API was served without a prefix before versioning, keep those paths
+	// as deprecated aliases of v1 while clients and providers move over
+	server.registerAPI(root.Group("", withRepresentation(RepresentationV1{}), deprecatedAlias("/v1")))
+	legacy := root.Group("", server.Authenticate)
+	legacy.HandleFunc(http.MethodGet, "/transaction", server.HandleGetTransaction)
+	legacy.HandleFunc(http.MethodGet, "/transactions", server.HandleGetTransactions)
+
+	return root
+}
+
+// registerAPI registers the routes of one API version. Everything but the
+// gateways' callback requires a merchant API key, callbacks are signed by the
+// gateway instead, see authenticateCallback.
+func (server *Server) registerAPI(api *router.Router) {
+	api.HandleFunc(http.MethodPost, "/callback", server.HandleCallback)
+
+	client := api.Group("", server.Authenticate)
+	client.HandleFunc(http.MethodPost, "/deposit", server.HandleDeposit)
+	client.HandleFunc(http.MethodPost, "/withdraw", server.HandleWithdraw)
+	client.HandleFunc(http.MethodPost, "/authorize", server.HandleAuthorize)
+	client.HandleFunc(http.MethodGet, "/transactions/{reference_id}", server.HandleGetTransactionByReference)
+	client.HandleFunc(http.MethodGet, "/transactions/{reference_id}/stream", server.HandleTransactionStream)
+	client.HandleFunc(http.MethodGet, "/transactions/{reference_id}/events", server.HandleGetTransactionHistory)
+	client.HandleFunc(http.MethodPost, "/transactions/{reference_id}/capture", server.HandleCaptureTransaction)
+	client.HandleFunc(http.MethodPost, "/transactions/{reference_id}/void", server.HandleVoidTransaction)
+	client.HandleFunc(http.MethodGet, "/accounts/{account_id}/transactions", server.HandleGetAccountTransactions)
+	client.HandleFunc(http.MethodGet, "/accounts/{account_id}/transactions/stream", server.HandleAccountTransactionStream)
+	client.HandleFunc(http.MethodGet, "/accounts/{account_id}/balance", server.HandleGetAccountBalance)
+	client.HandleFunc(http.MethodGet, "/accounts/{account_id}/statement", server.HandleGetAccountStatement)
+	client.HandleFunc(http.MethodPost, "/fx/quotes", server.HandleCreateFxQuote)
+	client.HandleFunc(http.MethodGet, "/webhooks/dead-letters", server.HandleGetDeadLetters)
+	client.HandleFunc(http.MethodPost, "/webhooks/dead-letters/{delivery_id}/redeliver", server.HandleRedeliverWebhook)
+}
+
+func deprecatedAlias(prefix string) router.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			setDeprecated(w, prefix+r.URL.Path)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
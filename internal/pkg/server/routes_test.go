@@ -0,0 +1,134 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/server"
+	"github.com/dinowar/gateway-service/internal/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func route(handler http.Handler, method, target, apiKey string, body interface{}) *httptest.ResponseRecorder {
+	var reqBody bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&reqBody).Encode(body)
+	}
+	req := httptest.NewRequest(method, target, &reqBody)
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// postCallback posts payload to the callback endpoint as the rest gateway,
+// signed with its callback secret.
+func postCallback(handler http.Handler, payload model.CallbackPayload) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, "/v1/callback", bytes.NewReader(body))
+	req.Header.Set(util.CallbackGatewayHeader, "rest")
+	req.Header.Set(util.CallbackSignatureHeader, util.SignCallback(testCallbackSecret, body))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	return recorder
+}
+
+var depositBody = map[string]interface{}{
+	"amount":     100.5,
+	"currency":   "USD",
+	"account_id": "ACC123",
+	"gateway_id": "rest",
+}
+
+func TestRoutes_V1(t *testing.T) {
+	env := newTestEnv(t)
+	routes := env.server.Routes()
+
+	recorder := route(routes, http.MethodPost, "/v1/deposit", env.apiKey, depositBody)
+	created := decodeTransaction(t, recorder)
+	assert.Empty(t, recorder.Header().Get("Deprecation"))
+
+	recorder = route(routes, http.MethodGet, "/v1/transactions/"+created.ReferenceId, env.apiKey, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, mustMarshal(t, created), recorder.Body.String())
+
+	recorder = route(routes, http.MethodGet, "/v1/accounts/ACC123/transactions", env.apiKey, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Len(t, decodePage(t, recorder).Transactions, 1)
+
+	assert.Equal(t, http.StatusOK, route(routes, http.MethodGet, "/healthz", env.apiKey, nil).Code)
+}
+
+func TestRoutes_MethodNotAllowedAndNotFound(t *testing.T) {
+	env := newTestEnv(t)
+	routes := env.server.Routes()
+
+	recorder := route(routes, http.MethodDelete, "/v1/transactions/ref-1", env.apiKey, nil)
+	require.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+	assert.Equal(t, "GET, HEAD", recorder.Header().Get("Allow"))
+	assert.Equal(t, model.CodeMethodNotAllowed, decodeProblem(t, recorder).Code)
+
+	recorder = route(routes, http.MethodGet, "/v1/refunds", env.apiKey, nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Equal(t, model.CodeRouteNotFound, decodeProblem(t, recorder).Code)
+
+	recorder = route(routes, http.MethodGet, "/v2/transactions/ref-1", env.apiKey, nil)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestRoutes_UnversionedPathsAreDeprecatedAliases(t *testing.T) {
+	env := newTestEnv(t)
+	routes := env.server.Routes()
+
+	recorder := route(routes, http.MethodPost, "/deposit", env.apiKey, depositBody)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, "true", recorder.Header().Get("Deprecation"))
+	assert.Equal(t, `</v1/deposit>; rel="successor-version"`, recorder.Header().Get("Link"))
+
+	recorder = route(routes, http.MethodGet, "/transactions", env.apiKey, model.GetTransactionsRequest{AccountId: "ACC123"})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, []string{`</v1/accounts/{account_id}/transactions>; rel="successor-version"`}, recorder.Header().Values("Link"))
+}
+
+// representationV2 stands in for a future version that changes the transaction shape.
+type representationV2 struct{}
+
+func (representationV2) Transaction(txn model.Transaction) interface{} {
+	return map[string]string{"id": txn.ReferenceId, "state": string(txn.Status)}
+}
+
+func (representationV2) Transactions(transactions []model.Transaction) interface{} {
+	return len(transactions)
+}
+
+func (representationV2) TransactionPage(page model.TransactionPage) interface{} {
+	return len(page.Transactions)
+}
+
+func TestRoutes_VersionsShareHandlers(t *testing.T) {
+	env := newTestEnv(t)
+	server.WithAPIVersion("v2", representationV2{})(env.server)
+	routes := env.server.Routes()
+
+	recorder := route(routes, http.MethodPost, "/v2/deposit", env.apiKey, depositBody)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var created map[string]string
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+	assert.Equal(t, "PENDING", created["state"])
+
+	recorder = route(routes, http.MethodGet, "/v1/transactions/"+created["id"], env.apiKey, nil)
+	v1 := decodeTransaction(t, recorder)
+	assert.Equal(t, model.StatusPending, v1.Status)
+
+	recorder = route(routes, http.MethodGet, "/v2/accounts/ACC123/transactions", env.apiKey, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, "1", recorder.Body.String())
+}
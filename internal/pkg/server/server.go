@@ -2,280 +2,464 @@ package server
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"github.com/dinowar/gateway-service/internal/pkg/config"
 	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
 	gateways "github.com/dinowar/gateway-service/internal/pkg/gateway"
 	"github.com/dinowar/gateway-service/internal/pkg/service"
+	"github.com/dinowar/gateway-service/internal/pkg/validation"
 	"github.com/google/uuid"
-	"github.com/shopspring/decimal"
 	"io"
 	"net/http"
-	"time"
+	"strings"
 )
 
 type Server struct {
-	rep      *service.RepositoryService
+	rep      service.TransactionRepository
 	logger   *service.LogService
-	gateways map[string]gateways.PaymentGateway
-	config   *config.ServiceConfig
+	health   *service.HealthService
+	auth     *service.AuthService
+	webhooks *service.WebhookService
+	broker   *service.TransactionBroker
+	ledger   *service.LedgerService
+	limits   *service.LimitService
+	fees     *service.FeeService
+	fx       *service.FxService
+	// two-step deposits, unrelated to authenticating merchants
+	authorizations *service.AuthorizationService
+	risk           *service.RiskService
+	reviews        *service.ReviewService
+	gateways       map[string]gateways.PaymentGateway
+	config         *config.ServiceConfig
+	versions       []apiVersion
 }
 
-func NewAppServer(rep *service.RepositoryService, logger *service.LogService, config *config.ServiceConfig) *Server {
-	return &Server{
+// Option configures optional dependencies of the Server.
+type Option func(server *Server)
+
+func WithHealthService(health *service.HealthService) Option {
+	return func(server *Server) {
+		server.health = health
+	}
+}
+
+func NewAppServer(rep service.TransactionRepository, logger *service.LogService, cfg *config.ServiceConfig, opts ...Option) *Server {
+	server := &Server{
 		rep:      rep,
 		logger:   logger,
 		gateways: make(map[string]gateways.PaymentGateway),
-		config:   config,
+		config:   cfg,
+		versions: []apiVersion{{name: "v1", representation: RepresentationV1{}}},
+	}
+	for _, opt := range opts {
+		opt(server)
+	}
+	if server.broker == nil {
+		server.broker = service.NewTransactionBroker()
+	}
+	if server.limits == nil {
+		server.limits = service.NewLimitService(rep)
+	}
+	if server.fees == nil {
+		server.fees = service.NewFeeService(nil)
 	}
+	if server.fx == nil {
+		server.fx = service.NewFxService(nil, nil, 0)
+	}
+	if server.authorizations == nil {
+		// claims work on any repository that stores authorizations, the sweep stays off
+		authorizationRep, _ := rep.(service.AuthorizationRepository)
+		server.authorizations = service.NewAuthorizationService(authorizationRep, logger, config.AuthorizationConfig{})
+	}
+	return server
 }
 
 func (server *Server) RegisterGateway(gatewayId string, gateway gateways.PaymentGateway) {
 	server.gateways[gatewayId] = gateway
+	if server.health != nil {
+		server.health.RegisterGateway(gatewayId, gateway)
+	}
 }
 
 func (server *Server) HandleDeposit(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	server.deposit(w, r, "HandleDeposit", false)
+}
+
+// deposit creates a deposit, only authorized for a later capture when
+// authorize is set, see HandleAuthorize.
+func (server *Server) deposit(w http.ResponseWriter, r *http.Request, operation string, authorize bool) {
+	req, merchant, reqErr := server.decodeClientRequest(w, r, Deposit)
+	if reqErr != nil {
+		server.writeError(w, r, operation, reqErr)
 		return
 	}
 
-	var req ClientRequest
-	decodeErr := json.NewDecoder(r.Body).Decode(&req)
-	if decodeErr != nil {
-		server.logger.LogError("HandleDeposit: error decoding request body: %v", decodeErr)
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+	referenceId := uuid.NewString()
+	txn := &Transaction{
+		ReferenceId: referenceId,
+		MerchantId:  merchant.Id,
+		AccountId:   req.AccountID,
+		GatewayId:   req.GatewayID,
+		Amount:      req.Amount,
+		Currency:    req.Currency,
+		Status:      StatusPending,
+		Operation:   Deposit,
+	}
+	txn.Fee = server.fees.Calculate(merchant.Settings, *txn)
+	if authorize {
+		server.authorizations.Authorize(txn)
+	}
+	if convertErr := server.convert(txn, req, merchant); convertErr != nil {
+		server.writeError(w, r, operation, convertErr)
 		return
 	}
 
-	if req.Amount <= 0 || req.Currency == "" || req.AccountID == "" || req.GatewayID == "" {
-		http.Error(w, "missing or invalid fields in request body", http.StatusBadRequest)
+	if riskErr := server.screenTransaction(txn); riskErr != nil {
+		server.releaseQuote(*txn)
+		server.writeError(w, r, operation, riskErr)
+		return
+	}
+	if txn.Status == StatusReview {
+		server.saveForReview(w, r, operation, merchant.Settings, txn)
 		return
 	}
+	server.saveAndDispatch(w, r, operation, merchant.Settings, txn)
+}
 
-	gateway, exists := server.gateways[req.GatewayID]
-	if !exists {
-		http.Error(w, fmt.Sprintf("gateway %s not found", req.GatewayID), http.StatusBadRequest)
+func (server *Server) HandleWithdraw(w http.ResponseWriter, r *http.Request) {
+	req, merchant, reqErr := server.decodeClientRequest(w, r, Withdraw)
+	if reqErr != nil {
+		server.writeError(w, r, "HandleWithdraw", reqErr)
 		return
 	}
 
 	referenceId := uuid.NewString()
 	txn := &Transaction{
 		ReferenceId: referenceId,
+		MerchantId:  merchant.Id,
 		AccountId:   req.AccountID,
 		GatewayId:   req.GatewayID,
-		Amount:      decimal.NewFromFloat(req.Amount),
-		Currency:    req.Currency,
-		Status:      StatusPending,
-		Operation:   Deposit,
-		Ts:          time.Now(),
-	}
-
-	depositReq := DepositReq{
 		Amount:      req.Amount,
 		Currency:    req.Currency,
-		ReferenceID: referenceId,
-		AccountID:   req.AccountID,
+		Status:      StatusPending,
+		Operation:   Withdraw,
+		// screened against the sanctions list by the risk rules
+		BeneficiaryName: strings.TrimSpace(req.BeneficiaryName),
 	}
-
-	depositResp, gatewayErr := gateway.ProcessDeposit(depositReq, server.config.ServiceCallbackEndpoint)
-	if gatewayErr != nil {
-		http.Error(w, "error processing deposit", http.StatusInternalServerError)
-		server.logger.LogError("HandleDeposit: error processing deposit: %v", gatewayErr)
+	txn.Fee = server.fees.Calculate(merchant.Settings, *txn)
+	if convertErr := server.convert(txn, req, merchant); convertErr != nil {
+		server.writeError(w, r, "HandleWithdraw", convertErr)
 		return
 	}
 
-	trxErr := server.rep.SaveTransaction(txn)
-	if trxErr != nil {
-		http.Error(w, "error saving transaction", http.StatusInternalServerError)
-		server.logger.LogError("HandleDeposit: error saving transaction: %v", trxErr)
+	if riskErr := server.screenTransaction(txn); riskErr != nil {
+		server.releaseQuote(*txn)
+		server.writeError(w, r, "HandleWithdraw", riskErr)
 		return
 	}
-
-	response := map[string]interface{}{
-		"transaction_status": txn.Status,
-		"operation_type":     Deposit,
-		"gateway":            depositResp.Gateway,
-		"account_id":         req.AccountID,
-		"reference_id":       txn.ReferenceId,
+	// withdrawals under review keep their hold until they are decided
+	if holdErr := server.holdFunds(*txn); holdErr != nil {
+		server.releaseQuote(*txn)
+		server.writeError(w, r, "HandleWithdraw", holdErr)
+		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	encoderErr := json.NewEncoder(w).Encode(response)
-	if encoderErr != nil {
-		server.logger.LogError("HandleDeposit: error encoding response: %v", encoderErr)
+	if txn.Status == StatusReview {
+		server.saveForReview(w, r, "HandleWithdraw", merchant.Settings, txn)
+		return
 	}
+	server.saveAndDispatch(w, r, "HandleWithdraw", merchant.Settings, txn)
 }
 
-func (server *Server) HandleWithdraw(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+// saveAndDispatch stores txn as PENDING before sending it to its gateway, so
+// a callback that arrives before the gateway answers finds the transaction.
+// A transaction that cannot be saved is never dispatched and gives up its
+// hold; one the gateway does not accept is failed, see failUndispatched.
+func (server *Server) saveAndDispatch(w http.ResponseWriter, r *http.Request, operation string, settings MerchantSettings, txn *Transaction) {
+	if !server.save(w, r, operation, settings, txn) {
 		return
 	}
 
-	var req ClientRequest
-	decodeErr := json.NewDecoder(r.Body).Decode(&req)
-	if decodeErr != nil {
-		server.logger.LogError("HandleDeposit: error decoding request body: %v", decodeErr)
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+	if gatewayErr := server.dispatch(*txn); gatewayErr != nil {
+		server.failUndispatched(operation, *txn, "the gateway did not accept the transaction")
+		server.writeError(w, r, operation, gatewayErr)
 		return
 	}
 
-	if req.Amount <= 0 || req.Currency == "" || req.AccountID == "" || req.GatewayID == "" {
-		http.Error(w, "missing or invalid fields in request body", http.StatusBadRequest)
+	server.writeJSON(w, operation, http.StatusOK, representation(r).Transaction(*txn))
+}
+
+// failUndispatched fails a stored transaction its gateway did not accept,
+// releasing its hold. The gateway error is what the caller reports, so errors
+// here are only logged.
+func (server *Server) failUndispatched(operation string, txn Transaction, message string) {
+	txn.Status = StatusFailed
+	txn.Message = message
+	if trxErr := server.rep.UpdateTransaction(&txn); trxErr != nil {
+		server.logger.LogError(operation+": error failing "+txn.ReferenceId, trxErr)
 		return
 	}
+	server.settleUndispatched(operation, txn)
+}
 
-	gateway, exists := server.gateways[req.GatewayID]
+// dispatch sends txn to its gateway, with the service's callback endpoint for
+// the status updates.
+func (server *Server) dispatch(txn Transaction) error {
+	gateway, exists := server.gateways[txn.GatewayId]
 	if !exists {
-		http.Error(w, fmt.Sprintf("gateway %s not found", req.GatewayID), http.StatusBadRequest)
-		return
+		return NewError(ErrInternal, CodeGatewayError, "gateway %s is not registered", txn.GatewayId)
+	}
+	if txn.Operation == Withdraw {
+		withdrawReq := WithdrawReq{
+			Amount:      txn.Amount.InexactFloat64(),
+			Currency:    txn.Currency,
+			ReferenceID: txn.ReferenceId,
+			AccountID:   txn.AccountId,
+		}
+		if _, gatewayErr := gateway.ProcessWithdrawal(withdrawReq, server.config.ServiceCallbackEndpoint); gatewayErr != nil {
+			return NewError(ErrInternal, CodeGatewayError, "error processing withdrawal").Wrap(gatewayErr)
+		}
+		return nil
+	}
+	if txn.IsAuthorization() {
+		authorizeReq := AuthorizeReq{
+			Amount:      txn.Amount.InexactFloat64(),
+			Currency:    txn.Currency,
+			ReferenceID: txn.ReferenceId,
+			AccountID:   txn.AccountId,
+		}
+		if _, gatewayErr := gateway.ProcessAuthorization(authorizeReq, server.config.ServiceCallbackEndpoint); gatewayErr != nil {
+			return NewError(ErrInternal, CodeGatewayError, "error processing authorization").Wrap(gatewayErr)
+		}
+		return nil
 	}
-
-	referenceId := uuid.NewString()
-	txn := &Transaction{
-		ReferenceId: referenceId,
-		AccountId:   req.AccountID,
-		GatewayId:   req.GatewayID,
-		Amount:      decimal.NewFromFloat(req.Amount),
-		Currency:    req.Currency,
-		Status:      StatusPending,
-		Operation:   Withdraw,
-		Ts:          time.Now(),
+	depositReq := DepositReq{
+		Amount:      txn.Amount.InexactFloat64(),
+		Currency:    txn.Currency,
+		ReferenceID: txn.ReferenceId,
+		AccountID:   txn.AccountId,
 	}
-
-	withdrawReq := WithdrawReq{
-		Amount:      req.Amount,
-		Currency:    req.Currency,
-		ReferenceID: referenceId,
-		AccountID:   req.AccountID,
+	if _, gatewayErr := gateway.ProcessDeposit(depositReq, server.config.ServiceCallbackEndpoint); gatewayErr != nil {
+		return NewError(ErrInternal, CodeGatewayError, "error processing deposit").Wrap(gatewayErr)
 	}
+	return nil
+}
+
+// save stores txn within the velocity limits of settings, see
+// service.LimitService.Save. A transaction that is not stored gives up its
+// hold and quote and is answered with the reason.
+func (server *Server) save(w http.ResponseWriter, r *http.Request, operation string, settings MerchantSettings, txn *Transaction) bool {
+	trxErr := server.limits.Save(settings, txn)
+	if trxErr == nil {
+		return true
+	}
+	server.releaseFunds(*txn)
+	server.releaseQuote(*txn)
+	var limitErr *Error
+	if !errors.As(trxErr, &limitErr) {
+		trxErr = NewError(ErrInternal, CodeInternal, "error saving transaction").Wrap(trxErr)
+	}
+	server.writeError(w, r, operation, trxErr)
+	return false
+}
 
-	depositResp, gatewayErr := gateway.ProcessWithdrawal(withdrawReq, server.config.ServiceCallbackEndpoint)
-	if gatewayErr != nil {
-		http.Error(w, "error processing deposit", http.StatusInternalServerError)
-		server.logger.LogError("HandleDeposit: error processing deposit: %v", gatewayErr)
+// saveForReview stores a transaction flagged by risk screening without
+// dispatching it and answers 202 Accepted.
+func (server *Server) saveForReview(w http.ResponseWriter, r *http.Request, operation string, settings MerchantSettings, txn *Transaction) {
+	if !server.save(w, r, operation, settings, txn) {
 		return
 	}
+	server.logger.LogInfo("transaction held for review", "reference_id", txn.ReferenceId, "reasons", strings.Join(txn.Risk.Reasons, "; "))
+	server.writeJSON(w, operation, http.StatusAccepted, representation(r).Transaction(*txn))
+}
 
-	trxErr := server.rep.SaveTransaction(txn)
-	if trxErr != nil {
-		http.Error(w, "error saving transaction", http.StatusInternalServerError)
-		server.logger.LogError("HandleDeposit: error saving transaction: %v", trxErr)
-		return
+// decodeClientRequest validates a money movement request against the
+// registered gateways and the settings of the authenticated merchant. Requests
+// without gateway_id are routed by the merchant's routing rules. Limits are
+// checked once the transaction is converted, see convert.
+func (server *Server) decodeClientRequest(w http.ResponseWriter, r *http.Request, operation Operation) (ClientRequest, Merchant, error) {
+	var req ClientRequest
+	decodeErr := validation.DecodeJSON(w, r, &req, server.maxBodyBytes())
+	if decodeErr != nil {
+		return req, Merchant{}, decodeErr
 	}
 
-	response := map[string]interface{}{
-		"transaction_status": txn.Status,
-		"operation_type":     Deposit,
-		"gateway":            depositResp.Gateway,
-		"account_id":         req.AccountID,
-		"reference_id":       txn.ReferenceId,
+	// without a merchant the request is still validated, then rejected as unauthenticated
+	merchant, merchantErr := server.merchant(r)
+	settings := merchant.Settings
+	if req.GatewayID == "" {
+		req.GatewayID = settings.Route(operation, req.Currency)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	encoderErr := json.NewEncoder(w).Encode(response)
-	if encoderErr != nil {
-		server.logger.LogError("HandleDeposit: error encoding response: %v", encoderErr)
+	// names can only be screened against the sanctions list when they are given
+	beneficiaryRequired := operation == Withdraw && server.risk != nil && server.risk.RequiresBeneficiary()
+	validationErr := validation.ValidateClientRequest(req, func(gatewayId string) bool {
+		_, exists := server.gateways[gatewayId]
+		return exists && settings.GatewayEnabled(gatewayId)
+	}, beneficiaryRequired)
+	if validationErr != nil {
+		return req, merchant, validationErr
 	}
+	if merchantErr != nil {
+		return req, merchant, merchantErr
+	}
+	// accounts are assigned to merchants up front, see `merchant assign-account`
+	if _, accountErr := server.authorizeAccount(r, req.AccountID); accountErr != nil {
+		return req, merchant, accountErr
+	}
+	return req, merchant, nil
 }
 
-func (server *Server) HandleCallback(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		return
+// convert books txn in the account currency requested by req and checks it
+// against the merchant's limits in that currency, so a request in another
+// currency cannot get around them. A transaction over a limit gives its quote
+// back, see releaseQuote.
+func (server *Server) convert(txn *Transaction, req ClientRequest, merchant Merchant) error {
+	if fxErr := server.fx.Convert(txn, req.AccountCurrency, req.FxQuoteId); fxErr != nil {
+		return fxErr
 	}
+	if limitErr := server.limits.Check(merchant.Settings, *txn); limitErr != nil {
+		server.releaseQuote(*txn)
+		return limitErr
+	}
+	return nil
+}
 
-	body, readErr := io.ReadAll(r.Body)
+func (server *Server) maxBodyBytes() int64 {
+	if server.config == nil || server.config.MaxBodyBytes <= 0 {
+		return validation.DefaultMaxBodyBytes
+	}
+	return server.config.MaxBodyBytes
+}
+
+func (server *Server) HandleCallback(w http.ResponseWriter, r *http.Request) {
+	body, readErr := io.ReadAll(http.MaxBytesReader(w, r.Body, server.maxBodyBytes()))
 	if readErr != nil {
-		server.logger.LogError("HandleCallback: error reading request body: %v", readErr)
-		http.Error(w, "error reading request body", http.StatusBadRequest)
+		server.writeError(w, r, "HandleCallback", NewError(ErrInvalidInput, CodeInvalidRequestBody, "error reading request body").Wrap(readErr))
 		return
 	}
 	defer r.Body.Close()
+	// nothing is read from an unsigned body, it could credit any account
+	if authErr := server.authenticateCallback(r, body); authErr != nil {
+		server.writeError(w, r, "HandleCallback", authErr)
+		return
+	}
 
 	var req CallbackPayload
 	decodeErr := json.Unmarshal(body, &req)
 	if decodeErr != nil {
-		server.logger.LogError("HandleCallback: error decoding request body: %v", decodeErr)
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		server.writeError(w, r, "HandleCallback", NewError(ErrInvalidInput, CodeInvalidRequestBody, "invalid request body").Wrap(decodeErr))
+		return
+	}
+
+	if req.ReferenceId == "" || req.Status == "" {
+		server.writeError(w, r, "HandleCallback", NewError(ErrInvalidInput, CodeValidationFailed, "missing or invalid fields in request body"))
 		return
 	}
 
-	trxErr := server.rep.UpdateTransaction(&Transaction{
+	status := TransactionStatus(req.Status)
+	// REVIEW is set by risk screening only, captures and voids are answered
+	// synchronously, see HandleCaptureTransaction
+	if !status.Valid() || status == StatusReview || status == StatusCaptured || status == StatusVoided {
+		server.writeError(w, r, "HandleCallback", NewError(ErrUnprocessable, CodeUnknownStatus, "unknown transaction status %s", req.Status))
+		return
+	}
+
+	txn := &Transaction{
 		Id:          req.TransactionId,
 		ReferenceId: req.ReferenceId,
-		Status:      TransactionStatus(req.Status),
+		Status:      status,
 		Message:     req.Message,
-	})
+	}
+	trxErr := server.rep.UpdateTransaction(txn)
 	if trxErr != nil {
-		http.Error(w, "error updating transaction", http.StatusInternalServerError)
-		server.logger.LogError("HandleCallback: error saving transaction: %v", trxErr)
+		server.writeError(w, r, "HandleCallback", trxErr)
+		return
+	}
+	// failing here makes the provider retry the callback, the update above is idempotent
+	if bookErr := server.bookTransaction(*txn); bookErr != nil {
+		server.writeError(w, r, "HandleCallback", bookErr)
 		return
 	}
-	fmt.Println(string(body))
+	if publishErr := server.publishTransactionEvent(*txn); publishErr != nil {
+		server.writeError(w, r, "HandleCallback", publishErr)
+		return
+	}
+	server.logger.LogInfo("callback processed", "reference_id", req.ReferenceId, "status", req.Status)
 }
 
+// HandleGetTransaction is the deprecated body-based lookup, superseded by
+// HandleGetTransactionByReference.
 func (server *Server) HandleGetTransaction(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+	setDeprecated(w, "/v1/transactions/{reference_id}")
 
 	var transactionReq GetTransactionRequest
-	decodeErr := json.NewDecoder(r.Body).Decode(&transactionReq)
+	decodeErr := validation.DecodeJSON(w, r, &transactionReq, server.maxBodyBytes())
 	if decodeErr != nil {
-		server.logger.LogError("HandleGetTransaction: error decoding request body: %v", decodeErr)
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		server.writeError(w, r, "HandleGetTransaction", decodeErr)
+		return
 	}
 
-	if transactionReq.ReferenceId == "" {
-		http.Error(w, "missing or invalid fields in request body", http.StatusBadRequest)
+	v := &validation.Validator{}
+	v.Required("reference_id", transactionReq.ReferenceId)
+	if validationErr := v.Err(); validationErr != nil {
+		server.writeError(w, r, "HandleGetTransaction", validationErr)
+		return
 	}
 
-	transaction, trErr := server.rep.GetTransaction(transactionReq.ReferenceId)
-	if trErr != nil {
-		server.logger.LogError("HandleGetTransaction: error getting transaction: %v", trErr)
-		http.Error(w, "error getting transaction", http.StatusInternalServerError)
+	merchant, merchantErr := server.merchant(r)
+	if merchantErr != nil {
+		server.writeError(w, r, "HandleGetTransaction", merchantErr)
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	encoderErr := json.NewEncoder(w).Encode(transaction)
-	if encoderErr != nil {
-		server.logger.LogError("HandleGetTransaction: error encoding response: %v", encoderErr)
+	transaction, trErr := server.rep.GetTransaction(merchant.Id, transactionReq.ReferenceId)
+	if trErr != nil {
+		server.writeError(w, r, "HandleGetTransaction", trErr)
+		return
 	}
+
+	server.writeJSON(w, "HandleGetTransaction", http.StatusOK, representation(r).Transaction(transaction))
 }
 
+// HandleGetTransactions is the deprecated body-based listing, superseded by
+// HandleGetAccountTransactions. It only returns the newest MaxPageSize transactions.
 func (server *Server) HandleGetTransactions(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+	setDeprecated(w, "/v1/accounts/{account_id}/transactions")
 
 	var transactionReq GetTransactionsRequest
-	decodeErr := json.NewDecoder(r.Body).Decode(&transactionReq)
+	decodeErr := validation.DecodeJSON(w, r, &transactionReq, server.maxBodyBytes())
 	if decodeErr != nil {
-		server.logger.LogError("HandleGetTransaction: error decoding request body: %v", decodeErr)
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		server.writeError(w, r, "HandleGetTransactions", decodeErr)
+		return
 	}
 
-	if transactionReq.AccountId == "" {
-		http.Error(w, "missing or invalid fields in request body", http.StatusBadRequest)
+	v := &validation.Validator{}
+	v.AccountId("account_id", transactionReq.AccountId)
+	if validationErr := v.Err(); validationErr != nil {
+		server.writeError(w, r, "HandleGetTransactions", validationErr)
+		return
+	}
+
+	merchant, authErr := server.authorizeAccount(r, transactionReq.AccountId)
+	if authErr != nil {
+		server.writeError(w, r, "HandleGetTransactions", authErr)
+		return
 	}
 
-	transaction, trErr := server.rep.GetTransactions(transactionReq.AccountId)
+	page, trErr := server.rep.GetTransactions(merchant.Id, transactionReq.AccountId, TransactionFilter{}, PageRequest{Limit: MaxPageSize})
 	if trErr != nil {
-		server.logger.LogError("HandleGetTransaction: error getting transaction: %v", trErr)
-		http.Error(w, "error getting transaction", http.StatusInternalServerError)
+		server.writeError(w, r, "HandleGetTransactions", trErr)
+		return
 	}
 
+	server.writeJSON(w, "HandleGetTransactions", http.StatusOK, representation(r).Transactions(page.Transactions))
+}
+
+func (server *Server) writeJSON(w http.ResponseWriter, operation string, status int, body interface{}) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	encoderErr := json.NewEncoder(w).Encode(transaction)
+	w.WriteHeader(status)
+	encoderErr := json.NewEncoder(w).Encode(body)
 	if encoderErr != nil {
-		server.logger.LogError("HandleGetTransaction: error encoding response: %v", encoderErr)
+		server.logger.LogError(operation+": error encoding response: %v", encoderErr)
 	}
 }
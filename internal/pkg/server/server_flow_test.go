@@ -0,0 +1,615 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dinowar/gateway-service/internal/pkg/config"
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/server"
+	"github.com/dinowar/gateway-service/internal/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type fakeGateway struct {
+	id          string
+	deposits    []model.DepositReq
+	withdrawals []model.WithdrawReq
+	captures    []model.CaptureReq
+	voids       []model.VoidReq
+	err         error
+	// declined makes the gateway decline captures and voids
+	declined bool
+	// dispatched runs before a deposit or withdrawal is answered, like a
+	// provider calling back early
+	dispatched func(referenceId string)
+	// settling runs before a capture or void is answered
+	settling func(referenceId string)
+}
+
+func (gw *fakeGateway) ProcessDeposit(req model.DepositReq, callbackUrl string) (*model.DepositResponse, error) {
+	if gw.err != nil {
+		return &model.DepositResponse{}, gw.err
+	}
+	gw.deposits = append(gw.deposits, req)
+	if gw.dispatched != nil {
+		gw.dispatched(req.ReferenceID)
+	}
+	return &model.DepositResponse{Gateway: gw.id, Status: model.StatusPending}, nil
+}
+
+func (gw *fakeGateway) ProcessWithdrawal(req model.WithdrawReq, callbackUrl string) (*model.WithdrawResponse, error) {
+	if gw.err != nil {
+		return &model.WithdrawResponse{}, gw.err
+	}
+	gw.withdrawals = append(gw.withdrawals, req)
+	if gw.dispatched != nil {
+		gw.dispatched(req.ReferenceID)
+	}
+	return &model.WithdrawResponse{Gateway: gw.id, Status: model.StatusPending}, nil
+}
+
+func (gw *fakeGateway) ProcessAuthorization(req model.AuthorizeReq, callbackUrl string) (*model.AuthorizeResponse, error) {
+	if gw.err != nil {
+		return &model.AuthorizeResponse{}, gw.err
+	}
+	return &model.AuthorizeResponse{Gateway: gw.id, Status: model.StatusPending}, nil
+}
+
+func (gw *fakeGateway) ProcessCapture(req model.CaptureReq) (*model.CaptureResponse, error) {
+	if gw.err != nil {
+		return &model.CaptureResponse{}, gw.err
+	}
+	if gw.settling != nil {
+		gw.settling(req.ReferenceID)
+	}
+	if gw.declined {
+		return &model.CaptureResponse{Gateway: gw.id, Status: model.StatusFailed, Message: "capture declined"}, nil
+	}
+	gw.captures = append(gw.captures, req)
+	return &model.CaptureResponse{Gateway: gw.id, TransactionID: req.TransactionID, Status: model.StatusCaptured, Message: "captured"}, nil
+}
+
+func (gw *fakeGateway) ProcessVoid(req model.VoidReq) (*model.VoidResponse, error) {
+	if gw.err != nil {
+		return &model.VoidResponse{}, gw.err
+	}
+	if gw.settling != nil {
+		gw.settling(req.ReferenceID)
+	}
+	if gw.declined {
+		return &model.VoidResponse{Gateway: gw.id, Status: model.StatusFailed, Message: "void declined"}, nil
+	}
+	gw.voids = append(gw.voids, req)
+	return &model.VoidResponse{Gateway: gw.id, TransactionID: req.TransactionID, Status: model.StatusVoided, Message: "voided"}, nil
+}
+
+type testEnv struct {
+	server   *server.Server
+	rep      *service.MemoryRepositoryService
+	auth     *service.AuthService
+	webhooks *service.WebhookService
+	broker   *service.TransactionBroker
+	ledger   *service.LedgerService
+	gateway  *fakeGateway
+	// merchant owns apiKey, the key every helper request is sent with
+	merchant model.Merchant
+	apiKey   string
+}
+
+const testAdminKey = "admin-0123456789abcdef0123456789abcdef"
+
+// callback secret of the rest gateway, see postCallback
+const testCallbackSecret = "rest-callback-0123456789abcdef0123456789abcdef"
+
+// reviewer keys, see config.ServiceConfig.ReviewerAPIKeys
+const (
+	testAliceKey = "alice-0123456789abcdef0123456789abcdef"
+	testBobKey   = "bob-0123456789abcdef0123456789abcdef"
+)
+
+// testAccounts are assigned to the env's merchant, as `merchant assign-account` would.
+var testAccounts = []string{"ACC123", "ACC456", "ACC666", "ACC777"}
+
+// newTestEnv serves one merchant through a fake "rest" gateway; opts are
+// applied after the defaults.
+func newTestEnv(t *testing.T, opts ...server.Option) *testEnv {
+	t.Helper()
+	return newTestEnvWithRepository(t, service.NewMemoryRepositoryService(), opts...)
+}
+
+// newTestEnvWithRepository is newTestEnv on rep, for options of services
+// that share the env's repository.
+func newTestEnvWithRepository(t *testing.T, rep *service.MemoryRepositoryService, opts ...server.Option) *testEnv {
+	t.Helper()
+
+	auth := service.NewAuthService(rep)
+	gateway := &fakeGateway{id: "rest"}
+	logger := service.NewLogService(zap.NewNop())
+	webhooks := service.NewWebhookService(rep, rep, logger, http.DefaultClient, config.WebhookConfig{
+		PollInterval: 1, Timeout: 1, MaxAttempts: 1, RetryBase: 1, BatchSize: 10,
+	})
+	broker := service.NewTransactionBroker()
+	rep.PublishUpdates(broker)
+	ledger := service.NewLedgerService(rep)
+	options := []server.Option{server.WithAuthService(auth), server.WithWebhookService(webhooks), server.WithTransactionBroker(broker),
+		server.WithLedgerService(ledger), server.WithReviewService(service.NewReviewService(rep))}
+	appServer := server.NewAppServer(rep, logger, &config.ServiceConfig{
+		ServiceCallbackEndpoint: "http://localhost:9090/callback",
+		RestGatewayConfig:       config.RestGatewayConfig{GatewayId: "rest", CallbackSecret: testCallbackSecret},
+		AdminAPIKey:             testAdminKey,
+		ReviewerAPIKeys:         map[string]string{"alice": testAliceKey, "bob": testBobKey},
+	}, append(options, opts...)...)
+	appServer.RegisterGateway("rest", gateway)
+
+	env := &testEnv{server: appServer, rep: rep, auth: auth, webhooks: webhooks, broker: broker, ledger: ledger, gateway: gateway}
+	env.apiKey = env.newMerchant(t, "acme", testAccounts...)
+	merchant, authErr := auth.Authenticate(env.apiKey)
+	require.NoError(t, authErr)
+	env.merchant = merchant
+	return env
+}
+
+// decodeTransaction requires recorder to answer 200 with a transaction.
+func decodeTransaction(t *testing.T, recorder *httptest.ResponseRecorder) server.TransactionResponse {
+	t.Helper()
+
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var txn server.TransactionResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &txn))
+	return txn
+}
+
+// newMerchant creates a merchant owning accounts and returns a fresh API key of it.
+func (env *testEnv) newMerchant(t *testing.T, name string, accounts ...string) string {
+	t.Helper()
+
+	merchant, createErr := env.auth.CreateMerchant(name)
+	require.NoError(t, createErr)
+	for _, accountId := range accounts {
+		require.NoError(t, env.auth.ClaimAccount(merchant, accountId))
+	}
+	apiKey, _, issueErr := env.auth.IssueAPIKey(merchant.Id)
+	require.NoError(t, issueErr)
+	return apiKey
+}
+
+// configure replaces the settings of the env's merchant.
+func (env *testEnv) configure(t *testing.T, settings model.MerchantSettings) {
+	t.Helper()
+	require.NoError(t, env.auth.ConfigureMerchant(env.merchant.Id, settings))
+}
+
+// addGateway registers a fake gateway next to "rest".
+func (env *testEnv) addGateway(id string) *fakeGateway {
+	gateway := &fakeGateway{id: id}
+	env.server.RegisterGateway(id, gateway)
+	return gateway
+}
+
+func (env *testEnv) do(handler http.HandlerFunc, method, target string, body interface{}) *httptest.ResponseRecorder {
+	var reqBody bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&reqBody).Encode(body)
+	}
+	req := httptest.NewRequest(method, target, &reqBody)
+	req.Header.Set("Authorization", "Bearer "+env.apiKey)
+	recorder := httptest.NewRecorder()
+	env.server.Authenticate(handler).ServeHTTP(recorder, req)
+	return recorder
+}
+
+func (env *testEnv) deposit(t *testing.T, accountId string) string {
+	t.Helper()
+
+	recorder := env.do(env.server.HandleDeposit, http.MethodPost, "/deposit", map[string]interface{}{
+		"amount":     100.5,
+		"currency":   "USD",
+		"account_id": accountId,
+		"gateway_id": "rest",
+	})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	return response["reference_id"].(string)
+}
+
+func TestFlow_DepositCallbackAndLookup(t *testing.T) {
+	env := newTestEnv(t)
+
+	referenceId := env.deposit(t, "ACC123")
+	require.Len(t, env.gateway.deposits, 1)
+	assert.Equal(t, referenceId, env.gateway.deposits[0].ReferenceID)
+
+	stored, getErr := env.rep.GetTransaction(env.merchant.Id, referenceId)
+	require.NoError(t, getErr)
+	assert.Equal(t, model.StatusPending, stored.Status)
+
+	recorder := postCallback(env.server.Routes(), model.CallbackPayload{
+		TransactionId: "provider-1",
+		ReferenceId:   referenceId,
+		Status:        string(model.StatusSuccess),
+		Message:       "deposit processed successfully",
+	})
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = env.do(env.server.HandleGetTransaction, http.MethodGet, "/transaction", model.GetTransactionRequest{ReferenceId: referenceId})
+	txn := decodeTransaction(t, recorder)
+	assert.Equal(t, model.StatusSuccess, txn.Status)
+	assert.Equal(t, "provider-1", txn.GatewayTransactionId)
+	assert.Equal(t, "ACC123", txn.AccountId)
+}
+
+func TestFlow_ListAccountTransactions(t *testing.T) {
+	env := newTestEnv(t)
+
+	first := env.deposit(t, "ACC123")
+	second := env.deposit(t, "ACC123")
+	env.deposit(t, "ACC456")
+
+	recorder := env.do(env.server.HandleGetTransactions, http.MethodGet, "/transactions", model.GetTransactionsRequest{AccountId: "ACC123"})
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var transactions []server.TransactionResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &transactions))
+	require.Len(t, transactions, 2)
+	assert.ElementsMatch(t, []string{first, second}, []string{transactions[0].ReferenceId, transactions[1].ReferenceId})
+}
+
+func TestFlow_GatewayErrorFailsTransaction(t *testing.T) {
+	env := newTestEnv(t)
+	env.fund(t, "ACC123", "USD", "10")
+	env.gateway.err = assert.AnError
+
+	recorder := env.do(env.server.HandleWithdraw, http.MethodPost, "/withdraw", map[string]interface{}{
+		"amount":     10,
+		"currency":   "USD",
+		"account_id": "ACC123",
+		"gateway_id": "rest",
+	})
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+
+	page, listErr := env.rep.GetTransactions(env.merchant.Id, "ACC123", model.TransactionFilter{}, model.PageRequest{})
+	require.NoError(t, listErr)
+	require.Len(t, page.Transactions, 1)
+	assert.Equal(t, model.StatusFailed, page.Transactions[0].Status)
+
+	balances, balancesErr := env.ledger.Balances(env.merchant.Id, "ACC123")
+	require.NoError(t, balancesErr)
+	assert.True(t, balances[0].Held.IsZero(), "the hold of an undispatched withdrawal is released")
+}
+
+// failingSaveRepository cannot store new transactions.
+type failingSaveRepository struct {
+	*service.MemoryRepositoryService
+}
+
+func (rep failingSaveRepository) SaveTransaction(*model.Transaction) error {
+	return assert.AnError
+}
+
+func TestFlow_SaveErrorReleasesHold(t *testing.T) {
+	env := newTestEnv(t)
+	env.fund(t, "ACC123", "USD", "10")
+	appServer := server.NewAppServer(failingSaveRepository{env.rep}, service.NewLogService(zap.NewNop()), &config.ServiceConfig{},
+		server.WithAuthService(env.auth), server.WithLedgerService(env.ledger))
+	appServer.RegisterGateway("rest", env.gateway)
+
+	recorder := route(appServer.Routes(), http.MethodPost, "/v1/withdraw", env.apiKey, map[string]interface{}{
+		"amount":     10,
+		"currency":   "USD",
+		"account_id": "ACC123",
+		"gateway_id": "rest",
+	})
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.Empty(t, env.gateway.withdrawals, "a transaction that was not stored is not dispatched")
+
+	balances, balancesErr := env.ledger.Balances(env.merchant.Id, "ACC123")
+	require.NoError(t, balancesErr)
+	assert.True(t, balances[0].Held.IsZero())
+	assert.Equal(t, "10", balances[0].Available().String())
+}
+
+func TestFlow_CallbackBeforeGatewayAnswers(t *testing.T) {
+	env := newTestEnv(t)
+	routes := env.server.Routes()
+	callbacks := 0
+	env.gateway.dispatched = func(referenceId string) {
+		callback := model.CallbackPayload{ReferenceId: referenceId, Status: string(model.StatusSuccess)}
+		recorder := postCallback(routes, callback)
+		assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		callbacks++
+	}
+
+	referenceId := env.deposit(t, "ACC123")
+	require.Equal(t, 1, callbacks)
+
+	stored, getErr := env.rep.GetTransaction(env.merchant.Id, referenceId)
+	require.NoError(t, getErr)
+	assert.Equal(t, model.StatusSuccess, stored.Status)
+}
+
+func TestHandleGetTransaction_NotFound(t *testing.T) {
+	env := newTestEnv(t)
+
+	recorder := env.do(env.server.HandleGetTransaction, http.MethodGet, "/transaction", model.GetTransactionRequest{ReferenceId: "missing"})
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Equal(t, "transaction_not_found", decodeProblem(t, recorder).Code)
+	assert.Equal(t, "transaction missing not found", decodeProblem(t, recorder).Detail)
+}
+
+func TestHandleGetTransaction_MissingReference(t *testing.T) {
+	env := newTestEnv(t)
+
+	recorder := env.do(env.server.HandleGetTransaction, http.MethodGet, "/transaction", model.GetTransactionRequest{})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, "validation_failed", decodeProblem(t, recorder).Code)
+}
+
+func TestHandleGetTransaction_InvalidBody(t *testing.T) {
+	env := newTestEnv(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/transaction", strings.NewReader("{"))
+	recorder := httptest.NewRecorder()
+	env.server.HandleGetTransaction(recorder, req)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, "invalid_request_body", decodeProblem(t, recorder).Code)
+}
+
+func TestHandleGetTransactions_MissingAccount(t *testing.T) {
+	env := newTestEnv(t)
+
+	recorder := env.do(env.server.HandleGetTransactions, http.MethodGet, "/transactions", model.GetTransactionsRequest{})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestHandleCallback_UnknownReference(t *testing.T) {
+	env := newTestEnv(t)
+
+	recorder := postCallback(env.server.Routes(), model.CallbackPayload{
+		ReferenceId: "missing",
+		Status:      string(model.StatusSuccess),
+	})
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Equal(t, "transaction_not_found", decodeProblem(t, recorder).Code)
+}
+
+func TestHandleCallback_AlreadyFinal(t *testing.T) {
+	env := newTestEnv(t)
+	referenceId := env.deposit(t, "ACC123")
+
+	recorder := postCallback(env.server.Routes(), model.CallbackPayload{ReferenceId: referenceId, Status: string(model.StatusFailed)})
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = postCallback(env.server.Routes(), model.CallbackPayload{ReferenceId: referenceId, Status: string(model.StatusSuccess)})
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	problem := decodeProblem(t, recorder)
+	assert.Equal(t, "transaction_already_final", problem.Code)
+	assert.Equal(t, "transaction "+referenceId+" is already FAILED", problem.Detail)
+}
+
+func TestHandleCallback_UnknownStatus(t *testing.T) {
+	env := newTestEnv(t)
+	referenceId := env.deposit(t, "ACC123")
+
+	recorder := postCallback(env.server.Routes(), model.CallbackPayload{ReferenceId: referenceId, Status: "DONE"})
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	assert.Equal(t, "unknown_transaction_status", decodeProblem(t, recorder).Code)
+}
+
+func TestHandleCallback_MissingReference(t *testing.T) {
+	env := newTestEnv(t)
+
+	recorder := postCallback(env.server.Routes(), model.CallbackPayload{Status: string(model.StatusSuccess)})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestHandleDeposit_GatewayError(t *testing.T) {
+	env := newTestEnv(t)
+	env.gateway.err = assert.AnError
+
+	recorder := env.do(env.server.HandleDeposit, http.MethodPost, "/deposit", map[string]interface{}{
+		"amount":     10,
+		"currency":   "USD",
+		"account_id": "ACC123",
+		"gateway_id": "rest",
+	})
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	problem := decodeProblem(t, recorder)
+	assert.Equal(t, "gateway_error", problem.Code)
+	assert.Equal(t, "error processing deposit", problem.Detail)
+}
+
+func TestHandleDeposit_ReportsAllViolations(t *testing.T) {
+	env := newTestEnv(t)
+
+	recorder := env.do(env.server.HandleDeposit, http.MethodPost, "/deposit", map[string]interface{}{
+		"amount":     "10.123",
+		"currency":   "USD",
+		"account_id": "",
+		"gateway_id": "paypal",
+	})
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	problem := decodeProblem(t, recorder)
+	assert.Equal(t, "validation_failed", problem.Code)
+	fields := make(map[string]string)
+	for _, field := range problem.Errors {
+		fields[field.Field] = field.Code
+	}
+	assert.Equal(t, map[string]string{
+		"amount":     "too_many_decimals",
+		"account_id": "required",
+		"gateway_id": "unknown_gateway",
+	}, fields)
+	assert.Empty(t, env.gateway.deposits)
+}
+
+func TestHandleWithdraw_UnknownField(t *testing.T) {
+	env := newTestEnv(t)
+
+	recorder := env.do(env.server.HandleWithdraw, http.MethodPost, "/withdraw", map[string]interface{}{
+		"amount":     10,
+		"currency":   "USD",
+		"account_id": "ACC123",
+		"gateway_id": "rest",
+		"gateway":    "soap",
+	})
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, "invalid_request_body", decodeProblem(t, recorder).Code)
+}
+
+func TestHandleDeposit_BodyTooLarge(t *testing.T) {
+	env := newTestEnv(t)
+
+	body := `{"amount": 10, "currency": "USD", "account_id": "` + strings.Repeat("A", 2<<20) + `", "gateway_id": "rest"}`
+	req := httptest.NewRequest(http.MethodPost, "/deposit", strings.NewReader(body))
+	recorder := httptest.NewRecorder()
+	env.server.HandleDeposit(recorder, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+	assert.Equal(t, "request_too_large", decodeProblem(t, recorder).Code)
+}
+
+func (env *testEnv) get(handler http.HandlerFunc, target string, pathValues map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("Authorization", "Bearer "+env.apiKey)
+	for name, value := range pathValues {
+		req.SetPathValue(name, value)
+	}
+	recorder := httptest.NewRecorder()
+	env.server.Authenticate(handler).ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestHandleGetTransactionByReference(t *testing.T) {
+	env := newTestEnv(t)
+	referenceId := env.deposit(t, "ACC123")
+
+	recorder := env.get(env.server.HandleGetTransactionByReference, "/transactions/"+referenceId, map[string]string{"reference_id": referenceId})
+	txn := decodeTransaction(t, recorder)
+	assert.Empty(t, recorder.Header().Get("Deprecation"))
+	assert.Equal(t, referenceId, txn.ReferenceId)
+
+	recorder = env.get(env.server.HandleGetTransactionByReference, "/transactions/missing", map[string]string{"reference_id": "missing"})
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestHandleGetAccountTransactions_Filters(t *testing.T) {
+	env := newTestEnv(t)
+	env.fund(t, "ACC123", "USD", "10")
+	deposit := env.deposit(t, "ACC123")
+	recorder := env.do(env.server.HandleWithdraw, http.MethodPost, "/withdraw", map[string]interface{}{
+		"amount":     10,
+		"currency":   "USD",
+		"account_id": "ACC123",
+		"gateway_id": "rest",
+	})
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = env.get(env.server.HandleGetAccountTransactions, "/accounts/ACC123/transactions?operation=deposit&status=pending&currency=usd&min_amount=50", map[string]string{"account_id": "ACC123"})
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	page := decodePage(t, recorder)
+	require.Len(t, page.Transactions, 1)
+	assert.Equal(t, deposit, page.Transactions[0].ReferenceId)
+	assert.Empty(t, page.NextCursor)
+
+	recorder = env.get(env.server.HandleGetAccountTransactions, "/accounts/ACC123/transactions?status=FAILED", map[string]string{"account_id": "ACC123"})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"transactions": []}`, recorder.Body.String())
+}
+
+func decodePage(t *testing.T, recorder *httptest.ResponseRecorder) server.TransactionPageResponse {
+	t.Helper()
+
+	var page server.TransactionPageResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &page))
+	return page
+}
+
+func TestHandleGetAccountTransactions_Pagination(t *testing.T) {
+	env := newTestEnv(t)
+	var created []string
+	for i := 0; i < 3; i++ {
+		created = append(created, env.deposit(t, "ACC123"))
+	}
+
+	var seen []string
+	target := "/accounts/ACC123/transactions?limit=2"
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 2, "listing must end after two pages")
+		recorder := env.get(env.server.HandleGetAccountTransactions, target, map[string]string{"account_id": "ACC123"})
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+		page := decodePage(t, recorder)
+		for _, txn := range page.Transactions {
+			seen = append(seen, txn.ReferenceId)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		target = "/accounts/ACC123/transactions?limit=2&cursor=" + page.NextCursor
+	}
+	assert.ElementsMatch(t, created, seen)
+	assert.Len(t, seen, 3)
+}
+
+func TestHandleGetAccountTransactions_InvalidFilters(t *testing.T) {
+	env := newTestEnv(t)
+
+	recorder := env.get(env.server.HandleGetAccountTransactions, "/accounts/ACC123/transactions?status=DONE&operation=Refund&gateway_id=paypal", map[string]string{"account_id": "ACC123"})
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	problem := decodeProblem(t, recorder)
+	fields := make([]string, 0, len(problem.Errors))
+	for _, field := range problem.Errors {
+		fields = append(fields, field.Field)
+	}
+	assert.ElementsMatch(t, []string{"status", "operation", "gateway_id"}, fields)
+
+	recorder = env.get(env.server.HandleGetAccountTransactions,
+		"/accounts/ACC123/transactions?limit=500&cursor=bogus&currency=XYZ&min_amount=-1&from=yesterday&to=2024-01-01T00:00:00Z",
+		map[string]string{"account_id": "ACC123"})
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	problem = decodeProblem(t, recorder)
+	fields = fields[:0]
+	for _, field := range problem.Errors {
+		fields = append(fields, field.Field)
+	}
+	assert.ElementsMatch(t, []string{"limit", "cursor", "currency", "min_amount", "from"}, fields)
+
+	recorder = env.get(env.server.HandleGetAccountTransactions,
+		"/accounts/ACC123/transactions?min_amount=10&max_amount=5&from=2024-02-01T00:00:00Z&to=2024-01-01T00:00:00Z",
+		map[string]string{"account_id": "ACC123"})
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	problem = decodeProblem(t, recorder)
+	fields = fields[:0]
+	for _, field := range problem.Errors {
+		fields = append(fields, field.Field)
+	}
+	assert.ElementsMatch(t, []string{"max_amount", "to"}, fields)
+}
+
+func TestLegacyLookups_AreDeprecated(t *testing.T) {
+	env := newTestEnv(t)
+	referenceId := env.deposit(t, "ACC123")
+
+	recorder := env.do(env.server.HandleGetTransaction, http.MethodGet, "/transaction", model.GetTransactionRequest{ReferenceId: referenceId})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "true", recorder.Header().Get("Deprecation"))
+	assert.Equal(t, `</v1/transactions/{reference_id}>; rel="successor-version"`, recorder.Header().Get("Link"))
+
+	recorder = env.do(env.server.HandleGetTransactions, http.MethodGet, "/transactions", model.GetTransactionsRequest{AccountId: "ACC123"})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "true", recorder.Header().Get("Deprecation"))
+}
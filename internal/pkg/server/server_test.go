@@ -2,17 +2,35 @@ package server_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
 	"github.com/dinowar/gateway-service/internal/pkg/server"
 	"github.com/dinowar/gateway-service/internal/pkg/service"
 	"github.com/golang/mock/gomock"
 	"go.uber.org/zap"
 )
 
+func decodeProblem(t *testing.T, recorder *httptest.ResponseRecorder) server.Problem {
+	t.Helper()
+
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/problem+json" {
+		t.Fatalf("handler returned unexpected content type: got %v want %v", contentType, "application/problem+json")
+	}
+	var problem server.Problem
+	if decodeErr := json.Unmarshal(recorder.Body.Bytes(), &problem); decodeErr != nil {
+		t.Fatalf("could not decode problem: %v", decodeErr)
+	}
+	if problem.Status != recorder.Code {
+		t.Errorf("problem status %v does not match response status %v", problem.Status, recorder.Code)
+	}
+	return problem
+}
+
 func TestHandleDeposit_InvalidMethod(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -22,25 +40,28 @@ func TestHandleDeposit_InvalidMethod(t *testing.T) {
 
 	appServer := server.NewAppServer(nil, logService, nil)
 
-	req, err := http.NewRequest(http.MethodGet, "/deposit", nil)
+	req, err := http.NewRequest(http.MethodGet, "/v1/deposit", nil)
 	if err != nil {
 		t.Fatalf("could not create request: %v", err)
 	}
 
 	recorder := httptest.NewRecorder()
 
-	handler := http.HandlerFunc(appServer.HandleDeposit)
-	handler.ServeHTTP(recorder, req)
+	appServer.Routes().ServeHTTP(recorder, req)
 
 	if status := recorder.Code; status != http.StatusMethodNotAllowed {
 		t.Errorf("handler returned wrong status code: got %v want %v",
 			status, http.StatusMethodNotAllowed)
 	}
 
-	expected := "method not allowed"
-	if strings.TrimSpace(recorder.Body.String()) != expected {
-		t.Errorf("handler returned unexpected body: got %v want %v",
-			recorder.Body.String(), expected)
+	if allow := recorder.Header().Get("Allow"); allow != http.MethodPost {
+		t.Errorf("handler returned unexpected Allow header: got %v want %v", allow, http.MethodPost)
+	}
+
+	problem := decodeProblem(t, recorder)
+	if problem.Code != "method_not_allowed" || problem.Detail != "method not allowed" {
+		t.Errorf("handler returned unexpected problem: got %+v want code %v detail %v",
+			problem, "method_not_allowed", "method not allowed")
 	}
 }
 
@@ -69,10 +90,10 @@ func TestHandleDeposit_InvalidBody(t *testing.T) {
 			status, http.StatusBadRequest)
 	}
 
-	expected := "invalid request body"
-	if strings.TrimSpace(recorder.Body.String()) != expected {
-		t.Errorf("handler returned unexpected body: got %v want %v",
-			recorder.Body.String(), expected)
+	problem := decodeProblem(t, recorder)
+	if problem.Code != "invalid_request_body" || problem.Detail != "invalid request body" {
+		t.Errorf("handler returned unexpected problem: got %+v want code %v detail %v",
+			problem, "invalid_request_body", "invalid request body")
 	}
 }
 
@@ -102,10 +123,10 @@ func TestHandleDeposit_MissingFields(t *testing.T) {
 			status, http.StatusBadRequest)
 	}
 
-	expected := "missing or invalid fields in request body"
-	if strings.TrimSpace(recorder.Body.String()) != expected {
-		t.Errorf("handler returned unexpected body: got %v want %v",
-			recorder.Body.String(), expected)
+	problem := decodeProblem(t, recorder)
+	if problem.Code != "validation_failed" || problem.Detail != "missing or invalid fields in request body" {
+		t.Errorf("handler returned unexpected problem: got %+v want code %v detail %v",
+			problem, "validation_failed", "missing or invalid fields in request body")
 	}
 }
 
@@ -139,10 +160,15 @@ func TestHandleWithdraw_GatewayNotFound(t *testing.T) {
 			status, http.StatusBadRequest)
 	}
 
-	expected := "gateway invalid_gateway not found"
-	if strings.TrimSpace(recorder.Body.String()) != expected {
-		t.Errorf("handler returned unexpected body: got %v want %v",
-			recorder.Body.String(), expected)
+	problem := decodeProblem(t, recorder)
+	if problem.Code != "gateway_not_found" || problem.Detail != "gateway invalid_gateway not found" || len(problem.Errors) != 1 {
+		t.Fatalf("handler returned unexpected problem: got %+v want code %v with one field error",
+			problem, "gateway_not_found")
+	}
+
+	expected := model.FieldError{Field: "gateway_id", Code: "unknown_gateway", Message: "gateway invalid_gateway not found"}
+	if problem.Errors[0] != expected {
+		t.Errorf("handler returned unexpected field error: got %+v want %+v", problem.Errors[0], expected)
 	}
 }
 
@@ -176,9 +202,83 @@ func TestHandleDeposit_InvalidAmount(t *testing.T) {
 			status, http.StatusBadRequest)
 	}
 
-	expected := "missing or invalid fields in request body"
-	if strings.TrimSpace(recorder.Body.String()) != expected {
-		t.Errorf("handler returned unexpected body: got %v want %v",
-			recorder.Body.String(), expected)
+	problem := decodeProblem(t, recorder)
+	if problem.Code != "validation_failed" || problem.Detail != "missing or invalid fields in request body" {
+		t.Errorf("handler returned unexpected problem: got %+v want code %v detail %v",
+			problem, "validation_failed", "missing or invalid fields in request body")
+	}
+}
+
+func TestHandleReadyz_NoHealthService(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	logService := service.NewLogService(logger)
+
+	appServer := server.NewAppServer(nil, logService, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/readyz", nil)
+	if err != nil {
+		t.Fatalf("could not create request: %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(appServer.HandleReadyz)
+	handler.ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusServiceUnavailable {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusServiceUnavailable)
+	}
+}
+
+func TestHandleHealthz_NoHealthService(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	logService := service.NewLogService(logger)
+
+	appServer := server.NewAppServer(nil, logService, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/healthz", nil)
+	if err != nil {
+		t.Fatalf("could not create request: %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(appServer.HandleHealthz)
+	handler.ServeHTTP(recorder, req)
+
+	if status := recorder.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+
+	if !strings.Contains(recorder.Body.String(), `"status":"UNKNOWN"`) {
+		t.Errorf("handler returned unexpected body: %v", recorder.Body.String())
+	}
+}
+
+func TestRequestId_PropagatedToProblem(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	logService := service.NewLogService(logger)
+
+	appServer := server.NewAppServer(nil, logService, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/v1/deposit", nil)
+	if err != nil {
+		t.Fatalf("could not create request: %v", err)
+	}
+	req.Header.Set("X-Request-Id", "req-123")
+
+	recorder := httptest.NewRecorder()
+
+	server.RequestId(appServer.Routes()).ServeHTTP(recorder, req)
+
+	if header := recorder.Header().Get("X-Request-Id"); header != "req-123" {
+		t.Errorf("handler returned unexpected request id header: got %v want %v", header, "req-123")
+	}
+
+	problem := decodeProblem(t, recorder)
+	if problem.RequestId != "req-123" || problem.Instance != "/v1/deposit" || problem.Type != "urn:gateway-service:problem:method_not_allowed" {
+		t.Errorf("handler returned unexpected problem: %+v", problem)
 	}
 }
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/service"
+	"github.com/dinowar/gateway-service/internal/pkg/validation"
+	"net/http"
+	"time"
+)
+
+// streamHeartbeat is how often an idle stream sends a comment, so proxies
+// and load balancers do not close it.
+const streamHeartbeat = 15 * time.Second
+
+// streamRetry is the reconnect delay, in milliseconds, EventSource clients are told to use.
+const streamRetry = 3000
+
+// WithTransactionBroker sets the broker streams subscribe to. Without one the
+// server uses a broker nothing publishes to.
+func WithTransactionBroker(broker *service.TransactionBroker) Option {
+	return func(server *Server) {
+		server.broker = broker
+	}
+}
+
+// HandleTransactionStream serves GET /transactions/{reference_id}/stream as
+// Server-Sent Events. It sends the current state of the transaction, then
+// every status change, and ends once the transaction's status is final:
+// SUCCESS, FAILED, CAPTURED or VOIDED, see TransactionStatus.Final.
+func (server *Server) HandleTransactionStream(w http.ResponseWriter, r *http.Request) {
+	referenceId := r.PathValue("reference_id")
+	v := &validation.Validator{}
+	v.Required("reference_id", referenceId)
+	if validationErr := v.Err(); validationErr != nil {
+		server.writeError(w, r, "HandleTransactionStream", validationErr)
+		return
+	}
+
+	merchant, merchantErr := server.merchant(r)
+	if merchantErr != nil {
+		server.writeError(w, r, "HandleTransactionStream", merchantErr)
+		return
+	}
+
+	// subscribe before reading, so no change between the two is lost
+	subscription := server.broker.SubscribeTransaction(merchant.Id, referenceId)
+	defer subscription.Close()
+	transaction, trErr := server.rep.GetTransaction(merchant.Id, referenceId)
+	if trErr != nil {
+		server.writeError(w, r, "HandleTransactionStream", trErr)
+		return
+	}
+
+	stream := server.startStream(w, r)
+	if !stream.send(transaction) || transaction.Status.Final() {
+		return
+	}
+	stream.follow(subscription, func(txn Transaction) bool {
+		return !txn.Status.Final()
+	})
+}
+
+// HandleAccountTransactionStream serves GET /accounts/{account_id}/transactions/stream
+// as Server-Sent Events, sending every status change of the account's
+// transactions until the client disconnects. Clients load the current state
+// from the listing after connecting.
+func (server *Server) HandleAccountTransactionStream(w http.ResponseWriter, r *http.Request) {
+	accountId := r.PathValue("account_id")
+	v := &validation.Validator{}
+	v.AccountId("account_id", accountId)
+	if validationErr := v.Err(); validationErr != nil {
+		server.writeError(w, r, "HandleAccountTransactionStream", validationErr)
+		return
+	}
+
+	merchant, authErr := server.authorizeAccount(r, accountId)
+	if authErr != nil {
+		server.writeError(w, r, "HandleAccountTransactionStream", authErr)
+		return
+	}
+
+	subscription := server.broker.SubscribeAccount(merchant.Id, accountId)
+	defer subscription.Close()
+	server.startStream(w, r).follow(subscription, func(Transaction) bool {
+		return true
+	})
+}
+
+type eventStream struct {
+	server     *Server
+	w          http.ResponseWriter
+	r          *http.Request
+	controller *http.ResponseController
+}
+
+// startStream answers the request with an event stream. The server's write
+// timeout is lifted for it, streams end on disconnect or shutdown instead.
+func (server *Server) startStream(w http.ResponseWriter, r *http.Request) *eventStream {
+	controller := http.NewResponseController(w)
+	if deadlineErr := controller.SetWriteDeadline(time.Time{}); deadlineErr != nil && !errors.Is(deadlineErr, http.ErrNotSupported) {
+		server.logger.LogError("clearing stream write deadline failed", deadlineErr)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry)
+	controller.Flush()
+	return &eventStream{server: server, w: w, r: r, controller: controller}
+}
+
+// follow sends the updates of subscription while more returns true for them.
+func (stream *eventStream) follow(subscription *service.TransactionSubscription, more func(Transaction) bool) {
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-stream.r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if !stream.write(": heartbeat\n\n") {
+				return
+			}
+		case txn, open := <-subscription.C:
+			if !open || !stream.send(txn) || !more(txn) {
+				return
+			}
+		}
+	}
+}
+
+// send writes txn as a `transaction` event in the representation of the request's API version.
+func (stream *eventStream) send(txn Transaction) bool {
+	data, encodeErr := json.Marshal(representation(stream.r).Transaction(txn))
+	if encodeErr != nil {
+		stream.server.logger.LogError("encoding stream event failed", encodeErr)
+		return false
+	}
+	return stream.write(fmt.Sprintf("event: transaction\nid: %s:%s\ndata: %s\n\n", txn.ReferenceId, txn.Status, data))
+}
+
+func (stream *eventStream) write(event string) bool {
+	if _, writeErr := fmt.Fprint(stream.w, event); writeErr != nil {
+		return false
+	}
+	return stream.controller.Flush() == nil
+}
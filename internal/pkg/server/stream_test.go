@@ -0,0 +1,168 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type streamEvent struct {
+	event, id string
+	data      server.TransactionResponse
+}
+
+// eventReader reads the transaction events of a Server-Sent Events response.
+type eventReader struct {
+	t       *testing.T
+	scanner *bufio.Scanner
+}
+
+func openStream(t *testing.T, ts *httptest.Server, path, apiKey string) (*http.Response, *eventReader) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+path, nil)
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	resp, respErr := ts.Client().Do(req)
+	require.NoError(t, respErr)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp, &eventReader{t: t, scanner: bufio.NewScanner(resp.Body)}
+}
+
+// next returns the following transaction event, skipping comments and the retry hint.
+func (reader *eventReader) next() streamEvent {
+	reader.t.Helper()
+
+	var event streamEvent
+	for reader.scanner.Scan() {
+		line := reader.scanner.Text()
+		if line == "" && event.event != "" {
+			return event
+		}
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "event":
+			event.event = value
+		case "id":
+			event.id = value
+		case "data":
+			require.NoError(reader.t, json.Unmarshal([]byte(value), &event.data))
+		}
+	}
+	reader.t.Fatalf("stream ended: %v", reader.scanner.Err())
+	return event
+}
+
+func (reader *eventReader) assertEnded() {
+	reader.t.Helper()
+
+	for reader.scanner.Scan() {
+		if line := reader.scanner.Text(); strings.HasPrefix(line, "event:") {
+			reader.t.Fatalf("unexpected %s after the final event", line)
+		}
+	}
+	assert.NoError(reader.t, reader.scanner.Err())
+}
+
+func TestTransactionStream_FollowsUntilFinal(t *testing.T) {
+	env := newTestEnv(t)
+	referenceId := env.deposit(t, "ACC123")
+	ts := httptest.NewServer(env.server.Routes())
+	defer ts.Close()
+
+	resp, events := openStream(t, ts, "/v1/transactions/"+referenceId+"/stream", env.apiKey)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", resp.Header.Get("Cache-Control"))
+
+	snapshot := events.next()
+	assert.Equal(t, "transaction", snapshot.event)
+	assert.Equal(t, referenceId+":PENDING", snapshot.id)
+	assert.Equal(t, model.StatusPending, snapshot.data.Status)
+
+	callback := model.CallbackPayload{ReferenceId: referenceId, Status: string(model.StatusSuccess)}
+	require.Equal(t, http.StatusOK, postCallback(ts.Config.Handler, callback).Code)
+
+	update := events.next()
+	assert.Equal(t, model.StatusSuccess, update.data.Status)
+	assert.Equal(t, referenceId, update.data.ReferenceId)
+	assert.Equal(t, "100.50", update.data.Amount)
+	events.assertEnded()
+}
+
+func TestTransactionStream_FinalTransactionEndsImmediately(t *testing.T) {
+	env := newTestEnv(t)
+	referenceId := env.deposit(t, "ACC123")
+	callback := model.CallbackPayload{ReferenceId: referenceId, Status: string(model.StatusFailed)}
+	require.Equal(t, http.StatusOK, postCallback(env.server.Routes(), callback).Code)
+	ts := httptest.NewServer(env.server.Routes())
+	defer ts.Close()
+
+	_, events := openStream(t, ts, "/v1/transactions/"+referenceId+"/stream", env.apiKey)
+	assert.Equal(t, model.StatusFailed, events.next().data.Status)
+	events.assertEnded()
+}
+
+func TestAccountTransactionStream(t *testing.T) {
+	env := newTestEnv(t)
+	first := env.deposit(t, "ACC123")
+	second := env.deposit(t, "ACC123")
+	elsewhere := env.deposit(t, "ACC456")
+	ts := httptest.NewServer(env.server.Routes())
+	defer ts.Close()
+
+	resp, events := openStream(t, ts, "/v1/accounts/ACC123/transactions/stream", env.apiKey)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	for _, callback := range []model.CallbackPayload{
+		{ReferenceId: elsewhere, Status: string(model.StatusSuccess)},
+		{ReferenceId: first, Status: string(model.StatusSuccess)},
+		{ReferenceId: second, Status: string(model.StatusFailed)},
+	} {
+		require.Equal(t, http.StatusOK, postCallback(ts.Config.Handler, callback).Code)
+	}
+
+	update := events.next()
+	assert.Equal(t, first, update.data.ReferenceId)
+	assert.Equal(t, model.StatusSuccess, update.data.Status)
+	update = events.next()
+	assert.Equal(t, second, update.data.ReferenceId)
+	assert.Equal(t, model.StatusFailed, update.data.Status)
+
+	env.broker.Close()
+	events.assertEnded()
+}
+
+func TestTransactionStreams_AreScopedToTheMerchant(t *testing.T) {
+	env := newTestEnv(t)
+	referenceId := env.deposit(t, "ACC123")
+	other := env.newMerchant(t, "other")
+	ts := httptest.NewServer(env.server.Routes())
+	defer ts.Close()
+
+	for path, status := range map[string]int{
+		"/v1/transactions/" + referenceId + "/stream": http.StatusNotFound,
+		"/v1/accounts/ACC123/transactions/stream":     http.StatusForbidden,
+		"/v1/accounts/ACC 123/transactions/stream":    http.StatusBadRequest,
+	} {
+		resp, _ := openStream(t, ts, strings.ReplaceAll(path, " ", "%20"), other)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, status, resp.StatusCode, "%s: %s", path, body)
+		assert.Equal(t, "application/problem+json", resp.Header.Get("Content-Type"))
+	}
+
+	resp, _ := openStream(t, ts, "/v1/transactions/"+referenceId+"/stream", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
@@ -0,0 +1,133 @@
+package server_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/server"
+	"github.com/dinowar/gateway-service/internal/pkg/validation"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerchantSettings_RoutesRequestsWithoutGateway(t *testing.T) {
+	env := newTestEnv(t)
+	soap := env.addGateway("soap")
+	env.configure(t, model.MerchantSettings{
+		RoutingRules: []model.RoutingRule{
+			{Operation: model.Withdraw, GatewayId: "soap"},
+			{Currency: "EUR", GatewayId: "soap"},
+			{GatewayId: "rest"},
+		},
+	})
+	routes := env.server.Routes()
+	env.fund(t, "ACC123", "USD", "10")
+
+	for _, tc := range []struct {
+		path, currency, gatewayId string
+	}{
+		{"/v1/deposit", "USD", "rest"},
+		{"/v1/deposit", "EUR", "soap"},
+		{"/v1/withdraw", "USD", "soap"},
+	} {
+		recorder := route(routes, http.MethodPost, tc.path, env.apiKey, map[string]interface{}{
+			"amount": "10", "currency": tc.currency, "account_id": "ACC123",
+		})
+		created := decodeTransaction(t, recorder)
+		assert.Equal(t, tc.gatewayId, created.GatewayId, tc.path+" "+tc.currency)
+	}
+	assert.Len(t, env.gateway.deposits, 1)
+	assert.Len(t, soap.deposits, 1)
+	assert.Len(t, soap.withdrawals, 1)
+
+	// an explicit gateway_id wins over the rules
+	recorder := route(routes, http.MethodPost, "/v1/deposit", env.apiKey, map[string]interface{}{
+		"amount": "10", "currency": "EUR", "account_id": "ACC123", "gateway_id": "rest",
+	})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Len(t, env.gateway.deposits, 2)
+}
+
+func TestMerchantSettings_WithoutRouteGatewayIsRequired(t *testing.T) {
+	env := newTestEnv(t)
+	env.addGateway("soap")
+	env.configure(t, model.MerchantSettings{})
+	routes := env.server.Routes()
+
+	recorder := route(routes, http.MethodPost, "/v1/deposit", env.apiKey, map[string]interface{}{
+		"amount": "10", "currency": "USD", "account_id": "ACC123",
+	})
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, validation.CodeRequired, fieldCode(decodeProblem(t, recorder), "gateway_id"))
+}
+
+func TestMerchantSettings_DisabledGatewaysAreUnknown(t *testing.T) {
+	env := newTestEnv(t)
+	soap := env.addGateway("soap")
+	env.configure(t, model.MerchantSettings{EnabledGateways: []string{"rest"}})
+	routes := env.server.Routes()
+	other := env.newMerchant(t, "other", "ACC999")
+
+	body := map[string]interface{}{"amount": "10", "currency": "USD", "account_id": "ACC123", "gateway_id": "soap"}
+	recorder := route(routes, http.MethodPost, "/v1/deposit", env.apiKey, body)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, validation.CodeUnknownGateway, fieldCode(decodeProblem(t, recorder), "gateway_id"))
+	assert.Empty(t, soap.deposits)
+
+	// settings are per merchant: the other merchant may still use every gateway
+	body["account_id"] = "ACC999"
+	recorder = route(routes, http.MethodPost, "/v1/deposit", other, body)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Len(t, soap.deposits, 1)
+}
+
+func TestMerchantSettings_Limits(t *testing.T) {
+	min, max := decimal.RequireFromString("5"), decimal.RequireFromString("100")
+	env := newTestEnv(t)
+	env.addGateway("soap")
+	env.configure(t, model.MerchantSettings{
+		Limits: []model.AmountLimit{
+			{Currency: "USD", Min: &min},
+			{Operation: model.Withdraw, Currency: "USD", Max: &max},
+		},
+	})
+	routes := env.server.Routes()
+	env.fund(t, "ACC123", "USD", "200")
+
+	deposit := func(path, amount string) int {
+		return route(routes, http.MethodPost, path, env.apiKey, map[string]interface{}{
+			"amount": amount, "currency": "USD", "account_id": "ACC123", "gateway_id": "rest",
+		}).Code
+	}
+	assert.Equal(t, http.StatusOK, deposit("/v1/deposit", "5"))
+	assert.Equal(t, http.StatusOK, deposit("/v1/deposit", "500"))
+	assert.Equal(t, http.StatusOK, deposit("/v1/withdraw", "100"))
+
+	recorder := route(routes, http.MethodPost, "/v1/withdraw", env.apiKey, map[string]interface{}{
+		"amount": "100.01", "currency": "USD", "account_id": "ACC123", "gateway_id": "rest",
+	})
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	assert.Equal(t, model.CodeAmountOutOfLimits, decodeProblem(t, recorder).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, deposit("/v1/deposit", "4.99"))
+	assert.Len(t, env.gateway.withdrawals, 1)
+}
+
+func TestMerchantSettings_TransactionsCarryTheirMerchant(t *testing.T) {
+	env := newTestEnv(t)
+	referenceId := env.deposit(t, "ACC123")
+
+	stored, getErr := env.rep.GetTransaction(env.merchant.Id, referenceId)
+	require.NoError(t, getErr)
+	assert.Equal(t, env.merchant.Id, stored.MerchantId)
+}
+
+func fieldCode(problem server.Problem, field string) string {
+	for _, fieldErr := range problem.Errors {
+		if fieldErr.Field == field {
+			return fieldErr.Code
+		}
+	}
+	return ""
+}
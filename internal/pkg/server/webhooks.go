@@ -0,0 +1,120 @@
+package server
+
+import (
+	"encoding/json"
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/service"
+	"net/http"
+	"time"
+)
+
+func WithWebhookService(webhooks *service.WebhookService) Option {
+	return func(server *Server) {
+		server.webhooks = webhooks
+	}
+}
+
+// WebhookEvent is the JSON body POSTed to merchants' webhook URLs. Data
+// always uses the v1 transaction representation.
+type WebhookEvent struct {
+	Id        string              `json:"id"`
+	Type      string              `json:"type"`
+	CreatedAt string              `json:"created_at"`
+	Data      TransactionResponse `json:"data"`
+}
+
+type WebhookDeliveryResponse struct {
+	Id             string `json:"id"`
+	ReferenceId    string `json:"reference_id"`
+	EventType      string `json:"event_type"`
+	Attempts       int    `json:"attempts"`
+	LastError      string `json:"last_error,omitempty"`
+	LastStatusCode int    `json:"last_status_code,omitempty"`
+	CreatedAt      string `json:"created_at"`
+	FailedAt       string `json:"failed_at,omitempty"`
+}
+
+type DeadLettersResponse struct {
+	DeadLetters []WebhookDeliveryResponse `json:"dead_letters"`
+}
+
+// publishTransactionEvent enqueues the webhook announcing txn's new status.
+// Enqueueing is idempotent, so a provider repeating a callback does not
+// notify the merchant twice.
+func (server *Server) publishTransactionEvent(txn Transaction) error {
+	eventType, announced := TransactionEventType(txn.Status)
+	if server.webhooks == nil || !announced || txn.MerchantId == "" {
+		return nil
+	}
+	return server.webhooks.Publish(txn.MerchantId, txn.ReferenceId, eventType, func(eventId string, createdAt time.Time) ([]byte, error) {
+		return json.Marshal(WebhookEvent{
+			Id:        eventId,
+			Type:      eventType,
+			CreatedAt: createdAt.UTC().Format(time.RFC3339),
+			Data:      NewTransactionResponse(txn),
+		})
+	})
+}
+
+// HandleGetDeadLetters serves GET /webhooks/dead-letters, the newest
+// deliveries of the merchant that ran out of attempts.
+func (server *Server) HandleGetDeadLetters(w http.ResponseWriter, r *http.Request) {
+	merchant, merchantErr := server.merchant(r)
+	if merchantErr != nil {
+		server.writeError(w, r, "HandleGetDeadLetters", merchantErr)
+		return
+	}
+	if server.webhooks == nil {
+		server.writeJSON(w, "HandleGetDeadLetters", http.StatusOK, DeadLettersResponse{DeadLetters: []WebhookDeliveryResponse{}})
+		return
+	}
+
+	deliveries, listErr := server.webhooks.DeadLetters(merchant.Id)
+	if listErr != nil {
+		server.writeError(w, r, "HandleGetDeadLetters", listErr)
+		return
+	}
+
+	response := DeadLettersResponse{DeadLetters: make([]WebhookDeliveryResponse, 0, len(deliveries))}
+	for _, delivery := range deliveries {
+		response.DeadLetters = append(response.DeadLetters, newWebhookDeliveryResponse(delivery))
+	}
+	server.writeJSON(w, "HandleGetDeadLetters", http.StatusOK, response)
+}
+
+// HandleRedeliverWebhook serves POST /webhooks/dead-letters/{delivery_id}/redeliver.
+// The delivery is queued again with a fresh set of attempts.
+func (server *Server) HandleRedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	deliveryId := r.PathValue("delivery_id")
+	merchant, merchantErr := server.merchant(r)
+	if merchantErr != nil {
+		server.writeError(w, r, "HandleRedeliverWebhook", merchantErr)
+		return
+	}
+	if server.webhooks == nil {
+		server.writeError(w, r, "HandleRedeliverWebhook", NewError(ErrNotFound, CodeDeliveryNotFound, "webhook delivery %s not found", deliveryId))
+		return
+	}
+
+	if redeliverErr := server.webhooks.Redeliver(merchant.Id, deliveryId); redeliverErr != nil {
+		server.writeError(w, r, "HandleRedeliverWebhook", redeliverErr)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func newWebhookDeliveryResponse(delivery WebhookDelivery) WebhookDeliveryResponse {
+	response := WebhookDeliveryResponse{
+		Id:             delivery.Id,
+		ReferenceId:    delivery.ReferenceId,
+		EventType:      delivery.EventType,
+		Attempts:       delivery.Attempts,
+		LastError:      delivery.LastError,
+		LastStatusCode: delivery.LastStatusCode,
+		CreatedAt:      delivery.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if delivery.FailedAt != nil {
+		response.FailedAt = delivery.FailedAt.UTC().Format(time.RFC3339)
+	}
+	return response
+}
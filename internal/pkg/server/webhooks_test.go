@@ -0,0 +1,139 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/server"
+	"github.com/dinowar/gateway-service/internal/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+// webhookReceiver answers status to every webhook and keeps what it got.
+type webhookReceiver struct {
+	mu       sync.Mutex
+	status   int
+	received []receivedWebhook
+}
+
+func (receiver *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	receiver.received = append(receiver.received, receivedWebhook{header: r.Header, body: body})
+	w.WriteHeader(receiver.status)
+}
+
+// subscribe points the env merchant's webhooks at receiver and returns the signing secret.
+func (env *testEnv) subscribe(t *testing.T, receiver *webhookReceiver) string {
+	t.Helper()
+
+	endpoint := httptest.NewServer(receiver)
+	t.Cleanup(endpoint.Close)
+	env.configure(t, model.MerchantSettings{WebhookURL: endpoint.URL})
+	secret, rotateErr := env.webhooks.RotateWebhookSecret(env.merchant.Id)
+	require.NoError(t, rotateErr)
+	return secret
+}
+
+func TestCallback_DeliversSignedWebhookOnce(t *testing.T) {
+	env := newTestEnv(t)
+	receiver := &webhookReceiver{status: http.StatusOK}
+	secret := env.subscribe(t, receiver)
+	referenceId := env.deposit(t, "ACC123")
+	routes := env.server.Routes()
+
+	callback := model.CallbackPayload{ReferenceId: referenceId, Status: string(model.StatusSuccess)}
+	require.Equal(t, http.StatusOK, postCallback(routes, callback).Code)
+	require.Equal(t, http.StatusOK, postCallback(routes, callback).Code, "providers may repeat callbacks")
+	assert.Equal(t, 1, env.webhooks.Dispatch(context.Background()))
+
+	require.Len(t, receiver.received, 1)
+	webhook := receiver.received[0]
+	var event server.WebhookEvent
+	require.NoError(t, json.Unmarshal(webhook.body, &event))
+	assert.Equal(t, model.EventTransactionSucceeded, event.Type)
+	assert.Equal(t, webhook.header.Get(service.WebhookIdHeader), event.Id)
+	assert.Equal(t, referenceId, event.Data.ReferenceId)
+	assert.Equal(t, model.StatusSuccess, event.Data.Status)
+	assert.Equal(t, "ACC123", event.Data.AccountId)
+	assert.Equal(t, "100.50", event.Data.Amount)
+
+	timestamp, _, _ := strings.Cut(strings.TrimPrefix(webhook.header.Get(service.WebhookSignatureHeader), "t="), ",")
+	unix, parseErr := strconv.ParseInt(timestamp, 10, 64)
+	require.NoError(t, parseErr)
+	assert.Equal(t, service.SignWebhook(secret, unix, webhook.body), webhook.header.Get(service.WebhookSignatureHeader))
+}
+
+func TestCallback_FailedTransactionEvent(t *testing.T) {
+	env := newTestEnv(t)
+	receiver := &webhookReceiver{status: http.StatusOK}
+	env.subscribe(t, receiver)
+	referenceId := env.deposit(t, "ACC123")
+
+	callback := model.CallbackPayload{ReferenceId: referenceId, Status: string(model.StatusFailed), Message: "declined"}
+	require.Equal(t, http.StatusOK, postCallback(env.server.Routes(), callback).Code)
+	env.webhooks.Dispatch(context.Background())
+
+	require.Len(t, receiver.received, 1)
+	var event server.WebhookEvent
+	require.NoError(t, json.Unmarshal(receiver.received[0].body, &event))
+	assert.Equal(t, model.EventTransactionFailed, event.Type)
+	assert.Equal(t, "declined", event.Data.Message)
+}
+
+func TestDeadLetters_ListAndRedeliver(t *testing.T) {
+	env := newTestEnv(t)
+	receiver := &webhookReceiver{status: http.StatusInternalServerError}
+	env.subscribe(t, receiver)
+	referenceId := env.deposit(t, "ACC123")
+	other := env.newMerchant(t, "other")
+	routes := env.server.Routes()
+
+	callback := model.CallbackPayload{ReferenceId: referenceId, Status: string(model.StatusSuccess)}
+	require.Equal(t, http.StatusOK, postCallback(routes, callback).Code)
+	env.webhooks.Dispatch(context.Background())
+
+	recorder := route(routes, http.MethodGet, "/v1/webhooks/dead-letters", env.apiKey, nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var deadLetters server.DeadLettersResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &deadLetters))
+	require.Len(t, deadLetters.DeadLetters, 1)
+	deadLetter := deadLetters.DeadLetters[0]
+	assert.Equal(t, referenceId, deadLetter.ReferenceId)
+	assert.Equal(t, model.EventTransactionSucceeded, deadLetter.EventType)
+	assert.Equal(t, 1, deadLetter.Attempts)
+	assert.Equal(t, http.StatusInternalServerError, deadLetter.LastStatusCode)
+	assert.NotEmpty(t, deadLetter.FailedAt)
+
+	recorder = route(routes, http.MethodGet, "/v1/webhooks/dead-letters", other, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"dead_letters":[]}`, recorder.Body.String())
+
+	redeliver := "/v1/webhooks/dead-letters/" + deadLetter.Id + "/redeliver"
+	recorder = route(routes, http.MethodPost, redeliver, other, nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Equal(t, model.CodeDeliveryNotFound, decodeProblem(t, recorder).Code)
+	assert.Equal(t, http.StatusUnauthorized, route(routes, http.MethodPost, redeliver, "", nil).Code)
+
+	receiver.status = http.StatusOK
+	require.Equal(t, http.StatusAccepted, route(routes, http.MethodPost, redeliver, env.apiKey, nil).Code)
+	assert.Equal(t, 1, env.webhooks.Dispatch(context.Background()))
+	require.Len(t, receiver.received, 2)
+	assert.Equal(t, receiver.received[0].body, receiver.received[1].body)
+	assert.Equal(t, http.StatusNotFound, route(routes, http.MethodPost, redeliver, env.apiKey, nil).Code)
+}
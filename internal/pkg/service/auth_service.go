@@ -0,0 +1,125 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/google/uuid"
+	"strings"
+)
+
+// API keys look like gws_<prefix>_<secret>. The prefix finds the stored key,
+// the whole key is compared by its SHA-256; keys carry 256 random bits, so a
+// slow password hash would add nothing but latency to every request.
+const apiKeyScheme = "gws"
+
+type AuthService struct {
+	rep MerchantRepository
+}
+
+func NewAuthService(rep MerchantRepository) *AuthService {
+	return &AuthService{rep: rep}
+}
+
+func (auth *AuthService) CreateMerchant(name string) (Merchant, error) {
+	merchant := Merchant{Id: uuid.NewString(), Name: name}
+	if createErr := auth.rep.CreateMerchant(&merchant); createErr != nil {
+		return Merchant{}, createErr
+	}
+	return merchant, nil
+}
+
+func (auth *AuthService) GetMerchant(merchantId string) (Merchant, error) {
+	return auth.rep.GetMerchant(merchantId)
+}
+
+// ConfigureMerchant replaces the settings of a merchant. Callers validate them
+// against the registered gateways first.
+func (auth *AuthService) ConfigureMerchant(merchantId string, settings MerchantSettings) error {
+	return auth.rep.SaveMerchantSettings(merchantId, settings)
+}
+
+// IssueAPIKey returns the plaintext key, which is shown to the merchant once
+// and cannot be recovered afterwards.
+func (auth *AuthService) IssueAPIKey(merchantId string) (string, APIKey, error) {
+	prefix := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, randErr := rand.Read(prefix); randErr != nil {
+		return "", APIKey{}, randErr
+	}
+	if _, randErr := rand.Read(secret); randErr != nil {
+		return "", APIKey{}, randErr
+	}
+
+	key := APIKey{Id: uuid.NewString(), MerchantId: merchantId, Prefix: hex.EncodeToString(prefix)}
+	plaintext := apiKeyScheme + "_" + key.Prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	key.Hash = HashAPIKey(plaintext)
+	if createErr := auth.rep.CreateAPIKey(&key); createErr != nil {
+		return "", APIKey{}, createErr
+	}
+	return plaintext, key, nil
+}
+
+func (auth *AuthService) RevokeAPIKey(keyId string) error {
+	return auth.rep.RevokeAPIKey(keyId)
+}
+
+func HashAPIKey(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
+}
+
+// Authenticate resolves a plaintext key to its merchant. Every failure is the
+// same ErrUnauthorized so callers cannot probe which keys exist.
+func (auth *AuthService) Authenticate(plaintext string) (Merchant, error) {
+	invalidErr := NewError(ErrUnauthorized, CodeUnauthenticated, "invalid or revoked API key")
+
+	scheme, rest, _ := strings.Cut(plaintext, "_")
+	prefix, _, _ := strings.Cut(rest, "_")
+	if scheme != apiKeyScheme || prefix == "" {
+		return Merchant{}, invalidErr
+	}
+
+	key, keyErr := auth.rep.GetAPIKeyByPrefix(prefix)
+	if errors.Is(keyErr, ErrNotFound) {
+		return Merchant{}, invalidErr
+	}
+	if keyErr != nil {
+		return Merchant{}, keyErr
+	}
+	if key.RevokedAt != nil || subtle.ConstantTimeCompare(HashAPIKey(plaintext), key.Hash) != 1 {
+		return Merchant{}, invalidErr
+	}
+	return auth.rep.GetMerchant(key.MerchantId)
+}
+
+// ClaimAccount assigns accountId to merchant, see `merchant assign-account`.
+// An account nobody owns becomes the merchant's; one owned by another merchant
+// is ErrForbidden. Transactions never claim accounts, see OwnsAccount.
+func (auth *AuthService) ClaimAccount(merchant Merchant, accountId string) error {
+	owner, claimErr := auth.rep.ClaimAccount(merchant.Id, accountId)
+	if claimErr != nil {
+		return claimErr
+	}
+	if owner != merchant.Id {
+		return NewError(ErrForbidden, CodeAccountNotOwned, "account %s belongs to another merchant", accountId)
+	}
+	return nil
+}
+
+// OwnsAccount reports whether merchant owns accountId; nobody owns an account
+// before it is assigned.
+func (auth *AuthService) OwnsAccount(merchant Merchant, accountId string) (bool, error) {
+	owner, ownerErr := auth.rep.GetAccountOwner(accountId)
+	if errors.Is(ownerErr, ErrNotFound) {
+		return false, nil
+	}
+	if ownerErr != nil {
+		return false, ownerErr
+	}
+	return owner == merchant.Id, nil
+}
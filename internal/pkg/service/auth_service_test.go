@@ -0,0 +1,140 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runMerchantRepositoryContract checks the behaviour every MerchantRepository
+// must share, driven through AuthService.
+func runMerchantRepositoryContract(t *testing.T, newRepository func(t *testing.T) MerchantRepository) {
+	t.Run("issue and authenticate", func(t *testing.T) {
+		rep := newRepository(t)
+		auth := NewAuthService(rep)
+		merchant, createErr := auth.CreateMerchant("acme")
+		require.NoError(t, createErr)
+		assert.False(t, merchant.CreatedAt.IsZero())
+
+		plaintext, key, issueErr := auth.IssueAPIKey(merchant.Id)
+		require.NoError(t, issueErr)
+		assert.True(t, strings.HasPrefix(plaintext, "gws_"+key.Prefix+"_"))
+
+		stored, getErr := rep.GetAPIKeyByPrefix(key.Prefix)
+		require.NoError(t, getErr)
+		assert.Equal(t, HashAPIKey(plaintext), stored.Hash)
+		assert.NotContains(t, string(stored.Hash), plaintext, "keys must be stored hashed")
+
+		authenticated, authErr := auth.Authenticate(plaintext)
+		require.NoError(t, authErr)
+		assert.Equal(t, merchant.Id, authenticated.Id)
+		assert.Equal(t, "acme", authenticated.Name)
+	})
+
+	t.Run("rejects wrong and revoked keys", func(t *testing.T) {
+		rep := newRepository(t)
+		auth := NewAuthService(rep)
+		merchant, _ := auth.CreateMerchant("acme")
+		plaintext, key, issueErr := auth.IssueAPIKey(merchant.Id)
+		require.NoError(t, issueErr)
+
+		for _, candidate := range []string{"", "gws_", "gws__x", "sk_" + key.Prefix + "_x", "gws_" + key.Prefix + "_wrong"} {
+			_, authErr := auth.Authenticate(candidate)
+			assert.ErrorIs(t, authErr, model.ErrUnauthorized, candidate)
+		}
+
+		require.NoError(t, auth.RevokeAPIKey(key.Id))
+		require.NoError(t, auth.RevokeAPIKey(key.Id), "revoking twice is a no-op")
+		_, authErr := auth.Authenticate(plaintext)
+		assert.ErrorIs(t, authErr, model.ErrUnauthorized)
+
+		assert.ErrorIs(t, auth.RevokeAPIKey("00000000-0000-0000-0000-000000000000"), model.ErrNotFound)
+	})
+
+	t.Run("unknown merchant", func(t *testing.T) {
+		auth := NewAuthService(newRepository(t))
+		unknown := "00000000-0000-0000-0000-000000000000"
+
+		_, _, issueErr := auth.IssueAPIKey(unknown)
+		assert.ErrorIs(t, issueErr, model.ErrNotFound)
+		claimErr := auth.ClaimAccount(model.Merchant{Id: unknown}, "ACC123")
+		assert.ErrorIs(t, claimErr, model.ErrNotFound)
+	})
+
+	t.Run("settings round trip", func(t *testing.T) {
+		rep := newRepository(t)
+		auth := NewAuthService(rep)
+		merchant, _ := auth.CreateMerchant("acme")
+		plaintext, _, _ := auth.IssueAPIKey(merchant.Id)
+
+		unconfigured, getErr := rep.GetMerchant(merchant.Id)
+		require.NoError(t, getErr)
+		assert.Nil(t, unconfigured.Settings.EnabledGateways)
+		assert.Empty(t, unconfigured.Settings.RoutingRules)
+		assert.Empty(t, unconfigured.Settings.Limits)
+
+		max := decimal.RequireFromString("250.5")
+		settings := model.MerchantSettings{
+			EnabledGateways: []string{"soap"},
+			RoutingRules:    []model.RoutingRule{{Operation: model.Deposit, Currency: "EUR", GatewayId: "soap"}},
+			Limits:          []model.AmountLimit{{Currency: "EUR", Max: &max}},
+			WebhookURL:      "https://acme.example/webhooks",
+		}
+		require.NoError(t, auth.ConfigureMerchant(merchant.Id, settings))
+
+		authenticated, authErr := auth.Authenticate(plaintext)
+		require.NoError(t, authErr)
+		assert.Equal(t, []string{"soap"}, authenticated.Settings.EnabledGateways)
+		assert.Equal(t, settings.RoutingRules, authenticated.Settings.RoutingRules)
+		require.Len(t, authenticated.Settings.Limits, 1)
+		assert.True(t, max.Equal(*authenticated.Settings.Limits[0].Max))
+		assert.Equal(t, "https://acme.example/webhooks", authenticated.Settings.WebhookURL)
+
+		require.NoError(t, auth.ConfigureMerchant(merchant.Id, model.MerchantSettings{EnabledGateways: []string{}}))
+		reset, _ := rep.GetMerchant(merchant.Id)
+		assert.NotNil(t, reset.Settings.EnabledGateways, "an empty list disables every gateway")
+		assert.Empty(t, reset.Settings.EnabledGateways)
+		assert.Empty(t, reset.Settings.WebhookURL)
+
+		assert.ErrorIs(t, auth.ConfigureMerchant("00000000-0000-0000-0000-000000000000", settings), model.ErrNotFound)
+	})
+
+	t.Run("account ownership", func(t *testing.T) {
+		auth := NewAuthService(newRepository(t))
+		first, _ := auth.CreateMerchant("first")
+		second, _ := auth.CreateMerchant("second")
+
+		owns, ownsErr := auth.OwnsAccount(first, "ACC123")
+		require.NoError(t, ownsErr)
+		assert.False(t, owns, "nobody owns an account before it is claimed")
+
+		require.NoError(t, auth.ClaimAccount(first, "ACC123"))
+		require.NoError(t, auth.ClaimAccount(first, "ACC123"))
+		claimErr := auth.ClaimAccount(second, "ACC123")
+		assert.ErrorIs(t, claimErr, model.ErrForbidden)
+		var domainErr *model.Error
+		require.ErrorAs(t, claimErr, &domainErr)
+		assert.Equal(t, model.CodeAccountNotOwned, domainErr.Code)
+
+		owns, _ = auth.OwnsAccount(first, "ACC123")
+		assert.True(t, owns)
+		owns, _ = auth.OwnsAccount(second, "ACC123")
+		assert.False(t, owns)
+	})
+}
+
+func TestMemoryMerchantRepository_Contract(t *testing.T) {
+	runMerchantRepositoryContract(t, func(t *testing.T) MerchantRepository {
+		return NewMemoryRepositoryService()
+	})
+}
+
+func TestPostgresMerchantRepository_Contract(t *testing.T) {
+	runMerchantRepositoryContract(t, func(t *testing.T) MerchantRepository {
+		return NewRepositoryService(migratedPostgresTestDB(t))
+	})
+}
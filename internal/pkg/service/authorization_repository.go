@@ -0,0 +1,36 @@
+package service
+
+import (
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"time"
+)
+
+// AuthorizationRepository claims authorizations for a capture or void at
+// their provider, including the void of those left uncaptured, implemented by
+// RepositoryService and MemoryRepositoryService with the same semantics.
+// Capturing and voiding go through TransactionRepository.UpdateTransaction.
+type AuthorizationRepository interface {
+	// ClaimAuthorization claims the AUTHORIZED transaction referenceId of
+	// merchantId until until and returns it. Transactions in another status
+	// and authorizations claimed past now return model.ErrConflict.
+	ClaimAuthorization(merchantId, referenceId string, now, until time.Time) (Transaction, error)
+	// ReleaseAuthorization gives up the claim on referenceId.
+	ReleaseAuthorization(referenceId string) error
+	// ClaimExpiredAuthorizations claims up to limit AUTHORIZED transactions
+	// whose authorization expired by now and that are not claimed past now,
+	// soonest expiry first, until until and returns them.
+	ClaimExpiredAuthorizations(now, until time.Time, limit int) ([]Transaction, error)
+}
+
+var (
+	_ AuthorizationRepository = (*RepositoryService)(nil)
+	_ AuthorizationRepository = (*MemoryRepositoryService)(nil)
+)
+
+// unclaimable explains why the stored transaction txn could not be claimed.
+func unclaimable(txn Transaction) error {
+	if checkErr := checkAuthorized(txn); checkErr != nil {
+		return checkErr
+	}
+	return NewError(ErrConflict, CodeAuthorizationInProgress, "authorization %s is already being captured or voided", txn.ReferenceId)
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"github.com/dinowar/gateway-service/internal/pkg/config"
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"time"
+)
+
+// DefaultAuthorizationTTL is how long authorizations are held when no TTL is
+// configured.
+const DefaultAuthorizationTTL = 7 * 24 * time.Hour
+
+// authorizationExpiryBatch bounds the authorizations claimed by one query.
+const authorizationExpiryBatch = 100
+
+// authorizationClaimTimeout bounds how long a capture or void may take at the
+// provider. The claim of a request that never finished lapses after it.
+const authorizationClaimTimeout = 5 * time.Minute
+
+// AuthorizationService holds deposits authorized for a later capture: when
+// they lapse, whether they can still be captured or voided, the claims that
+// keep two of those apart, and the sweep that voids the lapsed ones.
+// Capturing and voiding at the provider is up to the caller. Without a
+// repository authorizations can be neither claimed nor swept.
+type AuthorizationService struct {
+	rep      AuthorizationRepository
+	logger   *LogService
+	ttl      time.Duration
+	interval time.Duration
+	now      func() time.Time
+}
+
+func NewAuthorizationService(rep AuthorizationRepository, logger *LogService, cfg config.AuthorizationConfig) *AuthorizationService {
+	ttl := time.Duration(cfg.TTL) * time.Minute
+	if ttl <= 0 {
+		ttl = DefaultAuthorizationTTL
+	}
+	return &AuthorizationService{
+		rep:      rep,
+		logger:   logger,
+		ttl:      ttl,
+		interval: time.Duration(cfg.ExpiryInterval) * time.Second,
+		now:      time.Now,
+	}
+}
+
+// Authorize makes txn an authorization lapsing one TTL from now.
+func (as *AuthorizationService) Authorize(txn *Transaction) {
+	expiresAt := as.now().UTC().Add(as.ttl)
+	txn.Authorization.ExpiresAt = &expiresAt
+}
+
+// Claim reserves the AUTHORIZED transaction referenceId of merchantId for a
+// capture or void at its provider and returns it. Other claims and the sweep
+// leave it alone until it is released or the claim lapses.
+func (as *AuthorizationService) Claim(merchantId, referenceId string) (Transaction, error) {
+	if as.rep == nil {
+		return Transaction{}, NewError(ErrInternal, CodeInternal, "authorizations are not stored")
+	}
+	now := as.now()
+	return as.rep.ClaimAuthorization(merchantId, referenceId, now, now.Add(authorizationClaimTimeout))
+}
+
+// Release gives up the claim on txn when its provider did not settle it.
+func (as *AuthorizationService) Release(txn Transaction) error {
+	if as.rep == nil {
+		return nil
+	}
+	return as.rep.ReleaseAuthorization(txn.ReferenceId)
+}
+
+// CheckCapture reports whether txn can be captured: it must be AUTHORIZED and
+// its authorization must not have lapsed.
+func (as *AuthorizationService) CheckCapture(txn Transaction) error {
+	if checkErr := checkAuthorized(txn); checkErr != nil {
+		return checkErr
+	}
+	if txn.Authorization.Expired(as.now()) {
+		return NewError(ErrUnprocessable, CodeAuthorizationExpired, "authorization %s expired at %s",
+			txn.ReferenceId, txn.Authorization.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// CheckVoid reports whether txn can be voided. Lapsed authorizations can,
+// ahead of the sweep.
+func (as *AuthorizationService) CheckVoid(txn Transaction) error {
+	return checkAuthorized(txn)
+}
+
+func checkAuthorized(txn Transaction) error {
+	if txn.Status != StatusAuthorized {
+		return NewError(ErrConflict, CodeNotAuthorized, "transaction %s is %s, not AUTHORIZED", txn.ReferenceId, txn.Status)
+	}
+	return nil
+}
+
+// ExpireDue claims the authorizations that lapsed by now and hands each to
+// void, which voids it at its provider and stores it, and returns how many
+// were voided. Authorizations void fails for, for instance because the
+// provider declined, keep their claim and are handed over again once it
+// lapses.
+func (as *AuthorizationService) ExpireDue(void func(Transaction) error) (int, error) {
+	if as.rep == nil {
+		return 0, nil
+	}
+	voided := 0
+	for {
+		now := as.now()
+		batch, claimErr := as.rep.ClaimExpiredAuthorizations(now, now.Add(authorizationClaimTimeout), authorizationExpiryBatch)
+		if claimErr != nil {
+			return voided, claimErr
+		}
+		for _, txn := range batch {
+			if voidErr := void(txn); voidErr != nil {
+				if as.logger != nil {
+					as.logger.LogError("error voiding expired authorization "+txn.ReferenceId, voidErr)
+				}
+				continue
+			}
+			voided++
+		}
+		if len(batch) < authorizationExpiryBatch {
+			return voided, nil
+		}
+	}
+}
+
+// Run voids lapsed authorizations every interval until ctx is done, see
+// ExpireDue. It returns at once when the sweep is turned off.
+func (as *AuthorizationService) Run(ctx context.Context, void func(Transaction) error) {
+	if as.rep == nil || as.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(as.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, expireErr := as.ExpireDue(void); expireErr != nil && as.logger != nil {
+				as.logger.LogError("error expiring authorizations", expireErr)
+			}
+		}
+	}
+}
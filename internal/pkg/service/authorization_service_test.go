@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dinowar/gateway-service/internal/pkg/config"
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestAuthorizationService_ChecksCaptureAndVoid(t *testing.T) {
+	now := time.Date(2024, 10, 14, 12, 0, 0, 0, time.UTC)
+	authorizations := NewAuthorizationService(nil, nil, config.AuthorizationConfig{TTL: 60})
+	authorizations.now = func() time.Time { return now }
+	code := func(err error) string {
+		var domainErr *model.Error
+		require.ErrorAs(t, err, &domainErr)
+		return domainErr.Code
+	}
+
+	txn := limitTestTxn("ref-1", "ACC123", "rest", model.Deposit, "100")
+	authorizations.Authorize(&txn)
+	require.True(t, txn.IsAuthorization())
+	assert.Equal(t, now.Add(time.Hour), *txn.Authorization.ExpiresAt)
+	assert.Equal(t, model.CodeNotAuthorized, code(authorizations.CheckCapture(txn)), "not authorized by the provider yet")
+
+	txn.Status = model.StatusAuthorized
+	assert.NoError(t, authorizations.CheckCapture(txn))
+	assert.NoError(t, authorizations.CheckVoid(txn))
+
+	authorizations.now = func() time.Time { return now.Add(time.Hour) }
+	assert.Equal(t, model.CodeAuthorizationExpired, code(authorizations.CheckCapture(txn)))
+	assert.NoError(t, authorizations.CheckVoid(txn), "lapsed authorizations can be voided ahead of the sweep")
+
+	txn.Status = model.StatusCaptured
+	assert.ErrorIs(t, authorizations.CheckVoid(txn), model.ErrConflict)
+
+	defaulted := NewAuthorizationService(nil, nil, config.AuthorizationConfig{})
+	assert.Equal(t, DefaultAuthorizationTTL, defaulted.ttl)
+}
+
+func TestAuthorizationService_RunVoidsLapsedAuthorizations(t *testing.T) {
+	rep := NewMemoryRepositoryService()
+	require.NoError(t, rep.CreateMerchant(&model.Merchant{Id: merchantId, Name: merchantId}))
+	authorizations := NewAuthorizationService(rep, NewLogService(zap.NewNop()), config.AuthorizationConfig{TTL: 60, ExpiryInterval: 1})
+	authorizations.interval = time.Millisecond
+
+	for referenceId, expiresAt := range map[string]time.Time{"ref-1": time.Now().Add(-time.Minute), "ref-2": time.Now().Add(time.Hour)} {
+		txn := limitTestTxn(referenceId, "ACC123", "rest", model.Deposit, "100")
+		txn.Authorization.ExpiresAt = &expiresAt
+		require.NoError(t, rep.SaveTransaction(&txn))
+		require.NoError(t, rep.UpdateTransaction(&model.Transaction{ReferenceId: txn.ReferenceId, Status: model.StatusAuthorized}))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	voided := make(chan model.Transaction, 2)
+	done := make(chan struct{})
+	go func() {
+		authorizations.Run(ctx, func(txn model.Transaction) error {
+			voided <- txn
+			return nil
+		})
+		close(done)
+	}()
+
+	select {
+	case txn := <-voided:
+		assert.Equal(t, "ref-1", txn.ReferenceId)
+		assert.Equal(t, model.StatusAuthorized, txn.Status, "voiding at the provider and storing it is up to void")
+	case <-time.After(time.Second):
+		t.Fatal("the lapsed authorization was not voided")
+	}
+	cancel()
+	<-done
+	assert.Empty(t, voided, "authorizations that have not lapsed are kept")
+
+	pending, getErr := rep.GetTransaction(merchantId, "ref-2")
+	require.NoError(t, getErr)
+	assert.Equal(t, model.StatusAuthorized, pending.Status)
+}
+
+func TestAuthorizationService_ExpireDueRetriesFailedVoids(t *testing.T) {
+	now := time.Date(2024, 10, 14, 12, 0, 0, 0, time.UTC)
+	rep := NewMemoryRepositoryService()
+	require.NoError(t, rep.CreateMerchant(&model.Merchant{Id: merchantId, Name: merchantId}))
+	authorizations := NewAuthorizationService(rep, NewLogService(zap.NewNop()), config.AuthorizationConfig{TTL: 60})
+	authorizations.now = func() time.Time { return now }
+
+	lapsed := now.Add(-time.Minute)
+	txn := limitTestTxn("ref-1", "ACC123", "rest", model.Deposit, "100")
+	txn.Authorization.ExpiresAt = &lapsed
+	require.NoError(t, rep.SaveTransaction(&txn))
+	require.NoError(t, rep.UpdateTransaction(&model.Transaction{ReferenceId: "ref-1", Status: model.StatusAuthorized}))
+
+	var attempts int
+	void := func(txn model.Transaction) error {
+		attempts++
+		if attempts == 1 {
+			return model.NewError(model.ErrUnprocessable, model.CodeGatewayError, "the gateway declined the void")
+		}
+		return rep.UpdateTransaction(&model.Transaction{ReferenceId: txn.ReferenceId, Status: model.StatusVoided})
+	}
+
+	voided, expireErr := authorizations.ExpireDue(void)
+	require.NoError(t, expireErr)
+	assert.Zero(t, voided)
+	voided, expireErr = authorizations.ExpireDue(void)
+	require.NoError(t, expireErr)
+	assert.Zero(t, voided)
+	assert.Equal(t, 1, attempts, "the declined void keeps its claim")
+
+	authorizations.now = func() time.Time { return now.Add(authorizationClaimTimeout) }
+	voided, expireErr = authorizations.ExpireDue(void)
+	require.NoError(t, expireErr)
+	assert.Equal(t, 1, voided, "the void is retried once its claim lapsed")
+	stored, getErr := rep.GetTransaction(merchantId, "ref-1")
+	require.NoError(t, getErr)
+	assert.Equal(t, model.StatusVoided, stored.Status)
+}
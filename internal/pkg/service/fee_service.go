@@ -0,0 +1,46 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/validation"
+	"github.com/shopspring/decimal"
+)
+
+// FeeService prices the provider fee of transactions when they are created.
+// A merchant's own fee rules take precedence over the service wide schedule;
+// within each the first matching rule wins, and without one the fee is zero.
+type FeeService struct {
+	schedule []FeeRule
+}
+
+func NewFeeService(schedule []FeeRule) *FeeService {
+	return &FeeService{schedule: schedule}
+}
+
+// ParseFeeSchedule reads a fee schedule given as a JSON array of fee rules.
+// An empty schedule has no rules.
+func ParseFeeSchedule(raw string) ([]FeeRule, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var schedule []FeeRule
+	if decodeErr := json.Unmarshal([]byte(raw), &schedule); decodeErr != nil {
+		return nil, fmt.Errorf("fee schedule is not a JSON array of fee rules: %w", decodeErr)
+	}
+	return schedule, nil
+}
+
+// Calculate returns the fee of txn in its currency.
+func (fs *FeeService) Calculate(settings MerchantSettings, txn Transaction) decimal.Decimal {
+	places, _ := validation.MinorUnits(txn.Currency)
+	for _, rules := range [][]FeeRule{settings.Fees, fs.schedule} {
+		for _, rule := range rules {
+			if rule.Matches(txn.Operation, txn.Currency, txn.GatewayId) {
+				return rule.Fee(txn.Amount, places)
+			}
+		}
+	}
+	return decimal.Zero
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeeService_Calculate(t *testing.T) {
+	schedule, parseErr := ParseFeeSchedule(`[
+		{"operation": "Deposit", "currency": "USD", "gateway_id": "soap", "percent": "1.5"},
+		{"operation": "Deposit", "currency": "USD", "fixed": "0.30", "percent": "2.9", "max": "5"},
+		{"operation": "Withdraw", "currency": "USD", "fixed": "1", "min": "2"},
+		{"currency": "JPY", "percent": "1.25"}
+	]`)
+	require.NoError(t, parseErr)
+	fees := NewFeeService(schedule)
+	fee := func(settings model.MerchantSettings, operation model.Operation, gatewayId, amount, currency string) string {
+		txn := limitTestTxn("ref-1", "ACC123", gatewayId, operation, amount)
+		txn.Currency = currency
+		return fees.Calculate(settings, txn).String()
+	}
+
+	assert.Equal(t, "3.2", fee(model.MerchantSettings{}, model.Deposit, "rest", "100", "USD"), "fixed plus percent")
+	assert.Equal(t, "0.33", fee(model.MerchantSettings{}, model.Deposit, "rest", "1.01", "USD"), "rounded half up to cents")
+	assert.Equal(t, "5", fee(model.MerchantSettings{}, model.Deposit, "rest", "1000", "USD"), "capped at max")
+	assert.Equal(t, "15", fee(model.MerchantSettings{}, model.Deposit, "soap", "1000", "USD"), "the first matching rule wins")
+	assert.Equal(t, "2", fee(model.MerchantSettings{}, model.Withdraw, "rest", "10", "USD"), "raised to min")
+	assert.Equal(t, "13", fee(model.MerchantSettings{}, model.Deposit, "rest", "1000", "JPY"), "rounded to yen")
+	assert.Equal(t, "0", fee(model.MerchantSettings{}, model.Deposit, "rest", "100", "EUR"), "no rule, no fee")
+
+	fixed := decimal.RequireFromString("0.10")
+	merchant := model.MerchantSettings{Fees: []model.FeeRule{{Currency: "USD", GatewayId: "rest", Fixed: &fixed}}}
+	assert.Equal(t, "0.1", fee(merchant, model.Deposit, "rest", "100", "USD"), "merchant rules take precedence")
+	assert.Equal(t, "15", fee(merchant, model.Deposit, "soap", "1000", "USD"), "and fall back to the schedule")
+
+	empty, parseErr := ParseFeeSchedule("")
+	require.NoError(t, parseErr)
+	assert.Empty(t, empty)
+	_, parseErr = ParseFeeSchedule(`{"currency": "USD"}`)
+	assert.ErrorContains(t, parseErr, "fee schedule is not a JSON array of fee rules")
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/shopspring/decimal"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// RateProvider quotes exchange rates. Pairs it cannot price return
+// model.ErrUnprocessable with CodeRateUnavailable.
+type RateProvider interface {
+	Rate(from, to string) (FxRate, error)
+}
+
+// inverseRatePlaces is the precision of rates derived from the opposite pair.
+const inverseRatePlaces = 10
+
+type rateFile struct {
+	Source string          `json:"source"`
+	AsOf   time.Time       `json:"as_of"`
+	Rates  []rateFileEntry `json:"rates"`
+}
+
+type rateFileEntry struct {
+	From string          `json:"from"`
+	To   string          `json:"to"`
+	Rate decimal.Decimal `json:"rate"`
+}
+
+type ratePair struct {
+	from string
+	to   string
+}
+
+// FileRateProvider serves rates from a local JSON file, for local runs and
+// tests. The file is read again when it changed; a file that fails to load
+// leaves the previous rates in place.
+type FileRateProvider struct {
+	path string
+
+	mu      sync.RWMutex
+	modTime time.Time
+	rates   map[ratePair]FxRate
+}
+
+func NewFileRateProvider(path string) *FileRateProvider {
+	return &FileRateProvider{path: path}
+}
+
+// Load reads the rates unless the file is unchanged since the last load.
+func (frp *FileRateProvider) Load() error {
+	info, statErr := os.Stat(frp.path)
+	if statErr != nil {
+		return statErr
+	}
+	frp.mu.RLock()
+	unchanged := frp.rates != nil && info.ModTime().Equal(frp.modTime)
+	frp.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	file, openErr := os.Open(frp.path)
+	if openErr != nil {
+		return openErr
+	}
+	defer file.Close()
+	listed, parseErr := ParseRates(file)
+	if parseErr != nil {
+		return fmt.Errorf("loading rates %s: %w", frp.path, parseErr)
+	}
+	rates := make(map[ratePair]FxRate, len(listed))
+	for _, rate := range listed {
+		if rate.Source == "" {
+			rate.Source = "file:" + filepath.Base(frp.path)
+		}
+		rates[ratePair{from: rate.From, to: rate.To}] = rate
+	}
+
+	frp.mu.Lock()
+	frp.modTime = info.ModTime()
+	frp.rates = rates
+	frp.mu.Unlock()
+	return nil
+}
+
+// Rate returns the rate of from in to, derived from the opposite pair when
+// only that one is listed.
+func (frp *FileRateProvider) Rate(from, to string) (FxRate, error) {
+	if loadErr := frp.Load(); loadErr != nil {
+		frp.mu.RLock()
+		loaded := frp.rates != nil
+		frp.mu.RUnlock()
+		if !loaded {
+			return FxRate{}, NewError(ErrUnprocessable, CodeRateUnavailable, "no exchange rates available").Wrap(loadErr)
+		}
+	}
+
+	frp.mu.RLock()
+	defer frp.mu.RUnlock()
+	if rate, listed := frp.rates[ratePair{from: from, to: to}]; listed {
+		return rate, nil
+	}
+	if rate, listed := frp.rates[ratePair{from: to, to: from}]; listed {
+		rate.From, rate.To = from, to
+		rate.Rate = decimal.NewFromInt(1).DivRound(rate.Rate, inverseRatePlaces)
+		return rate, nil
+	}
+	return FxRate{}, NewError(ErrUnprocessable, CodeRateUnavailable, "no exchange rate from %s to %s", from, to)
+}
+
+// ParseRates reads a rate file: a JSON object with the source and as_of time
+// of its rates and a rates array of from, to and positive rate.
+func ParseRates(r io.Reader) ([]FxRate, error) {
+	var file rateFile
+	if decodeErr := json.NewDecoder(r).Decode(&file); decodeErr != nil {
+		return nil, decodeErr
+	}
+	if len(file.Rates) == 0 {
+		return nil, errors.New("rate file lists no rates")
+	}
+	rates := make([]FxRate, 0, len(file.Rates))
+	for i, entry := range file.Rates {
+		if entry.From == "" || entry.To == "" || entry.From == entry.To {
+			return nil, fmt.Errorf("rates[%d] needs two different currencies", i)
+		}
+		if !entry.Rate.IsPositive() {
+			return nil, fmt.Errorf("rates[%d] from %s to %s must be positive", i, entry.From, entry.To)
+		}
+		rates = append(rates, FxRate{
+			From:   entry.From,
+			To:     entry.To,
+			Rate:   entry.Rate,
+			Source: file.Source,
+			AsOf:   file.AsOf,
+		})
+	}
+	return rates, nil
+}
@@ -0,0 +1,26 @@
+package service
+
+import . "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+
+// FxRepository stores the exchange rate quotes locked for merchants,
+// implemented by RepositoryService and MemoryRepositoryService with the same
+// semantics.
+type FxRepository interface {
+	// SaveQuote stores a new quote.
+	SaveQuote(quote *FxQuote) error
+	// GetQuote returns a quote of merchantId, expired or not. Unknown ids and
+	// quotes of other merchants return model.ErrNotFound.
+	GetQuote(merchantId, quoteId string) (FxQuote, error)
+	// UseQuote ties a quote of merchantId to the transaction referenceId.
+	// Using it again for the same transaction is a no-op, for another one
+	// model.ErrConflict.
+	UseQuote(merchantId, quoteId, referenceId string) error
+	// ReleaseQuote frees a quote used by referenceId for another transaction.
+	// Quotes used by other transactions and unknown quotes are left alone.
+	ReleaseQuote(merchantId, quoteId, referenceId string) error
+}
+
+var (
+	_ FxRepository = (*RepositoryService)(nil)
+	_ FxRepository = (*MemoryRepositoryService)(nil)
+)
@@ -0,0 +1,134 @@
+package service
+
+import (
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/dinowar/gateway-service/internal/pkg/validation"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+// FxService converts transactions into the currency of the account they are
+// booked to. Gateways always move the requested amount and currency; the
+// account is booked the converted amount, at the rate of a quote locked in
+// advance or at the provider's current rate. Without a rate provider
+// conversion is disabled.
+type FxService struct {
+	rates    RateProvider
+	rep      FxRepository
+	quoteTTL time.Duration
+	now      func() time.Time
+}
+
+func NewFxService(rates RateProvider, rep FxRepository, quoteTTL time.Duration) *FxService {
+	return &FxService{rates: rates, rep: rep, quoteTTL: quoteTTL, now: time.Now}
+}
+
+// Quote locks the current rate from from into to for the merchant.
+func (fs *FxService) Quote(merchantId, from, to string) (FxQuote, error) {
+	rate, rateErr := fs.rate(from, to)
+	if rateErr != nil {
+		return FxQuote{}, rateErr
+	}
+	now := fs.now().UTC()
+	quote := FxQuote{
+		Id:         uuid.NewString(),
+		MerchantId: merchantId,
+		From:       from,
+		To:         to,
+		Rate:       rate.Rate,
+		Source:     rate.Source,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(fs.quoteTTL),
+	}
+	if saveErr := fs.rep.SaveQuote(&quote); saveErr != nil {
+		return FxQuote{}, NewError(ErrInternal, CodeInternal, "error saving fx quote").Wrap(saveErr)
+	}
+	return quote, nil
+}
+
+// Convert fills the conversion of txn into accountCurrency, at the rate of the
+// quote quoteId when it is set. A quote alone implies its target currency and
+// converts txn only, see FxRepository.UseQuote. Transactions booked in their
+// own currency are left unconverted.
+func (fs *FxService) Convert(txn *Transaction, accountCurrency, quoteId string) error {
+	if quoteId == "" {
+		if accountCurrency == "" || accountCurrency == txn.Currency {
+			return nil
+		}
+		rate, rateErr := fs.rate(txn.Currency, accountCurrency)
+		if rateErr != nil {
+			return rateErr
+		}
+		return applyConversion(txn, FxConversion{
+			Rate:     rate.Rate,
+			Source:   rate.Source,
+			Currency: accountCurrency,
+			Amount:   convertAmount(txn.Amount, rate.Rate, accountCurrency),
+		})
+	}
+
+	if fs.rep == nil {
+		return NewError(ErrUnprocessable, CodeRateUnavailable, "currency conversion is not enabled")
+	}
+	quote, quoteErr := fs.rep.GetQuote(txn.MerchantId, quoteId)
+	if quoteErr != nil {
+		return quoteErr
+	}
+	if accountCurrency == "" {
+		accountCurrency = quote.To
+	}
+	if quote.From != txn.Currency || quote.To != accountCurrency {
+		return NewError(ErrUnprocessable, CodeQuoteMismatch, "fx quote %s converts %s to %s, not %s to %s",
+			quoteId, quote.From, quote.To, txn.Currency, accountCurrency)
+	}
+	if quote.Expired(fs.now()) {
+		return NewError(ErrUnprocessable, CodeQuoteExpired, "fx quote %s expired at %s", quoteId, quote.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	conversionErr := applyConversion(txn, FxConversion{
+		QuoteId:  quote.Id,
+		Rate:     quote.Rate,
+		Source:   quote.Source,
+		Currency: accountCurrency,
+		Amount:   convertAmount(txn.Amount, quote.Rate, accountCurrency),
+	})
+	if conversionErr != nil {
+		return conversionErr
+	}
+	// the rate is locked for one transaction only, see Release
+	return fs.rep.UseQuote(txn.MerchantId, quoteId, txn.ReferenceId)
+}
+
+// Release frees the quote txn was converted with, for a transaction that was
+// rejected before it was accepted, so the merchant can retry with the quote.
+func (fs *FxService) Release(txn Transaction) error {
+	if fs.rep == nil || txn.Conversion.QuoteId == "" {
+		return nil
+	}
+	return fs.rep.ReleaseQuote(txn.MerchantId, txn.Conversion.QuoteId, txn.ReferenceId)
+}
+
+func (fs *FxService) rate(from, to string) (FxRate, error) {
+	if fs.rates == nil || fs.rep == nil {
+		return FxRate{}, NewError(ErrUnprocessable, CodeRateUnavailable, "currency conversion is not enabled")
+	}
+	return fs.rates.Rate(from, to)
+}
+
+// applyConversion sets conversion on txn unless the amount converts to
+// nothing, which could not be booked.
+func applyConversion(txn *Transaction, conversion FxConversion) error {
+	if !conversion.Amount.IsPositive() {
+		return NewError(ErrUnprocessable, CodeValidationFailed, "%s %s converts to 0 %s",
+			txn.Amount.String(), txn.Currency, conversion.Currency)
+	}
+	txn.Conversion = conversion
+	return nil
+}
+
+// convertAmount converts amount at rate, rounded to the minor units of the
+// target currency.
+func convertAmount(amount, rate decimal.Decimal, currency string) decimal.Decimal {
+	places, _ := validation.MinorUnits(currency)
+	return amount.Mul(rate).Round(places)
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRates = `{
+	"source": "ECB reference rates",
+	"as_of": "2024-10-14T14:00:00Z",
+	"rates": [
+		{"from": "EUR", "to": "USD", "rate": "1.0907"},
+		{"from": "USD", "to": "JPY", "rate": "149.21"}
+	]
+}`
+
+func newTestFxService(t *testing.T, now time.Time) *FxService {
+	t.Helper()
+
+	rep := NewMemoryRepositoryService()
+	for _, id := range []string{merchantId, otherMerchantId} {
+		require.NoError(t, rep.CreateMerchant(&model.Merchant{Id: id, Name: id}))
+	}
+	rates := NewFileRateProvider(writeTestFile(t, "rates.json", testRates))
+	require.NoError(t, rates.Load())
+	fx := NewFxService(rates, rep, time.Minute)
+	fx.now = func() time.Time { return now }
+	return fx
+}
+
+func TestParseRates(t *testing.T) {
+	rates, parseErr := ParseRates(strings.NewReader(testRates))
+	require.NoError(t, parseErr)
+	require.Len(t, rates, 2)
+	assert.Equal(t, "EUR", rates[0].From)
+	assert.Equal(t, "1.0907", rates[0].Rate.String())
+	assert.Equal(t, "ECB reference rates", rates[0].Source)
+	assert.Equal(t, time.Date(2024, 10, 14, 14, 0, 0, 0, time.UTC), rates[0].AsOf)
+
+	_, parseErr = ParseRates(strings.NewReader(`{"rates": []}`))
+	assert.ErrorContains(t, parseErr, "lists no rates")
+	_, parseErr = ParseRates(strings.NewReader(`{"rates": [{"from": "EUR", "to": "EUR", "rate": "1"}]}`))
+	assert.ErrorContains(t, parseErr, "rates[0] needs two different currencies")
+	_, parseErr = ParseRates(strings.NewReader(`{"rates": [{"from": "EUR", "to": "USD", "rate": "0"}]}`))
+	assert.ErrorContains(t, parseErr, "rates[0] from EUR to USD must be positive")
+}
+
+func TestFileRateProvider(t *testing.T) {
+	path := writeTestFile(t, "rates.json", testRates)
+	rates := NewFileRateProvider(path)
+
+	rate, rateErr := rates.Rate("EUR", "USD")
+	require.NoError(t, rateErr)
+	assert.Equal(t, "1.0907", rate.Rate.String())
+
+	inverse, rateErr := rates.Rate("USD", "EUR")
+	require.NoError(t, rateErr)
+	assert.Equal(t, "USD", inverse.From)
+	assert.Equal(t, "0.9168423948", inverse.Rate.String(), "derived from the opposite pair")
+
+	_, rateErr = rates.Rate("EUR", "JPY")
+	assert.ErrorIs(t, rateErr, model.ErrUnprocessable)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"rates": [{"from": "EUR", "to": "USD", "rate": "1.1"}]}`), 0o600))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+	rate, rateErr = rates.Rate("EUR", "USD")
+	require.NoError(t, rateErr)
+	assert.Equal(t, "1.1", rate.Rate.String(), "a changed file is read again")
+	assert.Equal(t, "file:rates.json", rate.Source, "without a source the file names it")
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"rates": `), 0o600))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(2*time.Minute)))
+	rate, rateErr = rates.Rate("EUR", "USD")
+	require.NoError(t, rateErr, "a broken file keeps the previous rates")
+	assert.Equal(t, "1.1", rate.Rate.String())
+
+	_, rateErr = NewFileRateProvider(path+".missing").Rate("EUR", "USD")
+	assert.ErrorIs(t, rateErr, model.ErrUnprocessable)
+}
+
+func TestFxService_ConvertsAtTheCurrentRate(t *testing.T) {
+	fx := newTestFxService(t, time.Now())
+
+	txn := limitTestTxn("ref-1", "ACC123", "rest", model.Deposit, "100")
+	txn.Currency = "EUR"
+	require.NoError(t, fx.Convert(&txn, "USD", ""))
+	assert.Equal(t, model.FxConversion{Rate: decimal.RequireFromString("1.0907"), Source: "ECB reference rates", Currency: "USD",
+		Amount: decimal.RequireFromString("109.07")}, txn.Conversion)
+
+	yen := limitTestTxn("ref-2", "ACC123", "rest", model.Deposit, "10.99")
+	require.NoError(t, fx.Convert(&yen, "JPY", ""))
+	assert.Equal(t, "1640", yen.Conversion.Amount.String(), "rounded to the minor units of the account currency")
+
+	same := limitTestTxn("ref-3", "ACC123", "rest", model.Deposit, "10")
+	require.NoError(t, fx.Convert(&same, "USD", ""))
+	require.NoError(t, fx.Convert(&same, "", ""))
+	assert.Equal(t, model.FxConversion{}, same.Conversion, "booked in its own currency")
+
+	tiny := limitTestTxn("ref-4", "ACC123", "rest", model.Deposit, "0.001")
+	tiny.Currency = "KWD"
+	assert.ErrorIs(t, fx.Convert(&tiny, "USD", ""), model.ErrUnprocessable)
+
+	disabled := NewFxService(nil, nil, time.Minute)
+	convertErr := disabled.Convert(&same, "EUR", "")
+	assert.ErrorIs(t, convertErr, model.ErrUnprocessable)
+	var domainErr *model.Error
+	require.ErrorAs(t, convertErr, &domainErr)
+	assert.Equal(t, model.CodeRateUnavailable, domainErr.Code)
+}
+
+func TestFxService_QuotesLockTheRate(t *testing.T) {
+	now := time.Date(2024, 10, 14, 12, 0, 0, 0, time.UTC)
+	fx := newTestFxService(t, now)
+	code := func(err error) string {
+		var domainErr *model.Error
+		require.ErrorAs(t, err, &domainErr)
+		return domainErr.Code
+	}
+
+	quote, quoteErr := fx.Quote(merchantId, "USD", "EUR")
+	require.NoError(t, quoteErr)
+	assert.Equal(t, "0.9168423948", quote.Rate.String())
+	assert.Equal(t, now.Add(time.Minute), quote.ExpiresAt)
+	_, quoteErr = fx.Quote(merchantId, "EUR", "GBP")
+	assert.Equal(t, model.CodeRateUnavailable, code(quoteErr))
+
+	txn := limitTestTxn("ref-1", "ACC123", "rest", model.Withdraw, "100")
+	require.NoError(t, fx.Convert(&txn, "", quote.Id), "the quote implies the account currency")
+	assert.Equal(t, model.FxConversion{QuoteId: quote.Id, Rate: quote.Rate, Source: "ECB reference rates", Currency: "EUR",
+		Amount: decimal.RequireFromString("91.68")}, txn.Conversion)
+	reused := limitTestTxn("ref-5", "ACC123", "rest", model.Withdraw, "100")
+	assert.Equal(t, model.CodeQuoteUsed, code(fx.Convert(&reused, "EUR", quote.Id)), "a quote converts a single transaction")
+	require.NoError(t, fx.Release(reused))
+	assert.Equal(t, model.CodeQuoteUsed, code(fx.Convert(&reused, "EUR", quote.Id)), "only the transaction using the quote releases it")
+	require.NoError(t, fx.Release(txn))
+	require.NoError(t, fx.Convert(&reused, "EUR", quote.Id), "a released quote converts the next transaction")
+
+	other := limitTestTxn("ref-2", "ACC123", "rest", model.Withdraw, "100")
+	other.MerchantId = otherMerchantId
+	assert.Equal(t, model.CodeQuoteNotFound, code(fx.Convert(&other, "EUR", quote.Id)))
+
+	mismatch := limitTestTxn("ref-3", "ACC123", "rest", model.Withdraw, "100")
+	assert.Equal(t, model.CodeQuoteMismatch, code(fx.Convert(&mismatch, "JPY", quote.Id)))
+
+	fx.now = func() time.Time { return now.Add(time.Minute) }
+	expired := limitTestTxn("ref-4", "ACC123", "rest", model.Withdraw, "100")
+	assert.Equal(t, model.CodeQuoteExpired, code(fx.Convert(&expired, "EUR", quote.Id)))
+	assert.Equal(t, model.FxConversion{}, expired.Conversion)
+}
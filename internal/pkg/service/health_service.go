@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	gateways "github.com/dinowar/gateway-service/internal/pkg/gateway"
+	"sync"
+	"time"
+)
+
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+type HealthService struct {
+	db       Pinger
+	logger   *LogService
+	interval time.Duration
+	timeout  time.Duration
+
+	mu       sync.RWMutex
+	checkers map[string]gateways.HealthChecker
+	database ComponentHealth
+	gateways map[string]ComponentHealth
+}
+
+func NewHealthService(db Pinger, logger *LogService, interval, timeout int) *HealthService {
+	return &HealthService{
+		db:       db,
+		logger:   logger,
+		interval: time.Duration(interval) * time.Second,
+		timeout:  time.Duration(timeout) * time.Second,
+		checkers: make(map[string]gateways.HealthChecker),
+		database: ComponentHealth{Status: HealthUnknown},
+		gateways: make(map[string]ComponentHealth),
+	}
+}
+
+func (hs *HealthService) RegisterGateway(gatewayId string, gateway gateways.PaymentGateway) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	hs.gateways[gatewayId] = ComponentHealth{Status: HealthUnknown}
+	if checker, ok := gateway.(gateways.HealthChecker); ok {
+		hs.checkers[gatewayId] = checker
+	}
+}
+
+// Run probes all components immediately and then on every interval until ctx is done.
+func (hs *HealthService) Run(ctx context.Context) {
+	hs.Probe(ctx)
+
+	ticker := time.NewTicker(hs.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			hs.Probe(ctx)
+		}
+	}
+}
+
+func (hs *HealthService) Probe(ctx context.Context) {
+	hs.mu.RLock()
+	checkers := make(map[string]gateways.HealthChecker, len(hs.checkers))
+	for gatewayId, checker := range hs.checkers {
+		checkers[gatewayId] = checker
+	}
+	hs.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	results := make(map[string]ComponentHealth, len(checkers))
+	var resultsMu sync.Mutex
+	for gatewayId, checker := range checkers {
+		wg.Add(1)
+		go func(gatewayId string, checker gateways.HealthChecker) {
+			defer wg.Done()
+			result := hs.check(ctx, checker.HealthCheck)
+			if result.Status == HealthDown {
+				hs.logger.LogInfo("health probe failed", "gateway", gatewayId, "error", result.Error)
+			}
+			resultsMu.Lock()
+			results[gatewayId] = result
+			resultsMu.Unlock()
+		}(gatewayId, checker)
+	}
+
+	database := ComponentHealth{Status: HealthUnknown}
+	if hs.db != nil {
+		database = hs.check(ctx, hs.db.PingContext)
+		if database.Status == HealthDown {
+			hs.logger.LogInfo("health probe failed", "component", "database", "error", database.Error)
+		}
+	}
+	wg.Wait()
+
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.database = database
+	for gatewayId, result := range results {
+		hs.gateways[gatewayId] = result
+	}
+}
+
+func (hs *HealthService) check(ctx context.Context, probe func(ctx context.Context) error) ComponentHealth {
+	probeCtx, cancel := context.WithTimeout(ctx, hs.timeout)
+	defer cancel()
+
+	start := time.Now()
+	probeErr := probe(probeCtx)
+	checkedAt := time.Now()
+	result := ComponentHealth{
+		Status:    HealthUp,
+		LatencyMs: checkedAt.Sub(start).Milliseconds(),
+		CheckedAt: &checkedAt,
+	}
+	if probeErr != nil {
+		result.Status = HealthDown
+		result.Error = probeErr.Error()
+	}
+	return result
+}
+
+func (hs *HealthService) Report() HealthReport {
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+
+	report := HealthReport{
+		Status:   HealthUp,
+		Database: hs.database,
+		Gateways: make(map[string]ComponentHealth, len(hs.gateways)),
+	}
+	for gatewayId, result := range hs.gateways {
+		report.Gateways[gatewayId] = result
+		if result.Status == HealthDown {
+			report.Status = HealthDegraded
+		}
+	}
+	if hs.database.Status != HealthUp {
+		report.Status = HealthDown
+	}
+	return report
+}
+
+// Ready reports whether the service can accept payments: the database is
+// reachable and at least one gateway is not known to be down.
+func (hs *HealthService) Ready() bool {
+	report := hs.Report()
+	if report.Database.Status != HealthUp {
+		return false
+	}
+	if len(report.Gateways) == 0 {
+		return true
+	}
+	for _, result := range report.Gateways {
+		if result.Status != HealthDown {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type stubGateway struct {
+	healthErr error
+}
+
+func (gw *stubGateway) ProcessDeposit(req model.DepositReq, callbackUrl string) (*model.DepositResponse, error) {
+	return &model.DepositResponse{}, nil
+}
+
+func (gw *stubGateway) ProcessWithdrawal(req model.WithdrawReq, callbackUrl string) (*model.WithdrawResponse, error) {
+	return &model.WithdrawResponse{}, nil
+}
+
+func (gw *stubGateway) ProcessAuthorization(req model.AuthorizeReq, callbackUrl string) (*model.AuthorizeResponse, error) {
+	return &model.AuthorizeResponse{}, nil
+}
+
+func (gw *stubGateway) ProcessCapture(req model.CaptureReq) (*model.CaptureResponse, error) {
+	return &model.CaptureResponse{}, nil
+}
+
+func (gw *stubGateway) ProcessVoid(req model.VoidReq) (*model.VoidResponse, error) {
+	return &model.VoidResponse{}, nil
+}
+
+func (gw *stubGateway) HealthCheck(ctx context.Context) error {
+	return gw.healthErr
+}
+
+func TestHealthService_AllUp(t *testing.T) {
+	db, mock, mockErr := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	assert.NoError(t, mockErr)
+	defer db.Close()
+
+	mock.ExpectPing()
+
+	health := NewHealthService(db, NewLogService(zap.NewNop()), 1, 1)
+	health.RegisterGateway("rest", &stubGateway{})
+	health.Probe(context.Background())
+
+	report := health.Report()
+	assert.Equal(t, model.HealthUp, report.Status)
+	assert.Equal(t, model.HealthUp, report.Database.Status)
+	assert.Equal(t, model.HealthUp, report.Gateways["rest"].Status)
+	assert.True(t, health.Ready())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHealthService_GatewayDown(t *testing.T) {
+	db, mock, mockErr := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	assert.NoError(t, mockErr)
+	defer db.Close()
+
+	mock.ExpectPing()
+
+	health := NewHealthService(db, NewLogService(zap.NewNop()), 1, 1)
+	health.RegisterGateway("rest", &stubGateway{})
+	health.RegisterGateway("soap", &stubGateway{healthErr: errors.New("connection refused")})
+	health.Probe(context.Background())
+
+	report := health.Report()
+	assert.Equal(t, model.HealthDegraded, report.Status)
+	assert.Equal(t, model.HealthDown, report.Gateways["soap"].Status)
+	assert.Equal(t, "connection refused", report.Gateways["soap"].Error)
+	assert.True(t, health.Ready())
+}
+
+func TestHealthService_DatabaseDown(t *testing.T) {
+	db, mock, mockErr := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	assert.NoError(t, mockErr)
+	defer db.Close()
+
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+
+	health := NewHealthService(db, NewLogService(zap.NewNop()), 1, 1)
+	health.RegisterGateway("rest", &stubGateway{})
+	health.Probe(context.Background())
+
+	report := health.Report()
+	assert.Equal(t, model.HealthDown, report.Status)
+	assert.Equal(t, model.HealthDown, report.Database.Status)
+	assert.False(t, health.Ready())
+}
+
+func TestHealthService_NotProbedYet(t *testing.T) {
+	health := NewHealthService(nil, NewLogService(zap.NewNop()), 1, 1)
+	health.RegisterGateway("rest", &stubGateway{})
+
+	report := health.Report()
+	assert.Equal(t, model.HealthUnknown, report.Gateways["rest"].Status)
+	assert.False(t, health.Ready())
+}
@@ -0,0 +1,34 @@
+package service
+
+import . "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+
+// LedgerRepository stores the double-entry ledger, implemented by
+// RepositoryService and MemoryRepositoryService with the same semantics.
+type LedgerRepository interface {
+	// PostEntry books a balanced entry, creating missing ledger accounts and
+	// filling CreatedAt and the postings' BalanceAfter. Concurrent entries
+	// on the same accounts are applied one after the other. An entry whose
+	// reference id and kind are booked already is ignored and returns nil
+	// with entry unchanged. An active hold with the entry's reference id is
+	// captured together with the booking.
+	PostEntry(entry *JournalEntry) error
+	// PlaceHold reserves hold.Amount of the account holder's available balance
+	// in hold.Currency and fills the hold's CreatedAt and Status. It fails with
+	// CodeInsufficientFunds when the available balance is short; concurrent
+	// holds on the same account are checked one after the other. Placing a
+	// hold for a reference id that has one already is a no-op.
+	PlaceHold(hold *FundsHold) error
+	// ReleaseHold returns the active hold of a reference id to the available
+	// balance and does nothing when there is none.
+	ReleaseHold(merchantId, referenceId string) error
+	// GetBalances returns the balances of an account holder, one per
+	// currency it has been booked or held in, ordered by currency.
+	GetBalances(merchantId, accountId string) ([]Balance, error)
+	// GetStatement returns one page of the postings to an account holder.
+	GetStatement(merchantId, accountId string, req StatementRequest) (StatementPage, error)
+}
+
+var (
+	_ LedgerRepository = (*RepositoryService)(nil)
+	_ LedgerRepository = (*MemoryRepositoryService)(nil)
+)
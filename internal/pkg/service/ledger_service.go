@@ -0,0 +1,149 @@
+package service
+
+import (
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// LedgerService books settled money movements into the double-entry ledger.
+// Every account holder has a customer ledger account per currency and every
+// gateway a gateway ledger account; a settled deposit moves money from the
+// gateway account to the customer, a withdrawal moves it back.
+type LedgerService struct {
+	rep LedgerRepository
+}
+
+func NewLedgerService(rep LedgerRepository) *LedgerService {
+	return &LedgerService{rep: rep}
+}
+
+// HoldWithdrawal reserves the amount of the withdrawal txn, in the currency of
+// the account, before it is dispatched, failing with insufficient funds when
+// the account's available balance is short. Deposits need no hold.
+func (ls *LedgerService) HoldWithdrawal(txn Transaction) error {
+	if txn.Operation != Withdraw || txn.MerchantId == "" {
+		return nil
+	}
+	amount, currency := txn.AccountAmount()
+	return ls.rep.PlaceHold(&FundsHold{
+		Id:          uuid.NewString(),
+		MerchantId:  txn.MerchantId,
+		AccountId:   txn.AccountId,
+		ReferenceId: txn.ReferenceId,
+		Currency:    currency,
+		Amount:      amount,
+	})
+}
+
+// ReleaseHold returns the funds held for txn, e.g. when it could not be dispatched.
+func (ls *LedgerService) ReleaseHold(txn Transaction) error {
+	return ls.rep.ReleaseHold(txn.MerchantId, txn.ReferenceId)
+}
+
+// BookTransaction books txn once it is SUCCESS, capturing the hold of a
+// withdrawal, and releases the hold when it is FAILED. A CAPTURED
+// authorization is booked like a deposit, for the captured amount. A fee is booked in an
+// entry of its own, from the gateway account to the gateway's fees account,
+// so the customer side only carries the amount. A converted transaction is
+// booked to the customer in the account's currency and to the gateway in its
+// own, see post. Booking a transaction again is a no-op.
+func (ls *LedgerService) BookTransaction(txn Transaction) error {
+	if txn.MerchantId == "" {
+		return nil
+	}
+	if txn.Status == StatusFailed {
+		return ls.ReleaseHold(txn)
+	}
+	if txn.Status != StatusSuccess && txn.Status != StatusCaptured {
+		return nil
+	}
+	kind, customer := EntryDeposit, Credit
+	if txn.Operation == Withdraw {
+		kind, customer = EntryWithdrawal, Debit
+	}
+	if postErr := ls.post(txn, txn.ReferenceId, kind, customer, txn.SettledAmount()); postErr != nil {
+		return postErr
+	}
+	if !txn.Fee.IsPositive() {
+		return nil
+	}
+	return ls.rep.PostEntry(&JournalEntry{
+		Id:          uuid.NewString(),
+		MerchantId:  txn.MerchantId,
+		ReferenceId: txn.ReferenceId,
+		Kind:        EntryFee,
+		Currency:    txn.Currency,
+		Postings: []Posting{
+			{Account: LedgerAccountKey{Type: LedgerFees, Owner: txn.GatewayId}, Direction: Debit, Amount: txn.Fee},
+			{Account: LedgerAccountKey{Type: LedgerGateway, Owner: txn.GatewayId}, Direction: Credit, Amount: txn.Fee},
+		},
+	})
+}
+
+// post books amount between the customer account of txn and its gateway,
+// in direction customer for the customer side. The amount of a converted
+// transaction passes through the gateway's fx account: the entry of kind
+// moves its conversion between the fx account and the customer, an EntryFx
+// the amount itself between the gateway and the fx account.
+func (ls *LedgerService) post(txn Transaction, referenceId string, kind EntryKind, customer Direction, amount decimal.Decimal) error {
+	gateway := Debit
+	if customer == Debit {
+		gateway = Credit
+	}
+	gatewayAccount := LedgerAccountKey{Type: LedgerGateway, Owner: txn.GatewayId}
+	customerAccount := LedgerAccountKey{Type: LedgerCustomer, Owner: txn.AccountId}
+	if txn.Conversion.Currency == "" {
+		return ls.rep.PostEntry(&JournalEntry{
+			Id:          uuid.NewString(),
+			MerchantId:  txn.MerchantId,
+			ReferenceId: referenceId,
+			Kind:        kind,
+			Currency:    txn.Currency,
+			Postings: []Posting{
+				{Account: gatewayAccount, Direction: gateway, Amount: amount},
+				{Account: customerAccount, Direction: customer, Amount: amount},
+			},
+		})
+	}
+
+	fxAccount := LedgerAccountKey{Type: LedgerFx, Owner: txn.GatewayId}
+	converted := txn.Conversion.Amount
+	if !amount.Equal(txn.Amount) {
+		converted = convertAmount(amount, txn.Conversion.Rate, txn.Conversion.Currency)
+	}
+	// the customer side goes first, it captures the hold of a withdrawal
+	customerErr := ls.rep.PostEntry(&JournalEntry{
+		Id:          uuid.NewString(),
+		MerchantId:  txn.MerchantId,
+		ReferenceId: referenceId,
+		Kind:        kind,
+		Currency:    txn.Conversion.Currency,
+		Postings: []Posting{
+			{Account: fxAccount, Direction: gateway, Amount: converted},
+			{Account: customerAccount, Direction: customer, Amount: converted},
+		},
+	})
+	if customerErr != nil {
+		return customerErr
+	}
+	return ls.rep.PostEntry(&JournalEntry{
+		Id:          uuid.NewString(),
+		MerchantId:  txn.MerchantId,
+		ReferenceId: referenceId,
+		Kind:        EntryFx,
+		Currency:    txn.Currency,
+		Postings: []Posting{
+			{Account: gatewayAccount, Direction: gateway, Amount: amount},
+			{Account: fxAccount, Direction: customer, Amount: amount},
+		},
+	})
+}
+
+func (ls *LedgerService) Balances(merchantId, accountId string) ([]Balance, error) {
+	return ls.rep.GetBalances(merchantId, accountId)
+}
+
+func (ls *LedgerService) Statement(merchantId, accountId string, req StatementRequest) (StatementPage, error) {
+	return ls.rep.GetStatement(merchantId, accountId, req)
+}
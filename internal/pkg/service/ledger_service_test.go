@@ -0,0 +1,365 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type ledgerTestRepository interface {
+	LedgerRepository
+	MerchantRepository
+}
+
+func settled(referenceId, accountId string, operation model.Operation, amount string) model.Transaction {
+	return model.Transaction{
+		ReferenceId: referenceId,
+		MerchantId:  merchantId,
+		AccountId:   accountId,
+		GatewayId:   "rest",
+		Amount:      decimal.RequireFromString(amount),
+		Currency:    "USD",
+		Status:      model.StatusSuccess,
+		Operation:   operation,
+	}
+}
+
+func pendingWithdrawal(referenceId, amount string) model.Transaction {
+	txn := settled(referenceId, "ACC123", model.Withdraw, amount)
+	txn.Status = model.StatusPending
+	return txn
+}
+
+// assertHeld checks the held and available USD balance of ACC123.
+func assertHeld(t *testing.T, ledger *LedgerService, held, available string) {
+	t.Helper()
+
+	balances, balancesErr := ledger.Balances(merchantId, "ACC123")
+	require.NoError(t, balancesErr)
+	require.Len(t, balances, 1)
+	assert.True(t, decimal.RequireFromString(held).Equal(balances[0].Held), "held %s, want %s", balances[0].Held, held)
+	assert.True(t, decimal.RequireFromString(available).Equal(balances[0].Available()), "available %s, want %s", balances[0].Available(), available)
+}
+
+func assertBalance(t *testing.T, ledger *LedgerService, accountId, currency, expected string) {
+	t.Helper()
+
+	balances, balancesErr := ledger.Balances(merchantId, accountId)
+	require.NoError(t, balancesErr)
+	for _, balance := range balances {
+		if balance.Currency == currency {
+			assert.True(t, decimal.RequireFromString(expected).Equal(balance.Balance), "balance %s, want %s", balance.Balance, expected)
+			return
+		}
+	}
+	t.Fatalf("no %s balance for %s", currency, accountId)
+}
+
+// runLedgerRepositoryContract checks the behaviour every LedgerRepository
+// must share, driven through LedgerService.
+func runLedgerRepositoryContract(t *testing.T, newEmptyRepository func(t *testing.T) ledgerTestRepository) {
+	newLedger := func(t *testing.T) (*LedgerService, ledgerTestRepository) {
+		rep := newEmptyRepository(t)
+		for _, id := range []string{merchantId, otherMerchantId} {
+			require.NoError(t, rep.CreateMerchant(&model.Merchant{Id: id, Name: id}))
+		}
+		return NewLedgerService(rep), rep
+	}
+
+	t.Run("books settled transactions once", func(t *testing.T) {
+		ledger, rep := newLedger(t)
+		require.NoError(t, ledger.BookTransaction(settled("dep-1", "ACC123", model.Deposit, "100.5")))
+		require.NoError(t, ledger.BookTransaction(settled("dep-1", "ACC123", model.Deposit, "100.5")))
+		require.NoError(t, ledger.BookTransaction(settled("wd-1", "ACC123", model.Withdraw, "40")))
+		pending := settled("dep-2", "ACC123", model.Deposit, "7")
+		pending.Status = model.StatusPending
+		require.NoError(t, ledger.BookTransaction(pending))
+		failed := settled("dep-3", "ACC123", model.Deposit, "7")
+		failed.Status = model.StatusFailed
+		require.NoError(t, ledger.BookTransaction(failed))
+
+		assertBalance(t, ledger, "ACC123", "USD", "60.5")
+		others, _ := rep.GetBalances(otherMerchantId, "ACC123")
+		assert.Empty(t, others)
+		none, _ := rep.GetBalances(merchantId, "ACC999")
+		assert.Empty(t, none)
+	})
+
+	t.Run("books captured authorizations for the captured amount", func(t *testing.T) {
+		ledger, _ := newLedger(t)
+		authorized := settled("auth-1", "ACC123", model.Deposit, "100")
+		authorized.Status = model.StatusAuthorized
+		require.NoError(t, ledger.BookTransaction(authorized))
+		voided := settled("auth-2", "ACC123", model.Deposit, "100")
+		voided.Status = model.StatusVoided
+		require.NoError(t, ledger.BookTransaction(voided))
+		captured := authorized
+		captured.Status = model.StatusCaptured
+		captured.Authorization.Captured = decimal.RequireFromString("35.25")
+		require.NoError(t, ledger.BookTransaction(captured))
+
+		assertBalance(t, ledger, "ACC123", "USD", "35.25")
+	})
+
+	t.Run("converted transactions are booked in the account currency", func(t *testing.T) {
+		ledger, _ := newLedger(t)
+		converted := func(txn model.Transaction, amount string) model.Transaction {
+			txn.Currency = "EUR"
+			txn.Conversion = model.FxConversion{Rate: decimal.RequireFromString("1.0907"), Source: "test", Currency: "USD", Amount: decimal.RequireFromString(amount)}
+			return txn
+		}
+		deposit := converted(settled("dep-1", "ACC123", model.Deposit, "100"), "109.07")
+		require.NoError(t, ledger.BookTransaction(deposit))
+		require.NoError(t, ledger.BookTransaction(deposit))
+		assertBalance(t, ledger, "ACC123", "USD", "109.07")
+
+		withdrawal := converted(pendingWithdrawal("wd-1", "50"), "54.54")
+		require.NoError(t, ledger.HoldWithdrawal(withdrawal))
+		assertHeld(t, ledger, "54.54", "54.53")
+		withdrawal.Status = model.StatusSuccess
+		require.NoError(t, ledger.BookTransaction(withdrawal))
+		assertHeld(t, ledger, "0", "54.53")
+		assertBalance(t, ledger, "ACC123", "USD", "54.53")
+	})
+
+	t.Run("fees stay off the customer side", func(t *testing.T) {
+		ledger, _ := newLedger(t)
+		deposit := settled("dep-1", "ACC123", model.Deposit, "100")
+		deposit.Fee = decimal.RequireFromString("3.20")
+		require.NoError(t, ledger.BookTransaction(deposit))
+		require.NoError(t, ledger.BookTransaction(deposit))
+		require.NoError(t, ledger.HoldWithdrawal(pendingWithdrawal("wd-1", "40")))
+		withdrawal := settled("wd-1", "ACC123", model.Withdraw, "40")
+		withdrawal.Fee = decimal.RequireFromString("1")
+		require.NoError(t, ledger.BookTransaction(withdrawal))
+
+		assertBalance(t, ledger, "ACC123", "USD", "60")
+		assertHeld(t, ledger, "0", "60")
+		statement, _ := ledger.Statement(merchantId, "ACC123", model.StatementRequest{})
+		assert.Len(t, statement.Lines, 2)
+	})
+
+	t.Run("balances per currency", func(t *testing.T) {
+		ledger, _ := newLedger(t)
+		require.NoError(t, ledger.BookTransaction(settled("dep-1", "ACC123", model.Deposit, "10")))
+		eur := settled("dep-2", "ACC123", model.Deposit, "20")
+		eur.Currency = "EUR"
+		require.NoError(t, ledger.BookTransaction(eur))
+
+		balances, balancesErr := ledger.Balances(merchantId, "ACC123")
+		require.NoError(t, balancesErr)
+		require.Len(t, balances, 2)
+		assert.Equal(t, "EUR", balances[0].Currency)
+		assert.Equal(t, "USD", balances[1].Currency)
+		assert.False(t, balances[1].UpdatedAt.IsZero())
+	})
+
+	t.Run("statement pages newest first", func(t *testing.T) {
+		ledger, _ := newLedger(t)
+		require.NoError(t, ledger.BookTransaction(settled("dep-1", "ACC123", model.Deposit, "100")))
+		require.NoError(t, ledger.BookTransaction(settled("wd-1", "ACC123", model.Withdraw, "30")))
+		require.NoError(t, ledger.BookTransaction(settled("dep-2", "ACC123", model.Deposit, "5")))
+		require.NoError(t, ledger.BookTransaction(settled("dep-3", "ACC456", model.Deposit, "1")))
+
+		first, statementErr := ledger.Statement(merchantId, "ACC123", model.StatementRequest{Limit: 2})
+		require.NoError(t, statementErr)
+		require.Len(t, first.Lines, 2)
+		assert.Equal(t, "dep-2", first.Lines[0].ReferenceId)
+		assert.Equal(t, model.EntryDeposit, first.Lines[0].Kind)
+		assert.True(t, decimal.RequireFromString("75").Equal(first.Lines[0].BalanceAfter))
+		assert.Equal(t, "wd-1", first.Lines[1].ReferenceId)
+		assert.Equal(t, model.EntryWithdrawal, first.Lines[1].Kind)
+		assert.True(t, decimal.RequireFromString("-30").Equal(first.Lines[1].Amount), "debits are negative")
+		assert.True(t, decimal.RequireFromString("70").Equal(first.Lines[1].BalanceAfter))
+		require.NotZero(t, first.Next)
+
+		second, statementErr := ledger.Statement(merchantId, "ACC123", model.StatementRequest{Limit: 2, Before: first.Next})
+		require.NoError(t, statementErr)
+		require.Len(t, second.Lines, 1)
+		assert.Equal(t, "dep-1", second.Lines[0].ReferenceId)
+		assert.True(t, decimal.RequireFromString("100").Equal(second.Lines[0].Amount))
+		assert.Zero(t, second.Next)
+
+		past := time.Now().Add(-time.Hour)
+		future := time.Now().Add(time.Hour)
+		empty, _ := ledger.Statement(merchantId, "ACC123", model.StatementRequest{From: &future})
+		assert.Empty(t, empty.Lines)
+		all, _ := ledger.Statement(merchantId, "ACC123", model.StatementRequest{From: &past, To: &future})
+		assert.Len(t, all.Lines, 3)
+		eur, _ := ledger.Statement(merchantId, "ACC123", model.StatementRequest{Currency: "EUR"})
+		assert.Empty(t, eur.Lines)
+		others, _ := ledger.Statement(otherMerchantId, "ACC123", model.StatementRequest{})
+		assert.Empty(t, others.Lines)
+	})
+
+	t.Run("holds", func(t *testing.T) {
+		ledger, rep := newLedger(t)
+		assert.ErrorIs(t, ledger.HoldWithdrawal(pendingWithdrawal("wd-0", "10")), model.ErrUnprocessable)
+		none, _ := rep.GetBalances(merchantId, "ACC123")
+		assert.Empty(t, none, "rejected holds leave no account behind")
+
+		require.NoError(t, ledger.BookTransaction(settled("dep-1", "ACC123", model.Deposit, "100")))
+		require.NoError(t, ledger.HoldWithdrawal(pendingWithdrawal("wd-1", "60")))
+		require.NoError(t, ledger.HoldWithdrawal(pendingWithdrawal("wd-1", "60")), "holding a reference again is a no-op")
+		holdErr := ledger.HoldWithdrawal(pendingWithdrawal("wd-2", "40.01"))
+		var domainErr *model.Error
+		require.ErrorAs(t, holdErr, &domainErr)
+		assert.Equal(t, model.CodeInsufficientFunds, domainErr.Code)
+		require.NoError(t, ledger.HoldWithdrawal(pendingWithdrawal("wd-2", "40")))
+		require.NoError(t, ledger.HoldWithdrawal(model.Transaction{
+			ReferenceId: "dep-2", MerchantId: merchantId, AccountId: "ACC123", Amount: decimal.NewFromInt(1000),
+			Currency: "USD", Operation: model.Deposit,
+		}), "deposits need no funds")
+		assertHeld(t, ledger, "100", "0")
+
+		failed := pendingWithdrawal("wd-1", "60")
+		failed.Status = model.StatusFailed
+		require.NoError(t, ledger.BookTransaction(failed))
+		require.NoError(t, ledger.BookTransaction(failed))
+		assertHeld(t, ledger, "40", "60")
+
+		require.NoError(t, ledger.BookTransaction(settled("wd-2", "ACC123", model.Withdraw, "40")))
+		assertBalance(t, ledger, "ACC123", "USD", "60")
+		assertHeld(t, ledger, "0", "60")
+		require.NoError(t, ledger.ReleaseHold(pendingWithdrawal("wd-2", "40")), "captured holds stay captured")
+		assertHeld(t, ledger, "0", "60")
+	})
+
+	t.Run("concurrent holds never overdraw", func(t *testing.T) {
+		ledger, _ := newLedger(t)
+		require.NoError(t, ledger.BookTransaction(settled("dep-1", "ACC123", model.Deposit, "100")))
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		held := 0
+		for i := 0; i < 25; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				holdErr := ledger.HoldWithdrawal(pendingWithdrawal(fmt.Sprintf("wd-%d", i), "10"))
+				if holdErr == nil {
+					mu.Lock()
+					held++
+					mu.Unlock()
+					return
+				}
+				assert.ErrorIs(t, holdErr, model.ErrUnprocessable)
+			}(i)
+		}
+		wg.Wait()
+
+		assert.Equal(t, 10, held)
+		assertHeld(t, ledger, "100", "0")
+	})
+
+	t.Run("concurrent bookings keep balances consistent", func(t *testing.T) {
+		ledger, _ := newLedger(t)
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				operation := model.Deposit
+				if i%4 == 0 {
+					operation = model.Withdraw
+				}
+				accountId := fmt.Sprintf("ACC%d", i%2)
+				assert.NoError(t, ledger.BookTransaction(settled(fmt.Sprintf("ref-%d", i), accountId, operation, "10")))
+				// a duplicate racing the original
+				assert.NoError(t, ledger.BookTransaction(settled(fmt.Sprintf("ref-%d", i), accountId, operation, "10")))
+			}(i)
+		}
+		wg.Wait()
+
+		// ACC0 has 10 bookings, 5 of them withdrawals; ACC1 10 deposits
+		assertBalance(t, ledger, "ACC0", "USD", "0")
+		assertBalance(t, ledger, "ACC1", "USD", "100")
+		statement, _ := ledger.Statement(merchantId, "ACC1", model.StatementRequest{})
+		require.Len(t, statement.Lines, 10)
+		for i, line := range statement.Lines {
+			assert.True(t, decimal.NewFromInt(int64(100-10*i)).Equal(line.BalanceAfter), "running balances follow the booking order")
+		}
+	})
+}
+
+func TestMemoryLedgerRepository_Contract(t *testing.T) {
+	runLedgerRepositoryContract(t, func(t *testing.T) ledgerTestRepository {
+		return NewMemoryRepositoryService()
+	})
+}
+
+func TestPostgresLedgerRepository_Contract(t *testing.T) {
+	runLedgerRepositoryContract(t, func(t *testing.T) ledgerTestRepository {
+		return NewRepositoryService(migratedPostgresTestDB(t))
+	})
+}
+
+func TestLedger_RejectsUnbalancedEntries(t *testing.T) {
+	rep := NewMemoryRepositoryService()
+	require.NoError(t, rep.CreateMerchant(&model.Merchant{Id: merchantId, Name: merchantId}))
+	entry := &model.JournalEntry{
+		Id: "entry-1", MerchantId: merchantId, ReferenceId: "ref-1", Kind: model.EntryDeposit, Currency: "USD",
+		Postings: []model.Posting{
+			{Account: model.LedgerAccountKey{Type: model.LedgerGateway, Owner: "rest"}, Direction: model.Debit, Amount: decimal.NewFromInt(10)},
+			{Account: model.LedgerAccountKey{Type: model.LedgerCustomer, Owner: "ACC123"}, Direction: model.Credit, Amount: decimal.NewFromInt(9)},
+		},
+	}
+	assert.Error(t, rep.PostEntry(entry))
+	assert.Error(t, NewRepositoryService(nil).PostEntry(entry), "checked before touching the database")
+
+	balances, _ := rep.GetBalances(merchantId, "ACC123")
+	assert.Empty(t, balances)
+}
+
+func TestLedger_BooksFeesApart(t *testing.T) {
+	rep := NewMemoryRepositoryService()
+	require.NoError(t, rep.CreateMerchant(&model.Merchant{Id: merchantId, Name: merchantId}))
+	ledger := NewLedgerService(rep)
+
+	deposit := settled("dep-1", "ACC123", model.Deposit, "100")
+	deposit.Fee = decimal.RequireFromString("3.20")
+	require.NoError(t, ledger.BookTransaction(deposit))
+	require.NoError(t, ledger.BookTransaction(settled("dep-2", "ACC123", model.Deposit, "10")), "no fee, no fee entry")
+
+	fee, booked := rep.journal[memoryJournalKey{referenceId: "dep-1", kind: model.EntryFee}]
+	require.True(t, booked)
+	assert.True(t, fee.Balanced())
+	_, booked = rep.journal[memoryJournalKey{referenceId: "dep-2", kind: model.EntryFee}]
+	assert.False(t, booked)
+
+	balance := func(accountType model.LedgerAccountType) string {
+		return rep.ledgerAccounts[memoryLedgerKey{merchantId: merchantId, account: model.LedgerAccountKey{Type: accountType, Owner: "rest"}, currency: "USD"}].balance.String()
+	}
+	assert.Equal(t, "106.8", balance(model.LedgerGateway), "the provider keeps the fee")
+	assert.Equal(t, "3.2", balance(model.LedgerFees))
+}
+
+func TestLedger_BooksConversionsThroughFxAccount(t *testing.T) {
+	rep := NewMemoryRepositoryService()
+	require.NoError(t, rep.CreateMerchant(&model.Merchant{Id: merchantId, Name: merchantId}))
+	ledger := NewLedgerService(rep)
+
+	deposit := settled("dep-1", "ACC123", model.Deposit, "100")
+	deposit.Currency = "EUR"
+	deposit.Conversion = model.FxConversion{Rate: decimal.RequireFromString("1.0907"), Source: "test", Currency: "USD", Amount: decimal.RequireFromString("109.07")}
+	require.NoError(t, ledger.BookTransaction(deposit))
+
+	for _, kind := range []model.EntryKind{model.EntryDeposit, model.EntryFx} {
+		entry, booked := rep.journal[memoryJournalKey{referenceId: "dep-1", kind: kind}]
+		require.True(t, booked, kind)
+		assert.True(t, entry.Balanced(), kind)
+	}
+	balance := func(accountType model.LedgerAccountType, currency string) string {
+		return rep.ledgerAccounts[memoryLedgerKey{merchantId: merchantId, account: model.LedgerAccountKey{Type: accountType, Owner: "rest"}, currency: currency}].balance.String()
+	}
+	assert.Equal(t, "100", balance(model.LedgerGateway, "EUR"), "the gateway moved euros")
+	assert.Equal(t, "-100", balance(model.LedgerFx, "EUR"))
+	assert.Equal(t, "109.07", balance(model.LedgerFx, "USD"))
+	assertBalance(t, ledger, "ACC123", "USD", "109.07")
+}
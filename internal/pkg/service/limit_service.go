@@ -0,0 +1,127 @@
+package service
+
+import (
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"sort"
+	"time"
+)
+
+// LimitService evaluates a merchant's limits before a transaction is
+// dispatched. Velocity totals are read from the stored transactions; Save
+// checks them again while it stores the transaction under a lock of the
+// totals, so requests racing each other close to a cap cannot all pass it.
+type LimitService struct {
+	rep    TransactionRepository
+	locker UsageLocker
+	now    func() time.Time
+}
+
+// NewLimitService locks velocity totals with rep when it is a UsageLocker,
+// as both repositories are.
+func NewLimitService(rep TransactionRepository) *LimitService {
+	locker, _ := rep.(UsageLocker)
+	return &LimitService{rep: rep, locker: locker, now: time.Now}
+}
+
+// Check returns ErrUnprocessable when txn breaks one of the per-transaction
+// limits of settings, or would take the count or total of its account or
+// gateway in the current period over a velocity limit. Limits apply to the
+// amount booked to the account, so a converted transaction is checked in
+// its account currency, see Transaction.AccountAmount.
+func (ls *LimitService) Check(settings MerchantSettings, txn Transaction) error {
+	amount, currency := txn.AccountAmount()
+	if limitErr := settings.CheckLimits(txn.Operation, currency, txn.GatewayId, amount); limitErr != nil {
+		return limitErr
+	}
+	return ls.checkVelocity(ls.rep, settings, txn)
+}
+
+// Save stores txn like TransactionRepository.SaveTransaction, checking the
+// velocity limits of settings again with the totals it counts towards locked
+// until txn is stored. FAILED transactions count towards no total and are
+// stored unchecked.
+func (ls *LimitService) Save(settings MerchantSettings, txn *Transaction) error {
+	keys := usageKeys(settings, *txn)
+	if ls.locker == nil || len(keys) == 0 || txn.Status == StatusFailed {
+		return ls.rep.SaveTransaction(txn)
+	}
+	return ls.locker.LockUsage(keys, func(store UsageStore) error {
+		if limitErr := ls.checkVelocity(store, settings, *txn); limitErr != nil {
+			return limitErr
+		}
+		return store.SaveTransaction(txn)
+	})
+}
+
+// usageKeys names the velocity totals of settings txn counts towards, sorted
+// so that transactions sharing them lock them in the same order.
+func usageKeys(settings MerchantSettings, txn Transaction) []string {
+	_, currency := txn.AccountAmount()
+	unique := make(map[string]bool)
+	for _, limit := range settings.VelocityLimits {
+		if !limit.Matches(txn.Operation, currency, txn.GatewayId) {
+			continue
+		}
+		if limit.Scope == ScopeGateway {
+			unique[txn.MerchantId+"/gateway/"+txn.GatewayId] = true
+		} else {
+			unique[txn.MerchantId+"/account/"+txn.AccountId] = true
+		}
+	}
+	keys := make([]string, 0, len(unique))
+	for key := range unique {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (ls *LimitService) checkVelocity(store UsageStore, settings MerchantSettings, txn Transaction) error {
+	amount, currency := txn.AccountAmount()
+	now := ls.now()
+	for _, limit := range settings.VelocityLimits {
+		if !limit.Matches(txn.Operation, currency, txn.GatewayId) {
+			continue
+		}
+		query := UsageQuery{
+			GatewayId: limit.GatewayId,
+			Operation: limit.Operation,
+			Currency:  limit.Currency,
+			Since:     limit.Period.Start(now),
+		}
+		subject := "account " + txn.AccountId
+		if limit.Scope == ScopeGateway {
+			query.GatewayId = txn.GatewayId
+			subject = "gateway " + txn.GatewayId
+		} else {
+			query.AccountId = txn.AccountId
+		}
+
+		usage, usageErr := store.GetUsage(txn.MerchantId, query)
+		if usageErr != nil {
+			return usageErr
+		}
+		if limit.MaxCount != nil && usage.Count >= *limit.MaxCount {
+			return NewError(ErrUnprocessable, CodeVelocityExceeded, "%s reached its %s limit of %d %s",
+				subject, limit.Period, *limit.MaxCount, limitedOperation(limit.Operation)+"s")
+		}
+		if limit.MaxAmount != nil {
+			if total := usage.Amount.Add(amount); total.GreaterThan(*limit.MaxAmount) {
+				return NewError(ErrUnprocessable, CodeVelocityExceeded, "%s %s total of %s would reach %s %s, above the limit of %s",
+					limit.Period, limitedOperation(limit.Operation), subject, total, limit.Currency, limit.MaxAmount)
+			}
+		}
+	}
+	return nil
+}
+
+// limitedOperation names what a limit of operation counts in rejection messages.
+func limitedOperation(operation Operation) string {
+	switch operation {
+	case Deposit:
+		return "deposit"
+	case Withdraw:
+		return "withdrawal"
+	}
+	return "transaction"
+}
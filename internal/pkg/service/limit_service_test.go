@@ -0,0 +1,179 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLimitTestService(t *testing.T, now time.Time) (*LimitService, *MemoryRepositoryService) {
+	t.Helper()
+
+	rep := NewMemoryRepositoryService()
+	require.NoError(t, rep.CreateMerchant(&model.Merchant{Id: merchantId, Name: merchantId}))
+	rep.now = func() time.Time { return now }
+	limits := NewLimitService(rep)
+	limits.now = func() time.Time { return now }
+	return limits, rep
+}
+
+func limitTestTxn(referenceId, accountId, gatewayId string, operation model.Operation, amount string) model.Transaction {
+	return model.Transaction{
+		ReferenceId: referenceId,
+		MerchantId:  merchantId,
+		AccountId:   accountId,
+		GatewayId:   gatewayId,
+		Amount:      decimal.RequireFromString(amount),
+		Currency:    "USD",
+		Status:      model.StatusPending,
+		Operation:   operation,
+	}
+}
+
+func limitCode(t *testing.T, err error) string {
+	t.Helper()
+
+	var domainErr *model.Error
+	require.ErrorAs(t, err, &domainErr)
+	assert.ErrorIs(t, err, model.ErrUnprocessable)
+	return domainErr.Code
+}
+
+func TestLimitService_PerTransactionLimits(t *testing.T) {
+	limits, _ := newLimitTestService(t, time.Now())
+	max, soapMax := decimal.RequireFromString("100"), decimal.RequireFromString("20")
+	settings := model.MerchantSettings{Limits: []model.AmountLimit{
+		{Currency: "USD", Max: &max},
+		{Currency: "USD", GatewayId: "soap", Max: &soapMax},
+	}}
+
+	assert.NoError(t, limits.Check(settings, limitTestTxn("ref-1", "ACC123", "rest", model.Deposit, "100")))
+	assert.Equal(t, model.CodeAmountOutOfLimits, limitCode(t, limits.Check(settings, limitTestTxn("ref-1", "ACC123", "rest", model.Deposit, "100.01"))))
+	assert.Equal(t, model.CodeAmountOutOfLimits, limitCode(t, limits.Check(settings, limitTestTxn("ref-1", "ACC123", "soap", model.Deposit, "21"))),
+		"gateway limits only apply to their gateway")
+
+	converted := limitTestTxn("ref-2", "ACC123", "rest", model.Deposit, "95")
+	converted.Currency = "EUR"
+	converted.Conversion = model.FxConversion{Currency: "USD", Amount: decimal.RequireFromString("103.62")}
+	assert.Equal(t, model.CodeAmountOutOfLimits, limitCode(t, limits.Check(settings, converted)),
+		"limits apply to the amount booked to the account")
+}
+
+func TestLimitService_AccountVelocity(t *testing.T) {
+	now := time.Date(2024, 10, 14, 12, 0, 0, 0, time.UTC)
+	limits, rep := newLimitTestService(t, now)
+	maxAmount, maxCount := decimal.RequireFromString("100"), 3
+	settings := model.MerchantSettings{VelocityLimits: []model.VelocityLimit{
+		{Scope: model.ScopeAccount, Period: model.PeriodDaily, Operation: model.Withdraw, Currency: "USD", MaxAmount: &maxAmount},
+		{Scope: model.ScopeAccount, Period: model.PeriodMonthly, Currency: "USD", MaxCount: &maxCount},
+	}}
+
+	// yesterday's withdrawal counts for the month only
+	rep.now = func() time.Time { return now.AddDate(0, 0, -1) }
+	yesterday := limitTestTxn("ref-0", "ACC123", "rest", model.Withdraw, "90")
+	require.NoError(t, rep.SaveTransaction(&yesterday))
+	rep.now = func() time.Time { return now }
+
+	first := limitTestTxn("ref-1", "ACC123", "rest", model.Withdraw, "60")
+	require.NoError(t, limits.Check(settings, first))
+	require.NoError(t, rep.SaveTransaction(&first))
+
+	overDaily := limits.Check(settings, limitTestTxn("ref-2", "ACC123", "rest", model.Withdraw, "40.01"))
+	assert.Equal(t, model.CodeVelocityExceeded, limitCode(t, overDaily))
+	assert.EqualError(t, overDaily, "daily withdrawal total of account ACC123 would reach 100.01 USD, above the limit of 100")
+	assert.NoError(t, limits.Check(settings, limitTestTxn("ref-2", "ACC999", "rest", model.Withdraw, "100")), "accounts have their own totals")
+
+	failed := limitTestTxn("ref-2", "ACC123", "rest", model.Deposit, "10")
+	failed.Status = model.StatusFailed
+	require.NoError(t, rep.SaveTransaction(&failed))
+	assert.NoError(t, limits.Check(settings, limitTestTxn("ref-3", "ACC123", "rest", model.Deposit, "500")), "failed transactions do not count")
+
+	third := limitTestTxn("ref-3", "ACC123", "rest", model.Deposit, "5")
+	require.NoError(t, rep.SaveTransaction(&third))
+	overMonthly := limits.Check(settings, limitTestTxn("ref-4", "ACC123", "rest", model.Deposit, "5"))
+	assert.Equal(t, model.CodeVelocityExceeded, limitCode(t, overMonthly))
+	assert.EqualError(t, overMonthly, "account ACC123 reached its monthly limit of 3 transactions")
+
+	limits.now = func() time.Time { return time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC) }
+	assert.NoError(t, limits.Check(settings, limitTestTxn("ref-4", "ACC123", "rest", model.Deposit, "5")), "a new month starts from zero")
+}
+
+func TestLimitService_GatewayVelocity(t *testing.T) {
+	limits, rep := newLimitTestService(t, time.Now())
+	maxAmount, soapCount := decimal.RequireFromString("150"), 1
+	settings := model.MerchantSettings{VelocityLimits: []model.VelocityLimit{
+		{Scope: model.ScopeGateway, Period: model.PeriodDaily, Currency: "USD", MaxAmount: &maxAmount},
+		{Scope: model.ScopeGateway, Period: model.PeriodDaily, Currency: "USD", GatewayId: "soap", MaxCount: &soapCount},
+	}}
+
+	for i, accountId := range []string{"ACC1", "ACC2"} {
+		txn := limitTestTxn("rest-"+accountId, accountId, "rest", model.Deposit, "70")
+		require.NoError(t, limits.Check(settings, txn), "deposit %d", i)
+		require.NoError(t, rep.SaveTransaction(&txn))
+	}
+	overRest := limits.Check(settings, limitTestTxn("rest-ACC3", "ACC3", "rest", model.Deposit, "20"))
+	assert.Equal(t, model.CodeVelocityExceeded, limitCode(t, overRest))
+	assert.Contains(t, overRest.Error(), "gateway rest")
+
+	soap := limitTestTxn("soap-1", "ACC3", "soap", model.Deposit, "20")
+	require.NoError(t, limits.Check(settings, soap), "every gateway has its own total")
+	require.NoError(t, rep.SaveTransaction(&soap))
+	assert.Equal(t, model.CodeVelocityExceeded, limitCode(t, limits.Check(settings, limitTestTxn("soap-2", "ACC4", "soap", model.Withdraw, "1"))))
+}
+
+type limitTestRepository interface {
+	TransactionRepository
+	MerchantRepository
+}
+
+func runConcurrentVelocityTest(t *testing.T, rep limitTestRepository) {
+	require.NoError(t, rep.CreateMerchant(&model.Merchant{Id: merchantId, Name: merchantId}))
+	limits := NewLimitService(rep)
+	maxCount := 5
+	settings := model.MerchantSettings{VelocityLimits: []model.VelocityLimit{
+		{Scope: model.ScopeAccount, Period: model.PeriodDaily, Currency: "USD", MaxCount: &maxCount},
+	}}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	saved := 0
+	for i := 0; i < 25; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			txn := limitTestTxn(fmt.Sprintf("ref-%d", i), "ACC123", "rest", model.Deposit, "10")
+			if checkErr := limits.Check(settings, txn); checkErr != nil {
+				assert.ErrorIs(t, checkErr, model.ErrUnprocessable)
+				return
+			}
+			saveErr := limits.Save(settings, &txn)
+			if saveErr == nil {
+				mu.Lock()
+				saved++
+				mu.Unlock()
+				return
+			}
+			assert.ErrorIs(t, saveErr, model.ErrUnprocessable)
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, maxCount, saved)
+	usage, usageErr := rep.GetUsage(merchantId, model.UsageQuery{AccountId: "ACC123", Currency: "USD", Since: time.Now().AddDate(0, 0, -1)})
+	require.NoError(t, usageErr)
+	assert.Equal(t, maxCount, usage.Count)
+}
+
+func TestMemoryLimitService_ConcurrentVelocity(t *testing.T) {
+	runConcurrentVelocityTest(t, NewMemoryRepositoryService())
+}
+
+func TestPostgresLimitService_ConcurrentVelocity(t *testing.T) {
+	runConcurrentVelocityTest(t, NewRepositoryService(migratedPostgresTestDB(t)))
+}
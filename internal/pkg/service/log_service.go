@@ -15,3 +15,11 @@ func NewLogService(logger *zap.Logger) *LogService {
 func (logger LogService) LogError(description string, err error) {
 	logger.logger.Error(description, zap.String("error", err.Error()))
 }
+
+func (logger LogService) LogInfo(description string, keysAndValues ...string) {
+	fields := make([]zap.Field, 0, len(keysAndValues)/2)
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		fields = append(fields, zap.String(keysAndValues[i], keysAndValues[i+1]))
+	}
+	logger.logger.Info(description, fields...)
+}
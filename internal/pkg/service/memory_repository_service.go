@@ -0,0 +1,239 @@
+package service
+
+import (
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/shopspring/decimal"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryRepositoryService keeps transactions in process memory. It mirrors the
+// Postgres upserts of RepositoryService and is meant for tests and local runs.
+type MemoryRepositoryService struct {
+	mu sync.RWMutex
+	// usageMu serializes LockUsage, see UsageLocker
+	usageMu         sync.Mutex
+	transactions    map[string]Transaction
+	merchants       map[string]Merchant
+	apiKeys         []APIKey
+	accountOwners   map[string]string
+	webhooks        map[string]WebhookDelivery
+	deadLetters     map[string]WebhookDelivery
+	journal         map[memoryJournalKey]JournalEntry
+	ledgerAccounts  map[memoryLedgerKey]*memoryLedgerAccount
+	postings        []memoryPosting
+	postingSequence int64
+	holds           map[string]FundsHold
+	history         []HistoryEvent
+	reviewDecisions []ReviewDecision
+	quotes          map[string]FxQuote
+	// authorizationClaims holds the claimed authorizations until their claim lapses
+	authorizationClaims map[string]time.Time
+	updates             *TransactionBroker
+	now                 func() time.Time
+}
+
+func NewMemoryRepositoryService() *MemoryRepositoryService {
+	return &MemoryRepositoryService{
+		transactions:        make(map[string]Transaction),
+		merchants:           make(map[string]Merchant),
+		accountOwners:       make(map[string]string),
+		webhooks:            make(map[string]WebhookDelivery),
+		deadLetters:         make(map[string]WebhookDelivery),
+		journal:             make(map[memoryJournalKey]JournalEntry),
+		ledgerAccounts:      make(map[memoryLedgerKey]*memoryLedgerAccount),
+		holds:               make(map[string]FundsHold),
+		quotes:              make(map[string]FxQuote),
+		authorizationClaims: make(map[string]time.Time),
+		now:                 time.Now,
+	}
+}
+
+func (rep *MemoryRepositoryService) SaveTransaction(txn *Transaction) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	stored, exists := rep.transactions[txn.ReferenceId]
+	previous := stored.Status
+	if !exists {
+		stored = Transaction{
+			ReferenceId: txn.ReferenceId,
+			MerchantId:  txn.MerchantId,
+			GatewayId:   txn.GatewayId,
+			Ts:          rep.now(),
+		}
+	}
+	stored.AccountId = txn.AccountId
+	stored.Amount = txn.Amount
+	stored.Fee = txn.Fee
+	stored.Currency = txn.Currency
+	stored.Status = txn.Status
+	stored.Operation = txn.Operation
+	stored.BeneficiaryName = txn.BeneficiaryName
+	stored.Conversion = txn.Conversion
+	stored.Authorization.ExpiresAt = txn.Authorization.ExpiresAt
+	stored.Risk = txn.Risk
+	rep.transactions[txn.ReferenceId] = stored
+	txn.Ts = stored.Ts
+	if !exists {
+		rep.recordHistory(stored, HistoryCreated, "", strings.Join(stored.Risk.Reasons, "; "))
+	} else if previous != stored.Status {
+		rep.recordHistory(stored, HistoryStatusChanged, "", stored.Message)
+	}
+	return nil
+}
+
+// recordHistory appends to the event history of txn like the Postgres
+// trigger of migration 0012 does; rep.mu must be held.
+func (rep *MemoryRepositoryService) recordHistory(txn Transaction, kind HistoryEventKind, actor, detail string) {
+	if txn.MerchantId == "" {
+		return
+	}
+	rep.history = append(rep.history, HistoryEvent{
+		Sequence:    int64(len(rep.history) + 1),
+		MerchantId:  txn.MerchantId,
+		ReferenceId: txn.ReferenceId,
+		Kind:        kind,
+		Status:      txn.Status,
+		Actor:       actor,
+		Detail:      detail,
+		CreatedAt:   rep.now(),
+	})
+}
+
+func (rep *MemoryRepositoryService) GetTransactionHistory(merchantId, referenceId string) ([]HistoryEvent, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	var events []HistoryEvent
+	for _, event := range rep.history {
+		if event.MerchantId == merchantId && event.ReferenceId == referenceId {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// PublishUpdates makes the repository publish status changes to broker, as
+// the Postgres trigger and TransactionListener do for RepositoryService.
+func (rep *MemoryRepositoryService) PublishUpdates(broker *TransactionBroker) {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	rep.updates = broker
+}
+
+func (rep *MemoryRepositoryService) UpdateTransaction(txn *Transaction) error {
+	rep.mu.Lock()
+
+	stored, exists := rep.transactions[txn.ReferenceId]
+	if !exists {
+		rep.mu.Unlock()
+		return NewError(ErrNotFound, CodeTransactionNotFound, "transaction %s not found", txn.ReferenceId)
+	}
+	if !txn.Status.Follows(stored.Status) {
+		rep.mu.Unlock()
+		return NewError(ErrConflict, CodeTransactionFinal, "transaction %s is already %s", txn.ReferenceId, stored.Status)
+	}
+	changed := stored.Status != txn.Status
+	stored.Id = txn.Id
+	stored.Status = txn.Status
+	stored.Message = txn.Message
+	if txn.Authorization.Captured.IsPositive() {
+		stored.Authorization.Captured = txn.Authorization.Captured
+		stored.Fee = txn.Fee
+	}
+	rep.transactions[txn.ReferenceId] = stored
+	*txn = stored
+	if changed {
+		rep.recordHistory(stored, HistoryStatusChanged, "", stored.Message)
+	}
+	updates := rep.updates
+	rep.mu.Unlock()
+
+	if changed && updates != nil && stored.MerchantId != "" {
+		updates.Publish(stored)
+	}
+	return nil
+}
+
+func (rep *MemoryRepositoryService) GetTransaction(merchantId, referenceId string) (Transaction, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	txn, exists := rep.transactions[referenceId]
+	if !exists || txn.MerchantId != merchantId {
+		return Transaction{}, NewError(ErrNotFound, CodeTransactionNotFound, "transaction %s not found", referenceId)
+	}
+	return txn, nil
+}
+
+func (rep *MemoryRepositoryService) GetTransactions(merchantId, accountId string, filter TransactionFilter, page PageRequest) (TransactionPage, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	var transactions []Transaction
+	for _, txn := range rep.transactions {
+		if txn.MerchantId != merchantId || txn.AccountId != accountId || !filter.Matches(txn) {
+			continue
+		}
+		if page.After != nil && !page.After.Precedes(txn) {
+			continue
+		}
+		transactions = append(transactions, txn)
+	}
+	sortTransactions(transactions)
+	return newTransactionPage(transactions, page.Size()), nil
+}
+
+// newTransactionPage trims a listing fetched with one extra row to size and
+// derives the next cursor from the last returned transaction.
+func newTransactionPage(transactions []Transaction, size int) TransactionPage {
+	if len(transactions) <= size {
+		return TransactionPage{Transactions: transactions}
+	}
+	transactions = transactions[:size]
+	last := transactions[size-1]
+	return TransactionPage{
+		Transactions: transactions,
+		Next:         &TransactionCursor{Ts: last.Ts, ReferenceId: last.ReferenceId},
+	}
+}
+
+func (rep *MemoryRepositoryService) GetUsage(merchantId string, query UsageQuery) (Usage, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	filter := TransactionFilter{GatewayId: query.GatewayId, Operation: query.Operation, From: &query.Since}
+	usage := Usage{Amount: decimal.Zero}
+	for _, txn := range rep.transactions {
+		amount, currency := txn.AccountAmount()
+		if txn.MerchantId != merchantId || ((txn.Status == StatusFailed || txn.Status == StatusVoided) && !query.IncludeFailed) ||
+			(query.AccountId != "" && txn.AccountId != query.AccountId) || (query.Currency != "" && currency != query.Currency) ||
+			!filter.Matches(txn) {
+			continue
+		}
+		usage.Count++
+		usage.Amount = usage.Amount.Add(amount)
+	}
+	return usage, nil
+}
+
+// LockUsage runs fn holding every usage key at once; within one process a
+// single lock serializes them all.
+func (rep *MemoryRepositoryService) LockUsage(keys []string, fn func(store UsageStore) error) error {
+	rep.usageMu.Lock()
+	defer rep.usageMu.Unlock()
+	return fn(rep)
+}
+
+// sortTransactions orders newest first, breaking ties by reference id like the SQL queries do.
+func sortTransactions(transactions []Transaction) {
+	sort.Slice(transactions, func(i, j int) bool {
+		if !transactions[i].Ts.Equal(transactions[j].Ts) {
+			return transactions[i].Ts.After(transactions[j].Ts)
+		}
+		return transactions[i].ReferenceId > transactions[j].ReferenceId
+	})
+}
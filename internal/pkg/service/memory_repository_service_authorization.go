@@ -0,0 +1,61 @@
+package service
+
+import (
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"sort"
+	"time"
+)
+
+func (rep *MemoryRepositoryService) ClaimAuthorization(merchantId, referenceId string, now, until time.Time) (Transaction, error) {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	txn, exists := rep.transactions[referenceId]
+	if !exists || txn.MerchantId != merchantId {
+		return Transaction{}, NewError(ErrNotFound, CodeTransactionNotFound, "transaction %s not found", referenceId)
+	}
+	if txn.Status != StatusAuthorized || rep.claimed(referenceId, now) {
+		return Transaction{}, unclaimable(txn)
+	}
+	rep.authorizationClaims[referenceId] = until
+	return txn, nil
+}
+
+func (rep *MemoryRepositoryService) ReleaseAuthorization(referenceId string) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	delete(rep.authorizationClaims, referenceId)
+	return nil
+}
+
+// claimed reports whether referenceId is claimed past now, callers hold rep.mu.
+func (rep *MemoryRepositoryService) claimed(referenceId string, now time.Time) bool {
+	until, exists := rep.authorizationClaims[referenceId]
+	return exists && until.After(now)
+}
+
+func (rep *MemoryRepositoryService) ClaimExpiredAuthorizations(now, until time.Time, limit int) ([]Transaction, error) {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	var expired []Transaction
+	for _, txn := range rep.transactions {
+		if txn.Status == StatusAuthorized && txn.Authorization.Expired(now) && !rep.claimed(txn.ReferenceId, now) {
+			expired = append(expired, txn)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool {
+		if !expired[i].Authorization.ExpiresAt.Equal(*expired[j].Authorization.ExpiresAt) {
+			return expired[i].Authorization.ExpiresAt.Before(*expired[j].Authorization.ExpiresAt)
+		}
+		return expired[i].ReferenceId < expired[j].ReferenceId
+	})
+	if len(expired) > limit {
+		expired = expired[:limit]
+	}
+	for _, txn := range expired {
+		rep.authorizationClaims[txn.ReferenceId] = until
+	}
+	return expired, nil
+}
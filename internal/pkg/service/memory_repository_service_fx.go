@@ -0,0 +1,53 @@
+package service
+
+import . "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+
+func (rep *MemoryRepositoryService) SaveQuote(quote *FxQuote) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	if _, exists := rep.merchants[quote.MerchantId]; !exists {
+		return NewError(ErrNotFound, CodeMerchantNotFound, "merchant %s not found", quote.MerchantId)
+	}
+	rep.quotes[quote.Id] = *quote
+	return nil
+}
+
+func (rep *MemoryRepositoryService) UseQuote(merchantId, quoteId, referenceId string) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	quote, exists := rep.quotes[quoteId]
+	if !exists || quote.MerchantId != merchantId {
+		return NewError(ErrNotFound, CodeQuoteNotFound, "fx quote %s not found", quoteId)
+	}
+	if quote.UsedBy != "" && quote.UsedBy != referenceId {
+		return NewError(ErrConflict, CodeQuoteUsed, "fx quote %s is already used by another transaction", quoteId)
+	}
+	quote.UsedBy = referenceId
+	rep.quotes[quoteId] = quote
+	return nil
+}
+
+func (rep *MemoryRepositoryService) ReleaseQuote(merchantId, quoteId, referenceId string) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	quote, exists := rep.quotes[quoteId]
+	if exists && quote.MerchantId == merchantId && quote.UsedBy == referenceId {
+		quote.UsedBy = ""
+		rep.quotes[quoteId] = quote
+	}
+	return nil
+}
+
+func (rep *MemoryRepositoryService) GetQuote(merchantId, quoteId string) (FxQuote, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	quote, exists := rep.quotes[quoteId]
+	if !exists || quote.MerchantId != merchantId {
+		return FxQuote{}, NewError(ErrNotFound, CodeQuoteNotFound, "fx quote %s not found", quoteId)
+	}
+	return quote, nil
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"fmt"
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/shopspring/decimal"
+	"sort"
+	"time"
+)
+
+type memoryLedgerKey struct {
+	merchantId string
+	account    LedgerAccountKey
+	currency   string
+}
+
+type memoryLedgerAccount struct {
+	balance   decimal.Decimal
+	held      decimal.Decimal
+	updatedAt time.Time
+}
+
+// ledgerAccount returns the account of key, creating it on first use. The
+// caller holds rep.mu for writing.
+func (rep *MemoryRepositoryService) ledgerAccount(key memoryLedgerKey) *memoryLedgerAccount {
+	account, exists := rep.ledgerAccounts[key]
+	if !exists {
+		account = &memoryLedgerAccount{}
+		rep.ledgerAccounts[key] = account
+	}
+	return account
+}
+
+type memoryJournalKey struct {
+	referenceId string
+	kind        EntryKind
+}
+
+func (rep *MemoryRepositoryService) PostEntry(entry *JournalEntry) error {
+	if !entry.Balanced() {
+		return fmt.Errorf("%s entry of %s is not balanced", entry.Kind, entry.ReferenceId)
+	}
+
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	if _, exists := rep.merchants[entry.MerchantId]; !exists {
+		return NewError(ErrNotFound, CodeMerchantNotFound, "merchant %s not found", entry.MerchantId)
+	}
+	journalKey := memoryJournalKey{referenceId: entry.ReferenceId, kind: entry.Kind}
+	if _, booked := rep.journal[journalKey]; booked {
+		return nil
+	}
+
+	entry.CreatedAt = rep.now()
+	for i := range entry.Postings {
+		posting := &entry.Postings[i]
+		key := memoryLedgerKey{merchantId: entry.MerchantId, account: posting.Account, currency: entry.Currency}
+		account := rep.ledgerAccount(key)
+		account.balance = account.balance.Add(posting.Account.BalanceDelta(posting.Direction, posting.Amount))
+		account.updatedAt = entry.CreatedAt
+		posting.BalanceAfter = account.balance
+
+		rep.postingSequence++
+		rep.postings = append(rep.postings, memoryPosting{
+			StatementLine: StatementLine{
+				Sequence:     rep.postingSequence,
+				EntryId:      entry.Id,
+				ReferenceId:  entry.ReferenceId,
+				Kind:         entry.Kind,
+				Currency:     entry.Currency,
+				Amount:       posting.Account.BalanceDelta(posting.Direction, posting.Amount),
+				BalanceAfter: posting.BalanceAfter,
+				CreatedAt:    entry.CreatedAt,
+			},
+			key: key,
+		})
+	}
+	rep.journal[journalKey] = *entry
+	rep.settleHold(entry.MerchantId, entry.ReferenceId, HoldCaptured)
+	return nil
+}
+
+func (rep *MemoryRepositoryService) PlaceHold(hold *FundsHold) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	if _, exists := rep.merchants[hold.MerchantId]; !exists {
+		return NewError(ErrNotFound, CodeMerchantNotFound, "merchant %s not found", hold.MerchantId)
+	}
+	if _, exists := rep.holds[hold.ReferenceId]; exists {
+		return nil
+	}
+
+	key := memoryLedgerKey{
+		merchantId: hold.MerchantId,
+		account:    LedgerAccountKey{Type: LedgerCustomer, Owner: hold.AccountId},
+		currency:   hold.Currency,
+	}
+	available := decimal.Zero
+	if account, exists := rep.ledgerAccounts[key]; exists {
+		available = account.balance.Sub(account.held)
+	}
+	if available.LessThan(hold.Amount) {
+		return NewError(ErrUnprocessable, CodeInsufficientFunds, "insufficient funds: %s %s available", available, hold.Currency)
+	}
+	account := rep.ledgerAccount(key)
+	account.held = account.held.Add(hold.Amount)
+	account.updatedAt = rep.now()
+	hold.Status = HoldActive
+	hold.CreatedAt = account.updatedAt
+	rep.holds[hold.ReferenceId] = *hold
+	return nil
+}
+
+func (rep *MemoryRepositoryService) ReleaseHold(merchantId, referenceId string) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	rep.settleHold(merchantId, referenceId, HoldReleased)
+	return nil
+}
+
+// settleHold moves the active hold of referenceId to status, returning its
+// amount to the available balance. The caller holds rep.mu for writing.
+func (rep *MemoryRepositoryService) settleHold(merchantId, referenceId string, status HoldStatus) {
+	hold, exists := rep.holds[referenceId]
+	if !exists || hold.MerchantId != merchantId || hold.Status != HoldActive {
+		return
+	}
+	key := memoryLedgerKey{
+		merchantId: merchantId,
+		account:    LedgerAccountKey{Type: LedgerCustomer, Owner: hold.AccountId},
+		currency:   hold.Currency,
+	}
+	account := rep.ledgerAccount(key)
+	account.held = account.held.Sub(hold.Amount)
+	account.updatedAt = rep.now()
+	hold.Status = status
+	rep.holds[referenceId] = hold
+}
+
+// memoryPosting keeps a posting as the statement line of its account; the
+// signed amount is only meaningful for customer accounts, which are the only
+// ones with statements.
+type memoryPosting struct {
+	StatementLine
+	key memoryLedgerKey
+}
+
+func (rep *MemoryRepositoryService) GetBalances(merchantId, accountId string) ([]Balance, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	var balances []Balance
+	for key, account := range rep.ledgerAccounts {
+		if key.merchantId == merchantId && key.account == (LedgerAccountKey{Type: LedgerCustomer, Owner: accountId}) {
+			balances = append(balances, Balance{Currency: key.currency, Balance: account.balance, Held: account.held, UpdatedAt: account.updatedAt})
+		}
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		return balances[i].Currency < balances[j].Currency
+	})
+	return balances, nil
+}
+
+func (rep *MemoryRepositoryService) GetStatement(merchantId, accountId string, req StatementRequest) (StatementPage, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	size := PageRequest{Limit: req.Limit}.Size()
+	var page StatementPage
+	for i := len(rep.postings) - 1; i >= 0; i-- {
+		posting := rep.postings[i]
+		if posting.key.merchantId != merchantId || posting.key.account != (LedgerAccountKey{Type: LedgerCustomer, Owner: accountId}) ||
+			(req.Currency != "" && posting.Currency != req.Currency) ||
+			(req.From != nil && posting.CreatedAt.Before(*req.From)) ||
+			(req.To != nil && !posting.CreatedAt.Before(*req.To)) ||
+			(req.Before > 0 && posting.Sequence >= req.Before) {
+			continue
+		}
+		if len(page.Lines) == size {
+			page.Next = page.Lines[size-1].Sequence
+			break
+		}
+		page.Lines = append(page.Lines, posting.StatementLine)
+	}
+	return page, nil
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"fmt"
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+)
+
+func (rep *MemoryRepositoryService) CreateMerchant(merchant *Merchant) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	if _, exists := rep.merchants[merchant.Id]; exists {
+		return fmt.Errorf("merchant %s already exists", merchant.Id)
+	}
+	merchant.CreatedAt = rep.now()
+	rep.merchants[merchant.Id] = *merchant
+	return nil
+}
+
+func (rep *MemoryRepositoryService) GetMerchant(merchantId string) (Merchant, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	merchant, exists := rep.merchants[merchantId]
+	if !exists {
+		return Merchant{}, NewError(ErrNotFound, CodeMerchantNotFound, "merchant %s not found", merchantId)
+	}
+	return merchant, nil
+}
+
+func (rep *MemoryRepositoryService) SaveMerchantSettings(merchantId string, settings MerchantSettings) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	merchant, exists := rep.merchants[merchantId]
+	if !exists {
+		return NewError(ErrNotFound, CodeMerchantNotFound, "merchant %s not found", merchantId)
+	}
+	merchant.Settings = settings
+	rep.merchants[merchantId] = merchant
+	return nil
+}
+
+func (rep *MemoryRepositoryService) SetWebhookSecret(merchantId, secret string) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	merchant, exists := rep.merchants[merchantId]
+	if !exists {
+		return NewError(ErrNotFound, CodeMerchantNotFound, "merchant %s not found", merchantId)
+	}
+	merchant.WebhookSecret = secret
+	rep.merchants[merchantId] = merchant
+	return nil
+}
+
+func (rep *MemoryRepositoryService) CreateAPIKey(key *APIKey) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	if _, exists := rep.merchants[key.MerchantId]; !exists {
+		return NewError(ErrNotFound, CodeMerchantNotFound, "merchant %s not found", key.MerchantId)
+	}
+	for _, existing := range rep.apiKeys {
+		if existing.Id == key.Id || existing.Prefix == key.Prefix {
+			return fmt.Errorf("api key %s already exists", key.Prefix)
+		}
+	}
+	key.CreatedAt = rep.now()
+	rep.apiKeys = append(rep.apiKeys, *key)
+	return nil
+}
+
+func (rep *MemoryRepositoryService) GetAPIKeyByPrefix(prefix string) (APIKey, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	for _, key := range rep.apiKeys {
+		if key.Prefix == prefix {
+			return key, nil
+		}
+	}
+	return APIKey{}, NewError(ErrNotFound, CodeAPIKeyNotFound, "api key %s not found", prefix)
+}
+
+func (rep *MemoryRepositoryService) RevokeAPIKey(keyId string) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	for i, key := range rep.apiKeys {
+		if key.Id == keyId {
+			if key.RevokedAt == nil {
+				revokedAt := rep.now()
+				rep.apiKeys[i].RevokedAt = &revokedAt
+			}
+			return nil
+		}
+	}
+	return NewError(ErrNotFound, CodeAPIKeyNotFound, "api key %s not found", keyId)
+}
+
+func (rep *MemoryRepositoryService) ClaimAccount(merchantId, accountId string) (string, error) {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	if owner, exists := rep.accountOwners[accountId]; exists {
+		return owner, nil
+	}
+	if _, exists := rep.merchants[merchantId]; !exists {
+		return "", NewError(ErrNotFound, CodeMerchantNotFound, "merchant %s not found", merchantId)
+	}
+	rep.accountOwners[accountId] = merchantId
+	return merchantId, nil
+}
+
+func (rep *MemoryRepositoryService) GetAccountOwner(accountId string) (string, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	owner, exists := rep.accountOwners[accountId]
+	if !exists {
+		return "", NewError(ErrNotFound, CodeAccountNotOwned, "account %s has no owner", accountId)
+	}
+	return owner, nil
+}
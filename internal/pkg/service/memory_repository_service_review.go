@@ -0,0 +1,76 @@
+package service
+
+import (
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"sort"
+)
+
+func (rep *MemoryRepositoryService) GetReviewQueue(merchantId string, limit int) ([]Transaction, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	var queue []Transaction
+	for _, txn := range rep.transactions {
+		if txn.Status == StatusReview && (merchantId == "" || txn.MerchantId == merchantId) {
+			queue = append(queue, txn)
+		}
+	}
+	sort.Slice(queue, func(i, j int) bool {
+		if !queue[i].Ts.Equal(queue[j].Ts) {
+			return queue[i].Ts.Before(queue[j].Ts)
+		}
+		return queue[i].ReferenceId < queue[j].ReferenceId
+	})
+	if len(queue) > limit {
+		queue = queue[:limit]
+	}
+	return queue, nil
+}
+
+func (rep *MemoryRepositoryService) DecideReview(decision *ReviewDecision) (Transaction, error) {
+	rep.mu.Lock()
+
+	stored, exists := rep.transactions[decision.ReferenceId]
+	if !exists {
+		rep.mu.Unlock()
+		return Transaction{}, NewError(ErrNotFound, CodeTransactionNotFound, "transaction %s not found", decision.ReferenceId)
+	}
+	if stored.Status != StatusReview {
+		rep.mu.Unlock()
+		return Transaction{}, NewError(ErrConflict, CodeNotInReview, "transaction %s is %s, not awaiting review", decision.ReferenceId, stored.Status)
+	}
+
+	decision.MerchantId = stored.MerchantId
+	decision.DecidedAt = rep.now()
+	rep.reviewDecisions = append(rep.reviewDecisions, *decision)
+	kind := HistoryReviewApproved
+	stored.Status = StatusPending
+	if decision.Outcome == ReviewRejected {
+		kind = HistoryReviewRejected
+		stored.Status = StatusFailed
+		stored.Message = decision.Reason
+	}
+	rep.transactions[stored.ReferenceId] = stored
+	rep.recordHistory(stored, kind, decision.Reviewer, decision.Reason)
+	rep.recordHistory(stored, HistoryStatusChanged, "", stored.Message)
+	updates := rep.updates
+	rep.mu.Unlock()
+
+	if updates != nil && stored.MerchantId != "" {
+		updates.Publish(stored)
+	}
+	return stored, nil
+}
+
+func (rep *MemoryRepositoryService) GetReviewDecisions(referenceId string, limit int) ([]ReviewDecision, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	var decisions []ReviewDecision
+	for i := len(rep.reviewDecisions) - 1; i >= 0 && len(decisions) < limit; i-- {
+		if referenceId == "" || rep.reviewDecisions[i].ReferenceId == referenceId {
+			decisions = append(decisions, rep.reviewDecisions[i])
+		}
+	}
+	return decisions, nil
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"sort"
+	"time"
+)
+
+func (rep *MemoryRepositoryService) EnqueueWebhook(delivery *WebhookDelivery) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	for _, existing := range []map[string]WebhookDelivery{rep.webhooks, rep.deadLetters} {
+		for _, stored := range existing {
+			if stored.ReferenceId == delivery.ReferenceId && stored.EventType == delivery.EventType {
+				return nil
+			}
+		}
+	}
+	stored := *delivery
+	stored.CreatedAt = rep.now()
+	stored.NextAttemptAt = stored.CreatedAt
+	rep.webhooks[stored.Id] = stored
+	return nil
+}
+
+func (rep *MemoryRepositoryService) ClaimWebhooks(now, leaseUntil time.Time, limit int) ([]WebhookDelivery, error) {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	var due []WebhookDelivery
+	for _, delivery := range rep.webhooks {
+		if delivery.DeliveredAt == nil && !delivery.NextAttemptAt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	for i := range due {
+		due[i].NextAttemptAt = leaseUntil
+		rep.webhooks[due[i].Id] = due[i]
+	}
+	return due, nil
+}
+
+func (rep *MemoryRepositoryService) RecordWebhookAttempt(delivery WebhookDelivery) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	stored, exists := rep.webhooks[delivery.Id]
+	if !exists {
+		return nil
+	}
+	stored.Attempts = delivery.Attempts
+	stored.NextAttemptAt = delivery.NextAttemptAt
+	stored.LastError = delivery.LastError
+	stored.LastStatusCode = delivery.LastStatusCode
+	stored.DeliveredAt = delivery.DeliveredAt
+	rep.webhooks[delivery.Id] = stored
+	return nil
+}
+
+func (rep *MemoryRepositoryService) DeadLetterWebhook(delivery WebhookDelivery) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	stored, exists := rep.webhooks[delivery.Id]
+	if !exists {
+		return nil
+	}
+	failedAt := rep.now()
+	stored.Attempts = delivery.Attempts
+	stored.LastError = delivery.LastError
+	stored.LastStatusCode = delivery.LastStatusCode
+	stored.FailedAt = &failedAt
+	delete(rep.webhooks, delivery.Id)
+	rep.deadLetters[delivery.Id] = stored
+	return nil
+}
+
+func (rep *MemoryRepositoryService) GetDeadLetters(merchantId string) ([]WebhookDelivery, error) {
+	rep.mu.RLock()
+	defer rep.mu.RUnlock()
+
+	var deadLetters []WebhookDelivery
+	for _, delivery := range rep.deadLetters {
+		if delivery.MerchantId == merchantId {
+			deadLetters = append(deadLetters, delivery)
+		}
+	}
+	sort.Slice(deadLetters, func(i, j int) bool {
+		if !deadLetters[i].FailedAt.Equal(*deadLetters[j].FailedAt) {
+			return deadLetters[i].FailedAt.After(*deadLetters[j].FailedAt)
+		}
+		return deadLetters[i].Id > deadLetters[j].Id
+	})
+	if len(deadLetters) > MaxPageSize {
+		deadLetters = deadLetters[:MaxPageSize]
+	}
+	return deadLetters, nil
+}
+
+func (rep *MemoryRepositoryService) RedeliverWebhook(merchantId, deliveryId string) error {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	delivery, exists := rep.deadLetters[deliveryId]
+	if !exists || delivery.MerchantId != merchantId {
+		return NewError(ErrNotFound, CodeDeliveryNotFound, "dead letter %s not found", deliveryId)
+	}
+	delete(rep.deadLetters, deliveryId)
+	rep.webhooks[deliveryId] = WebhookDelivery{
+		Id:            delivery.Id,
+		MerchantId:    delivery.MerchantId,
+		ReferenceId:   delivery.ReferenceId,
+		EventType:     delivery.EventType,
+		Payload:       delivery.Payload,
+		NextAttemptAt: rep.now(),
+		CreatedAt:     delivery.CreatedAt,
+	}
+	return nil
+}
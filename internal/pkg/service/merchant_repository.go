@@ -0,0 +1,33 @@
+package service
+
+import . "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+
+// MerchantRepository stores merchants, their API keys and the accounts they
+// own. Like TransactionRepository it is implemented by RepositoryService and
+// MemoryRepositoryService with the same semantics.
+type MerchantRepository interface {
+	CreateMerchant(merchant *Merchant) error
+	// GetMerchant returns model.ErrNotFound for unknown ids and zero
+	// settings for merchants that were never configured.
+	GetMerchant(merchantId string) (Merchant, error)
+	// SaveMerchantSettings replaces the settings of a merchant and returns
+	// model.ErrNotFound for unknown merchants.
+	SaveMerchantSettings(merchantId string, settings MerchantSettings) error
+	// SetWebhookSecret returns model.ErrNotFound for unknown merchants.
+	SetWebhookSecret(merchantId, secret string) error
+	// CreateAPIKey returns model.ErrNotFound for unknown merchants.
+	CreateAPIKey(key *APIKey) error
+	// GetAPIKeyByPrefix returns revoked keys too, callers check RevokedAt.
+	GetAPIKeyByPrefix(prefix string) (APIKey, error)
+	RevokeAPIKey(keyId string) error
+	// ClaimAccount makes merchantId the owner of an unowned account and
+	// returns the owner, which differs from merchantId if it was owned already.
+	ClaimAccount(merchantId, accountId string) (string, error)
+	// GetAccountOwner returns model.ErrNotFound for accounts nobody owns yet.
+	GetAccountOwner(accountId string) (string, error)
+}
+
+var (
+	_ MerchantRepository = (*RepositoryService)(nil)
+	_ MerchantRepository = (*MemoryRepositoryService)(nil)
+)
@@ -0,0 +1,491 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	merchantId      = "merchant-1"
+	otherMerchantId = "merchant-2"
+)
+
+// runTransactionRepositoryContract checks the behaviour every TransactionRepository must share.
+func runTransactionRepositoryContract(t *testing.T, newEmptyRepository func(t *testing.T) TransactionRepository) {
+	// transactions reference their merchant, so every repository starts with two of them
+	newRepository := func(t *testing.T) TransactionRepository {
+		rep := newEmptyRepository(t)
+		for _, id := range []string{merchantId, otherMerchantId} {
+			require.NoError(t, rep.(MerchantRepository).CreateMerchant(&model.Merchant{Id: id, Name: id}))
+		}
+		return rep
+	}
+	newTxn := func(referenceId, accountId string) *model.Transaction {
+		return &model.Transaction{
+			ReferenceId: referenceId,
+			MerchantId:  merchantId,
+			AccountId:   accountId,
+			GatewayId:   "rest",
+			Amount:      decimal.RequireFromString("100.5"),
+			Currency:    "USD",
+			Status:      model.StatusPending,
+			Operation:   model.Deposit,
+		}
+	}
+
+	t.Run("amounts keep their minor units", func(t *testing.T) {
+		rep := newRepository(t)
+		dinars := newTxn("ref-1", "ACC123")
+		dinars.Amount = decimal.RequireFromString("1.125")
+		dinars.Currency = "KWD"
+		require.NoError(t, rep.SaveTransaction(dinars))
+		large := newTxn("ref-2", "ACC123")
+		large.Amount = decimal.RequireFromString("123456789.50")
+		require.NoError(t, rep.SaveTransaction(large))
+
+		stored, getErr := rep.GetTransaction(merchantId, "ref-1")
+		require.NoError(t, getErr)
+		assert.Equal(t, "1.125", stored.Amount.String())
+		require.NoError(t, rep.UpdateTransaction(&model.Transaction{ReferenceId: "ref-1", Status: model.StatusSuccess}))
+		stored, getErr = rep.GetTransaction(merchantId, "ref-1")
+		require.NoError(t, getErr)
+		assert.Equal(t, "1.125", stored.Amount.String(), "settling keeps the amount")
+		stored, getErr = rep.GetTransaction(merchantId, "ref-2")
+		require.NoError(t, getErr)
+		assert.True(t, large.Amount.Equal(stored.Amount), "amount %s", stored.Amount)
+	})
+
+	t.Run("save and get", func(t *testing.T) {
+		rep := newRepository(t)
+		saved := newTxn("ref-1", "ACC123")
+		require.NoError(t, rep.SaveTransaction(saved))
+
+		txn, getErr := rep.GetTransaction(merchantId, "ref-1")
+		require.NoError(t, getErr)
+		assert.Equal(t, merchantId, txn.MerchantId)
+		assert.Equal(t, "ACC123", txn.AccountId)
+		assert.Equal(t, "rest", txn.GatewayId)
+		assert.True(t, decimal.RequireFromString("100.5").Equal(txn.Amount))
+		assert.Equal(t, model.StatusPending, txn.Status)
+		assert.Equal(t, model.Deposit, txn.Operation)
+		assert.False(t, txn.Ts.IsZero())
+		assert.True(t, saved.Ts.Equal(txn.Ts), "SaveTransaction must report the stored creation time")
+	})
+
+	t.Run("save upserts but keeps gateway", func(t *testing.T) {
+		rep := newRepository(t)
+		require.NoError(t, rep.SaveTransaction(newTxn("ref-1", "ACC123")))
+
+		changed := newTxn("ref-1", "ACC123")
+		changed.Amount = decimal.RequireFromString("7")
+		changed.GatewayId = "soap"
+		require.NoError(t, rep.SaveTransaction(changed))
+
+		txn, getErr := rep.GetTransaction(merchantId, "ref-1")
+		require.NoError(t, getErr)
+		assert.True(t, decimal.RequireFromString("7").Equal(txn.Amount))
+		assert.Equal(t, "rest", txn.GatewayId)
+	})
+
+	t.Run("update changes provider id, status and message only", func(t *testing.T) {
+		rep := newRepository(t)
+		require.NoError(t, rep.SaveTransaction(newTxn("ref-1", "ACC123")))
+
+		update := &model.Transaction{
+			Id:          "provider-1",
+			ReferenceId: "ref-1",
+			Status:      model.StatusSuccess,
+			Message:     "done",
+		}
+		require.NoError(t, rep.UpdateTransaction(update))
+		assert.Equal(t, merchantId, update.MerchantId, "UpdateTransaction must report the stored transaction")
+		assert.Equal(t, "ACC123", update.AccountId)
+		assert.Equal(t, model.Deposit, update.Operation)
+		assert.True(t, decimal.RequireFromString("100.5").Equal(update.Amount))
+
+		txn, getErr := rep.GetTransaction(merchantId, "ref-1")
+		require.NoError(t, getErr)
+		assert.Equal(t, "provider-1", txn.Id)
+		assert.Equal(t, model.StatusSuccess, txn.Status)
+		assert.Equal(t, "done", txn.Message)
+		assert.Equal(t, "ACC123", txn.AccountId)
+		assert.True(t, decimal.RequireFromString("100.5").Equal(txn.Amount))
+	})
+
+	t.Run("get of unknown reference is not found", func(t *testing.T) {
+		rep := newRepository(t)
+
+		_, getErr := rep.GetTransaction(merchantId, "missing")
+		assert.ErrorIs(t, getErr, model.ErrNotFound)
+	})
+
+	t.Run("update of unknown reference is not found", func(t *testing.T) {
+		rep := newRepository(t)
+
+		updateErr := rep.UpdateTransaction(&model.Transaction{ReferenceId: "missing", Status: model.StatusSuccess})
+		assert.ErrorIs(t, updateErr, model.ErrNotFound)
+	})
+
+	t.Run("final status only accepts repeats", func(t *testing.T) {
+		rep := newRepository(t)
+		require.NoError(t, rep.SaveTransaction(newTxn("ref-1", "ACC123")))
+		require.NoError(t, rep.UpdateTransaction(&model.Transaction{ReferenceId: "ref-1", Status: model.StatusSuccess}))
+
+		assert.NoError(t, rep.UpdateTransaction(&model.Transaction{ReferenceId: "ref-1", Status: model.StatusSuccess}))
+		updateErr := rep.UpdateTransaction(&model.Transaction{ReferenceId: "ref-1", Status: model.StatusFailed})
+		assert.ErrorIs(t, updateErr, model.ErrConflict)
+	})
+
+	t.Run("list is scoped to the account and newest first", func(t *testing.T) {
+		rep := newRepository(t)
+		require.NoError(t, rep.SaveTransaction(newTxn("ref-1", "ACC123")))
+		require.NoError(t, rep.SaveTransaction(newTxn("ref-2", "ACC123")))
+		require.NoError(t, rep.SaveTransaction(newTxn("ref-3", "ACC999")))
+
+		page, listErr := rep.GetTransactions(merchantId, "ACC123", model.TransactionFilter{}, model.PageRequest{})
+		require.NoError(t, listErr)
+		require.Len(t, page.Transactions, 2)
+		assert.Equal(t, "ref-2", page.Transactions[0].ReferenceId)
+		assert.Equal(t, "ref-1", page.Transactions[1].ReferenceId)
+	})
+
+	t.Run("list applies filters", func(t *testing.T) {
+		rep := newRepository(t)
+		require.NoError(t, rep.SaveTransaction(newTxn("ref-1", "ACC123")))
+		withdrawal := newTxn("ref-2", "ACC123")
+		withdrawal.Operation = model.Withdraw
+		withdrawal.GatewayId = "soap"
+		require.NoError(t, rep.SaveTransaction(withdrawal))
+		require.NoError(t, rep.UpdateTransaction(&model.Transaction{ReferenceId: "ref-2", Status: model.StatusSuccess}))
+
+		page, listErr := rep.GetTransactions(merchantId, "ACC123", model.TransactionFilter{Operation: model.Withdraw}, model.PageRequest{})
+		require.NoError(t, listErr)
+		require.Len(t, page.Transactions, 1)
+		assert.Equal(t, "ref-2", page.Transactions[0].ReferenceId)
+
+		page, listErr = rep.GetTransactions(merchantId, "ACC123", model.TransactionFilter{Status: model.StatusPending, GatewayId: "rest"}, model.PageRequest{})
+		require.NoError(t, listErr)
+		require.Len(t, page.Transactions, 1)
+		assert.Equal(t, "ref-1", page.Transactions[0].ReferenceId)
+
+		page, listErr = rep.GetTransactions(merchantId, "ACC123", model.TransactionFilter{Status: model.StatusFailed}, model.PageRequest{})
+		require.NoError(t, listErr)
+		assert.Empty(t, page.Transactions)
+	})
+
+	t.Run("list filters by currency, amount and time", func(t *testing.T) {
+		rep := newRepository(t)
+		require.NoError(t, rep.SaveTransaction(newTxn("ref-1", "ACC123")))
+		large := newTxn("ref-2", "ACC123")
+		large.Amount = decimal.RequireFromString("2500")
+		large.Currency = "EUR"
+		require.NoError(t, rep.SaveTransaction(large))
+
+		page, listErr := rep.GetTransactions(merchantId, "ACC123", model.TransactionFilter{Currency: "EUR"}, model.PageRequest{})
+		require.NoError(t, listErr)
+		require.Len(t, page.Transactions, 1)
+		assert.Equal(t, "ref-2", page.Transactions[0].ReferenceId)
+
+		minAmount, maxAmount := decimal.RequireFromString("100.5"), decimal.RequireFromString("1000")
+		page, listErr = rep.GetTransactions(merchantId, "ACC123", model.TransactionFilter{MinAmount: &minAmount, MaxAmount: &maxAmount}, model.PageRequest{})
+		require.NoError(t, listErr)
+		require.Len(t, page.Transactions, 1)
+		assert.Equal(t, "ref-1", page.Transactions[0].ReferenceId)
+
+		// A day of slack keeps the bounds clear of any database time zone.
+		dayAgo := time.Now().Add(-24 * time.Hour)
+		page, listErr = rep.GetTransactions(merchantId, "ACC123", model.TransactionFilter{From: &dayAgo}, model.PageRequest{})
+		require.NoError(t, listErr)
+		assert.Len(t, page.Transactions, 2)
+
+		page, listErr = rep.GetTransactions(merchantId, "ACC123", model.TransactionFilter{To: &dayAgo}, model.PageRequest{})
+		require.NoError(t, listErr)
+		assert.Empty(t, page.Transactions)
+	})
+
+	t.Run("list pages with keyset cursors", func(t *testing.T) {
+		rep := newRepository(t)
+		for _, referenceId := range []string{"ref-1", "ref-2", "ref-3", "ref-4", "ref-5"} {
+			require.NoError(t, rep.SaveTransaction(newTxn(referenceId, "ACC123")))
+		}
+
+		var seen []string
+		request := model.PageRequest{Limit: 2}
+		for pages := 0; ; pages++ {
+			require.Less(t, pages, 3, "listing must end after three pages")
+			page, listErr := rep.GetTransactions(merchantId, "ACC123", model.TransactionFilter{}, request)
+			require.NoError(t, listErr)
+			require.LessOrEqual(t, len(page.Transactions), 2)
+			for _, txn := range page.Transactions {
+				seen = append(seen, txn.ReferenceId)
+			}
+			if page.Next == nil {
+				break
+			}
+			request.After = page.Next
+		}
+		assert.Equal(t, []string{"ref-5", "ref-4", "ref-3", "ref-2", "ref-1"}, seen)
+	})
+
+	t.Run("reads are scoped to the merchant", func(t *testing.T) {
+		rep := newRepository(t)
+		require.NoError(t, rep.SaveTransaction(newTxn("ref-1", "ACC123")))
+		foreign := newTxn("ref-2", "ACC123")
+		foreign.MerchantId = otherMerchantId
+		require.NoError(t, rep.SaveTransaction(foreign))
+
+		_, getErr := rep.GetTransaction(otherMerchantId, "ref-1")
+		assert.ErrorIs(t, getErr, model.ErrNotFound)
+
+		page, listErr := rep.GetTransactions(merchantId, "ACC123", model.TransactionFilter{}, model.PageRequest{})
+		require.NoError(t, listErr)
+		require.Len(t, page.Transactions, 1)
+		assert.Equal(t, "ref-1", page.Transactions[0].ReferenceId)
+
+		moved := newTxn("ref-1", "ACC123")
+		moved.MerchantId = otherMerchantId
+		require.NoError(t, rep.SaveTransaction(moved))
+		txn, getErr := rep.GetTransaction(merchantId, "ref-1")
+		require.NoError(t, getErr)
+		assert.Equal(t, merchantId, txn.MerchantId, "upserts must not move a transaction to another merchant")
+	})
+
+	t.Run("list of unknown account is empty", func(t *testing.T) {
+		rep := newRepository(t)
+
+		page, listErr := rep.GetTransactions(merchantId, "nobody", model.TransactionFilter{}, model.PageRequest{})
+		require.NoError(t, listErr)
+		assert.Empty(t, page.Transactions)
+	})
+
+	t.Run("usage counts transactions that have not failed", func(t *testing.T) {
+		rep := newRepository(t)
+		require.NoError(t, rep.SaveTransaction(newTxn("ref-1", "ACC123")))
+		settledTxn := newTxn("ref-2", "ACC123")
+		settledTxn.Status = model.StatusSuccess
+		require.NoError(t, rep.SaveTransaction(settledTxn))
+		failed := newTxn("ref-3", "ACC123")
+		failed.Status = model.StatusFailed
+		require.NoError(t, rep.SaveTransaction(failed))
+		withdrawal := newTxn("ref-4", "ACC123")
+		withdrawal.Operation = model.Withdraw
+		withdrawal.GatewayId = "soap"
+		require.NoError(t, rep.SaveTransaction(withdrawal))
+		require.NoError(t, rep.SaveTransaction(newTxn("ref-5", "ACC999")))
+		foreign := newTxn("ref-6", "ACC123")
+		foreign.MerchantId = otherMerchantId
+		require.NoError(t, rep.SaveTransaction(foreign))
+		converted := newTxn("ref-7", "ACC456")
+		converted.Currency = "EUR"
+		converted.GatewayId = "soap"
+		converted.Conversion = model.FxConversion{Rate: decimal.RequireFromString("1.0907"), Source: "ECB reference rates",
+			Currency: "USD", Amount: decimal.RequireFromString("109.07")}
+		require.NoError(t, rep.SaveTransaction(converted))
+
+		since := time.Now().Add(-time.Hour)
+		usage, usageErr := rep.GetUsage(merchantId, model.UsageQuery{AccountId: "ACC123", Currency: "USD", Since: since})
+		require.NoError(t, usageErr)
+		assert.Equal(t, 3, usage.Count)
+		assert.True(t, decimal.RequireFromString("301.5").Equal(usage.Amount), "usage %s", usage.Amount)
+
+		usage, usageErr = rep.GetUsage(merchantId, model.UsageQuery{AccountId: "ACC456", Currency: "USD", Since: since})
+		require.NoError(t, usageErr)
+		assert.Equal(t, 1, usage.Count, "converted transactions count in their account currency")
+		assert.True(t, decimal.RequireFromString("109.07").Equal(usage.Amount), "usage %s", usage.Amount)
+
+		usage, usageErr = rep.GetUsage(merchantId, model.UsageQuery{GatewayId: "rest", Operation: model.Deposit, Since: since})
+		require.NoError(t, usageErr)
+		assert.Equal(t, 3, usage.Count, "gateway usage spans accounts")
+
+		usage, usageErr = rep.GetUsage(merchantId, model.UsageQuery{AccountId: "ACC123", Since: since, IncludeFailed: true})
+		require.NoError(t, usageErr)
+		assert.Equal(t, 4, usage.Count, "attempts include failed transactions")
+
+		usage, usageErr = rep.GetUsage(merchantId, model.UsageQuery{Since: time.Now().Add(time.Hour)})
+		require.NoError(t, usageErr)
+		assert.Zero(t, usage.Count)
+		assert.True(t, usage.Amount.IsZero())
+	})
+
+	t.Run("risk assessment and review status are stored", func(t *testing.T) {
+		rep := newRepository(t)
+		txn := newTxn("ref-1", "ACC123")
+		txn.Status = model.StatusReview
+		txn.Risk = model.RiskAssessment{Decision: model.RiskReview, Reasons: []string{"account ACC123 made 11 attempts in 10 minutes"}}
+		require.NoError(t, rep.SaveTransaction(txn))
+		require.NoError(t, rep.SaveTransaction(newTxn("ref-2", "ACC123")))
+
+		stored, getErr := rep.GetTransaction(merchantId, "ref-1")
+		require.NoError(t, getErr)
+		assert.Equal(t, model.StatusReview, stored.Status)
+		assert.Equal(t, txn.Risk, stored.Risk)
+
+		unscreened, getErr := rep.GetTransaction(merchantId, "ref-2")
+		require.NoError(t, getErr)
+		assert.Equal(t, model.RiskAssessment{}, unscreened.Risk)
+
+		updateErr := rep.UpdateTransaction(&model.Transaction{ReferenceId: "ref-1", Status: model.StatusSuccess})
+		assert.ErrorIs(t, updateErr, model.ErrConflict, "transactions under review were not dispatched")
+	})
+
+	t.Run("fx quotes and conversions are stored", func(t *testing.T) {
+		rep := newRepository(t)
+		quotes := rep.(FxRepository)
+		createdAt := time.Date(2024, 10, 14, 12, 0, 0, 0, time.UTC)
+		quote := &model.FxQuote{Id: "quote-1", MerchantId: merchantId, From: "USD", To: "EUR", Rate: decimal.RequireFromString("0.9168"),
+			Source: "ECB reference rates", CreatedAt: createdAt, ExpiresAt: createdAt.Add(time.Minute)}
+		require.NoError(t, quotes.SaveQuote(quote))
+
+		stored, getErr := quotes.GetQuote(merchantId, "quote-1")
+		require.NoError(t, getErr)
+		assert.Equal(t, "EUR", stored.To)
+		assert.True(t, quote.Rate.Equal(stored.Rate))
+		assert.True(t, quote.ExpiresAt.Equal(stored.ExpiresAt))
+		_, getErr = quotes.GetQuote(otherMerchantId, "quote-1")
+		assert.ErrorIs(t, getErr, model.ErrNotFound, "quotes are scoped to the merchant")
+
+		require.NoError(t, quotes.UseQuote(merchantId, "quote-1", "ref-1"))
+		require.NoError(t, quotes.UseQuote(merchantId, "quote-1", "ref-1"), "using a quote again for the same transaction is a no-op")
+		assert.ErrorIs(t, quotes.UseQuote(merchantId, "quote-1", "ref-2"), model.ErrConflict, "a quote converts a single transaction")
+		assert.ErrorIs(t, quotes.UseQuote(otherMerchantId, "quote-1", "ref-3"), model.ErrNotFound)
+		require.NoError(t, quotes.ReleaseQuote(merchantId, "quote-1", "ref-2"), "another transaction's quote is left alone")
+		require.NoError(t, quotes.ReleaseQuote(otherMerchantId, "quote-1", "ref-1"))
+		assert.ErrorIs(t, quotes.UseQuote(merchantId, "quote-1", "ref-2"), model.ErrConflict)
+		require.NoError(t, quotes.ReleaseQuote(merchantId, "quote-1", "ref-1"))
+		require.NoError(t, quotes.UseQuote(merchantId, "quote-1", "ref-2"), "a released quote can be used again")
+		require.NoError(t, quotes.ReleaseQuote(merchantId, "quote-1", "ref-2"))
+		require.NoError(t, quotes.UseQuote(merchantId, "quote-1", "ref-1"))
+		stored, getErr = quotes.GetQuote(merchantId, "quote-1")
+		require.NoError(t, getErr)
+		assert.Equal(t, "ref-1", stored.UsedBy)
+
+		txn := newTxn("ref-1", "ACC123")
+		txn.Conversion = model.FxConversion{QuoteId: "quote-1", Rate: quote.Rate, Source: quote.Source, Currency: "EUR", Amount: decimal.RequireFromString("92.14")}
+		require.NoError(t, rep.SaveTransaction(txn))
+		require.NoError(t, rep.SaveTransaction(newTxn("ref-2", "ACC123")))
+
+		converted, getErr := rep.GetTransaction(merchantId, "ref-1")
+		require.NoError(t, getErr)
+		assert.Equal(t, "EUR", converted.Conversion.Currency)
+		assert.True(t, txn.Conversion.Amount.Equal(converted.Conversion.Amount))
+		assert.True(t, txn.Conversion.Rate.Equal(converted.Conversion.Rate))
+		assert.Equal(t, "quote-1", converted.Conversion.QuoteId)
+		assert.Equal(t, "ECB reference rates", converted.Conversion.Source)
+
+		unconverted, getErr := rep.GetTransaction(merchantId, "ref-2")
+		require.NoError(t, getErr)
+		assert.Equal(t, "", unconverted.Conversion.Currency)
+	})
+
+	t.Run("authorizations are captured once and expire", func(t *testing.T) {
+		rep := newRepository(t)
+		now := time.Date(2024, 10, 14, 12, 0, 0, 0, time.UTC)
+		authorize := func(referenceId string, expiresAt time.Time) {
+			txn := newTxn(referenceId, "ACC123")
+			txn.Authorization.ExpiresAt = &expiresAt
+			require.NoError(t, rep.SaveTransaction(txn))
+			require.NoError(t, rep.UpdateTransaction(&model.Transaction{Id: "auth-" + referenceId, ReferenceId: referenceId, Status: model.StatusAuthorized}))
+		}
+		authorize("ref-1", now.Add(time.Hour))
+		authorize("ref-2", now.Add(-time.Minute))
+		authorize("ref-3", now.Add(-time.Hour))
+
+		stored, getErr := rep.GetTransaction(merchantId, "ref-1")
+		require.NoError(t, getErr)
+		require.NotNil(t, stored.Authorization.ExpiresAt)
+		assert.True(t, now.Add(time.Hour).Equal(*stored.Authorization.ExpiresAt))
+		assert.True(t, stored.Authorization.Captured.IsZero())
+
+		capture := &model.Transaction{Id: "auth-ref-1", ReferenceId: "ref-1", Status: model.StatusCaptured, Fee: decimal.RequireFromString("1.46"),
+			Authorization: model.Authorization{Captured: decimal.RequireFromString("40")}}
+		require.NoError(t, rep.UpdateTransaction(capture))
+		assert.True(t, decimal.RequireFromString("40").Equal(capture.Authorization.Captured))
+		assert.True(t, decimal.RequireFromString("1.46").Equal(capture.Fee), "captures are priced for the captured amount")
+		assert.True(t, decimal.RequireFromString("100.5").Equal(capture.Amount), "the authorized amount is kept")
+		updateErr := rep.UpdateTransaction(&model.Transaction{ReferenceId: "ref-1", Status: model.StatusVoided})
+		assert.ErrorIs(t, updateErr, model.ErrConflict, "captured authorizations cannot be voided")
+		updateErr = rep.UpdateTransaction(&model.Transaction{ReferenceId: "ref-2", Status: model.StatusSuccess})
+		assert.ErrorIs(t, updateErr, model.ErrConflict, "authorizations settle by capture")
+
+		authorizations := rep.(AuthorizationRepository)
+		expired, expireErr := authorizations.ClaimExpiredAuthorizations(now, now.Add(time.Minute), 1)
+		require.NoError(t, expireErr)
+		require.Len(t, expired, 1)
+		assert.Equal(t, "ref-3", expired[0].ReferenceId, "soonest expiry first")
+		assert.Equal(t, model.StatusAuthorized, expired[0].Status, "claimed authorizations are voided at the provider first")
+		assert.Equal(t, "auth-ref-3", expired[0].Id)
+
+		expired, expireErr = authorizations.ClaimExpiredAuthorizations(now, now.Add(time.Minute), 10)
+		require.NoError(t, expireErr)
+		require.Len(t, expired, 1)
+		assert.Equal(t, "ref-2", expired[0].ReferenceId)
+
+		expired, expireErr = authorizations.ClaimExpiredAuthorizations(now, now.Add(time.Minute), 10)
+		require.NoError(t, expireErr)
+		assert.Empty(t, expired)
+		require.NoError(t, rep.UpdateTransaction(&model.Transaction{ReferenceId: "ref-2", Status: model.StatusVoided, Message: "authorization expired"}))
+		expired, expireErr = authorizations.ClaimExpiredAuthorizations(now.Add(time.Minute), now.Add(2*time.Minute), 10)
+		require.NoError(t, expireErr)
+		require.Len(t, expired, 1)
+		assert.Equal(t, "ref-3", expired[0].ReferenceId, "authorizations still AUTHORIZED are claimed again once their claim lapsed")
+		require.NoError(t, rep.UpdateTransaction(&model.Transaction{ReferenceId: "ref-3", Status: model.StatusVoided, Message: "authorization expired"}))
+
+		usage, usageErr := rep.GetUsage(merchantId, model.UsageQuery{AccountId: "ACC123", Since: now.Add(-24 * time.Hour)})
+		require.NoError(t, usageErr)
+		assert.Equal(t, 1, usage.Count, "voided authorizations do not count")
+	})
+
+	t.Run("authorizations are claimed by one request at a time", func(t *testing.T) {
+		rep := newRepository(t)
+		authorizations := rep.(AuthorizationRepository)
+		now := time.Date(2024, 10, 14, 12, 0, 0, 0, time.UTC)
+		code := func(err error) string {
+			var domainErr *model.Error
+			require.ErrorAs(t, err, &domainErr)
+			return domainErr.Code
+		}
+		lapsed := now.Add(-time.Minute)
+		txn := newTxn("ref-1", "ACC123")
+		txn.Authorization.ExpiresAt = &lapsed
+		require.NoError(t, rep.SaveTransaction(txn))
+
+		_, claimErr := authorizations.ClaimAuthorization(merchantId, "ref-1", now, now.Add(time.Minute))
+		assert.Equal(t, model.CodeNotAuthorized, code(claimErr), "only AUTHORIZED transactions are claimed")
+		require.NoError(t, rep.UpdateTransaction(&model.Transaction{Id: "auth-ref-1", ReferenceId: "ref-1", Status: model.StatusAuthorized}))
+		_, claimErr = authorizations.ClaimAuthorization(otherMerchantId, "ref-1", now, now.Add(time.Minute))
+		assert.ErrorIs(t, claimErr, model.ErrNotFound)
+
+		claimed, claimErr := authorizations.ClaimAuthorization(merchantId, "ref-1", now, now.Add(time.Minute))
+		require.NoError(t, claimErr)
+		assert.Equal(t, "auth-ref-1", claimed.Id)
+		assert.Equal(t, model.StatusAuthorized, claimed.Status)
+		_, claimErr = authorizations.ClaimAuthorization(merchantId, "ref-1", now, now.Add(time.Minute))
+		assert.Equal(t, model.CodeAuthorizationInProgress, code(claimErr))
+		expired, expireErr := authorizations.ClaimExpiredAuthorizations(now, now.Add(time.Minute), 10)
+		require.NoError(t, expireErr)
+		assert.Empty(t, expired, "claimed authorizations are left to their capture or void")
+
+		require.NoError(t, authorizations.ReleaseAuthorization("ref-1"))
+		_, claimErr = authorizations.ClaimAuthorization(merchantId, "ref-1", now, now.Add(time.Minute))
+		require.NoError(t, claimErr, "released authorizations can be claimed again")
+		_, claimErr = authorizations.ClaimAuthorization(merchantId, "ref-1", now.Add(time.Minute), now.Add(2*time.Minute))
+		require.NoError(t, claimErr, "claims lapse")
+	})
+}
+
+func TestMemoryRepository_Contract(t *testing.T) {
+	runTransactionRepositoryContract(t, func(t *testing.T) TransactionRepository {
+		return NewMemoryRepositoryService()
+	})
+}
+
+func TestPostgresRepository_Contract(t *testing.T) {
+	runTransactionRepositoryContract(t, func(t *testing.T) TransactionRepository {
+		return NewRepositoryService(migratedPostgresTestDB(t))
+	})
+}
@@ -3,7 +3,9 @@ package service
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/lib/pq"
 )
 
 type RepositoryService struct {
@@ -14,51 +16,120 @@ func NewRepositoryService(db *sql.DB) *RepositoryService {
 	return &RepositoryService{db: db}
 }
 
+// rowQuerier is a *sql.DB or *sql.Tx.
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// SaveTransaction upserts txn and sets txn.Ts to the stored creation time.
 func (rep *RepositoryService) SaveTransaction(txn *Transaction) error {
-	_, trxSaveErr := rep.db.Exec(
-		`INSERT INTO transactions (reference_id, account_id, amount, currency, status, operation, gateway_id) 
-		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+	return saveTransaction(rep.db, txn)
+}
+
+func saveTransaction(db rowQuerier, txn *Transaction) error {
+	row := db.QueryRow(
+		`INSERT INTO transactions (reference_id, account_id, amount, currency, status, operation, gateway_id, merchant_id, risk_decision, risk_reasons, beneficiary_name, fee,
+		                           account_currency, account_amount, fx_rate, fx_source, fx_quote_id, authorization_expires_at) 
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10, NULLIF($11, ''), $12,
+		         NULLIF($13, ''), NULLIF($14::numeric, 0), NULLIF($15::numeric, 0), NULLIF($16, ''), NULLIF($17, ''), $18)
 		 ON CONFLICT (reference_id) 
 		 DO UPDATE SET account_id = EXCLUDED.account_id, amount = EXCLUDED.amount, currency = EXCLUDED.currency, 
-		               status = EXCLUDED.status, operation = EXCLUDED.operation`,
-		txn.ReferenceId, txn.AccountId, txn.Amount, txn.Currency, txn.Status, txn.Operation, txn.GatewayId,
+		               status = EXCLUDED.status, operation = EXCLUDED.operation,
+		               risk_decision = EXCLUDED.risk_decision, risk_reasons = EXCLUDED.risk_reasons,
+		               beneficiary_name = EXCLUDED.beneficiary_name, fee = EXCLUDED.fee,
+		               account_currency = EXCLUDED.account_currency, account_amount = EXCLUDED.account_amount,
+		               fx_rate = EXCLUDED.fx_rate, fx_source = EXCLUDED.fx_source, fx_quote_id = EXCLUDED.fx_quote_id,
+		               authorization_expires_at = EXCLUDED.authorization_expires_at
+		 RETURNING ts`,
+		txn.ReferenceId, txn.AccountId, txn.Amount, txn.Currency, txn.Status, txn.Operation, txn.GatewayId, txn.MerchantId,
+		txn.Risk.Decision, pq.Array(txn.Risk.Reasons), txn.BeneficiaryName, txn.Fee,
+		txn.Conversion.Currency, txn.Conversion.Amount, txn.Conversion.Rate, txn.Conversion.Source, txn.Conversion.QuoteId,
+		txn.Authorization.ExpiresAt,
 	)
-	return trxSaveErr
+	return row.Scan(&txn.Ts)
 }
 
+// UpdateTransaction applies a provider status update, with the captured
+// amount and fee of a capture, and fills txn with the stored transaction. Updates the
+// current status does not lead to, see TransactionStatus.Predecessors, are
+// ErrConflict unless they repeat it.
 func (rep *RepositoryService) UpdateTransaction(txn *Transaction) error {
-	_, trxSaveErr := rep.db.Exec(
-		`INSERT INTO transactions (id, reference_id, account_id, amount, currency, status, operation, message, gateway_id) 
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-		 ON CONFLICT (reference_id) 
-		 DO UPDATE SET id = EXCLUDED.id, 
-		               status = EXCLUDED.status, 
-		               message = EXCLUDED.message`,
-		txn.Id, txn.ReferenceId, txn.AccountId, txn.Amount, txn.Currency, txn.Status, txn.Operation, txn.Message, txn.GatewayId,
+	row := rep.db.QueryRow(
+		`UPDATE transactions
+		 SET id = $1, status = $2, message = $3, captured_amount = COALESCE(NULLIF($6::numeric, 0), captured_amount),
+		     fee = CASE WHEN $6::numeric > 0 THEN $7 ELSE fee END
+		 WHERE reference_id = $4 AND (status = ANY($5) OR status = $2)
+		 RETURNING COALESCE(merchant_id, ''), account_id, amount, fee, currency, operation, gateway_id,
+		           COALESCE(risk_decision, ''), risk_reasons, COALESCE(beneficiary_name, ''),
+		           COALESCE(account_currency, ''), COALESCE(account_amount, 0), COALESCE(fx_rate, 0), COALESCE(fx_source, ''), COALESCE(fx_quote_id, ''),
+		           authorization_expires_at, COALESCE(captured_amount, 0), ts`,
+		txn.Id, txn.Status, txn.Message, txn.ReferenceId, pq.Array(statusNames(txn.Status.Predecessors())), txn.Authorization.Captured, txn.Fee,
 	)
-	return trxSaveErr
+	updateErr := row.Scan(&txn.MerchantId, &txn.AccountId, &txn.Amount, &txn.Fee, &txn.Currency, &txn.Operation, &txn.GatewayId,
+		&txn.Risk.Decision, pq.Array(&txn.Risk.Reasons), &txn.BeneficiaryName,
+		&txn.Conversion.Currency, &txn.Conversion.Amount, &txn.Conversion.Rate, &txn.Conversion.Source, &txn.Conversion.QuoteId,
+		&txn.Authorization.ExpiresAt, &txn.Authorization.Captured, &txn.Ts)
+	if updateErr == nil {
+		return nil
+	}
+	if !errors.Is(updateErr, sql.ErrNoRows) {
+		return updateErr
+	}
+
+	var current TransactionStatus
+	statusErr := rep.db.QueryRow(`SELECT status FROM transactions WHERE reference_id = $1`, txn.ReferenceId).Scan(&current)
+	if errors.Is(statusErr, sql.ErrNoRows) {
+		return NewError(ErrNotFound, CodeTransactionNotFound, "transaction %s not found", txn.ReferenceId)
+	}
+	if statusErr != nil {
+		return statusErr
+	}
+	return NewError(ErrConflict, CodeTransactionFinal, "transaction %s is already %s", txn.ReferenceId, current)
+}
+
+func statusNames(statuses []TransactionStatus) []string {
+	names := make([]string, len(statuses))
+	for i, status := range statuses {
+		names[i] = string(status)
+	}
+	return names
 }
 
-func (rep *RepositoryService) GetTransaction(referenceId string) (Transaction, error) {
+func (rep *RepositoryService) GetTransaction(merchantId, referenceId string) (Transaction, error) {
 	var txn Transaction
 	row := rep.db.QueryRow(`
 		SELECT 
 			COALESCE(id, '') AS id, 
 			reference_id, 
+			merchant_id, 
 			account_id, 
 			amount, 
+			fee,
 			currency, 
 			status, 
 			operation,
 			COALESCE(message, '') AS message, 
 			gateway_id,
+			COALESCE(risk_decision, '') AS risk_decision,
+			risk_reasons,
+			COALESCE(beneficiary_name, '') AS beneficiary_name,
+			COALESCE(account_currency, '') AS account_currency,
+			COALESCE(account_amount, 0) AS account_amount,
+			COALESCE(fx_rate, 0) AS fx_rate,
+			COALESCE(fx_source, '') AS fx_source,
+			COALESCE(fx_quote_id, '') AS fx_quote_id,
+			authorization_expires_at,
+			COALESCE(captured_amount, 0) AS captured_amount,
 			ts 
 		FROM transactions 
-		WHERE reference_id = $1`, referenceId)
+		WHERE merchant_id = $1 AND reference_id = $2`, merchantId, referenceId)
 
-	trxErr := row.Scan(&txn.Id, &txn.ReferenceId, &txn.AccountId, &txn.Amount, &txn.Currency, &txn.Status, &txn.Operation, &txn.Message, &txn.GatewayId, &txn.Ts)
+	trxErr := row.Scan(&txn.Id, &txn.ReferenceId, &txn.MerchantId, &txn.AccountId, &txn.Amount, &txn.Fee, &txn.Currency, &txn.Status, &txn.Operation, &txn.Message, &txn.GatewayId,
+		&txn.Risk.Decision, pq.Array(&txn.Risk.Reasons), &txn.BeneficiaryName,
+		&txn.Conversion.Currency, &txn.Conversion.Amount, &txn.Conversion.Rate, &txn.Conversion.Source, &txn.Conversion.QuoteId,
+		&txn.Authorization.ExpiresAt, &txn.Authorization.Captured, &txn.Ts)
 	if errors.Is(trxErr, sql.ErrNoRows) {
-		return Transaction{}, nil
+		return Transaction{}, NewError(ErrNotFound, CodeTransactionNotFound, "transaction %s not found", referenceId)
 	}
 	if trxErr != nil {
 		return Transaction{}, trxErr
@@ -67,23 +138,74 @@ func (rep *RepositoryService) GetTransaction(referenceId string) (Transaction, e
 	return txn, nil
 }
 
-func (rep *RepositoryService) GetTransactions(accountId string) ([]Transaction, error) {
-	rows, rowsErr := rep.db.Query(`
+func (rep *RepositoryService) GetTransactions(merchantId, accountId string, filter TransactionFilter, page PageRequest) (TransactionPage, error) {
+	query := `
 		SELECT 
 			COALESCE(id, '') AS id,  
 			reference_id, 
+			merchant_id, 
 			account_id, 
 			amount, 
+			fee,
 			currency, 
 			status, 
 			operation,
 			COALESCE(message, '') AS message, 
 			gateway_id,
+			COALESCE(risk_decision, '') AS risk_decision,
+			risk_reasons,
+			COALESCE(beneficiary_name, '') AS beneficiary_name,
+			COALESCE(account_currency, '') AS account_currency,
+			COALESCE(account_amount, 0) AS account_amount,
+			COALESCE(fx_rate, 0) AS fx_rate,
+			COALESCE(fx_source, '') AS fx_source,
+			COALESCE(fx_quote_id, '') AS fx_quote_id,
+			authorization_expires_at,
+			COALESCE(captured_amount, 0) AS captured_amount,
 			ts 
 		FROM transactions 
-		WHERE account_id = $1 ORDER BY ts DESC`, accountId)
+		WHERE merchant_id = $1 AND account_id = $2`
+	args := []interface{}{merchantId, accountId}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		query += fmt.Sprintf(" AND "+condition, len(args))
+	}
+	if filter.Status != "" {
+		where("status = $%d", filter.Status)
+	}
+	if filter.Operation != "" {
+		where("operation = $%d", filter.Operation)
+	}
+	if filter.GatewayId != "" {
+		where("gateway_id = $%d", filter.GatewayId)
+	}
+	if filter.Currency != "" {
+		where("currency = $%d", filter.Currency)
+	}
+	if filter.MinAmount != nil {
+		where("amount >= $%d", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		where("amount <= $%d", *filter.MaxAmount)
+	}
+	// ts is a TIMESTAMP read back as UTC, so bounds and cursors are compared in UTC too.
+	if filter.From != nil {
+		where("ts >= $%d", filter.From.UTC())
+	}
+	if filter.To != nil {
+		where("ts < $%d", filter.To.UTC())
+	}
+	if page.After != nil {
+		args = append(args, page.After.Ts.UTC(), page.After.ReferenceId)
+		query += fmt.Sprintf(" AND (ts, reference_id) < ($%d, $%d)", len(args)-1, len(args))
+	}
+	size := page.Size()
+	args = append(args, size+1)
+	query += fmt.Sprintf(" ORDER BY ts DESC, reference_id DESC LIMIT $%d", len(args))
+
+	rows, rowsErr := rep.db.Query(query, args...)
 	if rowsErr != nil {
-		return nil, rowsErr
+		return TransactionPage{}, rowsErr
 	}
 
 	defer rows.Close()
@@ -91,16 +213,94 @@ func (rep *RepositoryService) GetTransactions(accountId string) ([]Transaction,
 	var transactions []Transaction
 	for rows.Next() {
 		var txn Transaction
-		cursorErr := rows.Scan(&txn.Id, &txn.ReferenceId, &txn.AccountId, &txn.Amount, &txn.Currency, &txn.Status, &txn.Operation, &txn.Message, &txn.GatewayId, &txn.Ts)
+		cursorErr := rows.Scan(&txn.Id, &txn.ReferenceId, &txn.MerchantId, &txn.AccountId, &txn.Amount, &txn.Fee, &txn.Currency, &txn.Status, &txn.Operation, &txn.Message, &txn.GatewayId,
+			&txn.Risk.Decision, pq.Array(&txn.Risk.Reasons), &txn.BeneficiaryName,
+			&txn.Conversion.Currency, &txn.Conversion.Amount, &txn.Conversion.Rate, &txn.Conversion.Source, &txn.Conversion.QuoteId,
+			&txn.Authorization.ExpiresAt, &txn.Authorization.Captured, &txn.Ts)
 		if cursorErr != nil {
-			return nil, cursorErr
+			return TransactionPage{}, cursorErr
 		}
 		transactions = append(transactions, txn)
 	}
 
 	if execErr := rows.Err(); execErr != nil {
-		return nil, execErr
+		return TransactionPage{}, execErr
+	}
+
+	return newTransactionPage(transactions, size), nil
+}
+
+func (rep *RepositoryService) GetUsage(merchantId string, usage UsageQuery) (Usage, error) {
+	return getUsage(rep.db, merchantId, usage)
+}
+
+func getUsage(db rowQuerier, merchantId string, usage UsageQuery) (Usage, error) {
+	query := `
+		SELECT COUNT(*), COALESCE(SUM(COALESCE(account_amount, amount)), 0)
+		FROM transactions
+		WHERE merchant_id = $1 AND ts >= $2`
+	args := []interface{}{merchantId, usage.Since.UTC()}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		query += fmt.Sprintf(" AND "+condition, len(args))
+	}
+	if !usage.IncludeFailed {
+		where("status <> ALL($%d)", pq.Array(statusNames([]TransactionStatus{StatusFailed, StatusVoided})))
+	}
+	if usage.AccountId != "" {
+		where("account_id = $%d", usage.AccountId)
 	}
+	if usage.GatewayId != "" {
+		where("gateway_id = $%d", usage.GatewayId)
+	}
+	if usage.Operation != "" {
+		where("operation = $%d", usage.Operation)
+	}
+	if usage.Currency != "" {
+		where("COALESCE(account_currency, currency) = $%d", usage.Currency)
+	}
+
+	var result Usage
+	if rowErr := db.QueryRow(query, args...).Scan(&result.Count, &result.Amount); rowErr != nil {
+		return Usage{}, rowErr
+	}
+	return result, nil
+}
+
+// usageLockClass is the first key of the advisory locks of LockUsage, the
+// second one is the hash of the usage key.
+const usageLockClass = 7262312
+
+// LockUsage runs fn in a database transaction holding an advisory lock per
+// key, so the usage fn reads and the transaction it saves are consistent
+// across replicas. The locks are released when it commits or rolls back.
+func (rep *RepositoryService) LockUsage(keys []string, fn func(store UsageStore) error) error {
+	tx, beginErr := rep.db.Begin()
+	if beginErr != nil {
+		return beginErr
+	}
+	defer tx.Rollback()
+
+	for _, key := range keys {
+		if _, lockErr := tx.Exec(`SELECT pg_advisory_xact_lock($1, hashtext($2))`, usageLockClass, key); lockErr != nil {
+			return lockErr
+		}
+	}
+	if fnErr := fn(txUsageStore{tx: tx}); fnErr != nil {
+		return fnErr
+	}
+	return tx.Commit()
+}
+
+// txUsageStore reads and saves within the transaction of LockUsage.
+type txUsageStore struct {
+	tx *sql.Tx
+}
+
+func (store txUsageStore) GetUsage(merchantId string, query UsageQuery) (Usage, error) {
+	return getUsage(store.tx, merchantId, query)
+}
 
-	return transactions, nil
+func (store txUsageStore) SaveTransaction(txn *Transaction) error {
+	return saveTransaction(store.tx, txn)
 }
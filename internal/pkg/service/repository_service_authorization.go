@@ -0,0 +1,87 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/lib/pq"
+	"time"
+)
+
+// authorizationColumns are the columns of the authorizations returned by
+// ClaimAuthorization and ClaimExpiredAuthorizations, see scanAuthorization.
+const authorizationColumns = `COALESCE(id, ''), reference_id, merchant_id, account_id, amount, fee, currency, status, operation,
+	COALESCE(message, ''), gateway_id, COALESCE(risk_decision, ''), risk_reasons, COALESCE(beneficiary_name, ''),
+	COALESCE(account_currency, ''), COALESCE(account_amount, 0), COALESCE(fx_rate, 0), COALESCE(fx_source, ''), COALESCE(fx_quote_id, ''),
+	authorization_expires_at, COALESCE(captured_amount, 0), ts`
+
+// rowScanner is a *sql.Row or *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAuthorization(row rowScanner) (Transaction, error) {
+	var txn Transaction
+	scanErr := row.Scan(&txn.Id, &txn.ReferenceId, &txn.MerchantId, &txn.AccountId, &txn.Amount, &txn.Fee, &txn.Currency, &txn.Status, &txn.Operation, &txn.Message, &txn.GatewayId,
+		&txn.Risk.Decision, pq.Array(&txn.Risk.Reasons), &txn.BeneficiaryName,
+		&txn.Conversion.Currency, &txn.Conversion.Amount, &txn.Conversion.Rate, &txn.Conversion.Source, &txn.Conversion.QuoteId,
+		&txn.Authorization.ExpiresAt, &txn.Authorization.Captured, &txn.Ts)
+	return txn, scanErr
+}
+
+// ClaimAuthorization claims the row in a single conditional update, so of two
+// requests racing for an authorization only one reaches the provider.
+func (rep *RepositoryService) ClaimAuthorization(merchantId, referenceId string, now, until time.Time) (Transaction, error) {
+	txn, scanErr := scanAuthorization(rep.db.QueryRow(
+		`UPDATE transactions SET authorization_claimed_until = $4
+		 WHERE merchant_id = $1 AND reference_id = $2 AND status = $3
+		   AND (authorization_claimed_until IS NULL OR authorization_claimed_until <= $5)
+		 RETURNING `+authorizationColumns,
+		merchantId, referenceId, StatusAuthorized, until.UTC(), now.UTC()))
+	if scanErr == nil {
+		return txn, nil
+	}
+	if !errors.Is(scanErr, sql.ErrNoRows) {
+		return Transaction{}, scanErr
+	}
+	stored, getErr := rep.GetTransaction(merchantId, referenceId)
+	if getErr != nil {
+		return Transaction{}, getErr
+	}
+	return Transaction{}, unclaimable(stored)
+}
+
+func (rep *RepositoryService) ReleaseAuthorization(referenceId string) error {
+	_, updateErr := rep.db.Exec(`UPDATE transactions SET authorization_claimed_until = NULL WHERE reference_id = $1`, referenceId)
+	return updateErr
+}
+
+func (rep *RepositoryService) ClaimExpiredAuthorizations(now, until time.Time, limit int) ([]Transaction, error) {
+	// captures and voids claim the row first, claimed rows are left to them
+	rows, rowsErr := rep.db.Query(
+		`UPDATE transactions
+		 SET authorization_claimed_until = $1
+		 WHERE status = $2 AND reference_id IN (
+		     SELECT reference_id FROM transactions
+		     WHERE status = $2 AND authorization_expires_at <= $3
+		       AND (authorization_claimed_until IS NULL OR authorization_claimed_until <= $3)
+		     ORDER BY authorization_expires_at, reference_id
+		     LIMIT $4
+		     FOR UPDATE SKIP LOCKED)
+		 RETURNING `+authorizationColumns,
+		until.UTC(), StatusAuthorized, now.UTC(), limit)
+	if rowsErr != nil {
+		return nil, rowsErr
+	}
+	defer rows.Close()
+
+	var expired []Transaction
+	for rows.Next() {
+		txn, scanErr := scanAuthorization(rows)
+		if scanErr != nil {
+			return nil, scanErr
+		}
+		expired = append(expired, txn)
+	}
+	return expired, rows.Err()
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+)
+
+func (rep *RepositoryService) SaveQuote(quote *FxQuote) error {
+	_, insertErr := rep.db.Exec(
+		`INSERT INTO fx_quotes (id, merchant_id, from_currency, to_currency, rate, source, created_at, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		quote.Id, quote.MerchantId, quote.From, quote.To, quote.Rate, quote.Source, quote.CreatedAt, quote.ExpiresAt,
+	)
+	return insertErr
+}
+
+func (rep *RepositoryService) GetQuote(merchantId, quoteId string) (FxQuote, error) {
+	var quote FxQuote
+	scanErr := rep.db.QueryRow(
+		`SELECT id, merchant_id, from_currency, to_currency, rate, source, created_at, expires_at, COALESCE(used_by, '')
+		 FROM fx_quotes
+		 WHERE id = $1 AND merchant_id = $2`, quoteId, merchantId,
+	).Scan(&quote.Id, &quote.MerchantId, &quote.From, &quote.To, &quote.Rate, &quote.Source, &quote.CreatedAt, &quote.ExpiresAt, &quote.UsedBy)
+	if errors.Is(scanErr, sql.ErrNoRows) {
+		return FxQuote{}, NewError(ErrNotFound, CodeQuoteNotFound, "fx quote %s not found", quoteId)
+	}
+	return quote, scanErr
+}
+
+// UseQuote claims the quote in a single conditional update, so of two
+// transactions racing for it only one succeeds.
+func (rep *RepositoryService) UseQuote(merchantId, quoteId, referenceId string) error {
+	result, updateErr := rep.db.Exec(
+		`UPDATE fx_quotes SET used_by = $3
+		 WHERE id = $1 AND merchant_id = $2 AND (used_by IS NULL OR used_by = $3)`,
+		quoteId, merchantId, referenceId,
+	)
+	if updateErr != nil {
+		return updateErr
+	}
+	affected, affectedErr := result.RowsAffected()
+	if affectedErr != nil {
+		return affectedErr
+	}
+	if affected == 1 {
+		return nil
+	}
+	if _, getErr := rep.GetQuote(merchantId, quoteId); getErr != nil {
+		return getErr
+	}
+	return NewError(ErrConflict, CodeQuoteUsed, "fx quote %s is already used by another transaction", quoteId)
+}
+
+func (rep *RepositoryService) ReleaseQuote(merchantId, quoteId, referenceId string) error {
+	_, updateErr := rep.db.Exec(
+		`UPDATE fx_quotes SET used_by = NULL WHERE id = $1 AND merchant_id = $2 AND used_by = $3`,
+		quoteId, merchantId, referenceId,
+	)
+	return updateErr
+}
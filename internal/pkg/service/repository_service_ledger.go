@@ -0,0 +1,281 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
+	"sort"
+)
+
+func (rep *RepositoryService) PostEntry(entry *JournalEntry) error {
+	if !entry.Balanced() {
+		return fmt.Errorf("%s entry of %s is not balanced", entry.Kind, entry.ReferenceId)
+	}
+
+	tx, beginErr := rep.db.Begin()
+	if beginErr != nil {
+		return beginErr
+	}
+	defer tx.Rollback()
+
+	// the unique (reference_id, kind) makes a concurrent duplicate wait here and then do nothing
+	insertErr := tx.QueryRow(
+		`INSERT INTO journal_entries (id, merchant_id, reference_id, kind, currency)
+		 VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (reference_id, kind) DO NOTHING
+		 RETURNING created_at`,
+		entry.Id, entry.MerchantId, entry.ReferenceId, entry.Kind, entry.Currency,
+	).Scan(&entry.CreatedAt)
+	if errors.Is(insertErr, sql.ErrNoRows) {
+		return nil
+	}
+	var pqErr *pq.Error
+	if errors.As(insertErr, &pqErr) && pqErr.Code == foreignKeyViolation {
+		return NewError(ErrNotFound, CodeMerchantNotFound, "merchant %s not found", entry.MerchantId)
+	}
+	if insertErr != nil {
+		return insertErr
+	}
+
+	// lock the accounts in key order, so entries sharing accounts cannot deadlock
+	keys := make([]LedgerAccountKey, 0, len(entry.Postings))
+	for _, posting := range entry.Postings {
+		keys = append(keys, posting.Account)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Type != keys[j].Type {
+			return keys[i].Type < keys[j].Type
+		}
+		return keys[i].Owner < keys[j].Owner
+	})
+	type lockedAccount struct {
+		id      int64
+		balance decimal.Decimal
+	}
+	accounts := make(map[LedgerAccountKey]*lockedAccount)
+	for _, key := range keys {
+		if _, locked := accounts[key]; locked {
+			continue
+		}
+		account := &lockedAccount{}
+		lockErr := tx.QueryRow(
+			`INSERT INTO ledger_accounts (merchant_id, type, owner, currency)
+			 VALUES ($1, $2, $3, $4)
+			 ON CONFLICT (merchant_id, type, owner, currency) DO UPDATE SET updated_at = ledger_accounts.updated_at
+			 RETURNING id, balance`,
+			entry.MerchantId, key.Type, key.Owner, entry.Currency,
+		).Scan(&account.id, &account.balance)
+		if lockErr != nil {
+			return lockErr
+		}
+		accounts[key] = account
+	}
+
+	for i := range entry.Postings {
+		posting := &entry.Postings[i]
+		account := accounts[posting.Account]
+		account.balance = account.balance.Add(posting.Account.BalanceDelta(posting.Direction, posting.Amount))
+		posting.BalanceAfter = account.balance
+
+		if _, postErr := tx.Exec(
+			`INSERT INTO ledger_postings (entry_id, ledger_account_id, direction, amount, balance_after) VALUES ($1, $2, $3, $4, $5)`,
+			entry.Id, account.id, posting.Direction, posting.Amount, posting.BalanceAfter,
+		); postErr != nil {
+			return postErr
+		}
+		if _, updateErr := tx.Exec(
+			`UPDATE ledger_accounts SET balance = $2, updated_at = now() WHERE id = $1`,
+			account.id, account.balance,
+		); updateErr != nil {
+			return updateErr
+		}
+	}
+	if captureErr := settleHold(tx, entry.MerchantId, entry.ReferenceId, HoldCaptured); captureErr != nil {
+		return captureErr
+	}
+	return tx.Commit()
+}
+
+func (rep *RepositoryService) PlaceHold(hold *FundsHold) error {
+	tx, beginErr := rep.db.Begin()
+	if beginErr != nil {
+		return beginErr
+	}
+	defer tx.Rollback()
+
+	// locking the account serialises the holds and bookings of the account
+	var accountId int64
+	var available decimal.Decimal
+	lockErr := tx.QueryRow(
+		`INSERT INTO ledger_accounts (merchant_id, type, owner, currency)
+		 VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (merchant_id, type, owner, currency) DO UPDATE SET updated_at = ledger_accounts.updated_at
+		 RETURNING id, balance - held`,
+		hold.MerchantId, LedgerCustomer, hold.AccountId, hold.Currency,
+	).Scan(&accountId, &available)
+	var pqErr *pq.Error
+	if errors.As(lockErr, &pqErr) && pqErr.Code == foreignKeyViolation {
+		return NewError(ErrNotFound, CodeMerchantNotFound, "merchant %s not found", hold.MerchantId)
+	}
+	if lockErr != nil {
+		return lockErr
+	}
+
+	insertErr := tx.QueryRow(
+		`INSERT INTO funds_holds (id, merchant_id, ledger_account_id, reference_id, amount, status)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 ON CONFLICT (reference_id) DO NOTHING
+		 RETURNING created_at`,
+		hold.Id, hold.MerchantId, accountId, hold.ReferenceId, hold.Amount, HoldActive,
+	).Scan(&hold.CreatedAt)
+	if errors.Is(insertErr, sql.ErrNoRows) {
+		return nil
+	}
+	if insertErr != nil {
+		return insertErr
+	}
+	if available.LessThan(hold.Amount) {
+		return NewError(ErrUnprocessable, CodeInsufficientFunds, "insufficient funds: %s %s available", available, hold.Currency)
+	}
+
+	if _, updateErr := tx.Exec(
+		`UPDATE ledger_accounts SET held = held + $2, updated_at = now() WHERE id = $1`,
+		accountId, hold.Amount,
+	); updateErr != nil {
+		return updateErr
+	}
+	if commitErr := tx.Commit(); commitErr != nil {
+		return commitErr
+	}
+	hold.Status = HoldActive
+	return nil
+}
+
+func (rep *RepositoryService) ReleaseHold(merchantId, referenceId string) error {
+	tx, beginErr := rep.db.Begin()
+	if beginErr != nil {
+		return beginErr
+	}
+	defer tx.Rollback()
+
+	// lock the account before the hold, in the order PostEntry and PlaceHold take them
+	if _, lockErr := tx.Exec(
+		`SELECT id FROM ledger_accounts
+		 WHERE id = (SELECT ledger_account_id FROM funds_holds WHERE merchant_id = $1 AND reference_id = $2)
+		 FOR UPDATE`,
+		merchantId, referenceId,
+	); lockErr != nil {
+		return lockErr
+	}
+	if releaseErr := settleHold(tx, merchantId, referenceId, HoldReleased); releaseErr != nil {
+		return releaseErr
+	}
+	return tx.Commit()
+}
+
+// settleHold moves the active hold of referenceId to status within tx,
+// returning its amount to the available balance. It does nothing when the
+// reference has no active hold.
+func settleHold(tx *sql.Tx, merchantId, referenceId string, status HoldStatus) error {
+	var accountId int64
+	var amount decimal.Decimal
+	settleErr := tx.QueryRow(
+		`UPDATE funds_holds SET status = $3, updated_at = now()
+		 WHERE merchant_id = $1 AND reference_id = $2 AND status = $4
+		 RETURNING ledger_account_id, amount`,
+		merchantId, referenceId, status, HoldActive,
+	).Scan(&accountId, &amount)
+	if errors.Is(settleErr, sql.ErrNoRows) {
+		return nil
+	}
+	if settleErr != nil {
+		return settleErr
+	}
+	_, updateErr := tx.Exec(
+		`UPDATE ledger_accounts SET held = held - $2, updated_at = now() WHERE id = $1`,
+		accountId, amount,
+	)
+	return updateErr
+}
+
+func (rep *RepositoryService) GetBalances(merchantId, accountId string) ([]Balance, error) {
+	rows, rowsErr := rep.db.Query(
+		`SELECT currency, balance, held, updated_at
+		 FROM ledger_accounts
+		 WHERE merchant_id = $1 AND type = $2 AND owner = $3
+		 ORDER BY currency`,
+		merchantId, LedgerCustomer, accountId,
+	)
+	if rowsErr != nil {
+		return nil, rowsErr
+	}
+	defer rows.Close()
+
+	var balances []Balance
+	for rows.Next() {
+		var balance Balance
+		if scanErr := rows.Scan(&balance.Currency, &balance.Balance, &balance.Held, &balance.UpdatedAt); scanErr != nil {
+			return nil, scanErr
+		}
+		balances = append(balances, balance)
+	}
+	return balances, rows.Err()
+}
+
+func (rep *RepositoryService) GetStatement(merchantId, accountId string, req StatementRequest) (StatementPage, error) {
+	query := `
+		SELECT p.id, e.id, e.reference_id, e.kind, a.currency, p.direction, p.amount, p.balance_after, e.created_at
+		FROM ledger_postings p
+		JOIN ledger_accounts a ON a.id = p.ledger_account_id
+		JOIN journal_entries e ON e.id = p.entry_id
+		WHERE a.merchant_id = $1 AND a.type = $2 AND a.owner = $3`
+	args := []interface{}{merchantId, LedgerCustomer, accountId}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		query += fmt.Sprintf(" AND "+condition, len(args))
+	}
+	if req.Currency != "" {
+		where("a.currency = $%d", req.Currency)
+	}
+	if req.From != nil {
+		where("e.created_at >= $%d", *req.From)
+	}
+	if req.To != nil {
+		where("e.created_at < $%d", *req.To)
+	}
+	if req.Before > 0 {
+		where("p.id < $%d", req.Before)
+	}
+	size := PageRequest{Limit: req.Limit}.Size()
+	args = append(args, size+1)
+	query += fmt.Sprintf(" ORDER BY p.id DESC LIMIT $%d", len(args))
+
+	rows, rowsErr := rep.db.Query(query, args...)
+	if rowsErr != nil {
+		return StatementPage{}, rowsErr
+	}
+	defer rows.Close()
+
+	var page StatementPage
+	for rows.Next() {
+		var line StatementLine
+		var direction Direction
+		scanErr := rows.Scan(&line.Sequence, &line.EntryId, &line.ReferenceId, &line.Kind, &line.Currency, &direction, &line.Amount, &line.BalanceAfter, &line.CreatedAt)
+		if scanErr != nil {
+			return StatementPage{}, scanErr
+		}
+		line.Amount = LedgerAccountKey{Type: LedgerCustomer}.BalanceDelta(direction, line.Amount)
+		page.Lines = append(page.Lines, line)
+	}
+	if rowsErr := rows.Err(); rowsErr != nil {
+		return StatementPage{}, rowsErr
+	}
+	if len(page.Lines) > size {
+		page.Lines = page.Lines[:size]
+		page.Next = page.Lines[size-1].Sequence
+	}
+	return page, nil
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/lib/pq"
+)
+
+// foreignKeyViolation is the Postgres error code of a missing referenced row.
+const foreignKeyViolation = "23503"
+
+func (rep *RepositoryService) CreateMerchant(merchant *Merchant) error {
+	return rep.db.QueryRow(
+		`INSERT INTO merchants (id, name) VALUES ($1, $2) RETURNING created_at`,
+		merchant.Id, merchant.Name,
+	).Scan(&merchant.CreatedAt)
+}
+
+func (rep *RepositoryService) GetMerchant(merchantId string) (Merchant, error) {
+	var merchant Merchant
+	var routingRules, limits, velocityLimits []byte
+	rowErr := rep.db.QueryRow(`
+		SELECT
+			m.id,
+			m.name,
+			m.created_at,
+			COALESCE(m.webhook_secret, '') AS webhook_secret,
+			s.enabled_gateways,
+			COALESCE(s.routing_rules, '[]') AS routing_rules,
+			COALESCE(s.limits, '[]') AS limits,
+			COALESCE(s.velocity_limits, '[]') AS velocity_limits,
+			COALESCE(s.webhook_url, '') AS webhook_url
+		FROM merchants m
+		LEFT JOIN merchant_settings s ON s.merchant_id = m.id
+		WHERE m.id = $1`, merchantId,
+	).Scan(&merchant.Id, &merchant.Name, &merchant.CreatedAt, &merchant.WebhookSecret, pq.Array(&merchant.Settings.EnabledGateways), &routingRules, &limits, &velocityLimits, &merchant.Settings.WebhookURL)
+	if errors.Is(rowErr, sql.ErrNoRows) {
+		return Merchant{}, NewError(ErrNotFound, CodeMerchantNotFound, "merchant %s not found", merchantId)
+	}
+	if rowErr != nil {
+		return Merchant{}, rowErr
+	}
+	if decodeErr := json.Unmarshal(routingRules, &merchant.Settings.RoutingRules); decodeErr != nil {
+		return Merchant{}, fmt.Errorf("decoding routing rules of merchant %s: %w", merchantId, decodeErr)
+	}
+	if decodeErr := json.Unmarshal(limits, &merchant.Settings.Limits); decodeErr != nil {
+		return Merchant{}, fmt.Errorf("decoding limits of merchant %s: %w", merchantId, decodeErr)
+	}
+	if decodeErr := json.Unmarshal(velocityLimits, &merchant.Settings.VelocityLimits); decodeErr != nil {
+		return Merchant{}, fmt.Errorf("decoding velocity limits of merchant %s: %w", merchantId, decodeErr)
+	}
+	return merchant, nil
+}
+
+func (rep *RepositoryService) SaveMerchantSettings(merchantId string, settings MerchantSettings) error {
+	routingRules, encodeErr := json.Marshal(nonNil(settings.RoutingRules))
+	if encodeErr != nil {
+		return encodeErr
+	}
+	limits, encodeErr := json.Marshal(nonNil(settings.Limits))
+	if encodeErr != nil {
+		return encodeErr
+	}
+	velocityLimits, encodeErr := json.Marshal(nonNil(settings.VelocityLimits))
+	if encodeErr != nil {
+		return encodeErr
+	}
+
+	var enabledGateways interface{}
+	if settings.EnabledGateways != nil {
+		enabledGateways = pq.Array(settings.EnabledGateways)
+	}
+	var webhookURL interface{}
+	if settings.WebhookURL != "" {
+		webhookURL = settings.WebhookURL
+	}
+
+	_, upsertErr := rep.db.Exec(
+		`INSERT INTO merchant_settings (merchant_id, enabled_gateways, routing_rules, limits, velocity_limits, webhook_url)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 ON CONFLICT (merchant_id)
+		 DO UPDATE SET enabled_gateways = EXCLUDED.enabled_gateways, routing_rules = EXCLUDED.routing_rules,
+		               limits = EXCLUDED.limits, velocity_limits = EXCLUDED.velocity_limits,
+		               webhook_url = EXCLUDED.webhook_url, updated_at = now()`,
+		merchantId, enabledGateways, string(routingRules), string(limits), string(velocityLimits), webhookURL,
+	)
+	var pqErr *pq.Error
+	if errors.As(upsertErr, &pqErr) && pqErr.Code == foreignKeyViolation {
+		return NewError(ErrNotFound, CodeMerchantNotFound, "merchant %s not found", merchantId)
+	}
+	return upsertErr
+}
+
+func (rep *RepositoryService) SetWebhookSecret(merchantId, secret string) error {
+	result, updateErr := rep.db.Exec(`UPDATE merchants SET webhook_secret = $2 WHERE id = $1`, merchantId, secret)
+	if updateErr != nil {
+		return updateErr
+	}
+	affected, affectedErr := result.RowsAffected()
+	if affectedErr != nil {
+		return affectedErr
+	}
+	if affected == 0 {
+		return NewError(ErrNotFound, CodeMerchantNotFound, "merchant %s not found", merchantId)
+	}
+	return nil
+}
+
+// nonNil makes empty lists encode as [] instead of null.
+func nonNil[T any](values []T) []T {
+	if values == nil {
+		return []T{}
+	}
+	return values
+}
+
+func (rep *RepositoryService) CreateAPIKey(key *APIKey) error {
+	insertErr := rep.db.QueryRow(
+		`INSERT INTO api_keys (id, merchant_id, prefix, hash) VALUES ($1, $2, $3, $4) RETURNING created_at`,
+		key.Id, key.MerchantId, key.Prefix, key.Hash,
+	).Scan(&key.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(insertErr, &pqErr) && pqErr.Code == foreignKeyViolation {
+		return NewError(ErrNotFound, CodeMerchantNotFound, "merchant %s not found", key.MerchantId)
+	}
+	return insertErr
+}
+
+func (rep *RepositoryService) GetAPIKeyByPrefix(prefix string) (APIKey, error) {
+	var key APIKey
+	rowErr := rep.db.QueryRow(
+		`SELECT id, merchant_id, prefix, hash, created_at, revoked_at FROM api_keys WHERE prefix = $1`, prefix,
+	).Scan(&key.Id, &key.MerchantId, &key.Prefix, &key.Hash, &key.CreatedAt, &key.RevokedAt)
+	if errors.Is(rowErr, sql.ErrNoRows) {
+		return APIKey{}, NewError(ErrNotFound, CodeAPIKeyNotFound, "api key %s not found", prefix)
+	}
+	return key, rowErr
+}
+
+func (rep *RepositoryService) RevokeAPIKey(keyId string) error {
+	result, updateErr := rep.db.Exec(`UPDATE api_keys SET revoked_at = COALESCE(revoked_at, now()) WHERE id = $1`, keyId)
+	if updateErr != nil {
+		return updateErr
+	}
+	affected, affectedErr := result.RowsAffected()
+	if affectedErr != nil {
+		return affectedErr
+	}
+	if affected == 0 {
+		return NewError(ErrNotFound, CodeAPIKeyNotFound, "api key %s not found", keyId)
+	}
+	return nil
+}
+
+// ClaimAccount reads the owner in a second statement: under READ COMMITTED it
+// then sees a row a concurrent claim committed while the insert waited on it.
+func (rep *RepositoryService) ClaimAccount(merchantId, accountId string) (string, error) {
+	_, insertErr := rep.db.Exec(
+		`INSERT INTO merchant_accounts (account_id, merchant_id) VALUES ($1, $2) ON CONFLICT (account_id) DO NOTHING`,
+		accountId, merchantId,
+	)
+	var pqErr *pq.Error
+	if errors.As(insertErr, &pqErr) && pqErr.Code == foreignKeyViolation {
+		return "", NewError(ErrNotFound, CodeMerchantNotFound, "merchant %s not found", merchantId)
+	}
+	if insertErr != nil {
+		return "", insertErr
+	}
+	return rep.GetAccountOwner(accountId)
+}
+
+func (rep *RepositoryService) GetAccountOwner(accountId string) (string, error) {
+	var merchantId string
+	rowErr := rep.db.QueryRow(`SELECT merchant_id FROM merchant_accounts WHERE account_id = $1`, accountId).Scan(&merchantId)
+	if errors.Is(rowErr, sql.ErrNoRows) {
+		return "", NewError(ErrNotFound, CodeAccountNotOwned, "account %s has no owner", accountId)
+	}
+	return merchantId, rowErr
+}
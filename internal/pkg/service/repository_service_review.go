@@ -0,0 +1,168 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/lib/pq"
+)
+
+func (rep *RepositoryService) GetTransactionHistory(merchantId, referenceId string) ([]HistoryEvent, error) {
+	rows, rowsErr := rep.db.Query(
+		`SELECT sequence, merchant_id, reference_id, kind, status, actor, detail, created_at
+		 FROM transaction_history
+		 WHERE merchant_id = $1 AND reference_id = $2
+		 ORDER BY sequence`, merchantId, referenceId)
+	if rowsErr != nil {
+		return nil, rowsErr
+	}
+	defer rows.Close()
+
+	var events []HistoryEvent
+	for rows.Next() {
+		var event HistoryEvent
+		scanErr := rows.Scan(&event.Sequence, &event.MerchantId, &event.ReferenceId, &event.Kind, &event.Status, &event.Actor, &event.Detail, &event.CreatedAt)
+		if scanErr != nil {
+			return nil, scanErr
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (rep *RepositoryService) GetReviewQueue(merchantId string, limit int) ([]Transaction, error) {
+	rows, rowsErr := rep.db.Query(`
+		SELECT 
+			COALESCE(id, '') AS id, 
+			reference_id, 
+			merchant_id, 
+			account_id, 
+			amount, 
+			fee,
+			currency, 
+			status, 
+			operation,
+			COALESCE(message, '') AS message, 
+			gateway_id,
+			COALESCE(risk_decision, '') AS risk_decision,
+			risk_reasons,
+			COALESCE(beneficiary_name, '') AS beneficiary_name,
+			COALESCE(account_currency, '') AS account_currency,
+			COALESCE(account_amount, 0) AS account_amount,
+			COALESCE(fx_rate, 0) AS fx_rate,
+			COALESCE(fx_source, '') AS fx_source,
+			COALESCE(fx_quote_id, '') AS fx_quote_id,
+			authorization_expires_at,
+			COALESCE(captured_amount, 0) AS captured_amount,
+			ts 
+		FROM transactions 
+		WHERE status = $1 AND ($2 = '' OR merchant_id = $2)
+		ORDER BY ts, reference_id
+		LIMIT $3`, StatusReview, merchantId, limit)
+	if rowsErr != nil {
+		return nil, rowsErr
+	}
+	defer rows.Close()
+
+	var queue []Transaction
+	for rows.Next() {
+		var txn Transaction
+		scanErr := rows.Scan(&txn.Id, &txn.ReferenceId, &txn.MerchantId, &txn.AccountId, &txn.Amount, &txn.Fee, &txn.Currency, &txn.Status, &txn.Operation, &txn.Message, &txn.GatewayId,
+			&txn.Risk.Decision, pq.Array(&txn.Risk.Reasons), &txn.BeneficiaryName,
+			&txn.Conversion.Currency, &txn.Conversion.Amount, &txn.Conversion.Rate, &txn.Conversion.Source, &txn.Conversion.QuoteId,
+			&txn.Authorization.ExpiresAt, &txn.Authorization.Captured, &txn.Ts)
+		if scanErr != nil {
+			return nil, scanErr
+		}
+		queue = append(queue, txn)
+	}
+	return queue, rows.Err()
+}
+
+func (rep *RepositoryService) DecideReview(decision *ReviewDecision) (Transaction, error) {
+	tx, beginErr := rep.db.Begin()
+	if beginErr != nil {
+		return Transaction{}, beginErr
+	}
+	defer tx.Rollback()
+
+	// the row lock makes a concurrent decision on the same transaction wait and then conflict
+	var current TransactionStatus
+	lockErr := tx.QueryRow(`SELECT status, COALESCE(merchant_id, '') FROM transactions WHERE reference_id = $1 FOR UPDATE`,
+		decision.ReferenceId).Scan(&current, &decision.MerchantId)
+	if errors.Is(lockErr, sql.ErrNoRows) {
+		return Transaction{}, NewError(ErrNotFound, CodeTransactionNotFound, "transaction %s not found", decision.ReferenceId)
+	}
+	if lockErr != nil {
+		return Transaction{}, lockErr
+	}
+	if current != StatusReview {
+		return Transaction{}, NewError(ErrConflict, CodeNotInReview, "transaction %s is %s, not awaiting review", decision.ReferenceId, current)
+	}
+
+	kind, status, message := HistoryReviewApproved, StatusPending, sql.NullString{}
+	if decision.Outcome == ReviewRejected {
+		kind, status, message = HistoryReviewRejected, StatusFailed, sql.NullString{String: decision.Reason, Valid: true}
+	}
+	insertErr := tx.QueryRow(
+		`INSERT INTO review_decisions (id, merchant_id, reference_id, outcome, reviewer, reason)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 RETURNING decided_at`,
+		decision.Id, decision.MerchantId, decision.ReferenceId, decision.Outcome, decision.Reviewer, decision.Reason,
+	).Scan(&decision.DecidedAt)
+	if insertErr != nil {
+		return Transaction{}, insertErr
+	}
+	// recorded before the update, whose trigger adds the status change after it
+	_, historyErr := tx.Exec(
+		`INSERT INTO transaction_history (merchant_id, reference_id, kind, status, actor, detail)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		decision.MerchantId, decision.ReferenceId, kind, status, decision.Reviewer, decision.Reason,
+	)
+	if historyErr != nil {
+		return Transaction{}, historyErr
+	}
+
+	var txn Transaction
+	updateErr := tx.QueryRow(
+		`UPDATE transactions
+		 SET status = $2, message = COALESCE($3, message)
+		 WHERE reference_id = $1
+		 RETURNING COALESCE(id, ''), reference_id, merchant_id, account_id, amount, fee, currency, status, operation,
+		           COALESCE(message, ''), gateway_id, COALESCE(risk_decision, ''), risk_reasons, COALESCE(beneficiary_name, ''),
+		           COALESCE(account_currency, ''), COALESCE(account_amount, 0), COALESCE(fx_rate, 0), COALESCE(fx_source, ''), COALESCE(fx_quote_id, ''),
+		           authorization_expires_at, COALESCE(captured_amount, 0), ts`,
+		decision.ReferenceId, status, message,
+	).Scan(&txn.Id, &txn.ReferenceId, &txn.MerchantId, &txn.AccountId, &txn.Amount, &txn.Fee, &txn.Currency, &txn.Status, &txn.Operation, &txn.Message, &txn.GatewayId,
+		&txn.Risk.Decision, pq.Array(&txn.Risk.Reasons), &txn.BeneficiaryName,
+		&txn.Conversion.Currency, &txn.Conversion.Amount, &txn.Conversion.Rate, &txn.Conversion.Source, &txn.Conversion.QuoteId,
+		&txn.Authorization.ExpiresAt, &txn.Authorization.Captured, &txn.Ts)
+	if updateErr != nil {
+		return Transaction{}, updateErr
+	}
+	return txn, tx.Commit()
+}
+
+func (rep *RepositoryService) GetReviewDecisions(referenceId string, limit int) ([]ReviewDecision, error) {
+	rows, rowsErr := rep.db.Query(
+		`SELECT id, merchant_id, reference_id, outcome, reviewer, reason, decided_at
+		 FROM review_decisions
+		 WHERE $1 = '' OR reference_id = $1
+		 ORDER BY decided_at DESC, id DESC
+		 LIMIT $2`, referenceId, limit)
+	if rowsErr != nil {
+		return nil, rowsErr
+	}
+	defer rows.Close()
+
+	var decisions []ReviewDecision
+	for rows.Next() {
+		var decision ReviewDecision
+		scanErr := rows.Scan(&decision.Id, &decision.MerchantId, &decision.ReferenceId, &decision.Outcome, &decision.Reviewer, &decision.Reason, &decision.DecidedAt)
+		if scanErr != nil {
+			return nil, scanErr
+		}
+		decisions = append(decisions, decision)
+	}
+	return decisions, rows.Err()
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -21,6 +22,7 @@ func TestSaveTransaction_Success(t *testing.T) {
 
 	txn := &model.Transaction{
 		ReferenceId: "ref123",
+		MerchantId:  "merchant-1",
 		AccountId:   "ACC123",
 		Amount:      decimal.NewFromFloat(100.50),
 		Currency:    "USD",
@@ -29,12 +31,15 @@ func TestSaveTransaction_Success(t *testing.T) {
 		GatewayId:   "rest_gateway",
 	}
 
-	mock.ExpectExec(`INSERT INTO transactions`).
-		WithArgs(txn.ReferenceId, txn.AccountId, txn.Amount, txn.Currency, txn.Status, txn.Operation, txn.GatewayId).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+	createdAt := time.Date(2024, 10, 14, 14, 32, 20, 0, time.UTC)
+	mock.ExpectQuery(`INSERT INTO transactions (.+) RETURNING ts`).
+		WithArgs(txn.ReferenceId, txn.AccountId, txn.Amount, txn.Currency, txn.Status, txn.Operation, txn.GatewayId, txn.MerchantId, "", nil, "", txn.Fee,
+			"", txn.Conversion.Amount, txn.Conversion.Rate, "", "", nil).
+		WillReturnRows(sqlmock.NewRows([]string{"ts"}).AddRow(createdAt))
 
 	saveErr := rep.SaveTransaction(txn)
 	assert.NoError(t, saveErr)
+	assert.Equal(t, createdAt, txn.Ts)
 
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -47,6 +52,7 @@ func TestSaveTransaction_Failure(t *testing.T) {
 	rep := NewRepositoryService(db)
 	txn := &model.Transaction{
 		ReferenceId: "ref123",
+		MerchantId:  "merchant-1",
 		AccountId:   "ACC123",
 		Amount:      decimal.NewFromFloat(100.50),
 		Currency:    "USD",
@@ -55,8 +61,9 @@ func TestSaveTransaction_Failure(t *testing.T) {
 		GatewayId:   "rest_gateway",
 	}
 
-	mock.ExpectExec(`INSERT INTO transactions`).
-		WithArgs(txn.ReferenceId, txn.AccountId, txn.Amount, txn.Currency, txn.Status, txn.Operation, txn.GatewayId).
+	mock.ExpectQuery(`INSERT INTO transactions`).
+		WithArgs(txn.ReferenceId, txn.AccountId, txn.Amount, txn.Currency, txn.Status, txn.Operation, txn.GatewayId, txn.MerchantId, "", nil, "", txn.Fee,
+			"", txn.Conversion.Amount, txn.Conversion.Rate, "", "", nil).
 		WillReturnError(errors.New("failed to insert transaction"))
 
 	saveErr := rep.SaveTransaction(txn)
@@ -75,6 +82,7 @@ func TestGetTransaction_Success(t *testing.T) {
 	txn := &model.Transaction{
 		Id:          "1",
 		ReferenceId: "ref123",
+		MerchantId:  "merchant-1",
 		AccountId:   "ACC123",
 		Amount:      decimal.NewFromFloat(100.50),
 		Currency:    "USD",
@@ -85,17 +93,26 @@ func TestGetTransaction_Success(t *testing.T) {
 		Ts:          time.Now(),
 	}
 
-	rows := sqlmock.NewRows([]string{"id", "reference_id", "account_id", "amount", "currency", "status", "operation", "message", "gateway_id", "ts"}).
-		AddRow(txn.Id, txn.ReferenceId, txn.AccountId, txn.Amount, txn.Currency, txn.Status, txn.Operation, txn.Message, txn.GatewayId, txn.Ts)
+	rows := sqlmock.NewRows([]string{"id", "reference_id", "merchant_id", "account_id", "amount", "fee", "currency", "status", "operation", "message", "gateway_id", "risk_decision", "risk_reasons", "beneficiary_name",
+		"account_currency", "account_amount", "fx_rate", "fx_source", "fx_quote_id", "authorization_expires_at", "captured_amount", "ts"}).
+		AddRow(txn.Id, txn.ReferenceId, txn.MerchantId, txn.AccountId, txn.Amount, txn.Fee, txn.Currency, txn.Status, txn.Operation, txn.Message, txn.GatewayId, "review", "{velocity,\"rapid withdrawal\"}", txn.BeneficiaryName,
+			"EUR", "92.13", "0.9168", "ECB reference rates", "quote-1", nil, "0", txn.Ts)
 
-	mock.ExpectQuery(`SELECT (.+) FROM transactions WHERE reference_id = ?`).
-		WithArgs("ref123").
+	mock.ExpectQuery(`SELECT (.+) FROM transactions WHERE merchant_id = \$1 AND reference_id = \$2`).
+		WithArgs("merchant-1", "ref123").
 		WillReturnRows(rows)
 
-	result, err := rep.GetTransaction("ref123")
+	result, err := rep.GetTransaction("merchant-1", "ref123")
 	assert.NoError(t, err)
 	assert.Equal(t, txn.ReferenceId, result.ReferenceId)
+	assert.Equal(t, txn.MerchantId, result.MerchantId)
 	assert.Equal(t, txn.Status, result.Status)
+	assert.Equal(t, model.RiskAssessment{Decision: model.RiskReview, Reasons: []string{"velocity", "rapid withdrawal"}}, result.Risk)
+	assert.Equal(t, "EUR", result.Conversion.Currency)
+	assert.Equal(t, "92.13", result.Conversion.Amount.String())
+	assert.Equal(t, "0.9168", result.Conversion.Rate.String())
+	assert.Equal(t, "ECB reference rates", result.Conversion.Source)
+	assert.Equal(t, "quote-1", result.Conversion.QuoteId)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -106,11 +123,368 @@ func TestGetTransaction_NotFound(t *testing.T) {
 
 	rep := NewRepositoryService(db)
 
-	mock.ExpectQuery(`SELECT (.+) FROM transactions WHERE reference_id = ?`).
+	mock.ExpectQuery(`SELECT (.+) FROM transactions WHERE merchant_id = \$1 AND reference_id = \$2`).
+		WithArgs("merchant-1", "ref123").
+		WillReturnError(sql.ErrNoRows)
+
+	_, txErr := rep.GetTransaction("merchant-1", "ref123")
+	assert.ErrorIs(t, txErr, model.ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetTransactions_KeysetPage(t *testing.T) {
+	db, mock, mockErr := sqlmock.New()
+	assert.NoError(t, mockErr)
+	defer db.Close()
+
+	rep := NewRepositoryService(db)
+
+	after := &model.TransactionCursor{Ts: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), ReferenceId: "ref-9"}
+	rows := sqlmock.NewRows([]string{"id", "reference_id", "merchant_id", "account_id", "amount", "fee", "currency", "status", "operation", "message", "gateway_id", "risk_decision", "risk_reasons", "beneficiary_name",
+		"account_currency", "account_amount", "fx_rate", "fx_source", "fx_quote_id", "authorization_expires_at", "captured_amount", "ts"}).
+		AddRow("", "ref-8", "merchant-1", "ACC123", "10", "0", "USD", model.StatusPending, model.Deposit, "", "rest", "", nil, "", "", "0", "0", "", "", nil, "0", after.Ts.Add(-time.Minute)).
+		AddRow("", "ref-7", "merchant-1", "ACC123", "10", "0", "USD", model.StatusPending, model.Deposit, "", "rest", "", nil, "", "", "0", "0", "", "", nil, "0", after.Ts.Add(-2*time.Minute))
+
+	mock.ExpectQuery(`WHERE merchant_id = \$1 AND account_id = \$2 AND currency = \$3 AND \(ts, reference_id\) < \(\$4, \$5\) ORDER BY ts DESC, reference_id DESC LIMIT \$6`).
+		WithArgs("merchant-1", "ACC123", "USD", after.Ts, "ref-9", 2).
+		WillReturnRows(rows)
+
+	page, listErr := rep.GetTransactions("merchant-1", "ACC123", model.TransactionFilter{Currency: "USD"}, model.PageRequest{Limit: 1, After: after})
+	assert.NoError(t, listErr)
+	assert.Len(t, page.Transactions, 1)
+	assert.Equal(t, "ref-8", page.Transactions[0].ReferenceId)
+	if assert.NotNil(t, page.Next) {
+		assert.Equal(t, "ref-8", page.Next.ReferenceId)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateTransaction_Success(t *testing.T) {
+	db, mock, mockErr := sqlmock.New()
+	assert.NoError(t, mockErr)
+	defer db.Close()
+
+	rep := NewRepositoryService(db)
+
+	createdAt := time.Date(2024, 10, 14, 14, 32, 20, 0, time.UTC)
+	mock.ExpectQuery(`UPDATE transactions (.+) RETURNING`).
+		WithArgs("provider-1", model.StatusSuccess, "done", "ref123", pq.Array([]string{"PENDING"}), decimal.Zero, decimal.Zero).
+		WillReturnRows(sqlmock.NewRows([]string{"merchant_id", "account_id", "amount", "fee", "currency", "operation", "gateway_id", "risk_decision", "risk_reasons", "beneficiary_name",
+			"account_currency", "account_amount", "fx_rate", "fx_source", "fx_quote_id", "authorization_expires_at", "captured_amount", "ts"}).
+			AddRow("merchant-1", "ACC123", "100.5", "0.30", "USD", model.Deposit, "rest", "allow", nil, "", "", "0", "0", "", "", nil, "0", createdAt))
+
+	txn := &model.Transaction{Id: "provider-1", ReferenceId: "ref123", Status: model.StatusSuccess, Message: "done"}
+	updateErr := rep.UpdateTransaction(txn)
+	assert.NoError(t, updateErr)
+	assert.Equal(t, "merchant-1", txn.MerchantId)
+	assert.Equal(t, "ACC123", txn.AccountId)
+	assert.Equal(t, "0.3", txn.Fee.String(), "the fee settles with the transaction")
+	assert.Equal(t, createdAt, txn.Ts)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateTransaction_NotFound(t *testing.T) {
+	db, mock, mockErr := sqlmock.New()
+	assert.NoError(t, mockErr)
+	defer db.Close()
+
+	rep := NewRepositoryService(db)
+
+	mock.ExpectQuery(`UPDATE transactions`).WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`SELECT status FROM transactions WHERE reference_id = ?`).
+		WithArgs("ref123").
+		WillReturnError(sql.ErrNoRows)
+
+	updateErr := rep.UpdateTransaction(&model.Transaction{ReferenceId: "ref123", Status: model.StatusSuccess})
+	assert.ErrorIs(t, updateErr, model.ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateTransaction_AlreadyFinal(t *testing.T) {
+	db, mock, mockErr := sqlmock.New()
+	assert.NoError(t, mockErr)
+	defer db.Close()
+
+	rep := NewRepositoryService(db)
+
+	mock.ExpectQuery(`UPDATE transactions`).WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`SELECT status FROM transactions WHERE reference_id = ?`).
 		WithArgs("ref123").
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(model.StatusFailed))
+
+	updateErr := rep.UpdateTransaction(&model.Transaction{ReferenceId: "ref123", Status: model.StatusSuccess})
+	assert.ErrorIs(t, updateErr, model.ErrConflict)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClaimAccount_ReturnsExistingOwner(t *testing.T) {
+	db, mock, mockErr := sqlmock.New()
+	assert.NoError(t, mockErr)
+	defer db.Close()
+
+	rep := NewRepositoryService(db)
+
+	mock.ExpectExec(`INSERT INTO merchant_accounts (.+) ON CONFLICT \(account_id\) DO NOTHING`).
+		WithArgs("ACC123", "merchant-2").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT merchant_id FROM merchant_accounts WHERE account_id = \$1`).
+		WithArgs("ACC123").
+		WillReturnRows(sqlmock.NewRows([]string{"merchant_id"}).AddRow("merchant-1"))
+
+	owner, claimErr := rep.ClaimAccount("merchant-2", "ACC123")
+	assert.NoError(t, claimErr)
+	assert.Equal(t, "merchant-1", owner)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUseQuote_UsedByAnotherTransaction(t *testing.T) {
+	db, mock, mockErr := sqlmock.New()
+	assert.NoError(t, mockErr)
+	defer db.Close()
+
+	rep := NewRepositoryService(db)
+
+	mock.ExpectExec(`UPDATE fx_quotes SET used_by = \$3`).
+		WithArgs("quote-1", "merchant-1", "ref-2").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT (.+) FROM fx_quotes`).
+		WithArgs("quote-1", "merchant-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "merchant_id", "from_currency", "to_currency", "rate", "source", "created_at", "expires_at", "used_by"}).
+			AddRow("quote-1", "merchant-1", "USD", "EUR", "0.9168", "ECB reference rates", time.Now(), time.Now(), "ref-1"))
+
+	useErr := rep.UseQuote("merchant-1", "quote-1", "ref-2")
+	assert.ErrorIs(t, useErr, model.ErrConflict)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReleaseQuote_OnlyForItsTransaction(t *testing.T) {
+	db, mock, mockErr := sqlmock.New()
+	assert.NoError(t, mockErr)
+	defer db.Close()
+
+	rep := NewRepositoryService(db)
+
+	mock.ExpectExec(`UPDATE fx_quotes SET used_by = NULL WHERE id = \$1 AND merchant_id = \$2 AND used_by = \$3`).
+		WithArgs("quote-1", "merchant-1", "ref-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, rep.ReleaseQuote("merchant-1", "quote-1", "ref-1"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClaimAuthorization_NotFound(t *testing.T) {
+	db, mock, mockErr := sqlmock.New()
+	assert.NoError(t, mockErr)
+	defer db.Close()
+
+	rep := NewRepositoryService(db)
+
+	mock.ExpectQuery(`UPDATE transactions SET authorization_claimed_until = \$4`).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`SELECT (.+) FROM transactions`).
+		WithArgs("merchant-1", "ref123").
+		WillReturnError(sql.ErrNoRows)
+
+	_, claimErr := rep.ClaimAuthorization("merchant-1", "ref123", time.Now(), time.Now().Add(time.Minute))
+	assert.ErrorIs(t, claimErr, model.ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateAPIKey_UnknownMerchant(t *testing.T) {
+	db, mock, mockErr := sqlmock.New()
+	assert.NoError(t, mockErr)
+	defer db.Close()
+
+	rep := NewRepositoryService(db)
+
+	mock.ExpectQuery(`INSERT INTO api_keys (.+) RETURNING created_at`).
+		WillReturnError(&pq.Error{Code: foreignKeyViolation})
+
+	createErr := rep.CreateAPIKey(&model.APIKey{Id: "key-1", MerchantId: "missing", Prefix: "abc", Hash: []byte{1}})
+	assert.ErrorIs(t, createErr, model.ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetMerchant_DecodesSettings(t *testing.T) {
+	db, mock, mockErr := sqlmock.New()
+	assert.NoError(t, mockErr)
+	defer db.Close()
+
+	rep := NewRepositoryService(db)
+
+	createdAt := time.Date(2024, 10, 14, 14, 32, 20, 0, time.UTC)
+	mock.ExpectQuery(`FROM merchants m LEFT JOIN merchant_settings s ON s.merchant_id = m.id WHERE m.id = \$1`).
+		WithArgs("merchant-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "created_at", "webhook_secret", "enabled_gateways", "routing_rules", "limits", "velocity_limits", "webhook_url"}).
+			AddRow("merchant-1", "acme", createdAt, "whsec_test", "{rest,soap}", `[{"currency":"EUR","gateway_id":"soap"}]`, `[{"currency":"USD","max":"500"}]`,
+				`[{"scope":"account","period":"daily","currency":"USD","max_count":3}]`, "https://acme.example/webhooks"))
+
+	merchant, getErr := rep.GetMerchant("merchant-1")
+	assert.NoError(t, getErr)
+	assert.Equal(t, []string{"rest", "soap"}, merchant.Settings.EnabledGateways)
+	assert.Equal(t, []model.RoutingRule{{Currency: "EUR", GatewayId: "soap"}}, merchant.Settings.RoutingRules)
+	if assert.Len(t, merchant.Settings.Limits, 1) {
+		assert.Equal(t, "500", merchant.Settings.Limits[0].Max.String())
+	}
+	if assert.Len(t, merchant.Settings.VelocityLimits, 1) {
+		assert.Equal(t, model.PeriodDaily, merchant.Settings.VelocityLimits[0].Period)
+		assert.Equal(t, 3, *merchant.Settings.VelocityLimits[0].MaxCount)
+	}
+	assert.Equal(t, "https://acme.example/webhooks", merchant.Settings.WebhookURL)
+	assert.Equal(t, "whsec_test", merchant.WebhookSecret)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeadLetterWebhook_MovesDeliveryInTransaction(t *testing.T) {
+	db, mock, mockErr := sqlmock.New()
+	assert.NoError(t, mockErr)
+	defer db.Close()
+
+	rep := NewRepositoryService(db)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO webhook_dead_letters (.+) SELECT (.+) FROM webhook_deliveries WHERE id = \$1`).
+		WithArgs("evt_1", 10, "webhook endpoint answered 503", 503).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`DELETE FROM webhook_deliveries WHERE id = \$1`).
+		WithArgs("evt_1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	deadErr := rep.DeadLetterWebhook(model.WebhookDelivery{Id: "evt_1", Attempts: 10, LastError: "webhook endpoint answered 503", LastStatusCode: 503})
+	assert.NoError(t, deadErr)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRedeliverWebhook_NotFound(t *testing.T) {
+	db, mock, mockErr := sqlmock.New()
+	assert.NoError(t, mockErr)
+	defer db.Close()
+
+	rep := NewRepositoryService(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`DELETE FROM webhook_dead_letters WHERE id = \$1 AND merchant_id = \$2 RETURNING (.+)`).
+		WithArgs("evt_1", "merchant-2").
 		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	redeliverErr := rep.RedeliverWebhook("merchant-2", "evt_1")
+	assert.ErrorIs(t, redeliverErr, model.ErrNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostEntry_AlreadyBooked(t *testing.T) {
+	db, mock, mockErr := sqlmock.New()
+	assert.NoError(t, mockErr)
+	defer db.Close()
+
+	rep := NewRepositoryService(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO journal_entries (.+) ON CONFLICT \(reference_id, kind\) DO NOTHING RETURNING created_at`).
+		WithArgs("entry-1", "merchant-1", "ref123", model.EntryDeposit, "USD").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}))
+	mock.ExpectRollback()
+
+	postErr := rep.PostEntry(&model.JournalEntry{
+		Id: "entry-1", MerchantId: "merchant-1", ReferenceId: "ref123", Kind: model.EntryDeposit, Currency: "USD",
+		Postings: []model.Posting{
+			{Account: model.LedgerAccountKey{Type: model.LedgerGateway, Owner: "rest_gateway"}, Direction: model.Debit, Amount: decimal.NewFromInt(10)},
+			{Account: model.LedgerAccountKey{Type: model.LedgerCustomer, Owner: "ACC123"}, Direction: model.Credit, Amount: decimal.NewFromInt(10)},
+		},
+	})
+	assert.NoError(t, postErr, "booking a reference twice is a no-op")
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPlaceHold_InsufficientFunds(t *testing.T) {
+	db, mock, mockErr := sqlmock.New()
+	assert.NoError(t, mockErr)
+	defer db.Close()
+
+	rep := NewRepositoryService(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO ledger_accounts (.+) RETURNING id, balance - held`).
+		WithArgs("merchant-1", model.LedgerCustomer, "ACC123", "USD").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "available"}).AddRow(1, "5"))
+	mock.ExpectQuery(`INSERT INTO funds_holds (.+) ON CONFLICT \(reference_id\) DO NOTHING RETURNING created_at`).
+		WithArgs("hold-1", "merchant-1", 1, "ref123", decimal.NewFromInt(10), model.HoldActive).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+	mock.ExpectRollback()
+
+	holdErr := rep.PlaceHold(&model.FundsHold{
+		Id: "hold-1", MerchantId: "merchant-1", AccountId: "ACC123", ReferenceId: "ref123", Currency: "USD", Amount: decimal.NewFromInt(10),
+	})
+	var domainErr *model.Error
+	assert.ErrorAs(t, holdErr, &domainErr)
+	assert.Equal(t, model.CodeInsufficientFunds, domainErr.Code)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDecideReview_NotInReview(t *testing.T) {
+	db, mock, mockErr := sqlmock.New()
+	assert.NoError(t, mockErr)
+	defer db.Close()
+
+	rep := NewRepositoryService(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT status, COALESCE\(merchant_id, ''\) FROM transactions WHERE reference_id = \$1 FOR UPDATE`).
+		WithArgs("ref123").
+		WillReturnRows(sqlmock.NewRows([]string{"status", "merchant_id"}).AddRow(model.StatusPending, "merchant-1"))
+	mock.ExpectRollback()
+
+	_, decideErr := rep.DecideReview(&model.ReviewDecision{Id: "decision-1", ReferenceId: "ref123", Outcome: model.ReviewApproved, Reviewer: "alice"})
+	assert.ErrorIs(t, decideErr, model.ErrConflict)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLockUsage_LocksEveryKey(t *testing.T) {
+	db, mock, mockErr := sqlmock.New()
+	assert.NoError(t, mockErr)
+	defer db.Close()
+
+	rep := NewRepositoryService(db)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock\(\$1, hashtext\(\$2\)\)`).
+		WithArgs(usageLockClass, "merchant-1/account/ACC123").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock\(\$1, hashtext\(\$2\)\)`).
+		WithArgs(usageLockClass, "merchant-1/gateway/rest").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	lockErr := rep.LockUsage([]string{"merchant-1/account/ACC123", "merchant-1/gateway/rest"}, func(store UsageStore) error {
+		return nil
+	})
+	assert.NoError(t, lockErr)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLockUsage_RollsBackWhenRejected(t *testing.T) {
+	db, mock, mockErr := sqlmock.New()
+	assert.NoError(t, mockErr)
+	defer db.Close()
+
+	rep := NewRepositoryService(db)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock\(\$1, hashtext\(\$2\)\)`).
+		WithArgs(usageLockClass, "merchant-1/account/ACC123").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
 
-	_, txErr := rep.GetTransaction("ref123")
-	assert.NoError(t, txErr)
+	rejected := model.NewError(model.ErrUnprocessable, model.CodeVelocityExceeded, "over the cap")
+	lockErr := rep.LockUsage([]string{"merchant-1/account/ACC123"}, func(store UsageStore) error {
+		return rejected
+	})
+	assert.ErrorIs(t, lockErr, model.ErrUnprocessable)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"time"
+)
+
+func (rep *RepositoryService) EnqueueWebhook(delivery *WebhookDelivery) error {
+	_, insertErr := rep.db.Exec(
+		`INSERT INTO webhook_deliveries (id, merchant_id, reference_id, event_type, payload)
+		 SELECT $1, $2, $3, $4, $5
+		 WHERE NOT EXISTS (SELECT 1 FROM webhook_dead_letters WHERE reference_id = $3 AND event_type = $4)
+		 ON CONFLICT (reference_id, event_type) DO NOTHING`,
+		delivery.Id, delivery.MerchantId, delivery.ReferenceId, delivery.EventType, string(delivery.Payload),
+	)
+	return insertErr
+}
+
+func (rep *RepositoryService) ClaimWebhooks(now, leaseUntil time.Time, limit int) ([]WebhookDelivery, error) {
+	rows, claimErr := rep.db.Query(
+		`UPDATE webhook_deliveries
+		 SET next_attempt_at = $2
+		 WHERE id IN (
+		     SELECT id FROM webhook_deliveries
+		     WHERE delivered_at IS NULL AND next_attempt_at <= $1
+		     ORDER BY next_attempt_at
+		     LIMIT $3
+		     FOR UPDATE SKIP LOCKED)
+		 RETURNING id, merchant_id, reference_id, event_type, payload, attempts, created_at`,
+		now, leaseUntil, limit,
+	)
+	if claimErr != nil {
+		return nil, claimErr
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		var delivery WebhookDelivery
+		var payload string
+		scanErr := rows.Scan(&delivery.Id, &delivery.MerchantId, &delivery.ReferenceId, &delivery.EventType, &payload, &delivery.Attempts, &delivery.CreatedAt)
+		if scanErr != nil {
+			return nil, scanErr
+		}
+		delivery.Payload = []byte(payload)
+		delivery.NextAttemptAt = leaseUntil
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func (rep *RepositoryService) RecordWebhookAttempt(delivery WebhookDelivery) error {
+	_, updateErr := rep.db.Exec(
+		`UPDATE webhook_deliveries
+		 SET attempts = $2, next_attempt_at = $3, last_error = NULLIF($4, ''), last_status_code = NULLIF($5, 0), delivered_at = $6
+		 WHERE id = $1`,
+		delivery.Id, delivery.Attempts, delivery.NextAttemptAt, delivery.LastError, delivery.LastStatusCode, delivery.DeliveredAt,
+	)
+	return updateErr
+}
+
+func (rep *RepositoryService) DeadLetterWebhook(delivery WebhookDelivery) error {
+	tx, beginErr := rep.db.Begin()
+	if beginErr != nil {
+		return beginErr
+	}
+	defer tx.Rollback()
+
+	_, moveErr := tx.Exec(
+		`INSERT INTO webhook_dead_letters (id, merchant_id, reference_id, event_type, payload, attempts, last_error, last_status_code, created_at)
+		 SELECT id, merchant_id, reference_id, event_type, payload, $2, NULLIF($3, ''), NULLIF($4, 0), created_at
+		 FROM webhook_deliveries WHERE id = $1`,
+		delivery.Id, delivery.Attempts, delivery.LastError, delivery.LastStatusCode,
+	)
+	if moveErr != nil {
+		return moveErr
+	}
+	if _, deleteErr := tx.Exec(`DELETE FROM webhook_deliveries WHERE id = $1`, delivery.Id); deleteErr != nil {
+		return deleteErr
+	}
+	return tx.Commit()
+}
+
+func (rep *RepositoryService) GetDeadLetters(merchantId string) ([]WebhookDelivery, error) {
+	rows, rowsErr := rep.db.Query(
+		`SELECT id, merchant_id, reference_id, event_type, payload, attempts,
+		        COALESCE(last_error, ''), COALESCE(last_status_code, 0), created_at, failed_at
+		 FROM webhook_dead_letters
+		 WHERE merchant_id = $1
+		 ORDER BY failed_at DESC, id DESC
+		 LIMIT $2`,
+		merchantId, MaxPageSize,
+	)
+	if rowsErr != nil {
+		return nil, rowsErr
+	}
+	defer rows.Close()
+
+	var deadLetters []WebhookDelivery
+	for rows.Next() {
+		var delivery WebhookDelivery
+		var payload string
+		var failedAt time.Time
+		scanErr := rows.Scan(&delivery.Id, &delivery.MerchantId, &delivery.ReferenceId, &delivery.EventType, &payload, &delivery.Attempts,
+			&delivery.LastError, &delivery.LastStatusCode, &delivery.CreatedAt, &failedAt)
+		if scanErr != nil {
+			return nil, scanErr
+		}
+		delivery.Payload = []byte(payload)
+		delivery.FailedAt = &failedAt
+		deadLetters = append(deadLetters, delivery)
+	}
+	return deadLetters, rows.Err()
+}
+
+func (rep *RepositoryService) RedeliverWebhook(merchantId, deliveryId string) error {
+	tx, beginErr := rep.db.Begin()
+	if beginErr != nil {
+		return beginErr
+	}
+	defer tx.Rollback()
+
+	var delivery WebhookDelivery
+	var payload string
+	moveErr := tx.QueryRow(
+		`DELETE FROM webhook_dead_letters WHERE id = $1 AND merchant_id = $2
+		 RETURNING id, merchant_id, reference_id, event_type, payload, created_at`,
+		deliveryId, merchantId,
+	).Scan(&delivery.Id, &delivery.MerchantId, &delivery.ReferenceId, &delivery.EventType, &payload, &delivery.CreatedAt)
+	if errors.Is(moveErr, sql.ErrNoRows) {
+		return NewError(ErrNotFound, CodeDeliveryNotFound, "dead letter %s not found", deliveryId)
+	}
+	if moveErr != nil {
+		return moveErr
+	}
+
+	_, insertErr := tx.Exec(
+		`INSERT INTO webhook_deliveries (id, merchant_id, reference_id, event_type, payload, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		delivery.Id, delivery.MerchantId, delivery.ReferenceId, delivery.EventType, payload, delivery.CreatedAt,
+	)
+	if insertErr != nil {
+		return insertErr
+	}
+	return tx.Commit()
+}
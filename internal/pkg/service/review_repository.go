@@ -0,0 +1,27 @@
+package service
+
+import . "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+
+// ReviewRepository is the queue of transactions held in StatusReview and the
+// audit trail of their review decisions, implemented by RepositoryService and
+// MemoryRepositoryService with the same semantics. Unlike the merchant API it
+// spans merchants: reviewers work for the operator.
+type ReviewRepository interface {
+	// GetReviewQueue returns up to limit transactions awaiting review, oldest
+	// first, of merchantId or of every merchant when it is empty.
+	GetReviewQueue(merchantId string, limit int) ([]Transaction, error)
+	// DecideReview moves the transaction of decision out of review, to PENDING
+	// when it is approved and to FAILED with the reason as message when it is
+	// rejected. It stores decision in the audit trail and the transaction's
+	// history and returns the updated transaction. Unknown reference ids return
+	// model.ErrNotFound, transactions not in review model.ErrConflict.
+	DecideReview(decision *ReviewDecision) (Transaction, error)
+	// GetReviewDecisions returns the newest limit decisions, of one
+	// transaction when referenceId is set.
+	GetReviewDecisions(referenceId string, limit int) ([]ReviewDecision, error)
+}
+
+var (
+	_ ReviewRepository = (*RepositoryService)(nil)
+	_ ReviewRepository = (*MemoryRepositoryService)(nil)
+)
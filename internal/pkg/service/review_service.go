@@ -0,0 +1,41 @@
+package service
+
+import (
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/google/uuid"
+)
+
+// ReviewService is the manual review workflow of transactions held by risk
+// screening. Dispatching approved transactions is up to the caller, which
+// knows the gateways.
+type ReviewService struct {
+	rep ReviewRepository
+}
+
+func NewReviewService(rep ReviewRepository) *ReviewService {
+	return &ReviewService{rep: rep}
+}
+
+// Queue returns up to limit transactions awaiting review, oldest first, of
+// merchantId or of every merchant when it is empty.
+func (rs *ReviewService) Queue(merchantId string, limit int) ([]Transaction, error) {
+	return rs.rep.GetReviewQueue(merchantId, limit)
+}
+
+// Decide records reviewer's outcome for the transaction referenceId and
+// returns the transaction, PENDING when approved and FAILED when rejected.
+func (rs *ReviewService) Decide(referenceId string, outcome ReviewOutcome, reviewer, reason string) (Transaction, error) {
+	return rs.rep.DecideReview(&ReviewDecision{
+		Id:          uuid.NewString(),
+		ReferenceId: referenceId,
+		Outcome:     outcome,
+		Reviewer:    reviewer,
+		Reason:      reason,
+	})
+}
+
+// Decisions returns the newest limit entries of the audit trail, of one
+// transaction when referenceId is set.
+func (rs *ReviewService) Decisions(referenceId string, limit int) ([]ReviewDecision, error) {
+	return rs.rep.GetReviewDecisions(referenceId, limit)
+}
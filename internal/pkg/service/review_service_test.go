@@ -0,0 +1,141 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type reviewTestRepository interface {
+	TransactionRepository
+	ReviewRepository
+	MerchantRepository
+}
+
+// runReviewRepositoryContract checks the behaviour every ReviewRepository
+// must share, driven through ReviewService.
+func runReviewRepositoryContract(t *testing.T, newEmptyRepository func(t *testing.T) reviewTestRepository) {
+	newReviews := func(t *testing.T) (*ReviewService, reviewTestRepository) {
+		rep := newEmptyRepository(t)
+		for _, id := range []string{merchantId, otherMerchantId} {
+			require.NoError(t, rep.CreateMerchant(&model.Merchant{Id: id, Name: id}))
+		}
+		return NewReviewService(rep), rep
+	}
+	held := func(t *testing.T, rep reviewTestRepository, referenceId, merchant string) {
+		t.Helper()
+
+		txn := &model.Transaction{
+			ReferenceId: referenceId,
+			MerchantId:  merchant,
+			AccountId:   "ACC123",
+			GatewayId:   "rest",
+			Amount:      decimal.RequireFromString("100.5"),
+			Currency:    "USD",
+			Status:      model.StatusReview,
+			Operation:   model.Withdraw,
+			Risk:        model.RiskAssessment{Decision: model.RiskReview, Reasons: []string{"rapid withdrawal"}},
+		}
+		require.NoError(t, rep.SaveTransaction(txn))
+	}
+
+	t.Run("queue lists transactions awaiting review oldest first", func(t *testing.T) {
+		reviews, rep := newReviews(t)
+		held(t, rep, "ref-1", merchantId)
+		held(t, rep, "ref-2", otherMerchantId)
+		held(t, rep, "ref-3", merchantId)
+		pending := &model.Transaction{ReferenceId: "ref-4", MerchantId: merchantId, AccountId: "ACC123", GatewayId: "rest",
+			Amount: decimal.RequireFromString("1"), Currency: "USD", Status: model.StatusPending, Operation: model.Deposit}
+		require.NoError(t, rep.SaveTransaction(pending))
+
+		queue, queueErr := reviews.Queue("", 10)
+		require.NoError(t, queueErr)
+		require.Len(t, queue, 3)
+		assert.Equal(t, []string{"ref-1", "ref-2", "ref-3"}, []string{queue[0].ReferenceId, queue[1].ReferenceId, queue[2].ReferenceId})
+		assert.Equal(t, []string{"rapid withdrawal"}, queue[0].Risk.Reasons)
+
+		queue, queueErr = reviews.Queue(merchantId, 1)
+		require.NoError(t, queueErr)
+		require.Len(t, queue, 1)
+		assert.Equal(t, "ref-1", queue[0].ReferenceId)
+	})
+
+	t.Run("decisions move transactions out of review once", func(t *testing.T) {
+		reviews, rep := newReviews(t)
+		held(t, rep, "ref-1", merchantId)
+		held(t, rep, "ref-2", merchantId)
+
+		approved, approveErr := reviews.Decide("ref-1", model.ReviewApproved, "alice", "")
+		require.NoError(t, approveErr)
+		assert.Equal(t, model.StatusPending, approved.Status)
+		assert.Equal(t, merchantId, approved.MerchantId)
+		assert.Equal(t, "ACC123", approved.AccountId)
+
+		rejected, rejectErr := reviews.Decide("ref-2", model.ReviewRejected, "bob", "card testing pattern")
+		require.NoError(t, rejectErr)
+		assert.Equal(t, model.StatusFailed, rejected.Status)
+		assert.Equal(t, "card testing pattern", rejected.Message)
+
+		_, againErr := reviews.Decide("ref-1", model.ReviewRejected, "bob", "too late")
+		assert.ErrorIs(t, againErr, model.ErrConflict)
+		_, missingErr := reviews.Decide("missing", model.ReviewApproved, "alice", "")
+		assert.ErrorIs(t, missingErr, model.ErrNotFound)
+
+		queue, _ := reviews.Queue("", 10)
+		assert.Empty(t, queue)
+
+		decisions, decisionsErr := reviews.Decisions("", 10)
+		require.NoError(t, decisionsErr)
+		require.Len(t, decisions, 2)
+		assert.Equal(t, "ref-2", decisions[0].ReferenceId, "newest first")
+		assert.Equal(t, model.ReviewRejected, decisions[0].Outcome)
+		assert.Equal(t, "bob", decisions[0].Reviewer)
+		assert.Equal(t, merchantId, decisions[0].MerchantId)
+		assert.False(t, decisions[0].DecidedAt.IsZero())
+
+		decisions, _ = reviews.Decisions("ref-1", 10)
+		require.Len(t, decisions, 1)
+		assert.Equal(t, "alice", decisions[0].Reviewer)
+	})
+
+	t.Run("history records creation, decisions and status changes", func(t *testing.T) {
+		reviews, rep := newReviews(t)
+		held(t, rep, "ref-1", merchantId)
+		_, approveErr := reviews.Decide("ref-1", model.ReviewApproved, "alice", "known customer")
+		require.NoError(t, approveErr)
+		require.NoError(t, rep.UpdateTransaction(&model.Transaction{Id: "provider-1", ReferenceId: "ref-1", Status: model.StatusSuccess, Message: "done"}))
+
+		history, historyErr := rep.GetTransactionHistory(merchantId, "ref-1")
+		require.NoError(t, historyErr)
+		var kinds []model.HistoryEventKind
+		for _, event := range history {
+			kinds = append(kinds, event.Kind)
+		}
+		require.Equal(t, []model.HistoryEventKind{model.HistoryCreated, model.HistoryReviewApproved, model.HistoryStatusChanged, model.HistoryStatusChanged}, kinds)
+		assert.Equal(t, model.StatusReview, history[0].Status)
+		assert.Equal(t, "rapid withdrawal", history[0].Detail)
+		assert.Equal(t, "alice", history[1].Actor)
+		assert.Equal(t, "known customer", history[1].Detail)
+		assert.Equal(t, model.StatusPending, history[2].Status)
+		assert.Equal(t, model.StatusSuccess, history[3].Status)
+		assert.Equal(t, "done", history[3].Detail)
+
+		others, _ := rep.GetTransactionHistory(otherMerchantId, "ref-1")
+		assert.Empty(t, others)
+	})
+}
+
+func TestMemoryReviewRepository_Contract(t *testing.T) {
+	runReviewRepositoryContract(t, func(t *testing.T) reviewTestRepository {
+		return NewMemoryRepositoryService()
+	})
+}
+
+func TestPostgresReviewRepository_Contract(t *testing.T) {
+	runReviewRepositoryContract(t, func(t *testing.T) reviewTestRepository {
+		return NewRepositoryService(migratedPostgresTestDB(t))
+	})
+}
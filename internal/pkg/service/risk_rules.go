@@ -0,0 +1,153 @@
+package service
+
+import (
+	"fmt"
+	"github.com/dinowar/gateway-service/internal/pkg/config"
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+// DefaultRiskRules builds the rules enabled in cfg. Blocklisted accounts are
+// denied, the other rules send transactions to review.
+func DefaultRiskRules(rep TransactionRepository, cfg config.RiskConfig) []RiskRule {
+	var rules []RiskRule
+	if len(cfg.BlockedAccounts) > 0 {
+		rules = append(rules, NewBlocklistRule(cfg.BlockedAccounts))
+	}
+	if cfg.VelocityMaxAttempts > 0 && cfg.VelocityWindow > 0 {
+		rules = append(rules, NewVelocityRule(rep, cfg.VelocityMaxAttempts, time.Duration(cfg.VelocityWindow)*time.Minute))
+	}
+	if cfg.AnomalyFactor > 0 && cfg.AnomalyHistoryDays > 0 {
+		rules = append(rules, NewAmountAnomalyRule(rep, decimal.NewFromInt(int64(cfg.AnomalyFactor)), cfg.AnomalyMinHistory,
+			time.Duration(cfg.AnomalyHistoryDays)*24*time.Hour))
+	}
+	if cfg.RapidWithdrawalWindow > 0 {
+		rules = append(rules, NewRapidWithdrawalRule(rep, time.Duration(cfg.RapidWithdrawalWindow)*time.Minute))
+	}
+	return rules
+}
+
+type blocklistRule struct {
+	accounts map[string]bool
+}
+
+// NewBlocklistRule denies every transaction of the given accounts.
+func NewBlocklistRule(accountIds []string) RiskRule {
+	rule := &blocklistRule{accounts: make(map[string]bool, len(accountIds))}
+	for _, accountId := range accountIds {
+		rule.accounts[accountId] = true
+	}
+	return rule
+}
+
+func (rule *blocklistRule) Evaluate(txn Transaction, _ time.Time) (RiskFinding, error) {
+	if rule.accounts[txn.AccountId] {
+		return RiskFinding{Decision: RiskDeny, Reason: fmt.Sprintf("account %s is blocklisted", txn.AccountId)}, nil
+	}
+	return RiskFinding{Decision: RiskAllow}, nil
+}
+
+type velocityRule struct {
+	rep         TransactionRepository
+	maxAttempts int
+	window      time.Duration
+}
+
+// NewVelocityRule reviews the attempts of an account beyond maxAttempts
+// within window. Failed attempts count too.
+func NewVelocityRule(rep TransactionRepository, maxAttempts int, window time.Duration) RiskRule {
+	return &velocityRule{rep: rep, maxAttempts: maxAttempts, window: window}
+}
+
+func (rule *velocityRule) Evaluate(txn Transaction, now time.Time) (RiskFinding, error) {
+	usage, usageErr := rule.rep.GetUsage(txn.MerchantId, UsageQuery{
+		AccountId:     txn.AccountId,
+		Since:         now.Add(-rule.window),
+		IncludeFailed: true,
+	})
+	if usageErr != nil {
+		return RiskFinding{}, usageErr
+	}
+	if attempts := usage.Count + 1; attempts > rule.maxAttempts {
+		return RiskFinding{Decision: RiskReview, Reason: fmt.Sprintf("account %s made %d attempts in %s",
+			txn.AccountId, attempts, minutes(rule.window))}, nil
+	}
+	return RiskFinding{Decision: RiskAllow}, nil
+}
+
+type amountAnomalyRule struct {
+	rep        TransactionRepository
+	factor     decimal.Decimal
+	minHistory int
+	history    time.Duration
+}
+
+// NewAmountAnomalyRule reviews amounts above factor times the account's
+// average for the operation and currency over history, both in the account
+// currency. Accounts with fewer than minHistory such transactions have no
+// average yet.
+func NewAmountAnomalyRule(rep TransactionRepository, factor decimal.Decimal, minHistory int, history time.Duration) RiskRule {
+	return &amountAnomalyRule{rep: rep, factor: factor, minHistory: minHistory, history: history}
+}
+
+func (rule *amountAnomalyRule) Evaluate(txn Transaction, now time.Time) (RiskFinding, error) {
+	amount, currency := txn.AccountAmount()
+	usage, usageErr := rule.rep.GetUsage(txn.MerchantId, UsageQuery{
+		AccountId: txn.AccountId,
+		Operation: txn.Operation,
+		Currency:  currency,
+		Since:     now.Add(-rule.history),
+	})
+	if usageErr != nil {
+		return RiskFinding{}, usageErr
+	}
+	if usage.Count == 0 || usage.Count < rule.minHistory {
+		return RiskFinding{Decision: RiskAllow}, nil
+	}
+	average := usage.Amount.Div(decimal.NewFromInt(int64(usage.Count)))
+	if amount.GreaterThan(average.Mul(rule.factor)) {
+		return RiskFinding{Decision: RiskReview, Reason: fmt.Sprintf("amount %s %s is more than %s times the account's average %s of %s",
+			amount, currency, rule.factor, limitedOperation(txn.Operation), average.StringFixed(2))}, nil
+	}
+	return RiskFinding{Decision: RiskAllow}, nil
+}
+
+type rapidWithdrawalRule struct {
+	rep    TransactionRepository
+	window time.Duration
+}
+
+// NewRapidWithdrawalRule reviews withdrawals from an account that received a
+// deposit in the same currency within window.
+func NewRapidWithdrawalRule(rep TransactionRepository, window time.Duration) RiskRule {
+	return &rapidWithdrawalRule{rep: rep, window: window}
+}
+
+func (rule *rapidWithdrawalRule) Evaluate(txn Transaction, now time.Time) (RiskFinding, error) {
+	if txn.Operation != Withdraw {
+		return RiskFinding{Decision: RiskAllow}, nil
+	}
+	_, currency := txn.AccountAmount()
+	usage, usageErr := rule.rep.GetUsage(txn.MerchantId, UsageQuery{
+		AccountId: txn.AccountId,
+		Operation: Deposit,
+		Currency:  currency,
+		Since:     now.Add(-rule.window),
+	})
+	if usageErr != nil {
+		return RiskFinding{}, usageErr
+	}
+	if usage.Count > 0 {
+		return RiskFinding{Decision: RiskReview, Reason: fmt.Sprintf("withdrawal within %s of a deposit to account %s",
+			minutes(rule.window), txn.AccountId)}, nil
+	}
+	return RiskFinding{Decision: RiskAllow}, nil
+}
+
+func minutes(window time.Duration) string {
+	if window == time.Minute {
+		return "1 minute"
+	}
+	return fmt.Sprintf("%d minutes", int(window.Minutes()))
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"time"
+)
+
+// RiskRule is one check of the risk engine. Rules return RiskAllow when they
+// have nothing against txn, and a reason for anything else.
+type RiskRule interface {
+	Evaluate(txn Transaction, now time.Time) (RiskFinding, error)
+}
+
+// RiskRuleFunc adapts a function to RiskRule.
+type RiskRuleFunc func(txn Transaction, now time.Time) (RiskFinding, error)
+
+func (f RiskRuleFunc) Evaluate(txn Transaction, now time.Time) (RiskFinding, error) {
+	return f(txn, now)
+}
+
+// RiskService screens transactions before they are dispatched. Every rule is
+// evaluated, so the assessment lists all reasons, and the most severe finding
+// decides.
+type RiskService struct {
+	rules []RiskRule
+	now   func() time.Time
+}
+
+func NewRiskService(rules ...RiskRule) *RiskService {
+	return &RiskService{rules: rules, now: time.Now}
+}
+
+// RequiresBeneficiary reports whether a rule screens beneficiary names, see
+// NewSanctionsRule. Withdrawals without one would slip past it.
+func (rs *RiskService) RequiresBeneficiary() bool {
+	for _, rule := range rs.rules {
+		if _, screens := rule.(*sanctionsRule); screens {
+			return true
+		}
+	}
+	return false
+}
+
+// Assess returns RiskAllow without reasons when no rule objects to txn.
+func (rs *RiskService) Assess(txn Transaction) (RiskAssessment, error) {
+	assessment := RiskAssessment{Decision: RiskAllow}
+	now := rs.now()
+	for _, rule := range rs.rules {
+		finding, ruleErr := rule.Evaluate(txn, now)
+		if ruleErr != nil {
+			return RiskAssessment{}, ruleErr
+		}
+		if !finding.Decision.Outweighs(RiskAllow) {
+			continue
+		}
+		assessment.Reasons = append(assessment.Reasons, finding.Reason)
+		if finding.Decision.Outweighs(assessment.Decision) {
+			assessment.Decision = finding.Decision
+		}
+	}
+	return assessment, nil
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dinowar/gateway-service/internal/pkg/config"
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seedTransactions stores transactions of ACC123 created at now less each age.
+func seedTransactions(t *testing.T, rep *MemoryRepositoryService, now time.Time, operation model.Operation, status model.TransactionStatus, amount string, ages ...time.Duration) {
+	t.Helper()
+
+	for _, age := range ages {
+		rep.now = func() time.Time { return now.Add(-age) }
+		txn := limitTestTxn(fmt.Sprintf("seed-%s-%s", operation, age), "ACC123", "rest", operation, amount)
+		txn.Status = status
+		require.NoError(t, rep.SaveTransaction(&txn))
+	}
+	rep.now = func() time.Time { return now }
+}
+
+func TestRiskService_MostSevereFindingDecides(t *testing.T) {
+	rule := func(decision model.RiskDecision, reason string) RiskRule {
+		return RiskRuleFunc(func(model.Transaction, time.Time) (model.RiskFinding, error) {
+			return model.RiskFinding{Decision: decision, Reason: reason}, nil
+		})
+	}
+	txn := limitTestTxn("ref-1", "ACC123", "rest", model.Deposit, "10")
+
+	assessment, assessErr := NewRiskService().Assess(txn)
+	require.NoError(t, assessErr)
+	assert.Equal(t, model.RiskAssessment{Decision: model.RiskAllow}, assessment)
+
+	assessment, assessErr = NewRiskService(rule(model.RiskReview, "first"), rule(model.RiskAllow, ""), rule(model.RiskDeny, "second"), rule(model.RiskReview, "third")).Assess(txn)
+	require.NoError(t, assessErr)
+	assert.Equal(t, model.RiskAssessment{Decision: model.RiskDeny, Reasons: []string{"first", "second", "third"}}, assessment)
+
+	failing := RiskRuleFunc(func(model.Transaction, time.Time) (model.RiskFinding, error) {
+		return model.RiskFinding{}, assert.AnError
+	})
+	_, assessErr = NewRiskService(rule(model.RiskReview, "first"), failing).Assess(txn)
+	assert.ErrorIs(t, assessErr, assert.AnError)
+}
+
+func TestRiskRules(t *testing.T) {
+	now := time.Date(2024, 10, 14, 12, 0, 0, 0, time.UTC)
+	deposit := limitTestTxn("ref-new", "ACC123", "rest", model.Deposit, "100")
+	withdrawal := limitTestTxn("ref-new", "ACC123", "rest", model.Withdraw, "100")
+
+	t.Run("blocklist", func(t *testing.T) {
+		rule := NewBlocklistRule([]string{"ACC666"})
+		finding, _ := rule.Evaluate(deposit, now)
+		assert.Equal(t, model.RiskAllow, finding.Decision)
+
+		blocked := deposit
+		blocked.AccountId = "ACC666"
+		finding, _ = rule.Evaluate(blocked, now)
+		assert.Equal(t, model.RiskFinding{Decision: model.RiskDeny, Reason: "account ACC666 is blocklisted"}, finding)
+	})
+
+	t.Run("velocity counts failed attempts in the window", func(t *testing.T) {
+		_, rep := newLimitTestService(t, now)
+		rule := NewVelocityRule(rep, 3, 10*time.Minute)
+		seedTransactions(t, rep, now, model.Deposit, model.StatusFailed, "5", time.Minute, 2*time.Minute)
+		seedTransactions(t, rep, now, model.Withdraw, model.StatusPending, "5", 20*time.Minute)
+
+		finding, findErr := rule.Evaluate(deposit, now)
+		require.NoError(t, findErr)
+		assert.Equal(t, model.RiskAllow, finding.Decision, "the third attempt is allowed")
+
+		seedTransactions(t, rep, now, model.Withdraw, model.StatusSuccess, "5", 3*time.Minute)
+		finding, findErr = rule.Evaluate(deposit, now)
+		require.NoError(t, findErr)
+		assert.Equal(t, model.RiskFinding{Decision: model.RiskReview, Reason: "account ACC123 made 4 attempts in 10 minutes"}, finding)
+	})
+
+	t.Run("amount anomaly", func(t *testing.T) {
+		_, rep := newLimitTestService(t, now)
+		rule := NewAmountAnomalyRule(rep, decimal.NewFromInt(4), 3, 30*24*time.Hour)
+		seedTransactions(t, rep, now, model.Deposit, model.StatusSuccess, "10", time.Hour, 2*time.Hour)
+
+		finding, _ := rule.Evaluate(deposit, now)
+		assert.Equal(t, model.RiskAllow, finding.Decision, "two deposits are too short a history")
+
+		seedTransactions(t, rep, now, model.Deposit, model.StatusSuccess, "40", 3*time.Hour)
+		seedTransactions(t, rep, now, model.Deposit, model.StatusSuccess, "1000", 60*24*time.Hour)
+		seedTransactions(t, rep, now, model.Deposit, model.StatusFailed, "1000", 4*time.Hour)
+		finding, findErr := rule.Evaluate(deposit, now)
+		require.NoError(t, findErr)
+		assert.Equal(t, model.RiskFinding{Decision: model.RiskReview, Reason: "amount 100 USD is more than 4 times the account's average deposit of 20.00"}, finding)
+
+		finding, _ = rule.Evaluate(limitTestTxn("ref-new", "ACC123", "rest", model.Deposit, "80"), now)
+		assert.Equal(t, model.RiskAllow, finding.Decision, "4 times the average is not above it")
+		finding, _ = rule.Evaluate(withdrawal, now)
+		assert.Equal(t, model.RiskAllow, finding.Decision, "withdrawals have their own average")
+	})
+
+	t.Run("rapid withdrawal", func(t *testing.T) {
+		_, rep := newLimitTestService(t, now)
+		rule := NewRapidWithdrawalRule(rep, 30*time.Minute)
+		seedTransactions(t, rep, now, model.Deposit, model.StatusPending, "10", 45*time.Minute)
+
+		finding, _ := rule.Evaluate(withdrawal, now)
+		assert.Equal(t, model.RiskAllow, finding.Decision)
+
+		seedTransactions(t, rep, now, model.Deposit, model.StatusSuccess, "10", 5*time.Minute)
+		finding, findErr := rule.Evaluate(withdrawal, now)
+		require.NoError(t, findErr)
+		assert.Equal(t, model.RiskFinding{Decision: model.RiskReview, Reason: "withdrawal within 30 minutes of a deposit to account ACC123"}, finding)
+		finding, _ = rule.Evaluate(deposit, now)
+		assert.Equal(t, model.RiskAllow, finding.Decision, "only withdrawals are checked")
+	})
+}
+
+func TestDefaultRiskRules_SkipDisabledRules(t *testing.T) {
+	rep := NewMemoryRepositoryService()
+	assert.Empty(t, DefaultRiskRules(rep, config.RiskConfig{}))
+	assert.Len(t, DefaultRiskRules(rep, config.RiskConfig{
+		VelocityMaxAttempts: 10, VelocityWindow: 10, AnomalyFactor: 10, AnomalyHistoryDays: 90,
+		RapidWithdrawalWindow: 30, BlockedAccounts: []string{"ACC666"},
+	}), 4)
+}
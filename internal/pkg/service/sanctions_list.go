@@ -0,0 +1,159 @@
+package service
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WatchlistEntry is one listed person or entity. Names are matched fuzzily,
+// AccountIds exactly.
+type WatchlistEntry struct {
+	Id         string
+	Names      []string
+	AccountIds []string
+}
+
+// LoadWatchlist reads a .csv file, see ParseWatchlistCSV, or a .xml file in
+// the consolidated list format, see ParseConsolidatedList.
+func LoadWatchlist(path string) ([]WatchlistEntry, error) {
+	file, openErr := os.Open(path)
+	if openErr != nil {
+		return nil, openErr
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return ParseWatchlistCSV(file)
+	case ".xml":
+		return ParseConsolidatedList(file)
+	}
+	return nil, fmt.Errorf("watchlist %s is neither a .csv nor a .xml file", path)
+}
+
+// ParseWatchlistCSV reads a CSV list with a header row. The columns id, name,
+// aliases and account_id are read, in any order, and others are ignored;
+// aliases and account ids hold several values separated by ';'. Every row
+// needs a name or an account id.
+func ParseWatchlistCSV(r io.Reader) ([]WatchlistEntry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, headerErr := reader.Read()
+	if errors.Is(headerErr, io.EOF) {
+		return nil, errors.New("watchlist is empty")
+	}
+	if headerErr != nil {
+		return nil, headerErr
+	}
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))] = i
+	}
+	_, hasName := columns["name"]
+	_, hasAccount := columns["account_id"]
+	if !hasName && !hasAccount {
+		return nil, errors.New("watchlist header needs a name or account_id column")
+	}
+	field := func(record []string, column string) string {
+		if i, exists := columns[column]; exists && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var entries []WatchlistEntry
+	for {
+		record, readErr := reader.Read()
+		if errors.Is(readErr, io.EOF) {
+			return entries, nil
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+		entry := WatchlistEntry{
+			Id:         field(record, "id"),
+			Names:      appendNonEmpty(nil, field(record, "name")),
+			AccountIds: appendNonEmpty(nil, strings.Split(field(record, "account_id"), ";")...),
+		}
+		entry.Names = appendNonEmpty(entry.Names, strings.Split(field(record, "aliases"), ";")...)
+		if len(entry.Names) == 0 && len(entry.AccountIds) == 0 {
+			line, _ := reader.FieldPos(0)
+			return nil, fmt.Errorf("watchlist line %d has neither a name nor an account id", line)
+		}
+		if entry.Id == "" {
+			entry.Id = entry.primaryName()
+		}
+		entries = append(entries, entry)
+	}
+}
+
+type consolidatedList struct {
+	Individuals []consolidatedEntry `xml:"INDIVIDUALS>INDIVIDUAL"`
+	Entities    []consolidatedEntry `xml:"ENTITIES>ENTITY"`
+}
+
+type consolidatedEntry struct {
+	DataId          string              `xml:"DATAID"`
+	ReferenceNumber string              `xml:"REFERENCE_NUMBER"`
+	FirstName       string              `xml:"FIRST_NAME"`
+	SecondName      string              `xml:"SECOND_NAME"`
+	ThirdName       string              `xml:"THIRD_NAME"`
+	FourthName      string              `xml:"FOURTH_NAME"`
+	Aliases         []consolidatedAlias `xml:"INDIVIDUAL_ALIAS"`
+	EntityAliases   []consolidatedAlias `xml:"ENTITY_ALIAS"`
+}
+
+type consolidatedAlias struct {
+	Name string `xml:"ALIAS_NAME"`
+}
+
+// ParseConsolidatedList reads the XML format of the UN Security Council
+// consolidated list. Individuals and entities become entries named after
+// their name parts and aliases, identified by their reference number.
+func ParseConsolidatedList(r io.Reader) ([]WatchlistEntry, error) {
+	var list consolidatedList
+	if decodeErr := xml.NewDecoder(r).Decode(&list); decodeErr != nil {
+		return nil, decodeErr
+	}
+
+	entries := make([]WatchlistEntry, 0, len(list.Individuals)+len(list.Entities))
+	for _, listed := range append(list.Individuals, list.Entities...) {
+		name := strings.Join(strings.Fields(strings.Join([]string{listed.FirstName, listed.SecondName, listed.ThirdName, listed.FourthName}, " ")), " ")
+		entry := WatchlistEntry{Id: strings.TrimSpace(listed.ReferenceNumber), Names: appendNonEmpty(nil, name)}
+		for _, alias := range append(listed.Aliases, listed.EntityAliases...) {
+			entry.Names = appendNonEmpty(entry.Names, alias.Name)
+		}
+		if len(entry.Names) == 0 {
+			continue
+		}
+		if entry.Id == "" {
+			entry.Id = strings.TrimSpace(listed.DataId)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (entry WatchlistEntry) primaryName() string {
+	if len(entry.Names) > 0 {
+		return entry.Names[0]
+	}
+	return entry.AccountIds[0]
+}
+
+func appendNonEmpty(values []string, candidates ...string) []string {
+	for _, candidate := range candidates {
+		if candidate = strings.TrimSpace(candidate); candidate != "" {
+			values = append(values, candidate)
+		}
+	}
+	return values
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/dinowar/gateway-service/internal/pkg/config"
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// SanctionsMatch is a watchlist entry hit by screening. Score is the name
+// similarity in percent, 100 for exact and account id matches.
+type SanctionsMatch struct {
+	EntryId string
+	Listed  string
+	Score   int
+}
+
+type watchlistName struct {
+	entryId    string
+	listed     string
+	normalized []rune
+}
+
+// SanctionsScreener screens account ids and names against a watchlist file.
+// Load reads the file again only when it changed, and a list that fails to
+// load leaves the previous one in place.
+type SanctionsScreener struct {
+	path      string
+	threshold float64
+	interval  time.Duration
+	logger    *LogService
+
+	mu       sync.RWMutex
+	modTime  time.Time
+	accounts map[string]SanctionsMatch
+	names    []watchlistName
+}
+
+func NewSanctionsScreener(cfg config.SanctionsConfig, logger *LogService) *SanctionsScreener {
+	return &SanctionsScreener{
+		path:      cfg.ListPath,
+		threshold: float64(cfg.MatchThreshold) / 100,
+		interval:  time.Duration(cfg.ReloadInterval) * time.Minute,
+		logger:    logger,
+	}
+}
+
+// Load reads the watchlist unless the file is unchanged since the last load.
+func (ss *SanctionsScreener) Load() error {
+	info, statErr := os.Stat(ss.path)
+	if statErr != nil {
+		return statErr
+	}
+	ss.mu.RLock()
+	unchanged := ss.accounts != nil && info.ModTime().Equal(ss.modTime)
+	ss.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	entries, loadErr := LoadWatchlist(ss.path)
+	if loadErr != nil {
+		return fmt.Errorf("loading watchlist %s: %w", ss.path, loadErr)
+	}
+	accounts := make(map[string]SanctionsMatch)
+	var names []watchlistName
+	for _, entry := range entries {
+		for _, accountId := range entry.AccountIds {
+			accounts[accountId] = SanctionsMatch{EntryId: entry.Id, Listed: entry.primaryName(), Score: 100}
+		}
+		for _, name := range entry.Names {
+			if normalized := normalizeName(name); len(normalized) > 0 {
+				names = append(names, watchlistName{entryId: entry.Id, listed: name, normalized: normalized})
+			}
+		}
+	}
+
+	ss.mu.Lock()
+	ss.modTime = info.ModTime()
+	ss.accounts = accounts
+	ss.names = names
+	ss.mu.Unlock()
+	if ss.logger != nil {
+		ss.logger.LogInfo("sanctions list loaded", "path", ss.path, "entries", strconv.Itoa(len(entries)))
+	}
+	return nil
+}
+
+// Run reloads the watchlist on every interval until ctx is done. The list is
+// expected to be loaded already; without an interval Run returns at once.
+func (ss *SanctionsScreener) Run(ctx context.Context) {
+	if ss.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(ss.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if loadErr := ss.Load(); loadErr != nil && ss.logger != nil {
+				ss.logger.LogError("error reloading sanctions list, keeping the previous one", loadErr)
+			}
+		}
+	}
+}
+
+// ScreenAccount reports whether accountId is listed.
+func (ss *SanctionsScreener) ScreenAccount(accountId string) (SanctionsMatch, bool) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	match, listed := ss.accounts[accountId]
+	return match, listed
+}
+
+// ScreenName returns the most similar listed name at or above the threshold.
+// Names are compared case-insensitively, ignoring punctuation and word order.
+func (ss *SanctionsScreener) ScreenName(name string) (SanctionsMatch, bool) {
+	normalized := normalizeName(name)
+	if len(normalized) == 0 {
+		return SanctionsMatch{}, false
+	}
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	best, bestScore := watchlistName{}, 0.0
+	for _, candidate := range ss.names {
+		if score := jaroWinkler(normalized, candidate.normalized); score > bestScore {
+			best, bestScore = candidate, score
+		}
+	}
+	if bestScore < ss.threshold {
+		return SanctionsMatch{}, false
+	}
+	return SanctionsMatch{EntryId: best.entryId, Listed: best.listed, Score: int(bestScore * 100)}, true
+}
+
+type sanctionsRule struct {
+	screener *SanctionsScreener
+	decision RiskDecision
+}
+
+// NewSanctionsRule screens the account and beneficiary name of withdrawals
+// and returns decision for a match.
+func NewSanctionsRule(screener *SanctionsScreener, decision RiskDecision) RiskRule {
+	return &sanctionsRule{screener: screener, decision: decision}
+}
+
+func (rule *sanctionsRule) Evaluate(txn Transaction, _ time.Time) (RiskFinding, error) {
+	if txn.Operation != Withdraw {
+		return RiskFinding{Decision: RiskAllow}, nil
+	}
+	if match, listed := rule.screener.ScreenAccount(txn.AccountId); listed {
+		return RiskFinding{Decision: rule.decision, Reason: fmt.Sprintf("account %s is on the sanctions list (entry %s)",
+			txn.AccountId, match.EntryId)}, nil
+	}
+	if match, listed := rule.screener.ScreenName(txn.BeneficiaryName); listed {
+		return RiskFinding{Decision: rule.decision, Reason: fmt.Sprintf("beneficiary %q matches %q on the sanctions list (entry %s, %d%% similar)",
+			txn.BeneficiaryName, match.Listed, match.EntryId, match.Score)}, nil
+	}
+	return RiskFinding{Decision: RiskAllow}, nil
+}
+
+// normalizeName lower-cases name, drops everything but letters and digits and
+// sorts the remaining words, so "DOE, John" and "john doe" compare equal.
+func normalizeName(name string) []rune {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	sort.Strings(words)
+	return []rune(strings.Join(words, " "))
+}
+
+// jaroWinkler returns the Jaro-Winkler similarity of a and b between 0 and 1.
+func jaroWinkler(a, b []rune) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	window := max(len(a), len(b))/2 - 1
+	if window < 0 {
+		window = 0
+	}
+	matchedA := make([]bool, len(a))
+	matchedB := make([]bool, len(b))
+	matches := 0
+	for i := range a {
+		for j := max(0, i-window); j < min(len(b), i+window+1); j++ {
+			if !matchedB[j] && a[i] == b[j] {
+				matchedA[i], matchedB[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions, j := 0, 0
+	for i := range a {
+		if !matchedA[i] {
+			continue
+		}
+		for !matchedB[j] {
+			j++
+		}
+		if a[i] != b[j] {
+			transpositions++
+		}
+		j++
+	}
+	m := float64(matches)
+	jaro := (m/float64(len(a)) + m/float64(len(b)) + (m-float64(transpositions/2))/m) / 3
+
+	prefix := 0
+	for prefix < min(4, len(a), len(b)) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
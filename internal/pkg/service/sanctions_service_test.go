@@ -0,0 +1,162 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dinowar/gateway-service/internal/pkg/config"
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testWatchlistCSV = `id,name,aliases,account_id,program
+SDN-1,Ivan Petrovich Sidorov,Ivan Sidorov;I. P. Sidorov,,RU
+SDN-2,,,ACC666;ACC667,
+SDN-3,"Acme Shell Holdings, Ltd.",,,
+`
+
+const testConsolidatedList = `<?xml version="1.0" encoding="UTF-8"?>
+<CONSOLIDATED_LIST dateGenerated="2024-10-01T00:00:00">
+  <INDIVIDUALS>
+    <INDIVIDUAL>
+      <DATAID>6908555</DATAID>
+      <FIRST_NAME>ABDUL</FIRST_NAME>
+      <SECOND_NAME>RAHMAN</SECOND_NAME>
+      <THIRD_NAME>AL-HAMAD</THIRD_NAME>
+      <REFERENCE_NUMBER>QDi.001</REFERENCE_NUMBER>
+      <INDIVIDUAL_ALIAS><QUALITY>Good</QUALITY><ALIAS_NAME>Abu Hamad</ALIAS_NAME></INDIVIDUAL_ALIAS>
+      <INDIVIDUAL_ALIAS><QUALITY>Low</QUALITY><ALIAS_NAME></ALIAS_NAME></INDIVIDUAL_ALIAS>
+    </INDIVIDUAL>
+  </INDIVIDUALS>
+  <ENTITIES>
+    <ENTITY>
+      <DATAID>110402</DATAID>
+      <FIRST_NAME>NORTHERN TRADING COMPANY</FIRST_NAME>
+      <ENTITY_ALIAS><ALIAS_NAME>NTC</ALIAS_NAME></ENTITY_ALIAS>
+    </ENTITY>
+  </ENTITIES>
+</CONSOLIDATED_LIST>`
+
+// writeTestFile writes content to a file named name in a temporary directory.
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func newTestScreener(t *testing.T, path string, threshold int) *SanctionsScreener {
+	t.Helper()
+
+	screener := NewSanctionsScreener(config.SanctionsConfig{ListPath: path, MatchThreshold: threshold, Action: "deny"}, nil)
+	require.NoError(t, screener.Load())
+	return screener
+}
+
+func TestParseWatchlistCSV(t *testing.T) {
+	entries, parseErr := ParseWatchlistCSV(strings.NewReader(testWatchlistCSV))
+	require.NoError(t, parseErr)
+	assert.Equal(t, []WatchlistEntry{
+		{Id: "SDN-1", Names: []string{"Ivan Petrovich Sidorov", "Ivan Sidorov", "I. P. Sidorov"}},
+		{Id: "SDN-2", AccountIds: []string{"ACC666", "ACC667"}},
+		{Id: "SDN-3", Names: []string{"Acme Shell Holdings, Ltd."}},
+	}, entries)
+
+	_, parseErr = ParseWatchlistCSV(strings.NewReader("id,program\nSDN-1,RU\n"))
+	assert.ErrorContains(t, parseErr, "needs a name or account_id column")
+
+	_, parseErr = ParseWatchlistCSV(strings.NewReader("id,name\nSDN-1,Ivan\nSDN-2,\n"))
+	assert.ErrorContains(t, parseErr, "line 3 has neither a name nor an account id")
+}
+
+func TestParseConsolidatedList(t *testing.T) {
+	entries, parseErr := ParseConsolidatedList(strings.NewReader(testConsolidatedList))
+	require.NoError(t, parseErr)
+	assert.Equal(t, []WatchlistEntry{
+		{Id: "QDi.001", Names: []string{"ABDUL RAHMAN AL-HAMAD", "Abu Hamad"}},
+		{Id: "110402", Names: []string{"NORTHERN TRADING COMPANY", "NTC"}},
+	}, entries)
+
+	_, parseErr = ParseConsolidatedList(strings.NewReader("<CONSOLIDATED_LIST><INDIVIDUALS>"))
+	assert.Error(t, parseErr)
+}
+
+func TestSanctionsScreener_ScreenName(t *testing.T) {
+	screener := newTestScreener(t, writeTestFile(t, "list.xml", testConsolidatedList), 90)
+
+	for _, test := range []struct {
+		name    string
+		entryId string
+	}{
+		{"Abdul Rahman Al-Hamad", "QDi.001"},
+		{"AL HAMAD, Abdul Rahman", "QDi.001"},
+		{"Abdul Rahman Al-Hammad", "QDi.001"},
+		{"abu hamad", "QDi.001"},
+		{"Northern Trading Co.", ""},
+		{"Jane Doe", ""},
+		{"", ""},
+	} {
+		match, listed := screener.ScreenName(test.name)
+		assert.Equal(t, test.entryId != "", listed, test.name)
+		assert.Equal(t, test.entryId, match.EntryId, test.name)
+	}
+
+	match, _ := screener.ScreenName("abdul rahman al hamad")
+	assert.Equal(t, SanctionsMatch{EntryId: "QDi.001", Listed: "ABDUL RAHMAN AL-HAMAD", Score: 100}, match)
+
+	lenient := newTestScreener(t, writeTestFile(t, "list.xml", testConsolidatedList), 80)
+	match, listed := lenient.ScreenName("Northern Trading Co.")
+	assert.True(t, listed)
+	assert.Equal(t, "110402", match.EntryId)
+	assert.Less(t, match.Score, 90)
+}
+
+func TestSanctionsScreener_ReloadsChangedList(t *testing.T) {
+	path := writeTestFile(t, "list.csv", testWatchlistCSV)
+	screener := newTestScreener(t, path, 90)
+	_, listed := screener.ScreenAccount("ACC666")
+	require.True(t, listed)
+
+	require.NoError(t, os.WriteFile(path, []byte("name,account_id\nJane Roe,ACC999\n"), 0o600))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+	require.NoError(t, screener.Load())
+	_, listed = screener.ScreenAccount("ACC666")
+	assert.False(t, listed)
+	match, listed := screener.ScreenAccount("ACC999")
+	assert.True(t, listed)
+	assert.Equal(t, SanctionsMatch{EntryId: "Jane Roe", Listed: "Jane Roe", Score: 100}, match)
+
+	require.NoError(t, os.WriteFile(path, []byte("program\nRU\n"), 0o600))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(2*time.Minute)))
+	assert.Error(t, screener.Load())
+	_, listed = screener.ScreenAccount("ACC999")
+	assert.True(t, listed, "a broken list keeps the previous one")
+}
+
+func TestSanctionsRule(t *testing.T) {
+	now := time.Date(2024, 10, 14, 12, 0, 0, 0, time.UTC)
+	rule := NewSanctionsRule(newTestScreener(t, writeTestFile(t, "list.csv", testWatchlistCSV), 90), model.RiskReview)
+
+	withdrawal := limitTestTxn("ref-1", "ACC123", "rest", model.Withdraw, "100")
+	finding, _ := rule.Evaluate(withdrawal, now)
+	assert.Equal(t, model.RiskAllow, finding.Decision)
+
+	withdrawal.BeneficiaryName = "SIDOROV Ivan"
+	finding, _ = rule.Evaluate(withdrawal, now)
+	assert.Equal(t, model.RiskFinding{Decision: model.RiskReview,
+		Reason: `beneficiary "SIDOROV Ivan" matches "Ivan Sidorov" on the sanctions list (entry SDN-1, 100% similar)`}, finding)
+
+	withdrawal = limitTestTxn("ref-2", "ACC667", "rest", model.Withdraw, "100")
+	finding, _ = rule.Evaluate(withdrawal, now)
+	assert.Equal(t, model.RiskFinding{Decision: model.RiskReview,
+		Reason: "account ACC667 is on the sanctions list (entry SDN-2)"}, finding)
+
+	deposit := limitTestTxn("ref-3", "ACC667", "rest", model.Deposit, "100")
+	finding, _ = rule.Evaluate(deposit, now)
+	assert.Equal(t, model.RiskAllow, finding.Decision, "only withdrawals are screened")
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"sync"
+)
+
+// subscriptionBuffer is how many updates a subscriber may fall behind before
+// it is dropped.
+const subscriptionBuffer = 16
+
+// TransactionBroker fans committed transaction status changes out to the
+// subscribers of this process. The repositories feed it: the memory
+// repository directly, Postgres through TransactionListener.
+type TransactionBroker struct {
+	mu          sync.Mutex
+	subscribers map[*TransactionSubscription]struct{}
+	closed      bool
+}
+
+// TransactionSubscription receives the updates of one transaction or of all
+// transactions of one account, always scoped to a merchant. C is closed when
+// the subscription ends, either by Close, by the broker shutting down, or
+// because the subscriber fell behind; readers then start over from the
+// stored state.
+type TransactionSubscription struct {
+	C           <-chan Transaction
+	updates     chan Transaction
+	broker      *TransactionBroker
+	merchantId  string
+	referenceId string
+	accountId   string
+}
+
+func NewTransactionBroker() *TransactionBroker {
+	return &TransactionBroker{subscribers: make(map[*TransactionSubscription]struct{})}
+}
+
+// SubscribeTransaction subscribes to the updates of referenceId.
+func (broker *TransactionBroker) SubscribeTransaction(merchantId, referenceId string) *TransactionSubscription {
+	return broker.subscribe(&TransactionSubscription{merchantId: merchantId, referenceId: referenceId})
+}
+
+// SubscribeAccount subscribes to the updates of every transaction of accountId.
+func (broker *TransactionBroker) SubscribeAccount(merchantId, accountId string) *TransactionSubscription {
+	return broker.subscribe(&TransactionSubscription{merchantId: merchantId, accountId: accountId})
+}
+
+func (broker *TransactionBroker) subscribe(subscription *TransactionSubscription) *TransactionSubscription {
+	subscription.updates = make(chan Transaction, subscriptionBuffer)
+	subscription.C = subscription.updates
+	subscription.broker = broker
+
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	if broker.closed {
+		close(subscription.updates)
+		return subscription
+	}
+	broker.subscribers[subscription] = struct{}{}
+	return subscription
+}
+
+// Publish hands txn to every matching subscriber without blocking.
+func (broker *TransactionBroker) Publish(txn Transaction) {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	for subscription := range broker.subscribers {
+		if !subscription.matches(txn) {
+			continue
+		}
+		select {
+		case subscription.updates <- txn:
+		default:
+			broker.remove(subscription)
+		}
+	}
+}
+
+// Close ends every subscription and rejects new ones, so streaming
+// handlers return on shutdown.
+func (broker *TransactionBroker) Close() {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	broker.closed = true
+	for subscription := range broker.subscribers {
+		broker.remove(subscription)
+	}
+}
+
+func (broker *TransactionBroker) remove(subscription *TransactionSubscription) {
+	if _, exists := broker.subscribers[subscription]; exists {
+		delete(broker.subscribers, subscription)
+		close(subscription.updates)
+	}
+}
+
+func (subscription *TransactionSubscription) Close() {
+	subscription.broker.mu.Lock()
+	defer subscription.broker.mu.Unlock()
+	subscription.broker.remove(subscription)
+}
+
+func (subscription *TransactionSubscription) matches(txn Transaction) bool {
+	if txn.MerchantId != subscription.merchantId {
+		return false
+	}
+	if subscription.referenceId != "" {
+		return txn.ReferenceId == subscription.referenceId
+	}
+	return txn.AccountId == subscription.accountId
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func receive(t *testing.T, subscription *TransactionSubscription) model.Transaction {
+	t.Helper()
+
+	select {
+	case txn, open := <-subscription.C:
+		require.True(t, open, "subscription closed")
+		return txn
+	case <-time.After(5 * time.Second):
+		t.Fatal("no update received")
+		return model.Transaction{}
+	}
+}
+
+func assertNothingReceived(t *testing.T, subscription *TransactionSubscription) {
+	t.Helper()
+
+	select {
+	case txn := <-subscription.C:
+		t.Fatalf("unexpected update %+v", txn)
+	default:
+	}
+}
+
+func TestTransactionBroker_ScopesSubscriptions(t *testing.T) {
+	broker := NewTransactionBroker()
+	byReference := broker.SubscribeTransaction("merchant-1", "ref-1")
+	byAccount := broker.SubscribeAccount("merchant-1", "ACC123")
+	otherMerchant := broker.SubscribeAccount("merchant-2", "ACC123")
+
+	broker.Publish(model.Transaction{MerchantId: "merchant-1", ReferenceId: "ref-2", AccountId: "ACC123", Status: model.StatusSuccess})
+	broker.Publish(model.Transaction{MerchantId: "merchant-1", ReferenceId: "ref-1", AccountId: "ACC123", Status: model.StatusFailed})
+
+	assert.Equal(t, "ref-1", receive(t, byReference).ReferenceId)
+	assertNothingReceived(t, byReference)
+	assert.Equal(t, "ref-2", receive(t, byAccount).ReferenceId)
+	assert.Equal(t, "ref-1", receive(t, byAccount).ReferenceId)
+	assertNothingReceived(t, otherMerchant)
+}
+
+func TestTransactionBroker_DropsSlowSubscribers(t *testing.T) {
+	broker := NewTransactionBroker()
+	slow := broker.SubscribeAccount("merchant-1", "ACC123")
+
+	for i := 0; i <= subscriptionBuffer; i++ {
+		broker.Publish(model.Transaction{MerchantId: "merchant-1", AccountId: "ACC123"})
+	}
+	for i := 0; i < subscriptionBuffer; i++ {
+		receive(t, slow)
+	}
+	_, open := <-slow.C
+	assert.False(t, open, "a subscriber that fell behind is closed, not blocked on")
+	slow.Close()
+}
+
+func TestTransactionBroker_Close(t *testing.T) {
+	broker := NewTransactionBroker()
+	subscription := broker.SubscribeTransaction("merchant-1", "ref-1")
+	subscription.Close()
+	subscription.Close()
+	_, open := <-subscription.C
+	assert.False(t, open)
+
+	live := broker.SubscribeTransaction("merchant-1", "ref-1")
+	broker.Close()
+	_, open = <-live.C
+	assert.False(t, open)
+	_, open = <-broker.SubscribeTransaction("merchant-1", "ref-1").C
+	assert.False(t, open, "subscriptions after Close end immediately")
+}
+
+func TestMemoryRepository_PublishesStatusChanges(t *testing.T) {
+	rep := NewMemoryRepositoryService()
+	broker := NewTransactionBroker()
+	rep.PublishUpdates(broker)
+	subscription := broker.SubscribeTransaction("merchant-1", "ref-1")
+
+	require.NoError(t, rep.SaveTransaction(&model.Transaction{
+		ReferenceId: "ref-1", MerchantId: "merchant-1", AccountId: "ACC123", Amount: decimal.NewFromInt(10),
+		Currency: "USD", Status: model.StatusPending, Operation: model.Deposit, GatewayId: "rest",
+	}))
+	assertNothingReceived(t, subscription)
+
+	require.NoError(t, rep.UpdateTransaction(&model.Transaction{ReferenceId: "ref-1", Status: model.StatusSuccess}))
+	update := receive(t, subscription)
+	assert.Equal(t, model.StatusSuccess, update.Status)
+	assert.Equal(t, "ACC123", update.AccountId)
+
+	require.NoError(t, rep.UpdateTransaction(&model.Transaction{ReferenceId: "ref-1", Status: model.StatusSuccess}))
+	assertNothingReceived(t, subscription)
+}
+
+func TestPostgres_TransactionListener(t *testing.T) {
+	db := migratedPostgresTestDB(t)
+	rep := NewRepositoryService(db)
+	merchant, _ := NewAuthService(rep).CreateMerchant("acme")
+	broker := NewTransactionBroker()
+	subscription := broker.SubscribeAccount(merchant.Id, "ACC123")
+
+	var search string
+	require.NoError(t, db.QueryRow(`SHOW search_path`).Scan(&search))
+	listener := NewTransactionListener(withSearchPath(t, os.Getenv(testDatabaseEnv), search), rep, broker, NewLogService(zap.NewNop()))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go listener.Run(ctx)
+
+	require.NoError(t, rep.SaveTransaction(&model.Transaction{
+		ReferenceId: "ref-1", MerchantId: merchant.Id, AccountId: "ACC123", Amount: decimal.NewFromInt(10),
+		Currency: "USD", Status: model.StatusPending, Operation: model.Deposit, GatewayId: "rest",
+	}))
+	// the listener connects asynchronously, keep changing the status until it hears one
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		require.NoError(t, rep.UpdateTransaction(&model.Transaction{ReferenceId: "ref-1", Status: model.StatusSuccess}))
+		select {
+		case update := <-subscription.C:
+			// resetting the status below is announced too
+			if update.Status == model.StatusSuccess {
+				assert.Equal(t, "ref-1", update.ReferenceId)
+				return
+			}
+		case <-time.After(100 * time.Millisecond):
+		}
+		require.True(t, time.Now().Before(deadline), "no notification received")
+		_, resetErr := db.Exec(`UPDATE transactions SET status = 'PENDING' WHERE reference_id = 'ref-1'`)
+		require.NoError(t, resetErr)
+	}
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/lib/pq"
+	"time"
+)
+
+// TransactionUpdatesChannel is the Postgres NOTIFY channel the
+// transactions_notify_update trigger announces status changes on.
+const TransactionUpdatesChannel = "transaction_updates"
+
+type transactionNotification struct {
+	ReferenceId string `json:"reference_id"`
+	MerchantId  string `json:"merchant_id"`
+}
+
+// TransactionListener LISTENs for the status changes committed by any
+// replica and publishes the updated transactions to the local broker.
+// Notifications sent while the connection is down are lost; streaming
+// clients recover by reconnecting, which starts from the stored state.
+type TransactionListener struct {
+	connStr string
+	rep     TransactionRepository
+	broker  *TransactionBroker
+	logger  *LogService
+}
+
+func NewTransactionListener(connStr string, rep TransactionRepository, broker *TransactionBroker, logger *LogService) *TransactionListener {
+	return &TransactionListener{connStr: connStr, rep: rep, broker: broker, logger: logger}
+}
+
+// Run listens until ctx is done.
+func (tl *TransactionListener) Run(ctx context.Context) {
+	listener := pq.NewListener(tl.connStr, time.Second, time.Minute, func(event pq.ListenerEventType, eventErr error) {
+		if eventErr != nil {
+			tl.logger.LogError("transaction listener connection failed", eventErr)
+		}
+	})
+	defer listener.Close()
+	if listenErr := listener.Listen(TransactionUpdatesChannel); listenErr != nil {
+		tl.logger.LogError("listening for transaction updates failed", listenErr)
+		return
+	}
+
+	// pings detect connections that died without an error
+	ticker := time.NewTicker(90 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			go listener.Ping()
+		case notification := <-listener.Notify:
+			// nil after a reconnect, when notifications may have been missed
+			if notification != nil {
+				tl.publish(notification.Extra)
+			}
+		}
+	}
+}
+
+func (tl *TransactionListener) publish(payload string) {
+	var notification transactionNotification
+	if decodeErr := json.Unmarshal([]byte(payload), &notification); decodeErr != nil {
+		tl.logger.LogError("decoding transaction notification failed", decodeErr)
+		return
+	}
+	txn, getErr := tl.rep.GetTransaction(notification.MerchantId, notification.ReferenceId)
+	if getErr != nil {
+		tl.logger.LogError("loading notified transaction failed", getErr)
+		return
+	}
+	tl.broker.Publish(txn)
+}
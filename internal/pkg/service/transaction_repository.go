@@ -0,0 +1,49 @@
+package service
+
+import . "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+
+// TransactionRepository is implemented by RepositoryService (Postgres) and
+// MemoryRepositoryService. Both must keep the same semantics for upserts,
+// ordering and missing rows; the contract tests run against each of them.
+// Lookups and updates of unknown reference ids return model.ErrNotFound,
+// status updates the current status does not lead to return model.ErrConflict.
+// SaveTransaction sets txn.Ts to the stored creation time and never changes
+// the merchant of an existing transaction. UpdateTransaction stores the
+// captured amount of a capture with its fee and fills txn with the stored
+// transaction.
+// Reads are scoped to a merchant: transactions of other merchants are missing
+// rows. UpdateTransaction is not, gateways report by reference id only.
+// GetTransactions pages newest first by (ts, reference_id) using keyset cursors.
+// GetUsage counts and sums the merchant's transactions matching the query,
+// which leaves out FAILED and VOIDED ones unless IncludeFailed is set.
+// Creating a transaction and changing its status append to its event history;
+// GetTransactionHistory returns it oldest first, empty for unknown transactions.
+type TransactionRepository interface {
+	SaveTransaction(txn *Transaction) error
+	UpdateTransaction(txn *Transaction) error
+	GetTransaction(merchantId, referenceId string) (Transaction, error)
+	GetTransactions(merchantId, accountId string, filter TransactionFilter, page PageRequest) (TransactionPage, error)
+	GetUsage(merchantId string, query UsageQuery) (Usage, error)
+	GetTransactionHistory(merchantId, referenceId string) ([]HistoryEvent, error)
+}
+
+// UsageStore reads usage and stores transactions, see UsageLocker.
+type UsageStore interface {
+	GetUsage(merchantId string, query UsageQuery) (Usage, error)
+	SaveTransaction(txn *Transaction) error
+}
+
+// UsageLocker serializes the velocity checks of transactions sharing a total.
+// LockUsage runs fn once it holds every key, which callers pass sorted, and
+// keeps them until what fn stored is visible to the next holder.
+// RepositoryService locks across replicas.
+type UsageLocker interface {
+	LockUsage(keys []string, fn func(store UsageStore) error) error
+}
+
+var (
+	_ TransactionRepository = (*RepositoryService)(nil)
+	_ TransactionRepository = (*MemoryRepositoryService)(nil)
+	_ UsageLocker           = (*RepositoryService)(nil)
+	_ UsageLocker           = (*MemoryRepositoryService)(nil)
+)
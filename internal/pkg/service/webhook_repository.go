@@ -0,0 +1,34 @@
+package service
+
+import (
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"time"
+)
+
+// WebhookRepository is the durable outbox of webhook deliveries, implemented
+// by RepositoryService and MemoryRepositoryService with the same semantics.
+// An event is identified by its reference id and event type: it is enqueued
+// at most once, whether it is pending, delivered or a dead letter.
+type WebhookRepository interface {
+	// EnqueueWebhook stores delivery due immediately, unless its event exists already.
+	EnqueueWebhook(delivery *WebhookDelivery) error
+	// ClaimWebhooks returns up to limit undelivered deliveries due at now and
+	// leases them until leaseUntil, so concurrent dispatchers skip them.
+	ClaimWebhooks(now, leaseUntil time.Time, limit int) ([]WebhookDelivery, error)
+	// RecordWebhookAttempt stores Attempts, NextAttemptAt, LastError,
+	// LastStatusCode and DeliveredAt of delivery.
+	RecordWebhookAttempt(delivery WebhookDelivery) error
+	// DeadLetterWebhook moves delivery to the dead letters with its attempts,
+	// last error and status code.
+	DeadLetterWebhook(delivery WebhookDelivery) error
+	// GetDeadLetters returns the newest MaxPageSize dead letters of a merchant.
+	GetDeadLetters(merchantId string) ([]WebhookDelivery, error)
+	// RedeliverWebhook moves a dead letter of merchantId back to the outbox,
+	// due immediately with no attempts. Unknown ids return model.ErrNotFound.
+	RedeliverWebhook(merchantId, deliveryId string) error
+}
+
+var (
+	_ WebhookRepository = (*RepositoryService)(nil)
+	_ WebhookRepository = (*MemoryRepositoryService)(nil)
+)
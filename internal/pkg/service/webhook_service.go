@@ -0,0 +1,223 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/dinowar/gateway-service/internal/pkg/config"
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/google/uuid"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Webhook requests carry these headers. The signature is
+// t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>" keyed by the merchant's webhook secret>.
+const (
+	WebhookIdHeader        = "Webhook-Id"
+	WebhookEventHeader     = "Webhook-Event"
+	WebhookSignatureHeader = "Webhook-Signature"
+)
+
+// maxWebhookBackoff caps the doubling retry delay of a failing delivery.
+const maxWebhookBackoff = 6 * time.Hour
+
+// WebhookService publishes transaction events to the outbox and delivers
+// them to the merchants' webhook URLs. Deliveries survive restarts; a
+// delivery is retried with exponential backoff until it succeeds with a 2xx
+// answer or runs out of attempts and becomes a dead letter.
+type WebhookService struct {
+	rep       WebhookRepository
+	merchants MerchantRepository
+	logger    *LogService
+	client    *http.Client
+	config    config.WebhookConfig
+	now       func() time.Time
+}
+
+func NewWebhookService(rep WebhookRepository, merchants MerchantRepository, logger *LogService, client *http.Client, config config.WebhookConfig) *WebhookService {
+	return &WebhookService{
+		rep:       rep,
+		merchants: merchants,
+		logger:    logger,
+		client:    client,
+		config:    config,
+		now:       time.Now,
+	}
+}
+
+// Publish enqueues an event for merchantId. payload renders the JSON body for
+// the event's id and creation time. Merchants without a webhook URL get no
+// deliveries; publishing the same event twice enqueues it once.
+func (ws *WebhookService) Publish(merchantId, referenceId, eventType string, payload func(eventId string, createdAt time.Time) ([]byte, error)) error {
+	merchant, merchantErr := ws.merchants.GetMerchant(merchantId)
+	if merchantErr != nil {
+		return merchantErr
+	}
+	if merchant.Settings.WebhookURL == "" {
+		return nil
+	}
+
+	delivery := &WebhookDelivery{
+		Id:          "evt_" + uuid.NewString(),
+		MerchantId:  merchantId,
+		ReferenceId: referenceId,
+		EventType:   eventType,
+	}
+	body, payloadErr := payload(delivery.Id, ws.now())
+	if payloadErr != nil {
+		return payloadErr
+	}
+	delivery.Payload = body
+	return ws.rep.EnqueueWebhook(delivery)
+}
+
+// Run dispatches due deliveries on every poll interval until ctx is done.
+func (ws *WebhookService) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(ws.config.PollInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		ws.Dispatch(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Dispatch attempts every due delivery, one batch at a time, and returns how
+// many were attempted.
+func (ws *WebhookService) Dispatch(ctx context.Context) int {
+	attempted := 0
+	for ctx.Err() == nil {
+		now := ws.now()
+		// a dispatcher that dies mid-batch leaves its deliveries leased, they are retried once the lease ends
+		leaseUntil := now.Add(time.Duration(2*ws.config.Timeout*ws.config.BatchSize) * time.Second)
+		deliveries, claimErr := ws.rep.ClaimWebhooks(now, leaseUntil, ws.config.BatchSize)
+		if claimErr != nil {
+			ws.logger.LogError("claiming webhook deliveries failed", claimErr)
+			return attempted
+		}
+		for _, delivery := range deliveries {
+			ws.attempt(ctx, delivery)
+		}
+		attempted += len(deliveries)
+		if len(deliveries) < ws.config.BatchSize {
+			return attempted
+		}
+	}
+	return attempted
+}
+
+func (ws *WebhookService) attempt(ctx context.Context, delivery WebhookDelivery) {
+	statusCode, deliverErr := ws.deliver(ctx, delivery)
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	delivery.LastError = ""
+
+	if deliverErr == nil {
+		deliveredAt := ws.now()
+		delivery.DeliveredAt = &deliveredAt
+		if recordErr := ws.rep.RecordWebhookAttempt(delivery); recordErr != nil {
+			ws.logger.LogError("recording webhook delivery failed", recordErr)
+		}
+		return
+	}
+
+	delivery.LastError = deliverErr.Error()
+	ws.logger.LogInfo("webhook delivery failed", "delivery_id", delivery.Id, "attempt", strconv.Itoa(delivery.Attempts), "error", delivery.LastError)
+	if delivery.Attempts >= ws.config.MaxAttempts {
+		if deadErr := ws.rep.DeadLetterWebhook(delivery); deadErr != nil {
+			ws.logger.LogError("dead lettering webhook delivery failed", deadErr)
+		}
+		return
+	}
+	delivery.NextAttemptAt = ws.now().Add(ws.retryDelay(delivery.Attempts))
+	if recordErr := ws.rep.RecordWebhookAttempt(delivery); recordErr != nil {
+		ws.logger.LogError("recording webhook delivery failed", recordErr)
+	}
+}
+
+// retryDelay is the wait after the given number of failed attempts.
+func (ws *WebhookService) retryDelay(attempts int) time.Duration {
+	delay := time.Duration(ws.config.RetryBase) * time.Second
+	for i := 1; i < attempts && delay < maxWebhookBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxWebhookBackoff {
+		return maxWebhookBackoff
+	}
+	return delay
+}
+
+// deliver posts the payload and returns the answer's status code, if any.
+func (ws *WebhookService) deliver(ctx context.Context, delivery WebhookDelivery) (int, error) {
+	merchant, merchantErr := ws.merchants.GetMerchant(delivery.MerchantId)
+	if merchantErr != nil {
+		return 0, merchantErr
+	}
+	if merchant.Settings.WebhookURL == "" || merchant.WebhookSecret == "" {
+		return 0, fmt.Errorf("merchant %s has no webhook URL or secret", merchant.Id)
+	}
+
+	deliverCtx, cancel := context.WithTimeout(ctx, time.Duration(ws.config.Timeout)*time.Second)
+	defer cancel()
+	req, reqErr := http.NewRequestWithContext(deliverCtx, http.MethodPost, merchant.Settings.WebhookURL, bytes.NewReader(delivery.Payload))
+	if reqErr != nil {
+		return 0, reqErr
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookIdHeader, delivery.Id)
+	req.Header.Set(WebhookEventHeader, delivery.EventType)
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(merchant.WebhookSecret, ws.now().Unix(), delivery.Payload))
+
+	resp, respErr := ws.client.Do(req)
+	if respErr != nil {
+		return 0, respErr
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook endpoint answered %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhook returns the Webhook-Signature header value of payload sent at timestamp.
+func SignWebhook(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(payload)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// RotateWebhookSecret replaces the merchant's signing secret and returns the
+// new one. Deliveries sent afterwards are signed with it.
+func (ws *WebhookService) RotateWebhookSecret(merchantId string) (string, error) {
+	raw := make([]byte, 32)
+	if _, randErr := rand.Read(raw); randErr != nil {
+		return "", randErr
+	}
+	secret := "whsec_" + base64.RawURLEncoding.EncodeToString(raw)
+	if setErr := ws.merchants.SetWebhookSecret(merchantId, secret); setErr != nil {
+		return "", setErr
+	}
+	return secret, nil
+}
+
+func (ws *WebhookService) DeadLetters(merchantId string) ([]WebhookDelivery, error) {
+	return ws.rep.GetDeadLetters(merchantId)
+}
+
+// Redeliver queues a dead letter of merchantId for a fresh round of attempts.
+func (ws *WebhookService) Redeliver(merchantId, deliveryId string) error {
+	return ws.rep.RedeliverWebhook(merchantId, deliveryId)
+}
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dinowar/gateway-service/internal/pkg/config"
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type webhookTestRepository interface {
+	WebhookRepository
+	MerchantRepository
+}
+
+// runWebhookRepositoryContract checks the behaviour every WebhookRepository must share.
+func runWebhookRepositoryContract(t *testing.T, newRepository func(t *testing.T) webhookTestRepository) {
+	newMerchant := func(t *testing.T, rep webhookTestRepository) string {
+		merchant, createErr := NewAuthService(rep).CreateMerchant("acme")
+		require.NoError(t, createErr)
+		return merchant.Id
+	}
+	enqueue := func(t *testing.T, rep webhookTestRepository, id, merchantId, referenceId string) {
+		require.NoError(t, rep.EnqueueWebhook(&model.WebhookDelivery{
+			Id:          id,
+			MerchantId:  merchantId,
+			ReferenceId: referenceId,
+			EventType:   model.EventTransactionSucceeded,
+			Payload:     []byte(`{"id":"` + id + `"}`),
+		}))
+	}
+	// the repositories stamp deliveries with their own clock, claim well past it
+	later := func() time.Time { return time.Now().Add(time.Minute) }
+
+	t.Run("enqueue is idempotent per event", func(t *testing.T) {
+		rep := newRepository(t)
+		merchantId := newMerchant(t, rep)
+		enqueue(t, rep, "evt_1", merchantId, "ref-1")
+		enqueue(t, rep, "evt_2", merchantId, "ref-1")
+
+		claimed, claimErr := rep.ClaimWebhooks(later(), later().Add(time.Minute), 10)
+		require.NoError(t, claimErr)
+		require.Len(t, claimed, 1)
+		assert.Equal(t, "evt_1", claimed[0].Id)
+		assert.Equal(t, `{"id":"evt_1"}`, string(claimed[0].Payload))
+		assert.Equal(t, "ref-1", claimed[0].ReferenceId)
+		assert.Equal(t, merchantId, claimed[0].MerchantId)
+	})
+
+	t.Run("claims lease deliveries until recorded", func(t *testing.T) {
+		rep := newRepository(t)
+		merchantId := newMerchant(t, rep)
+		enqueue(t, rep, "evt_1", merchantId, "ref-1")
+		enqueue(t, rep, "evt_2", merchantId, "ref-2")
+
+		now := later()
+		first, claimErr := rep.ClaimWebhooks(now, now.Add(time.Hour), 1)
+		require.NoError(t, claimErr)
+		require.Len(t, first, 1)
+		second, claimErr := rep.ClaimWebhooks(now, now.Add(time.Hour), 10)
+		require.NoError(t, claimErr)
+		require.Len(t, second, 1)
+		assert.NotEqual(t, first[0].Id, second[0].Id)
+		none, _ := rep.ClaimWebhooks(now, now.Add(time.Hour), 10)
+		assert.Empty(t, none)
+
+		delivered := first[0]
+		deliveredAt := now
+		delivered.Attempts, delivered.LastStatusCode, delivered.DeliveredAt = 1, 200, &deliveredAt
+		require.NoError(t, rep.RecordWebhookAttempt(delivered))
+		retried := second[0]
+		retried.Attempts, retried.LastStatusCode, retried.LastError = 1, 500, "boom"
+		retried.NextAttemptAt = now.Add(time.Minute)
+		require.NoError(t, rep.RecordWebhookAttempt(retried))
+
+		due, _ := rep.ClaimWebhooks(now.Add(2*time.Minute), now.Add(time.Hour), 10)
+		require.Len(t, due, 1, "delivered events are not claimed again")
+		assert.Equal(t, retried.Id, due[0].Id)
+		assert.Equal(t, 1, due[0].Attempts)
+		assert.Equal(t, "boom", due[0].LastError)
+		assert.Equal(t, 500, due[0].LastStatusCode)
+	})
+
+	t.Run("dead letters and redelivery", func(t *testing.T) {
+		rep := newRepository(t)
+		merchantId := newMerchant(t, rep)
+		otherId := newMerchant(t, rep)
+		enqueue(t, rep, "evt_1", merchantId, "ref-1")
+
+		claimed, _ := rep.ClaimWebhooks(later(), later().Add(time.Hour), 10)
+		require.Len(t, claimed, 1)
+		dead := claimed[0]
+		dead.Attempts, dead.LastError, dead.LastStatusCode = 3, "webhook endpoint answered 503", 503
+		require.NoError(t, rep.DeadLetterWebhook(dead))
+
+		enqueue(t, rep, "evt_2", merchantId, "ref-1")
+		none, _ := rep.ClaimWebhooks(later().Add(2*time.Hour), later().Add(3*time.Hour), 10)
+		assert.Empty(t, none, "dead letters are not enqueued again")
+
+		deadLetters, listErr := rep.GetDeadLetters(merchantId)
+		require.NoError(t, listErr)
+		require.Len(t, deadLetters, 1)
+		assert.Equal(t, "evt_1", deadLetters[0].Id)
+		assert.Equal(t, 3, deadLetters[0].Attempts)
+		assert.Equal(t, 503, deadLetters[0].LastStatusCode)
+		assert.NotNil(t, deadLetters[0].FailedAt)
+		others, _ := rep.GetDeadLetters(otherId)
+		assert.Empty(t, others)
+
+		assert.ErrorIs(t, rep.RedeliverWebhook(otherId, "evt_1"), model.ErrNotFound)
+		assert.ErrorIs(t, rep.RedeliverWebhook(merchantId, "evt_missing"), model.ErrNotFound)
+		require.NoError(t, rep.RedeliverWebhook(merchantId, "evt_1"))
+		assert.ErrorIs(t, rep.RedeliverWebhook(merchantId, "evt_1"), model.ErrNotFound)
+
+		remaining, _ := rep.GetDeadLetters(merchantId)
+		assert.Empty(t, remaining)
+		redelivered, _ := rep.ClaimWebhooks(later(), later().Add(time.Hour), 10)
+		require.Len(t, redelivered, 1)
+		assert.Equal(t, "evt_1", redelivered[0].Id)
+		assert.Zero(t, redelivered[0].Attempts)
+		assert.Equal(t, `{"id":"evt_1"}`, string(redelivered[0].Payload))
+	})
+}
+
+func TestMemoryWebhookRepository_Contract(t *testing.T) {
+	runWebhookRepositoryContract(t, func(t *testing.T) webhookTestRepository {
+		return NewMemoryRepositoryService()
+	})
+}
+
+func TestPostgresWebhookRepository_Contract(t *testing.T) {
+	runWebhookRepositoryContract(t, func(t *testing.T) webhookTestRepository {
+		return NewRepositoryService(migratedPostgresTestDB(t))
+	})
+}
+
+type webhookEndpoint struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   []string
+}
+
+func (e *webhookEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.requests = append(e.requests, r)
+	e.bodies = append(e.bodies, string(body))
+	w.WriteHeader(e.status)
+}
+
+// newWebhookTestService returns a dispatcher for a merchant whose webhook URL
+// points at endpoint, with a clock the test moves forward.
+func newWebhookTestService(t *testing.T, endpoint *webhookEndpoint) (*WebhookService, *MemoryRepositoryService, string, *time.Time) {
+	server := httptest.NewServer(endpoint)
+	t.Cleanup(server.Close)
+
+	rep := NewMemoryRepositoryService()
+	auth := NewAuthService(rep)
+	merchant, _ := auth.CreateMerchant("acme")
+	require.NoError(t, auth.ConfigureMerchant(merchant.Id, model.MerchantSettings{WebhookURL: server.URL}))
+
+	webhooks := NewWebhookService(rep, rep, NewLogService(zap.NewNop()), server.Client(), config.WebhookConfig{
+		PollInterval: 1, Timeout: 1, MaxAttempts: 3, RetryBase: 30, BatchSize: 10,
+	})
+	_, rotateErr := webhooks.RotateWebhookSecret(merchant.Id)
+	require.NoError(t, rotateErr)
+	now := time.Now().Add(time.Second)
+	webhooks.now = func() time.Time { return now }
+	return webhooks, rep, merchant.Id, &now
+}
+
+func publish(t *testing.T, webhooks *WebhookService, merchantId, referenceId string) {
+	require.NoError(t, webhooks.Publish(merchantId, referenceId, model.EventTransactionSucceeded, func(eventId string, createdAt time.Time) ([]byte, error) {
+		return []byte(`{"id":"` + eventId + `","type":"transaction.succeeded"}`), nil
+	}))
+}
+
+func TestWebhookService_SignsDeliveries(t *testing.T) {
+	endpoint := &webhookEndpoint{status: http.StatusNoContent}
+	webhooks, rep, merchantId, now := newWebhookTestService(t, endpoint)
+	merchant, _ := rep.GetMerchant(merchantId)
+
+	publish(t, webhooks, merchantId, "ref-1")
+	publish(t, webhooks, merchantId, "ref-1")
+	assert.Equal(t, 1, webhooks.Dispatch(context.Background()))
+	assert.Zero(t, webhooks.Dispatch(context.Background()), "delivered events are sent once")
+
+	require.Len(t, endpoint.requests, 1)
+	request := endpoint.requests[0]
+	assert.Equal(t, "application/json", request.Header.Get("Content-Type"))
+	assert.Equal(t, "transaction.succeeded", request.Header.Get(WebhookEventHeader))
+	assert.Contains(t, endpoint.bodies[0], request.Header.Get(WebhookIdHeader))
+	assert.Equal(t, SignWebhook(merchant.WebhookSecret, now.Unix(), []byte(endpoint.bodies[0])), request.Header.Get(WebhookSignatureHeader))
+	assert.NotEqual(t, SignWebhook("whsec_other", now.Unix(), []byte(endpoint.bodies[0])), request.Header.Get(WebhookSignatureHeader))
+}
+
+func TestWebhookService_SkipsMerchantsWithoutURL(t *testing.T) {
+	endpoint := &webhookEndpoint{status: http.StatusOK}
+	webhooks, rep, _, _ := newWebhookTestService(t, endpoint)
+	other, _ := NewAuthService(rep).CreateMerchant("other")
+
+	publish(t, webhooks, other.Id, "ref-1")
+	assert.Zero(t, webhooks.Dispatch(context.Background()))
+	assert.Empty(t, endpoint.requests)
+}
+
+func TestWebhookService_RetriesWithBackoffThenDeadLetters(t *testing.T) {
+	endpoint := &webhookEndpoint{status: http.StatusServiceUnavailable}
+	webhooks, _, merchantId, now := newWebhookTestService(t, endpoint)
+	publish(t, webhooks, merchantId, "ref-1")
+
+	assert.Equal(t, 1, webhooks.Dispatch(context.Background()))
+	*now = now.Add(29 * time.Second)
+	assert.Zero(t, webhooks.Dispatch(context.Background()), "the first retry waits RetryBase")
+	*now = now.Add(time.Second)
+	assert.Equal(t, 1, webhooks.Dispatch(context.Background()))
+	*now = now.Add(59 * time.Second)
+	assert.Zero(t, webhooks.Dispatch(context.Background()), "the delay doubles")
+	*now = now.Add(time.Second)
+	assert.Equal(t, 1, webhooks.Dispatch(context.Background()))
+	require.Len(t, endpoint.requests, 3)
+
+	deadLetters, listErr := webhooks.DeadLetters(merchantId)
+	require.NoError(t, listErr)
+	require.Len(t, deadLetters, 1)
+	assert.Equal(t, 3, deadLetters[0].Attempts)
+	assert.Equal(t, http.StatusServiceUnavailable, deadLetters[0].LastStatusCode)
+	assert.Equal(t, "webhook endpoint answered 503", deadLetters[0].LastError)
+
+	*now = now.Add(24 * time.Hour)
+	assert.Zero(t, webhooks.Dispatch(context.Background()), "dead letters are not retried")
+
+	endpoint.status = http.StatusOK
+	require.NoError(t, webhooks.Redeliver(merchantId, deadLetters[0].Id))
+	assert.Equal(t, 1, webhooks.Dispatch(context.Background()))
+	require.Len(t, endpoint.requests, 4)
+	assert.Equal(t, endpoint.bodies[0], endpoint.bodies[3], "redelivery sends the original event")
+	remaining, _ := webhooks.DeadLetters(merchantId)
+	assert.Empty(t, remaining)
+}
+
+func TestWebhookService_RetryDelayIsCapped(t *testing.T) {
+	webhooks := NewWebhookService(nil, nil, nil, nil, config.WebhookConfig{RetryBase: 30})
+	assert.Equal(t, 30*time.Second, webhooks.retryDelay(1))
+	assert.Equal(t, 4*time.Minute, webhooks.retryDelay(4))
+	assert.Equal(t, maxWebhookBackoff, webhooks.retryDelay(40))
+}
@@ -0,0 +1,37 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Gateways name themselves in CallbackGatewayHeader and sign the raw callback
+// body in CallbackSignatureHeader, see SignCallback.
+const (
+	CallbackGatewayHeader   = "X-Gateway-Id"
+	CallbackSignatureHeader = "X-Gateway-Signature"
+)
+
+// SignCallback returns the hex encoded HMAC-SHA256 of body under the
+// gateway's callback secret.
+func SignCallback(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyCallback reports whether signature is SignCallback of body under
+// secret. An empty secret verifies nothing.
+func VerifyCallback(secret string, body []byte, signature string) bool {
+	if secret == "" {
+		return false
+	}
+	expected, decodeErr := hex.DecodeString(signature)
+	if decodeErr != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
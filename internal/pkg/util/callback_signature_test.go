@@ -0,0 +1,18 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyCallback(t *testing.T) {
+	body := []byte(`{"reference_id":"ref-1","status":"SUCCESS"}`)
+	signature := SignCallback("secret", body)
+
+	assert.True(t, VerifyCallback("secret", body, signature))
+	assert.False(t, VerifyCallback("other", body, signature))
+	assert.False(t, VerifyCallback("secret", []byte(`{"reference_id":"ref-2","status":"SUCCESS"}`), signature))
+	assert.False(t, VerifyCallback("secret", body, "not hex"))
+	assert.False(t, VerifyCallback("", body, SignCallback("", body)), "an unset secret verifies nothing")
+}
@@ -1,16 +1,47 @@
 package util
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/dinowar/gateway-service/internal/pkg/config"
 	_ "github.com/lib/pq"
+	"time"
 )
 
-func InitDB(host, port, dbname, user, password string) (*sql.DB, error) {
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", host, port, user, password, dbname)
-	db, dbErr := sql.Open("postgres", connStr)
+// InitDB opens the pool and pings Postgres with exponential backoff until it
+// answers or cfg.ConnectTimeout elapses, so callers never get an unusable pool.
+func InitDB(ctx context.Context, cfg config.DBConfig) (*sql.DB, error) {
+	db, dbErr := sql.Open("postgres", ConnectionString(cfg))
 	if dbErr != nil {
 		return nil, dbErr
 	}
+
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime) * time.Second)
+	db.SetConnMaxIdleTime(time.Duration(cfg.ConnMaxIdleTime) * time.Second)
+
+	pingErr := PingWithRetry(ctx, db, time.Duration(cfg.ConnectTimeout)*time.Second)
+	if pingErr != nil {
+		db.Close()
+		return nil, fmt.Errorf("database %s:%s/%s is not reachable: %w", cfg.Host, cfg.Port, cfg.Database, pingErr)
+	}
 	return db, nil
 }
+
+// ConnectionString is the lib/pq connection string of cfg, also used for
+// connections outside the pool such as LISTEN.
+func ConnectionString(cfg config.DBConfig) string {
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", cfg.Host, cfg.Port, cfg.Username, cfg.Password, cfg.Database)
+}
+
+func PingWithRetry(ctx context.Context, db *sql.DB, maxElapsedTime time.Duration) error {
+	expBackoff := backoff.NewExponentialBackOff()
+	expBackoff.MaxElapsedTime = maxElapsedTime
+
+	return backoff.Retry(func() error {
+		return db.PingContext(ctx)
+	}, backoff.WithContext(expBackoff, ctx))
+}
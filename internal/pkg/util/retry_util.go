@@ -1,6 +1,7 @@
 package util
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/cenkalti/backoff/v4"
 	"io"
@@ -11,6 +12,23 @@ import (
 const callbackHeader = "Callback-URL"
 
 func RetryableRequest(url string, method string, body io.Reader, callbackUrl, contentType string, timeout, waitingTime int) (*http.Response, error) {
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	header.Set(callbackHeader, callbackUrl)
+	return retryableRequest(url, method, body, header, timeout, waitingTime)
+}
+
+// RetryableCallback posts a gateway's JSON callback to the service, signed
+// with the gateway's callback secret, see SignCallback.
+func RetryableCallback(url string, body []byte, gatewayId, secret string, timeout, waitingTime int) (*http.Response, error) {
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set(CallbackGatewayHeader, gatewayId)
+	header.Set(CallbackSignatureHeader, SignCallback(secret, body))
+	return retryableRequest(url, http.MethodPost, bytes.NewReader(body), header, timeout, waitingTime)
+}
+
+func retryableRequest(url string, method string, body io.Reader, header http.Header, timeout, waitingTime int) (*http.Response, error) {
 	var resp *http.Response
 	var err error
 
@@ -23,8 +41,7 @@ func RetryableRequest(url string, method string, body io.Reader, callbackUrl, co
 			return reqErr
 		}
 
-		req.Header.Set("Content-Type", contentType)
-		req.Header.Set(callbackHeader, callbackUrl)
+		req.Header = header.Clone()
 
 		client := &http.Client{
 			Timeout: retryTimeout,
@@ -0,0 +1,62 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dinowar/gateway-service/internal/pkg/config"
+	"net/http"
+	"sync"
+	"time"
+)
+
+func NewHTTPServer(port string, handler http.Handler, cfg config.HTTPConfig) *http.Server {
+	return &http.Server{
+		Addr:         fmt.Sprintf(":%s", port),
+		Handler:      handler,
+		ReadTimeout:  time.Duration(cfg.ReadTimeout) * time.Second,
+		WriteTimeout: time.Duration(cfg.WriteTimeout) * time.Second,
+		IdleTimeout:  time.Duration(cfg.IdleTimeout) * time.Second,
+	}
+}
+
+// ServeAndDrain runs srv until ctx is cancelled. It then stops accepting
+// connections and waits for in-flight requests and workers, all within
+// shutdownTimeout seconds. Workers are waited for even when the HTTP shutdown
+// fails, so a stuck connection never cuts their drain short.
+func ServeAndDrain(ctx context.Context, srv *http.Server, workers *sync.WaitGroup, shutdownTimeout int) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case listenErr := <-serveErr:
+		return listenErr
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(shutdownTimeout)*time.Second)
+	defer cancel()
+
+	// Workers watch ctx as well, so they drain while the server shuts down.
+	drained := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(drained)
+	}()
+
+	var drainErrs []error
+	if shutdownErr := srv.Shutdown(shutdownCtx); shutdownErr != nil {
+		drainErrs = append(drainErrs, fmt.Errorf("http server shutdown: %w", shutdownErr))
+	} else if listenErr := <-serveErr; listenErr != nil && !errors.Is(listenErr, http.ErrServerClosed) {
+		drainErrs = append(drainErrs, listenErr)
+	}
+
+	select {
+	case <-drained:
+	case <-shutdownCtx.Done():
+		drainErrs = append(drainErrs, fmt.Errorf("background workers did not stop: %w", shutdownCtx.Err()))
+	}
+	return errors.Join(drainErrs...)
+}
@@ -0,0 +1,136 @@
+package util
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func freeAddress(t *testing.T) string {
+	listener, listenErr := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, listenErr)
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func TestServeAndDrain_WaitsForInFlightRequestsAndWorkers(t *testing.T) {
+	address := freeAddress(t)
+	started := make(chan struct{})
+	var workers sync.WaitGroup
+	workerDone := false
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+	srv := &http.Server{Addr: address, Handler: mux}
+
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		time.Sleep(300 * time.Millisecond)
+		workerDone = true
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- ServeAndDrain(ctx, srv, &workers, 5)
+	}()
+
+	var body string
+	requestDone := make(chan struct{})
+	go func() {
+		defer close(requestDone)
+		var resp *http.Response
+		var respErr error
+		for i := 0; i < 50; i++ {
+			resp, respErr = http.Get("http://" + address + "/slow")
+			if respErr == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if respErr != nil {
+			return
+		}
+		defer resp.Body.Close()
+		bytes, _ := io.ReadAll(resp.Body)
+		body = string(bytes)
+	}()
+
+	<-started
+	cancel()
+
+	assert.NoError(t, <-serveErr)
+	<-requestDone
+	assert.Equal(t, "done", body)
+	assert.True(t, workerDone)
+}
+
+func TestServeAndDrain_WorkersExceedTimeout(t *testing.T) {
+	var workers sync.WaitGroup
+	workers.Add(1)
+	defer workers.Done()
+
+	srv := &http.Server{Addr: freeAddress(t), Handler: http.NewServeMux()}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	drainErr := ServeAndDrain(ctx, srv, &workers, 0)
+	assert.Error(t, drainErr)
+}
+
+func TestServeAndDrain_WaitsForWorkersWhenShutdownFails(t *testing.T) {
+	address := freeAddress(t)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stuck", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+	srv := &http.Server{Addr: address, Handler: mux}
+
+	var workers sync.WaitGroup
+	stopWorker := make(chan struct{})
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		<-stopWorker
+	}()
+	defer close(stopWorker)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- ServeAndDrain(ctx, srv, &workers, 1)
+	}()
+
+	go func() {
+		for i := 0; i < 50; i++ {
+			if resp, respErr := http.Get("http://" + address + "/stuck"); respErr == nil {
+				resp.Body.Close()
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	<-started
+	cancel()
+
+	drainErr := <-serveErr
+	assert.ErrorContains(t, drainErr, "http server shutdown")
+	assert.ErrorContains(t, drainErr, "background workers did not stop")
+}
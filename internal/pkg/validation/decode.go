@@ -0,0 +1,32 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"io"
+	"net/http"
+)
+
+const DefaultMaxBodyBytes int64 = 1 << 20
+
+// DecodeJSON strictly decodes a request body into dst: it is limited to
+// maxBytes, unknown fields and trailing data are rejected.
+func DecodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}, maxBytes int64) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBytes))
+	decoder.DisallowUnknownFields()
+
+	decodeErr := decoder.Decode(dst)
+	if decodeErr == nil {
+		if decoder.Decode(&struct{}{}) != io.EOF {
+			return NewError(ErrInvalidInput, CodeInvalidRequestBody, "request body must contain a single JSON object")
+		}
+		return nil
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(decodeErr, &maxBytesErr) {
+		return NewError(ErrTooLarge, CodeRequestTooLarge, "request body must not exceed %d bytes", maxBytes)
+	}
+	return NewError(ErrInvalidInput, CodeInvalidRequestBody, "invalid request body").Wrap(decodeErr)
+}
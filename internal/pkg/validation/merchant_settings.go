@@ -0,0 +1,130 @@
+package validation
+
+import (
+	"fmt"
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/shopspring/decimal"
+	"net/url"
+)
+
+// ValidateMerchantSettings checks a merchant's overrides against the
+// registered gateways. Routing rules may only pick enabled gateways.
+func ValidateMerchantSettings(settings MerchantSettings, gatewayExists func(gatewayId string) bool) error {
+	v := &Validator{}
+	for i, gatewayId := range settings.EnabledGateways {
+		v.Gateway(fmt.Sprintf("enabled_gateways[%d]", i), gatewayId, gatewayExists)
+	}
+
+	for i, rule := range settings.RoutingRules {
+		field := fmt.Sprintf("routing_rules[%d]", i)
+		if rule.Operation != "" && !rule.Operation.Valid() {
+			v.Add(field+".operation", CodeInvalidFormat, "operation must be one of Deposit, Withdraw")
+		}
+		if rule.Currency != "" {
+			v.Currency(field+".currency", rule.Currency)
+		}
+		v.Gateway(field+".gateway_id", rule.GatewayId, func(gatewayId string) bool {
+			return gatewayExists(gatewayId) && settings.GatewayEnabled(gatewayId)
+		})
+	}
+
+	for i, limit := range settings.Limits {
+		field := fmt.Sprintf("limits[%d]", i)
+		if limit.Operation != "" && !limit.Operation.Valid() {
+			v.Add(field+".operation", CodeInvalidFormat, "operation must be one of Deposit, Withdraw")
+		}
+		v.Currency(field+".currency", limit.Currency)
+		if limit.GatewayId != "" {
+			v.Gateway(field+".gateway_id", limit.GatewayId, gatewayExists)
+		}
+		if limit.Min == nil && limit.Max == nil {
+			v.Add(field, CodeRequired, "%s needs a min or a max", field)
+		}
+		if limit.Min != nil && limit.Min.IsNegative() {
+			v.Add(field+".min", CodeOutOfRange, "min must not be negative")
+		}
+		if limit.Min != nil && limit.Max != nil && limit.Min.GreaterThan(*limit.Max) {
+			v.Add(field+".max", CodeOutOfRange, "max must not be less than min")
+		}
+	}
+
+	for i, limit := range settings.VelocityLimits {
+		field := fmt.Sprintf("velocity_limits[%d]", i)
+		if !limit.Scope.Valid() {
+			v.Add(field+".scope", CodeInvalidFormat, "scope must be one of account, gateway")
+		}
+		if !limit.Period.Valid() {
+			v.Add(field+".period", CodeInvalidFormat, "period must be one of daily, monthly")
+		}
+		if limit.Operation != "" && !limit.Operation.Valid() {
+			v.Add(field+".operation", CodeInvalidFormat, "operation must be one of Deposit, Withdraw")
+		}
+		v.Currency(field+".currency", limit.Currency)
+		if limit.GatewayId != "" {
+			v.Gateway(field+".gateway_id", limit.GatewayId, gatewayExists)
+		}
+		if limit.MaxAmount == nil && limit.MaxCount == nil {
+			v.Add(field, CodeRequired, "%s needs a max_amount or a max_count", field)
+		}
+		if limit.MaxAmount != nil && !limit.MaxAmount.IsPositive() {
+			v.Add(field+".max_amount", CodeOutOfRange, "max_amount must be positive")
+		}
+		if limit.MaxCount != nil && *limit.MaxCount < 1 {
+			v.Add(field+".max_count", CodeOutOfRange, "max_count must be at least 1")
+		}
+	}
+
+	validateFeeRules(v, settings.Fees, gatewayExists)
+
+	if settings.WebhookURL != "" {
+		parsed, parseErr := url.Parse(settings.WebhookURL)
+		if parseErr != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			v.Add("webhook_url", CodeInvalidFormat, "webhook_url must be an absolute http(s) URL")
+		}
+	}
+	return v.Err()
+}
+
+// ValidateFeeSchedule checks the service wide fee schedule like the fee
+// overrides of a merchant.
+func ValidateFeeSchedule(rules []FeeRule, gatewayExists func(gatewayId string) bool) error {
+	v := &Validator{}
+	validateFeeRules(v, rules, gatewayExists)
+	return v.Err()
+}
+
+func validateFeeRules(v *Validator, rules []FeeRule, gatewayExists func(gatewayId string) bool) {
+	hundred := decimal.NewFromInt(100)
+	for i, rule := range rules {
+		field := fmt.Sprintf("fees[%d]", i)
+		if rule.Operation != "" && !rule.Operation.Valid() {
+			v.Add(field+".operation", CodeInvalidFormat, "operation must be one of Deposit, Withdraw")
+		}
+		knownCurrency := v.Currency(field+".currency", rule.Currency)
+		if rule.GatewayId != "" {
+			v.Gateway(field+".gateway_id", rule.GatewayId, gatewayExists)
+		}
+		if rule.Fixed == nil && rule.Percent == nil {
+			v.Add(field, CodeRequired, "%s needs a fixed or a percent fee", field)
+		}
+		for _, amount := range []struct {
+			name  string
+			value *decimal.Decimal
+		}{{"fixed", rule.Fixed}, {"min", rule.Min}, {"max", rule.Max}} {
+			if amount.value == nil {
+				continue
+			}
+			if amount.value.IsNegative() {
+				v.Add(field+"."+amount.name, CodeOutOfRange, "%s must not be negative", amount.name)
+			} else if knownCurrency {
+				v.AmountPrecision(field+"."+amount.name, *amount.value, rule.Currency)
+			}
+		}
+		if rule.Percent != nil && (rule.Percent.IsNegative() || rule.Percent.GreaterThan(hundred)) {
+			v.Add(field+".percent", CodeOutOfRange, "percent must be between 0 and 100")
+		}
+		if rule.Min != nil && rule.Max != nil && rule.Min.GreaterThan(*rule.Max) {
+			v.Add(field+".max", CodeOutOfRange, "max must not be less than min")
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateMerchantSettings_Valid(t *testing.T) {
+	max, count := decimal.RequireFromString("1000"), 10
+	fixed, percent := decimal.RequireFromString("0.30"), decimal.RequireFromString("2.9")
+	settings := model.MerchantSettings{
+		EnabledGateways: []string{"rest"},
+		RoutingRules:    []model.RoutingRule{{Currency: "EUR", GatewayId: "rest"}, {GatewayId: "rest"}},
+		Limits:          []model.AmountLimit{{Operation: model.Withdraw, Currency: "USD", GatewayId: "rest", Max: &max}},
+		VelocityLimits: []model.VelocityLimit{
+			{Scope: model.ScopeAccount, Period: model.PeriodDaily, Operation: model.Withdraw, Currency: "USD", MaxAmount: &max},
+			{Scope: model.ScopeGateway, Period: model.PeriodMonthly, Currency: "USD", GatewayId: "rest", MaxCount: &count},
+		},
+		Fees:       []model.FeeRule{{Operation: model.Deposit, Currency: "USD", GatewayId: "rest", Fixed: &fixed, Percent: &percent, Max: &max}},
+		WebhookURL: "https://merchant.example/webhooks",
+	}
+	assert.NoError(t, ValidateMerchantSettings(settings, knownGateway))
+	assert.NoError(t, ValidateMerchantSettings(model.MerchantSettings{}, knownGateway))
+}
+
+func TestValidateMerchantSettings_ReportsEveryField(t *testing.T) {
+	min, max, zero, count := decimal.RequireFromString("10"), decimal.RequireFromString("5"), decimal.Zero, 0
+	negative, precise, percent := decimal.RequireFromString("-1"), decimal.RequireFromString("0.125"), decimal.RequireFromString("101")
+	settings := model.MerchantSettings{
+		EnabledGateways: []string{"soap"},
+		RoutingRules:    []model.RoutingRule{{Operation: "Refund", Currency: "XXX", GatewayId: "rest"}},
+		Limits:          []model.AmountLimit{{Currency: "USD", Min: &min, Max: &max}, {Currency: "EUR", GatewayId: "soap"}},
+		VelocityLimits: []model.VelocityLimit{
+			{Scope: "merchant", Period: "weekly", Currency: "USD", MaxAmount: &zero, MaxCount: &count},
+			{Scope: model.ScopeAccount, Period: model.PeriodDaily, Currency: "USD"},
+		},
+		Fees: []model.FeeRule{
+			{Currency: "USD", Fixed: &negative, Percent: &percent, Min: &min, Max: &max},
+			{Operation: "Refund", Currency: "USD", GatewayId: "soap", Min: &precise},
+		},
+		WebhookURL: "merchant.example/webhooks",
+	}
+
+	codes := fieldCodes(t, ValidateMerchantSettings(settings, knownGateway))
+	assert.Equal(t, map[string]string{
+		"enabled_gateways[0]":           CodeUnknownGateway,
+		"routing_rules[0].operation":    CodeInvalidFormat,
+		"routing_rules[0].currency":     CodeUnknownCurrency,
+		"routing_rules[0].gateway_id":   CodeUnknownGateway,
+		"limits[0].max":                 CodeOutOfRange,
+		"limits[1]":                     CodeRequired,
+		"limits[1].gateway_id":          CodeUnknownGateway,
+		"velocity_limits[0].scope":      CodeInvalidFormat,
+		"velocity_limits[0].period":     CodeInvalidFormat,
+		"velocity_limits[0].max_amount": CodeOutOfRange,
+		"velocity_limits[0].max_count":  CodeOutOfRange,
+		"velocity_limits[1]":            CodeRequired,
+		"fees[0].fixed":                 CodeOutOfRange,
+		"fees[0].percent":               CodeOutOfRange,
+		"fees[0].max":                   CodeOutOfRange,
+		"fees[1]":                       CodeRequired,
+		"fees[1].operation":             CodeInvalidFormat,
+		"fees[1].gateway_id":            CodeUnknownGateway,
+		"fees[1].min":                   CodeTooManyDecimals,
+		"webhook_url":                   CodeInvalidFormat,
+	}, codes)
+}
@@ -0,0 +1,137 @@
+package validation
+
+import (
+	"fmt"
+	. "github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/shopspring/decimal"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Field error codes, part of the public API next to the problem codes.
+const (
+	CodeRequired        = "required"
+	CodeNotPositive     = "not_positive"
+	CodeTooManyDecimals = "too_many_decimals"
+	CodeUnknownCurrency = "unknown_currency"
+	CodeInvalidFormat   = "invalid_format"
+	CodeUnknownGateway  = "unknown_gateway"
+	CodeOutOfRange      = "out_of_range"
+)
+
+// MaxBeneficiaryNameLength bounds the beneficiary name of a withdrawal.
+const MaxBeneficiaryNameLength = 140
+
+var accountIdPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:-]{0,63}$`)
+
+// Validator collects every violation of a request instead of stopping at the
+// first one, so clients can fix all fields in a single round trip.
+type Validator struct {
+	fields []FieldError
+}
+
+func (v *Validator) Add(field, code, format string, args ...interface{}) {
+	v.fields = append(v.fields, FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *Validator) Required(field, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.Add(field, CodeRequired, "%s is required", field)
+		return false
+	}
+	return true
+}
+
+func (v *Validator) PositiveAmount(field string, amount decimal.Decimal) bool {
+	if !amount.IsPositive() {
+		v.Add(field, CodeNotPositive, "%s must be greater than zero", field)
+		return false
+	}
+	return true
+}
+
+func (v *Validator) Currency(field, currency string) bool {
+	if !v.Required(field, currency) {
+		return false
+	}
+	if _, known := MinorUnits(currency); !known {
+		v.Add(field, CodeUnknownCurrency, "%s %q is not a supported ISO 4217 currency", field, currency)
+		return false
+	}
+	return true
+}
+
+// AmountPrecision expects a currency that already passed Currency.
+func (v *Validator) AmountPrecision(field string, amount decimal.Decimal, currency string) bool {
+	units, _ := MinorUnits(currency)
+	if !amount.Equal(amount.Truncate(units)) {
+		v.Add(field, CodeTooManyDecimals, "%s allows at most %d decimal places for %s", field, units, currency)
+		return false
+	}
+	return true
+}
+
+func (v *Validator) AccountId(field, accountId string) bool {
+	if !v.Required(field, accountId) {
+		return false
+	}
+	if !accountIdPattern.MatchString(accountId) {
+		v.Add(field, CodeInvalidFormat, "%s must be 1-64 letters, digits or _.:- and start with a letter or digit", field)
+		return false
+	}
+	return true
+}
+
+func (v *Validator) Gateway(field, gatewayId string, exists func(gatewayId string) bool) bool {
+	if !v.Required(field, gatewayId) {
+		return false
+	}
+	if !exists(gatewayId) {
+		v.Add(field, CodeUnknownGateway, "gateway %s not found", gatewayId)
+		return false
+	}
+	return true
+}
+
+func (v *Validator) Fields() []FieldError {
+	return v.fields
+}
+
+// Err returns nil when no violation was recorded.
+func (v *Validator) Err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	validationErr := NewError(ErrInvalidInput, CodeValidationFailed, "missing or invalid fields in request body")
+	validationErr.Fields = v.fields
+	return validationErr
+}
+
+// ValidateClientRequest checks the money movement requests shared by deposit
+// and withdraw; beneficiaryRequired makes beneficiary_name mandatory.
+func ValidateClientRequest(req ClientRequest, gatewayExists func(gatewayId string) bool, beneficiaryRequired bool) error {
+	v := &Validator{}
+	v.PositiveAmount("amount", req.Amount)
+	if v.Currency("currency", req.Currency) {
+		v.AmountPrecision("amount", req.Amount, req.Currency)
+	}
+	v.AccountId("account_id", req.AccountID)
+	v.Gateway("gateway_id", req.GatewayID, gatewayExists)
+	if req.AccountCurrency != "" {
+		v.Currency("account_currency", req.AccountCurrency)
+	}
+	if beneficiaryRequired {
+		v.Required("beneficiary_name", req.BeneficiaryName)
+	}
+	if utf8.RuneCountInString(req.BeneficiaryName) > MaxBeneficiaryNameLength {
+		v.Add("beneficiary_name", CodeOutOfRange, "beneficiary_name must not be longer than %d characters", MaxBeneficiaryNameLength)
+	}
+	// an unknown gateway alone keeps the code clients saw before field errors
+	if len(v.fields) == 1 && v.fields[0].Code == CodeUnknownGateway {
+		gatewayErr := NewError(ErrInvalidInput, CodeGatewayNotFound, "%s", v.fields[0].Message)
+		gatewayErr.Fields = v.fields
+		return gatewayErr
+	}
+	return v.Err()
+}
@@ -0,0 +1,167 @@
+package validation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dinowar/gateway-service/internal/pkg/domain/model"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func knownGateway(gatewayId string) bool {
+	return gatewayId == "rest"
+}
+
+func fieldCodes(t *testing.T, err error) map[string]string {
+	t.Helper()
+
+	var domainErr *model.Error
+	require.ErrorAs(t, err, &domainErr)
+	assert.ErrorIs(t, err, model.ErrInvalidInput)
+	assert.Equal(t, model.CodeValidationFailed, domainErr.Code)
+
+	codes := make(map[string]string)
+	for _, field := range domainErr.Fields {
+		codes[field.Field] = field.Code
+	}
+	return codes
+}
+
+func TestValidateClientRequest_Valid(t *testing.T) {
+	req := model.ClientRequest{
+		Amount:    decimal.RequireFromString("100.50"),
+		Currency:  "USD",
+		AccountID: "ACC123",
+		GatewayID: "rest",
+	}
+
+	assert.NoError(t, ValidateClientRequest(req, knownGateway, false))
+}
+
+func TestValidateClientRequest_ReportsEveryField(t *testing.T) {
+	req := model.ClientRequest{
+		Amount:          decimal.RequireFromString("-1"),
+		Currency:        "XXX",
+		AccountID:       "acc 123",
+		GatewayID:       "paypal",
+		BeneficiaryName: strings.Repeat("é", MaxBeneficiaryNameLength+1),
+		AccountCurrency: "usd",
+	}
+
+	codes := fieldCodes(t, ValidateClientRequest(req, knownGateway, false))
+	assert.Equal(t, map[string]string{
+		"amount":           CodeNotPositive,
+		"currency":         CodeUnknownCurrency,
+		"account_id":       CodeInvalidFormat,
+		"gateway_id":       CodeUnknownGateway,
+		"beneficiary_name": CodeOutOfRange,
+		"account_currency": CodeUnknownCurrency,
+	}, codes)
+}
+
+func TestValidateClientRequest_UnknownGatewayAlone(t *testing.T) {
+	req := model.ClientRequest{
+		Amount:    decimal.RequireFromString("100.50"),
+		Currency:  "USD",
+		AccountID: "ACC123",
+		GatewayID: "paypal",
+	}
+
+	var domainErr *model.Error
+	require.ErrorAs(t, ValidateClientRequest(req, knownGateway, false), &domainErr)
+	assert.ErrorIs(t, domainErr, model.ErrInvalidInput)
+	assert.Equal(t, model.CodeGatewayNotFound, domainErr.Code)
+	assert.Equal(t, []model.FieldError{{Field: "gateway_id", Code: CodeUnknownGateway, Message: "gateway paypal not found"}}, domainErr.Fields)
+}
+
+func TestValidateClientRequest_Missing(t *testing.T) {
+	codes := fieldCodes(t, ValidateClientRequest(model.ClientRequest{}, knownGateway, false))
+	assert.Equal(t, map[string]string{
+		"amount":     CodeNotPositive,
+		"currency":   CodeRequired,
+		"account_id": CodeRequired,
+		"gateway_id": CodeRequired,
+	}, codes)
+}
+
+func TestValidateClientRequest_BeneficiaryRequired(t *testing.T) {
+	req := model.ClientRequest{
+		Amount:          decimal.RequireFromString("100.50"),
+		Currency:        "USD",
+		AccountID:       "ACC123",
+		GatewayID:       "rest",
+		BeneficiaryName: " ",
+	}
+	assert.NoError(t, ValidateClientRequest(req, knownGateway, false))
+	assert.Equal(t, map[string]string{"beneficiary_name": CodeRequired}, fieldCodes(t, ValidateClientRequest(req, knownGateway, true)))
+
+	req.BeneficiaryName = "John Doe"
+	assert.NoError(t, ValidateClientRequest(req, knownGateway, true))
+}
+
+func TestValidateClientRequest_Decimals(t *testing.T) {
+	tests := []struct {
+		amount   string
+		currency string
+		valid    bool
+	}{
+		{"10.25", "USD", true},
+		{"10.250", "USD", true},
+		{"10.255", "USD", false},
+		{"1000", "JPY", true},
+		{"1000.5", "JPY", false},
+		{"1.125", "KWD", true},
+	}
+
+	for _, test := range tests {
+		req := model.ClientRequest{
+			Amount:    decimal.RequireFromString(test.amount),
+			Currency:  test.currency,
+			AccountID: "ACC123",
+			GatewayID: "rest",
+		}
+		validationErr := ValidateClientRequest(req, knownGateway, false)
+		if test.valid {
+			assert.NoError(t, validationErr, "%s %s", test.amount, test.currency)
+		} else {
+			assert.Equal(t, map[string]string{"amount": CodeTooManyDecimals}, fieldCodes(t, validationErr))
+		}
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		kind error
+		code string
+	}{
+		{"valid", `{"amount": 10, "currency": "USD"}`, nil, ""},
+		{"amount as string", `{"amount": "10.50"}`, nil, ""},
+		{"unknown field", `{"amount": 10, "currncy": "USD"}`, model.ErrInvalidInput, model.CodeInvalidRequestBody},
+		{"trailing data", `{"amount": 10} {}`, model.ErrInvalidInput, model.CodeInvalidRequestBody},
+		{"malformed", `{"amount": `, model.ErrInvalidInput, model.CodeInvalidRequestBody},
+		{"too large", `{"currency": "` + strings.Repeat("U", 100) + `"}`, model.ErrTooLarge, model.CodeRequestTooLarge},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/deposit", strings.NewReader(test.body))
+			var dst model.ClientRequest
+
+			decodeErr := DecodeJSON(httptest.NewRecorder(), req, &dst, 64)
+			if test.kind == nil {
+				assert.NoError(t, decodeErr)
+				return
+			}
+			assert.ErrorIs(t, decodeErr, test.kind)
+			var domainErr *model.Error
+			require.ErrorAs(t, decodeErr, &domainErr)
+			assert.Equal(t, test.code, domainErr.Code)
+		})
+	}
+}